@@ -0,0 +1,792 @@
+package gosmt
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+/*
+ *  The bit-blaster translates expressions into CNF with the Tseitin encoding.
+ *  Bit-vectors are slices of literals, the least significant bit first.
+ *  Gate definitions are never retracted, so a translated node can be reused in
+ *  every scope; the translated roots are pinned to keep the cache valid.
+ */
+type bitblaster struct {
+	sat *satSolver
+	t   int
+
+	ands    map[[2]int]int
+	xors    map[[2]int]int
+	bvs     map[uintptr][]int
+	bools   map[uintptr]int
+	pinned  []ExprPtr
+	symbols map[string][]int
+	reads   map[string][]bitblastRead
+	apps    map[string][]bitblastRead
+	funs    map[string]*FunDecl
+}
+
+// The reads of an array symbol and the applications of an uninterpreted
+// function (with the arguments concatenated in the index) are kept to enforce
+// functional consistency
+type bitblastRead struct {
+	index []int
+	value []int
+}
+
+func newBitblaster() *bitblaster {
+	b := &bitblaster{
+		sat:     newSatSolver(),
+		ands:    make(map[[2]int]int),
+		xors:    make(map[[2]int]int),
+		bvs:     make(map[uintptr][]int),
+		bools:   make(map[uintptr]int),
+		pinned:  make([]ExprPtr, 0),
+		symbols: make(map[string][]int),
+		reads:   make(map[string][]bitblastRead),
+		apps:    make(map[string][]bitblastRead),
+		funs:    make(map[string]*FunDecl),
+	}
+	b.t = satLit(b.sat.newVar(), false)
+	b.sat.addClause(b.t)
+	return b
+}
+
+func (b *bitblaster) f() int {
+	return b.t ^ 1
+}
+
+func (b *bitblaster) fresh() int {
+	return satLit(b.sat.newVar(), false)
+}
+
+func (b *bitblaster) and(x, y int) int {
+	if x == b.f() || y == b.f() || x == y^1 {
+		return b.f()
+	}
+	if x == b.t || x == y {
+		return y
+	}
+	if y == b.t {
+		return x
+	}
+	if x > y {
+		x, y = y, x
+	}
+	if g, ok := b.ands[[2]int{x, y}]; ok {
+		return g
+	}
+	g := b.fresh()
+	b.sat.addClause(g^1, x)
+	b.sat.addClause(g^1, y)
+	b.sat.addClause(g, x^1, y^1)
+	b.ands[[2]int{x, y}] = g
+	return g
+}
+
+func (b *bitblaster) or(x, y int) int {
+	return b.and(x^1, y^1) ^ 1
+}
+
+func (b *bitblaster) xor(x, y int) int {
+	// normalize the inputs to positive literals
+	parity := (x & 1) ^ (y & 1)
+	x, y = x&^1, y&^1
+	if x == y {
+		return b.f() ^ parity
+	}
+	if x == b.t {
+		return y ^ 1 ^ parity
+	}
+	if y == b.t {
+		return x ^ 1 ^ parity
+	}
+	if x > y {
+		x, y = y, x
+	}
+	if g, ok := b.xors[[2]int{x, y}]; ok {
+		return g ^ parity
+	}
+	g := b.fresh()
+	b.sat.addClause(g^1, x, y)
+	b.sat.addClause(g^1, x^1, y^1)
+	b.sat.addClause(g, x^1, y)
+	b.sat.addClause(g, x, y^1)
+	b.xors[[2]int{x, y}] = g
+	return g ^ parity
+}
+
+func (b *bitblaster) mux(cond, iftrue, iffalse int) int {
+	if cond == b.t || iftrue == iffalse {
+		return iftrue
+	}
+	if cond == b.f() {
+		return iffalse
+	}
+	return b.or(b.and(cond, iftrue), b.and(cond^1, iffalse))
+}
+
+func (b *bitblaster) muxBits(cond int, iftrue, iffalse []int) []int {
+	res := make([]int, len(iftrue))
+	for i := range iftrue {
+		res[i] = b.mux(cond, iftrue[i], iffalse[i])
+	}
+	return res
+}
+
+func (b *bitblaster) constBits(v *big.Int, size uint) []int {
+	res := make([]int, size)
+	for i := range res {
+		if v.Bit(i) == 1 {
+			res[i] = b.t
+		} else {
+			res[i] = b.f()
+		}
+	}
+	return res
+}
+
+func (b *bitblaster) repeat(lit int, n uint) []int {
+	res := make([]int, n)
+	for i := range res {
+		res[i] = lit
+	}
+	return res
+}
+
+func (b *bitblaster) notBits(xs []int) []int {
+	res := make([]int, len(xs))
+	for i := range xs {
+		res[i] = xs[i] ^ 1
+	}
+	return res
+}
+
+func (b *bitblaster) addWithCarry(xs, ys []int, carry int) ([]int, int) {
+	res := make([]int, len(xs))
+	for i := range xs {
+		t := b.xor(xs[i], ys[i])
+		res[i] = b.xor(t, carry)
+		carry = b.or(b.and(xs[i], ys[i]), b.and(t, carry))
+	}
+	return res, carry
+}
+
+func (b *bitblaster) add(xs, ys []int) []int {
+	res, _ := b.addWithCarry(xs, ys, b.f())
+	return res
+}
+
+func (b *bitblaster) sub(xs, ys []int) []int {
+	res, _ := b.addWithCarry(xs, b.notBits(ys), b.t)
+	return res
+}
+
+func (b *bitblaster) neg(xs []int) []int {
+	return b.sub(b.repeat(b.f(), uint(len(xs))), xs)
+}
+
+func (b *bitblaster) mul(xs, ys []int) []int {
+	res := b.repeat(b.f(), uint(len(xs)))
+	for i := range ys {
+		if ys[i] == b.f() {
+			continue
+		}
+		partial := b.repeat(b.f(), uint(len(xs)))
+		for j := 0; i+j < len(xs); j++ {
+			partial[i+j] = b.and(xs[j], ys[i])
+		}
+		res = b.add(res, partial)
+	}
+	return res
+}
+
+func (b *bitblaster) udivrem(xs, ys []int) ([]int, []int) {
+	// restoring division; division by zero gives all ones as quotient and the
+	// dividend as remainder, as in SMT-LIB
+	n := len(xs)
+	q := make([]int, n)
+	r := b.repeat(b.f(), uint(n))
+	ysExt := append(append([]int{}, ys...), b.f())
+	for i := n - 1; i >= 0; i-- {
+		shifted := append([]int{xs[i]}, r...)
+		diff, geq := b.addWithCarry(shifted, b.notBits(ysExt), b.t)
+		q[i] = geq
+		r = b.muxBits(geq, diff[:n], shifted[:n])
+	}
+	return q, r
+}
+
+func (b *bitblaster) abs(xs []int) []int {
+	return b.muxBits(xs[len(xs)-1], b.neg(xs), xs)
+}
+
+func (b *bitblaster) sdiv(xs, ys []int) []int {
+	q, _ := b.udivrem(b.abs(xs), b.abs(ys))
+	return b.muxBits(b.xor(xs[len(xs)-1], ys[len(ys)-1]), b.neg(q), q)
+}
+
+func (b *bitblaster) srem(xs, ys []int) []int {
+	_, r := b.udivrem(b.abs(xs), b.abs(ys))
+	return b.muxBits(xs[len(xs)-1], b.neg(r), r)
+}
+
+func (b *bitblaster) shift(xs, amount []int, left bool, fill int) []int {
+	n := len(xs)
+	res := xs
+	overflow := b.f()
+	for k := range amount {
+		if k >= 31 || 1<<k >= n {
+			overflow = b.or(overflow, amount[k])
+			continue
+		}
+		next := make([]int, n)
+		for i := range next {
+			src := i + 1<<k
+			if left {
+				src = i - 1<<k
+			}
+			v := fill
+			if src >= 0 && src < n {
+				v = res[src]
+			}
+			next[i] = b.mux(amount[k], v, res[i])
+		}
+		res = next
+	}
+	return b.muxBits(overflow, b.repeat(fill, uint(n)), res)
+}
+
+func (b *bitblaster) ult(xs, ys []int) int {
+	_, geq := b.addWithCarry(xs, b.notBits(ys), b.t)
+	return geq ^ 1
+}
+
+func (b *bitblaster) slt(xs, ys []int) int {
+	n := len(xs)
+	xs = append(append([]int{}, xs[:n-1]...), xs[n-1]^1)
+	ys = append(append([]int{}, ys[:n-1]...), ys[n-1]^1)
+	return b.ult(xs, ys)
+}
+
+func (b *bitblaster) eq(xs, ys []int) int {
+	res := b.t
+	for i := range xs {
+		res = b.and(res, b.xor(xs[i], ys[i])^1)
+	}
+	return res
+}
+
+func (b *bitblaster) read(array internalArrayExpr, index []int) []int {
+	switch array.kind() {
+	case TY_ARRAY_CONST:
+		return b.blastBV(array.(*internalArrayConst).value.e)
+	case TY_STORE:
+		array := array.(*internalArrayStore)
+		stored := b.blastBV(array.value.e)
+		hit := b.eq(b.blastBV(array.index.e), index)
+		return b.muxBits(hit, stored, b.read(array.array.e, index))
+	case TY_ARRAY_SYM:
+		array := array.(*internalArrayS)
+		var value []int
+		b.reads[array.name], value = b.uninterpreted(b.reads[array.name], index, array.valSize)
+		return value
+	}
+	panic("invalid expression type")
+}
+
+// uninterpreted returns fresh value bits for the read at index, constrained
+// so that equal indexes imply equal values
+func (b *bitblaster) uninterpreted(reads []bitblastRead, index []int, size uint) ([]bitblastRead, []int) {
+	value := make([]int, size)
+	for i := range value {
+		value[i] = b.fresh()
+	}
+	for _, r := range reads {
+		sameIndex := b.eq(r.index, index)
+		sameValue := b.eq(r.value, value)
+		b.sat.addClause(sameIndex^1, sameValue)
+	}
+	return append(reads, bitblastRead{index: index, value: value}), value
+}
+
+func (b *bitblaster) blastBV(e internalBVExpr) []int {
+	if bits, ok := b.bvs[e.rawPtr()]; ok {
+		return bits
+	}
+
+	var res []int
+	switch e.kind() {
+	case TY_SYM:
+		e := e.(*internalBVS)
+		if bits, ok := b.symbols[e.name]; ok {
+			res = bits
+			break
+		}
+		res = make([]int, e.size())
+		for i := range res {
+			res[i] = b.fresh()
+		}
+		b.symbols[e.name] = res
+	case TY_CONST:
+		e := e.(*internalBVV)
+		res = b.constBits(e.Value.value, e.size())
+	case TY_EXTRACT:
+		e := e.(*internalBVExprExtract)
+		res = b.blastBV(e.child.e)[e.low : e.high+1]
+	case TY_CONCAT:
+		e := e.(*internalBVExprConcat)
+		res = make([]int, 0, e.size())
+		for i := len(e.children) - 1; i >= 0; i-- {
+			res = append(res, b.blastBV(e.children[i].e)...)
+		}
+	case TY_ZEXT:
+		e := e.(*internalBVExprExtend)
+		res = append(append([]int{}, b.blastBV(e.child.e)...), b.repeat(b.f(), e.n)...)
+	case TY_SEXT:
+		e := e.(*internalBVExprExtend)
+		child := b.blastBV(e.child.e)
+		res = append(append([]int{}, child...), b.repeat(child[len(child)-1], e.n)...)
+	case TY_ITE:
+		e := e.(*internalBVExprITE)
+		cond := b.blastBool(e.cond.e)
+		res = b.muxBits(cond, b.blastBV(e.iftrue.e), b.blastBV(e.iffalse.e))
+	case TY_SELECT:
+		e := e.(*internalBVExprSelect)
+		res = b.read(e.array.e, b.blastBV(e.index.e))
+	case TY_APPLY:
+		e := e.(*internalBVExprApply)
+		index := make([]int, 0)
+		for _, a := range e.args {
+			index = append(index, b.blastBV(a.e)...)
+		}
+		b.funs[e.fun.name] = e.fun
+		b.apps[e.fun.name], res = b.uninterpreted(b.apps[e.fun.name], index, e.fun.retSize)
+	case TY_NOT:
+		e := e.(*internalBVExprUnArithmetic)
+		res = b.notBits(b.blastBV(e.child.e))
+	case TY_NEG:
+		e := e.(*internalBVExprUnArithmetic)
+		res = b.neg(b.blastBV(e.child.e))
+	case TY_SHL, TY_LSHR, TY_ASHR:
+		e := e.(*internalBVExprBinArithmetic)
+		lhs := b.blastBV(e.children[0].e)
+		rhs := b.blastBV(e.children[1].e)
+		switch e.kind() {
+		case TY_SHL:
+			res = b.shift(lhs, rhs, true, b.f())
+		case TY_LSHR:
+			res = b.shift(lhs, rhs, false, b.f())
+		default:
+			res = b.shift(lhs, rhs, false, lhs[len(lhs)-1])
+		}
+	case TY_SDIV, TY_UDIV, TY_SREM, TY_UREM:
+		e := e.(*internalBVExprBinArithmetic)
+		lhs := b.blastBV(e.children[0].e)
+		rhs := b.blastBV(e.children[1].e)
+		switch e.kind() {
+		case TY_SDIV:
+			res = b.sdiv(lhs, rhs)
+		case TY_UDIV:
+			res, _ = b.udivrem(lhs, rhs)
+		case TY_SREM:
+			res = b.srem(lhs, rhs)
+		default:
+			_, res = b.udivrem(lhs, rhs)
+		}
+	case TY_AND, TY_OR, TY_XOR, TY_ADD, TY_MUL:
+		e := e.(*internalBVExprBinArithmetic)
+		res = b.blastBV(e.children[0].e)
+		for i := 1; i < len(e.children); i++ {
+			child := b.blastBV(e.children[i].e)
+			switch e.kind() {
+			case TY_ADD:
+				res = b.add(res, child)
+			case TY_MUL:
+				res = b.mul(res, child)
+			default:
+				next := make([]int, len(res))
+				for j := range res {
+					switch e.kind() {
+					case TY_AND:
+						next[j] = b.and(res[j], child[j])
+					case TY_OR:
+						next[j] = b.or(res[j], child[j])
+					default:
+						next[j] = b.xor(res[j], child[j])
+					}
+				}
+				res = next
+			}
+		}
+	default:
+		panic("invalid expression type")
+	}
+
+	b.bvs[e.rawPtr()] = res
+	return res
+}
+
+func (b *bitblaster) blastBool(e internalExpr) int {
+	if lit, ok := b.bools[e.rawPtr()]; ok {
+		return lit
+	}
+
+	var res int
+	switch e.kind() {
+	case TY_ULT, TY_ULE, TY_UGT, TY_UGE, TY_SLT, TY_SLE, TY_SGT, TY_SGE, TY_EQ:
+		e := e.(*internalBoolExprCmp)
+		lhs := b.blastBV(e.lhs.e)
+		rhs := b.blastBV(e.rhs.e)
+		switch e.kind() {
+		case TY_ULT:
+			res = b.ult(lhs, rhs)
+		case TY_ULE:
+			res = b.ult(rhs, lhs) ^ 1
+		case TY_UGT:
+			res = b.ult(rhs, lhs)
+		case TY_UGE:
+			res = b.ult(lhs, rhs) ^ 1
+		case TY_SLT:
+			res = b.slt(lhs, rhs)
+		case TY_SLE:
+			res = b.slt(rhs, lhs) ^ 1
+		case TY_SGT:
+			res = b.slt(rhs, lhs)
+		case TY_SGE:
+			res = b.slt(lhs, rhs) ^ 1
+		default:
+			res = b.eq(lhs, rhs)
+		}
+	case TY_BOOL_CONST:
+		e := e.(*internalBoolVal)
+		res = b.f()
+		if e.Value.Value {
+			res = b.t
+		}
+	case TY_BOOL_NOT:
+		e := e.(*internalBoolUnArithmetic)
+		res = b.blastBool(e.child.e) ^ 1
+	case TY_BOOL_AND, TY_BOOL_OR:
+		e := e.(*internalBoolExprNaryOp)
+		res = b.blastBool(e.children[0].e)
+		for i := 1; i < len(e.children); i++ {
+			child := b.blastBool(e.children[i].e)
+			if e.kind() == TY_BOOL_AND {
+				res = b.and(res, child)
+			} else {
+				res = b.or(res, child)
+			}
+		}
+	default:
+		panic("invalid expression type")
+	}
+
+	b.bools[e.rawPtr()] = res
+	return res
+}
+
+func (b *bitblaster) bitsFromModel(bits []int) *BVConst {
+	v := big.NewInt(0)
+	for i, lit := range bits {
+		if b.sat.modelValue(lit) {
+			v.SetBit(v, i, 1)
+		}
+	}
+	return MakeBVConstFromBigint(v, uint(len(bits)))
+}
+
+func (b *bitblaster) funModel() map[string]*FunInterp {
+	interps := newFunInterpBuilder()
+	for name, apps := range b.apps {
+		fun := b.funs[name]
+		for _, app := range apps {
+			args := make([]*BVConst, len(fun.argSizes))
+			low := 0
+			for i, size := range fun.argSizes {
+				args[i] = b.bitsFromModel(app.index[low : low+int(size)])
+				low += int(size)
+			}
+			interps.add(fun, args, b.bitsFromModel(app.value))
+		}
+	}
+	return interps.interps
+}
+
+// The roots are pinned only when they are not translated yet, otherwise they
+// are already kept alive by the pinned expressions that reference them
+func (b *bitblaster) translateBV(e *BVExprPtr) []int {
+	if _, ok := b.bvs[e.e.rawPtr()]; !ok {
+		b.pinned = append(b.pinned, e)
+	}
+	return b.blastBV(e.e)
+}
+
+func (b *bitblaster) translateBool(e *BoolExprPtr) int {
+	if _, ok := b.bools[e.e.rawPtr()]; !ok {
+		b.pinned = append(b.pinned, e)
+	}
+	return b.blastBool(e.e)
+}
+
+var errBitblastUnsupported = errors.New("floating-point expressions are not supported by the bit-blaster")
+
+func bitblastSupported(e ExprPtr) bool {
+	visited := make(map[uintptr]bool)
+	queue := []internalExpr{e.getInternal()}
+	for len(queue) > 0 {
+		el := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if visited[el.rawPtr()] {
+			continue
+		}
+		visited[el.rawPtr()] = true
+
+		if el.kind() >= TY_FP_CONST && el.kind() <= TY_FP_TO_SBV {
+			return false
+		}
+		queue = append(queue, el.subexprs()...)
+	}
+	return true
+}
+
+/*
+ *  Scopes and queries are implemented with activation literals: the
+ *  constraints of a scope are guarded by its literal, which is assumed while
+ *  the scope is alive and permanently falsified when it is popped (or when
+ *  the query is done). The SAT solver then drops the guarded clauses, see
+ *  satSolver.simplify
+ */
+type bitblastBackend struct {
+	bb     *bitblaster
+	synced bool
+
+	assertions []*BoolExprPtr
+	scopes     []int
+	acts       []int
+
+	// index of the first assertion that cannot be bit-blasted, or -1
+	unsupported int
+
+	lastSatModel map[string]*BVConst
+	lastFunModel map[string]*FunInterp
+}
+
+func newBitblastBackend() *bitblastBackend {
+	return &bitblastBackend{
+		bb:           newBitblaster(),
+		synced:       true,
+		assertions:   make([]*BoolExprPtr, 0),
+		scopes:       make([]int, 0),
+		acts:         make([]int, 0),
+		unsupported:  -1,
+		lastSatModel: nil,
+		lastFunModel: nil,
+	}
+}
+
+func (s *bitblastBackend) fresh() solverBackend {
+	return newBitblastBackend()
+}
+
+func (s *bitblastBackend) clone() solverBackend {
+	// The assertions are replayed lazily, on the first query
+	clone := newBitblastBackend()
+	clone.synced = false
+	clone.assertions = append(clone.assertions, s.assertions...)
+	clone.scopes = append(clone.scopes, s.scopes...)
+	clone.unsupported = s.unsupported
+	return clone
+}
+
+func (s *bitblastBackend) assert(e *BoolExprPtr) {
+	if !bitblastSupported(e) {
+		return
+	}
+	lit := s.bb.translateBool(e)
+	if len(s.acts) > 0 {
+		s.bb.sat.addClause(s.acts[len(s.acts)-1]^1, lit)
+	} else {
+		s.bb.sat.addClause(lit)
+	}
+}
+
+func (s *bitblastBackend) sync() {
+	if s.synced {
+		return
+	}
+
+	s.bb = newBitblaster()
+	s.acts = make([]int, 0)
+	scope := 0
+	for i, a := range s.assertions {
+		for ; scope < len(s.scopes) && s.scopes[scope] == i; scope++ {
+			s.acts = append(s.acts, s.bb.fresh())
+		}
+		s.assert(a)
+	}
+	for ; scope < len(s.scopes); scope++ {
+		s.acts = append(s.acts, s.bb.fresh())
+	}
+	s.synced = true
+}
+
+func (s *bitblastBackend) push() {
+	s.scopes = append(s.scopes, len(s.assertions))
+	if s.synced {
+		s.acts = append(s.acts, s.bb.fresh())
+	}
+}
+
+func (s *bitblastBackend) pop(n int) {
+	for i := 0; i < n; i++ {
+		s.assertions = s.assertions[:s.scopes[len(s.scopes)-1]]
+		s.scopes = s.scopes[:len(s.scopes)-1]
+		if s.synced {
+			s.bb.sat.addClause(s.acts[len(s.acts)-1] ^ 1)
+			s.acts = s.acts[:len(s.acts)-1]
+		}
+	}
+	if s.unsupported >= len(s.assertions) {
+		s.unsupported = -1
+	}
+}
+
+func (s *bitblastBackend) add(constraint *BoolExprPtr) {
+	if s.unsupported < 0 && !bitblastSupported(constraint) {
+		s.unsupported = len(s.assertions)
+	}
+	s.assertions = append(s.assertions, constraint)
+	if s.synced {
+		s.assert(constraint)
+	}
+}
+
+// activate guards the query with a fresh activation literal, that must be
+// falsified when the query is done
+func (s *bitblastBackend) activate(query *BoolExprPtr) int {
+	act := s.bb.fresh()
+	s.bb.sat.addClause(act^1, s.bb.translateBool(query))
+	return act
+}
+
+func (s *bitblastBackend) solve(ctx context.Context, lits ...int) (int, error) {
+	assumptions := append(append([]int{}, s.acts...), lits...)
+	r, err := s.bb.sat.solve(ctx, assumptions)
+	if r == RESULT_SAT {
+		s.lastSatModel = make(map[string]*BVConst)
+		for name, bits := range s.bb.symbols {
+			s.lastSatModel[name] = s.bb.bitsFromModel(bits)
+		}
+		s.lastFunModel = s.bb.funModel()
+	}
+	return r, err
+}
+
+func (s *bitblastBackend) check(ctx context.Context, query *BoolExprPtr) (int, error) {
+	if s.unsupported >= 0 || !bitblastSupported(query) {
+		s.lastSatModel = nil
+		return RESULT_UNKNOWN, errBitblastUnsupported
+	}
+	s.sync()
+	act := s.activate(query)
+	defer s.bb.sat.addClause(act ^ 1)
+
+	r, err := s.solve(ctx, act)
+	if r != RESULT_SAT {
+		s.lastSatModel = nil
+	}
+	return r, err
+}
+
+func (s *bitblastBackend) checkAssuming(ctx context.Context, assumptions []*BoolExprPtr) (int, []int, error) {
+	supported := s.unsupported < 0
+	for _, a := range assumptions {
+		supported = supported && bitblastSupported(a)
+	}
+	if !supported {
+		s.lastSatModel = nil
+		return RESULT_UNKNOWN, nil, errBitblastUnsupported
+	}
+	s.sync()
+	lits := make([]int, len(assumptions))
+	index := make(map[int]int)
+	for i, a := range assumptions {
+		lits[i] = s.bb.translateBool(a)
+		if _, ok := index[lits[i]]; !ok {
+			index[lits[i]] = i
+		}
+	}
+
+	r, err := s.solve(ctx, lits...)
+	if r != RESULT_SAT {
+		s.lastSatModel = nil
+	}
+	if r != RESULT_UNSAT {
+		return r, nil, err
+	}
+	failed := make([]int, 0)
+	for _, lit := range s.bb.sat.conflict {
+		if i, ok := index[lit]; ok {
+			failed = append(failed, i)
+		}
+	}
+	sort.Ints(failed)
+	return r, failed, nil
+}
+
+func (s *bitblastBackend) model() map[string]*BVConst {
+	if s.lastSatModel == nil {
+		return nil
+	}
+	res := make(map[string]*BVConst)
+	for name, v := range s.lastSatModel {
+		res[name] = v
+	}
+	return res
+}
+
+func (s *bitblastBackend) funModel() map[string]*FunInterp {
+	if s.lastSatModel == nil {
+		return nil
+	}
+	return s.lastFunModel
+}
+
+func (s *bitblastBackend) evalUpto(ctx context.Context, bv *BVExprPtr, query *BoolExprPtr, n int) ([]*BVConst, error) {
+	if s.unsupported >= 0 || !bitblastSupported(bv) || !bitblastSupported(query) {
+		return nil, errBitblastUnsupported
+	}
+	s.sync()
+	bits := s.bb.translateBV(bv)
+	act := s.activate(query)
+	defer s.bb.sat.addClause(act ^ 1)
+
+	values := make([]*BVConst, 0)
+	for n > 0 {
+		r, err := s.solve(ctx, act)
+		if err != nil {
+			return values, err
+		}
+		if r != RESULT_SAT {
+			break
+		}
+
+		v := s.bb.bitsFromModel(bits)
+		values = append(values, v)
+
+		block := []int{act ^ 1}
+		for i, lit := range bits {
+			if v.value.Bit(i) == 1 {
+				block = append(block, lit^1)
+			} else {
+				block = append(block, lit)
+			}
+		}
+		s.bb.sat.addClause(block...)
+		n -= 1
+	}
+	return values, nil
+}
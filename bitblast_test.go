@@ -0,0 +1,159 @@
+package gosmt_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestBitblastOps(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	rng := rand.New(rand.NewSource(1))
+
+	type binop func(a, b *gosmt.BVExprPtr) (*gosmt.BVExprPtr, error)
+	ops := map[string]binop{
+		"add": eb.Add,
+		"sub": func(a, b *gosmt.BVExprPtr) (*gosmt.BVExprPtr, error) {
+			return eb.Add(a, eb.Neg(b))
+		},
+		"mul":  eb.Mul,
+		"udiv": eb.UDiv,
+		"sdiv": eb.SDiv,
+		"urem": eb.URem,
+		"srem": eb.SRem,
+		"shl":  eb.Shl,
+		"lshr": eb.LShr,
+		"ashr": eb.AShr,
+		"and":  eb.And,
+		"or":   eb.Or,
+		"xor":  eb.Xor,
+		"concat": func(a, b *gosmt.BVExprPtr) (*gosmt.BVExprPtr, error) {
+			e, _ := eb.Concat(a, b)
+			return eb.Extract(e, a.Size()+2, 3)
+		},
+		"ite": func(a, b *gosmt.BVExprPtr) (*gosmt.BVExprPtr, error) {
+			c, _ := eb.SLt(a, b)
+			e1, _ := eb.SExt(a, 3)
+			e2, _ := eb.ZExt(eb.Neg(b), 3)
+			e, _ := eb.ITE(c, e1, e2)
+			return eb.Extract(e, a.Size()-1, 0)
+		},
+	}
+	cmps := map[string]func(a, b *gosmt.BVExprPtr) (*gosmt.BoolExprPtr, error){
+		"ult": eb.Ult, "ule": eb.Ule, "ugt": eb.UGt, "uge": eb.UGe,
+		"slt": eb.SLt, "sle": eb.SLe, "sgt": eb.SGt, "sge": eb.SGe, "eq": eb.Eq,
+	}
+
+	for _, size := range []uint{8, 13} {
+		a := eb.BVS("a", size)
+		b := eb.BVS("b", size)
+		values := []int64{0, 1, -1, 2, 3, 1 << (size - 1), int64(size), int64(size + 1)}
+		for i := 0; i < 4; i++ {
+			values = append(values, rng.Int63())
+		}
+
+		for _, va := range values {
+			for _, vb := range values {
+				z3s := gosmt.NewZ3Solver(eb)
+				bbs := gosmt.NewBitblastSolver(eb)
+				for _, s := range []*gosmt.Solver{z3s, bbs} {
+					e, _ := eb.Eq(a, eb.BVV(va, size))
+					s.Add(e)
+					e, _ = eb.Eq(b, eb.BVV(vb, size))
+					s.Add(e)
+				}
+
+				for name, op := range ops {
+					e, err := op(a, b)
+					if isErr(t, err) {
+						return
+					}
+					v1 := z3s.Eval(e)
+					v2 := bbs.Eval(e)
+					if v1.String() != v2.String() {
+						t.Errorf("%s %d %d: %s != %s", name, va, vb, v1.String(), v2.String())
+						return
+					}
+				}
+				for name, cmp := range cmps {
+					e, err := cmp(a, b)
+					if isErr(t, err) {
+						return
+					}
+					if z3s.CheckSat(e) != bbs.CheckSat(e) {
+						t.Errorf("%s %d %d: different results", name, va, vb)
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBitblastFactor(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewBitblastSolver(eb)
+
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	prod, _ := eb.Mul(a, b)
+	e, _ := eb.Eq(prod, eb.BVV(1000003*1009, 32))
+	s.Add(e)
+	e, _ = eb.Ult(a, eb.BVV(1<<16, 32))
+	s.Add(e)
+	e, _ = eb.Ult(b, eb.BVV(1<<24, 32))
+	s.Add(e)
+	e, _ = eb.UGt(a, eb.BVV(1, 32))
+	s.Add(e)
+	e, _ = eb.UGt(b, eb.BVV(1, 32))
+	s.Add(e)
+
+	if r, _ := s.Satisfiable(); r != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	if uint32(s.Eval(a).AsULong()*s.Eval(b).AsULong()) != 1000003*1009 {
+		t.Error("invalid model")
+		return
+	}
+}
+
+func TestBitblastPushPop(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewBitblastSolver(eb)
+
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	e, _ := eb.Ule(a, eb.BVV(42, 32))
+	s.Add(e)
+	e, _ = eb.UGe(a, eb.BVV(21, 32))
+	s.Add(e)
+
+	s.Push()
+	e, _ = eb.Eq(a, b)
+	s.Add(e)
+	e, _ = eb.Ult(b, eb.BVV(10, 32))
+	s.Add(e)
+	if r, _ := s.Satisfiable(); r != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+	clone := s.Clone()
+
+	s.Pop(1)
+	if vals := s.EvalUpto(a, 128); len(vals) != 22 {
+		t.Error("unable to find all values")
+		return
+	}
+	if r, _ := clone.Satisfiable(); r != gosmt.RESULT_UNSAT {
+		t.Error("clone should be unsat")
+		return
+	}
+	clone.Pop(1)
+	e, _ = eb.Eq(b, eb.BVV(100, 32))
+	if clone.CheckSat(e) != gosmt.RESULT_SAT {
+		t.Error("clone should be sat")
+		return
+	}
+}
@@ -109,7 +109,7 @@ func (bv *BVConst) String() string {
 }
 
 func (bv *BVConst) FitInLong() bool {
-	maxulong := big.NewInt(2)
+	maxulong := big.NewInt(1)
 	maxulong.Lsh(maxulong, 64)
 	maxulong.Sub(maxulong, one)
 
@@ -310,6 +310,10 @@ func (bv *BVConst) Xor(o *BVConst) error {
 
 func (bv *BVConst) AShr(n uint) {
 	if n >= bv.Size {
+		if bv.IsNegative() {
+			bv.value = new(big.Int).Set(bv.mask)
+			return
+		}
 		bv.value = big.NewInt(0)
 		return
 	}
@@ -324,8 +328,8 @@ func (bv *BVConst) AShr(n uint) {
 
 	bv.value = bv.value.Rsh(bv.value, n)
 	if isNeg {
-		mask := makeMask(bv.Size - n)
-		mask = mask.Lsh(mask, n)
+		mask := makeMask(n)
+		mask = mask.Lsh(mask, bv.Size-n)
 		bv.value = bv.value.Or(bv.value, mask)
 	}
 }
@@ -352,6 +356,7 @@ func (bv *BVConst) Shl(n uint) {
 	}
 
 	bv.value = bv.value.Lsh(bv.value, n)
+	bv.value.And(bv.value, bv.mask)
 }
 
 func (bv *BVConst) Concat(o *BVConst) {
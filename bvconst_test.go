@@ -1,6 +1,7 @@
 package gosmt_test
 
 import (
+	"math/big"
 	"testing"
 
 	"github.com/borzacchiello/gosmt"
@@ -121,6 +122,45 @@ func TestAShr(t *testing.T) {
 		t.Errorf("incorrect BV")
 		return
 	}
+
+	bv = gosmt.MakeBVConst(0xd0, 8)
+	bv.AShr(2)
+
+	if bv.AsULong() != 0xf4 {
+		t.Errorf("incorrect BV")
+		return
+	}
+
+	bv = gosmt.MakeBVConst(-128, 8)
+	bv.AShr(9)
+
+	if bv.AsLong() != -1 {
+		t.Errorf("incorrect BV")
+		return
+	}
+}
+
+func TestShl(t *testing.T) {
+	bv := gosmt.MakeBVConst(0x2a, 8)
+	bv.Shl(5)
+
+	if bv.AsULong() != 0x40 {
+		t.Errorf("incorrect BV")
+		return
+	}
+}
+
+func TestFitInLong(t *testing.T) {
+	v := new(big.Int).Lsh(big.NewInt(1), 64)
+	if gosmt.MakeBVConstFromBigint(v, 65).FitInLong() {
+		t.Errorf("2^64 does not fit in 64 bits")
+		return
+	}
+	v.Sub(v, big.NewInt(1))
+	if !gosmt.MakeBVConstFromBigint(v, 65).FitInLong() {
+		t.Errorf("2^64-1 fits in 64 bits")
+		return
+	}
 }
 
 func TestNeg(t *testing.T) {
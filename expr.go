@@ -47,6 +47,34 @@ const (
 	TY_BOOL_NOT   = 32
 	TY_BOOL_AND   = 33
 	TY_BOOL_OR    = 34
+
+	TY_ARRAY_SYM   = 35
+	TY_ARRAY_CONST = 36
+	TY_STORE       = 37
+	TY_SELECT      = 38
+
+	TY_APPLY = 39
+
+	TY_FP_CONST     = 40
+	TY_FP_FROM_BITS = 41
+	TY_FP_FROM_SBV  = 42
+	TY_FP_FROM_UBV  = 43
+	TY_FP_TO_FP     = 44
+	TY_FP_NEG       = 45
+	TY_FP_ABS       = 46
+	TY_FP_SQRT      = 47
+	TY_FP_ADD       = 48
+	TY_FP_SUB       = 49
+	TY_FP_MUL       = 50
+	TY_FP_DIV       = 51
+	TY_FP_LT        = 52
+	TY_FP_LE        = 53
+	TY_FP_GT        = 54
+	TY_FP_GE        = 55
+	TY_FP_EQ        = 56
+	TY_FP_TO_BITS   = 57
+	TY_FP_TO_UBV    = 58
+	TY_FP_TO_SBV    = 59
 )
 
 /*
@@ -56,6 +84,8 @@ const (
 type ExprPtr interface {
 	IsBV() bool
 	IsBool() bool
+	IsArray() bool
+	IsFP() bool
 
 	getInternal() internalExpr
 }
@@ -76,6 +106,14 @@ func (bv *BVExprPtr) IsBool() bool {
 	return false
 }
 
+func (bv *BVExprPtr) IsArray() bool {
+	return false
+}
+
+func (bv *BVExprPtr) IsFP() bool {
+	return false
+}
+
 func (bv *BVExprPtr) IsConst() bool {
 	return bv.e.kind() == TY_CONST
 }
@@ -158,6 +196,14 @@ func (bv *BoolExprPtr) IsBool() bool {
 	return true
 }
 
+func (bv *BoolExprPtr) IsArray() bool {
+	return false
+}
+
+func (bv *BoolExprPtr) IsFP() bool {
+	return false
+}
+
 func (e *BoolExprPtr) IsConst() bool {
 	return e.e.kind() == TY_BOOL_CONST
 }
@@ -0,0 +1,466 @@
+package gosmt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+/*
+ *   Public Interface
+ */
+
+type ArrayExprPtr struct {
+	e internalArrayExpr
+}
+
+func (a *ArrayExprPtr) getInternal() internalExpr {
+	return a.e
+}
+
+func (a *ArrayExprPtr) IsBV() bool {
+	return false
+}
+
+func (a *ArrayExprPtr) IsBool() bool {
+	return false
+}
+
+func (a *ArrayExprPtr) IsArray() bool {
+	return true
+}
+
+func (a *ArrayExprPtr) IsFP() bool {
+	return false
+}
+
+func (a *ArrayExprPtr) IndexSize() uint {
+	return a.e.indexSize()
+}
+
+func (a *ArrayExprPtr) ValueSize() uint {
+	return a.e.valueSize()
+}
+
+func (a *ArrayExprPtr) String() string {
+	return a.e.String()
+}
+
+func (a *ArrayExprPtr) Id() uintptr {
+	return a.e.rawPtr()
+}
+
+func (a *ArrayExprPtr) Kind() int {
+	return a.e.kind()
+}
+
+/*
+ *   Private Interface
+ */
+
+type internalArrayExpr interface {
+	internalExpr
+
+	indexSize() uint
+	valueSize() uint
+	deepEq(internalArrayExpr) bool
+	shallowEq(internalArrayExpr) bool
+}
+
+func hashPtrs(tag string, ptrs ...uintptr) uint64 {
+	h := xxhash.New()
+	h.Write([]byte(tag))
+
+	raw := make([]byte, 8)
+	for _, p := range ptrs {
+		binary.BigEndian.PutUint64(raw, uint64(p))
+		h.Write(raw)
+	}
+	return h.Sum64()
+}
+
+/*
+ *  TY_ARRAY_SYM
+ */
+
+type internalArrayS struct {
+	name    string
+	idxSize uint
+	valSize uint
+}
+
+func mkinternalArrayS(name string, indexSize, valueSize uint) *internalArrayS {
+	return &internalArrayS{name: name, idxSize: indexSize, valSize: valueSize}
+}
+
+func (a *internalArrayS) String() string {
+	return a.name
+}
+
+func (a *internalArrayS) indexSize() uint {
+	return a.idxSize
+}
+
+func (a *internalArrayS) valueSize() uint {
+	return a.valSize
+}
+
+func (a *internalArrayS) subexprs() []internalExpr {
+	return make([]internalExpr, 0)
+}
+
+func (a *internalArrayS) kind() int {
+	return TY_ARRAY_SYM
+}
+
+func (a *internalArrayS) hash() uint64 {
+	h := xxhash.New()
+	n, err := h.Write([]byte(a.name))
+	if err != nil || n != len(a.name) {
+		panic(err)
+	}
+	return h.Sum64()
+}
+
+func (a *internalArrayS) deepEq(other internalArrayExpr) bool {
+	if other.kind() != TY_ARRAY_SYM {
+		return false
+	}
+	oa := other.(*internalArrayS)
+	return oa.name == a.name && oa.idxSize == a.idxSize && oa.valSize == a.valSize
+}
+
+func (a *internalArrayS) shallowEq(other internalArrayExpr) bool {
+	return a.deepEq(other)
+}
+
+func (a *internalArrayS) isLeaf() bool {
+	return true
+}
+
+func (a *internalArrayS) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(a))
+}
+
+/*
+ *  TY_ARRAY_CONST
+ */
+
+type internalArrayConst struct {
+	idxSize uint
+	value   *BVExprPtr
+}
+
+func mkinternalArrayConst(indexSize uint, value *BVExprPtr) *internalArrayConst {
+	return &internalArrayConst{idxSize: indexSize, value: value}
+}
+
+func (a *internalArrayConst) String() string {
+	return fmt.Sprintf("ConstArray(%s, %d)", a.value.String(), a.idxSize)
+}
+
+func (a *internalArrayConst) indexSize() uint {
+	return a.idxSize
+}
+
+func (a *internalArrayConst) valueSize() uint {
+	return a.value.Size()
+}
+
+func (a *internalArrayConst) subexprs() []internalExpr {
+	return []internalExpr{a.value.e}
+}
+
+func (a *internalArrayConst) kind() int {
+	return TY_ARRAY_CONST
+}
+
+func (a *internalArrayConst) hash() uint64 {
+	return hashPtrs("TY_ARRAY_CONST", uintptr(a.idxSize), a.value.e.rawPtr())
+}
+
+func (a *internalArrayConst) deepEq(other internalArrayExpr) bool {
+	if other.kind() != TY_ARRAY_CONST {
+		return false
+	}
+	oa := other.(*internalArrayConst)
+	return oa.idxSize == a.idxSize && a.value.e.deepEq(oa.value.e)
+}
+
+func (a *internalArrayConst) shallowEq(other internalArrayExpr) bool {
+	if other.kind() != TY_ARRAY_CONST {
+		return false
+	}
+	oa := other.(*internalArrayConst)
+	return oa.idxSize == a.idxSize && a.value.e.rawPtr() == oa.value.e.rawPtr()
+}
+
+func (a *internalArrayConst) isLeaf() bool {
+	return false
+}
+
+func (a *internalArrayConst) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(a))
+}
+
+/*
+ *  TY_STORE
+ */
+
+type internalArrayStore struct {
+	array *ArrayExprPtr
+	index *BVExprPtr
+	value *BVExprPtr
+}
+
+func mkinternalArrayStore(array *ArrayExprPtr, index *BVExprPtr, value *BVExprPtr) (*internalArrayStore, error) {
+	if array.IndexSize() != index.Size() || array.ValueSize() != value.Size() {
+		return nil, fmt.Errorf("mkinternalArrayStore(): invalid sizes")
+	}
+	return &internalArrayStore{array: array, index: index, value: value}, nil
+}
+
+func (a *internalArrayStore) String() string {
+	return fmt.Sprintf("Store(%s, %s, %s)", a.array.String(), a.index.String(), a.value.String())
+}
+
+func (a *internalArrayStore) indexSize() uint {
+	return a.array.IndexSize()
+}
+
+func (a *internalArrayStore) valueSize() uint {
+	return a.array.ValueSize()
+}
+
+func (a *internalArrayStore) subexprs() []internalExpr {
+	return []internalExpr{a.array.e, a.index.e, a.value.e}
+}
+
+func (a *internalArrayStore) kind() int {
+	return TY_STORE
+}
+
+func (a *internalArrayStore) hash() uint64 {
+	return hashPtrs("TY_STORE", a.array.e.rawPtr(), a.index.e.rawPtr(), a.value.e.rawPtr())
+}
+
+func (a *internalArrayStore) deepEq(other internalArrayExpr) bool {
+	if other.kind() != TY_STORE {
+		return false
+	}
+	oa := other.(*internalArrayStore)
+	return a.array.e.deepEq(oa.array.e) && a.index.e.deepEq(oa.index.e) && a.value.e.deepEq(oa.value.e)
+}
+
+func (a *internalArrayStore) shallowEq(other internalArrayExpr) bool {
+	if other.kind() != TY_STORE {
+		return false
+	}
+	oa := other.(*internalArrayStore)
+	return a.array.e.rawPtr() == oa.array.e.rawPtr() &&
+		a.index.e.rawPtr() == oa.index.e.rawPtr() &&
+		a.value.e.rawPtr() == oa.value.e.rawPtr()
+}
+
+func (a *internalArrayStore) isLeaf() bool {
+	return false
+}
+
+func (a *internalArrayStore) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(a))
+}
+
+/*
+ *  TY_SELECT
+ */
+
+type internalBVExprSelect struct {
+	array *ArrayExprPtr
+	index *BVExprPtr
+}
+
+func mkinternalBVExprSelect(array *ArrayExprPtr, index *BVExprPtr) (*internalBVExprSelect, error) {
+	if array.IndexSize() != index.Size() {
+		return nil, fmt.Errorf("mkinternalBVExprSelect(): invalid sizes")
+	}
+	return &internalBVExprSelect{array: array, index: index}, nil
+}
+
+func (e *internalBVExprSelect) String() string {
+	if e.array.e.isLeaf() {
+		return fmt.Sprintf("%s[%s]", e.array.String(), e.index.String())
+	}
+	return fmt.Sprintf("(%s)[%s]", e.array.String(), e.index.String())
+}
+
+func (e *internalBVExprSelect) size() uint {
+	return e.array.ValueSize()
+}
+
+func (e *internalBVExprSelect) subexprs() []internalExpr {
+	return []internalExpr{e.array.e, e.index.e}
+}
+
+func (e *internalBVExprSelect) kind() int {
+	return TY_SELECT
+}
+
+func (e *internalBVExprSelect) hash() uint64 {
+	return hashPtrs("TY_SELECT", e.array.e.rawPtr(), e.index.e.rawPtr())
+}
+
+func (e *internalBVExprSelect) deepEq(other internalBVExpr) bool {
+	if other.kind() != TY_SELECT {
+		return false
+	}
+	oe := other.(*internalBVExprSelect)
+	return e.array.e.deepEq(oe.array.e) && e.index.e.deepEq(oe.index.e)
+}
+
+func (e *internalBVExprSelect) shallowEq(other internalBVExpr) bool {
+	if other.kind() != TY_SELECT {
+		return false
+	}
+	oe := other.(*internalBVExprSelect)
+	return e.array.e.rawPtr() == oe.array.e.rawPtr() && e.index.e.rawPtr() == oe.index.e.rawPtr()
+}
+
+func (e *internalBVExprSelect) isLeaf() bool {
+	return false
+}
+
+func (e *internalBVExprSelect) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(e))
+}
+
+/*
+ *  Builder
+ */
+
+type arrayexpr struct {
+	exp     internalArrayExpr
+	counter int
+}
+
+func (eb *ExprBuilder) arrayFinalizer(e *ArrayExprPtr) {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	h := e.e.hash()
+	if _, ok := eb.arraycache[h]; !ok {
+		return
+	}
+	buck := eb.arraycache[h]
+	newBuck := make([]arrayexpr, 0)
+	for i := 0; i < len(buck); i++ {
+		if buck[i].exp.rawPtr() == e.e.rawPtr() {
+			buck[i].counter -= 1
+			if buck[i].counter <= 0 {
+				eb.Stats.CachedArrays -= 1
+				continue
+			}
+		}
+		newBuck = append(newBuck, buck[i])
+	}
+	eb.arraycache[h] = newBuck
+}
+
+func (eb *ExprBuilder) getOrCreateArray(e internalArrayExpr) *ArrayExprPtr {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+	eb.Stats.CacheLookups += 1
+
+	h := e.hash()
+	if _, ok := eb.arraycache[h]; !ok {
+		eb.arraycache[h] = make([]arrayexpr, 0)
+	}
+
+	bucket := eb.arraycache[h]
+	for i := 0; i < len(bucket); i++ {
+		if bucket[i].exp.shallowEq(e) {
+			eb.Stats.CacheHits += 1
+
+			bucket[i].counter += 1
+			r := &ArrayExprPtr{bucket[i].exp}
+			runtime.SetFinalizer(r, eb.arrayFinalizer)
+			return r
+		}
+	}
+	eb.Stats.CachedArrays += 1
+
+	bucket = append(bucket, arrayexpr{e, 1})
+	eb.arraycache[h] = bucket
+	r := &ArrayExprPtr{e}
+	runtime.SetFinalizer(r, eb.arrayFinalizer)
+	return r
+}
+
+func (eb *ExprBuilder) ArrayS(name string, indexSize, valueSize uint) *ArrayExprPtr {
+	return eb.getOrCreateArray(mkinternalArrayS(name, indexSize, valueSize))
+}
+
+func (eb *ExprBuilder) ConstArray(indexSize uint, value *BVExprPtr) *ArrayExprPtr {
+	return eb.getOrCreateArray(mkinternalArrayConst(indexSize, value))
+}
+
+func (eb *ExprBuilder) Store(array *ArrayExprPtr, index *BVExprPtr, value *BVExprPtr) (*ArrayExprPtr, error) {
+	if array.IndexSize() != index.Size() || array.ValueSize() != value.Size() {
+		return nil, fmt.Errorf("different sizes")
+	}
+
+	// Store of the value already in the array
+	if value.Kind() == TY_SELECT {
+		valueInt := value.e.(*internalBVExprSelect)
+		if valueInt.array.Id() == array.Id() && valueInt.index.Id() == index.Id() {
+			return array, nil
+		}
+	}
+
+	// Overwritten store
+	if array.Kind() == TY_STORE {
+		arrayInt := array.e.(*internalArrayStore)
+		if arrayInt.index.Id() == index.Id() {
+			array = arrayInt.array
+		}
+	}
+
+	ex, err := mkinternalArrayStore(array, index, value)
+	if err != nil {
+		return nil, err
+	}
+	return eb.getOrCreateArray(ex), nil
+}
+
+func (eb *ExprBuilder) Select(array *ArrayExprPtr, index *BVExprPtr) (*BVExprPtr, error) {
+	if array.IndexSize() != index.Size() {
+		return nil, fmt.Errorf("different sizes")
+	}
+
+	// Read over write
+	for {
+		if array.Kind() == TY_ARRAY_CONST {
+			return array.e.(*internalArrayConst).value, nil
+		}
+		if array.Kind() != TY_STORE {
+			break
+		}
+		arrayInt := array.e.(*internalArrayStore)
+		if arrayInt.index.Id() == index.Id() {
+			return arrayInt.value, nil
+		}
+		if !arrayInt.index.IsConst() || !index.IsConst() {
+			break
+		}
+		// the indexes are different constants
+		array = arrayInt.array
+	}
+
+	ex, err := mkinternalBVExprSelect(array, index)
+	if err != nil {
+		return nil, err
+	}
+	return eb.getOrCreateBV(ex), nil
+}
@@ -0,0 +1,154 @@
+package gosmt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestArrayCache(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	m1 := eb.ArrayS("m", 32, 8)
+	m2 := eb.ArrayS("m", 32, 8)
+	if m1.Id() != m2.Id() {
+		t.Error("should be the same object")
+		return
+	}
+
+	i := eb.BVS("i", 32)
+	s1, _ := eb.Store(m1, i, eb.BVV(42, 8))
+	s2, _ := eb.Store(m2, i, eb.BVV(42, 8))
+	if s1.Id() != s2.Id() {
+		t.Error("should be the same object")
+		return
+	}
+
+	if _, err := eb.Select(m1, eb.BVV(0, 8)); err == nil {
+		t.Error("should fail")
+		return
+	}
+}
+
+func TestArrayReadOverWrite(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	m := eb.ArrayS("m", 32, 8)
+	i := eb.BVS("i", 32)
+
+	st, _ := eb.Store(m, eb.BVV(0, 32), eb.BVV(42, 8))
+	st, _ = eb.Store(st, eb.BVV(1, 32), eb.BVV(43, 8))
+
+	e, _ := eb.Select(st, eb.BVV(0, 32))
+	if !e.IsConst() || e.String() != "0x2a" {
+		t.Error("unexpected select")
+		return
+	}
+	e, _ = eb.Select(st, eb.BVV(2, 32))
+	if e.String() != "m[0x2]" {
+		t.Error("unexpected select")
+		return
+	}
+	e, _ = eb.Select(st, i)
+	if e.String() != "(Store(Store(m, 0x0, 0x2a), 0x1, 0x2b))[i]" {
+		t.Error("unexpected select")
+		return
+	}
+
+	st2, _ := eb.Store(st, eb.BVV(1, 32), eb.BVV(44, 8))
+	if st2.String() != "Store(Store(m, 0x0, 0x2a), 0x1, 0x2c)" {
+		t.Error("unexpected store")
+		return
+	}
+	e, _ = eb.Select(m, i)
+	st2, _ = eb.Store(m, i, e)
+	if st2.Id() != m.Id() {
+		t.Error("unexpected store")
+		return
+	}
+
+	e, _ = eb.Select(eb.ConstArray(32, eb.BVV(7, 8)), i)
+	if e.String() != "0x7" {
+		t.Error("unexpected select")
+		return
+	}
+}
+
+func TestArraySolver(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		m := eb.ArrayS("m", 32, 8)
+		i := eb.BVS("i", 32)
+		j := eb.BVS("j", 32)
+
+		e, _ := eb.Select(m, i)
+		c, _ := eb.Eq(e, eb.BVV(1, 8))
+		s.Add(c)
+		e, _ = eb.Select(m, j)
+		c, _ = eb.Eq(e, eb.BVV(2, 8))
+		s.Add(c)
+
+		c, _ = eb.Eq(i, j)
+		if s.CheckSat(c) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+
+		st, _ := eb.Store(eb.ConstArray(32, eb.BVV(0, 8)), i, eb.BVV(3, 8))
+		e, _ = eb.Select(st, j)
+		c, _ = eb.Eq(e, eb.BVV(0, 8))
+		s.Add(c)
+		if vals := s.EvalUpto(e, 2); len(vals) != 1 || !vals[0].IsZero() {
+			t.Error("unexpected values")
+			return
+		}
+
+		st, _ = eb.Store(m, j, eb.BVV(5, 8))
+		e, _ = eb.Select(st, i)
+		if v := s.Eval(e); v.AsULong() != 1 {
+			t.Error("unexpected value")
+			return
+		}
+
+		out := strings.Builder{}
+		s.DumpSMTLIB2(&out)
+		if !strings.Contains(out.String(), "(declare-const m (Array (_ BitVec 32) (_ BitVec 8)))") ||
+			!strings.Contains(out.String(), "((as const (Array (_ BitVec 32) (_ BitVec 8))) #x00)") {
+			t.Error("unexpected dump")
+			return
+		}
+	}
+}
+
+func TestArrayDependencies(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		m := eb.ArrayS("m", 32, 8)
+		i := eb.BVS("i", 32)
+
+		// the query has no bit-vector symbols, it depends on the constraints
+		// only through the array
+		e, _ := eb.Select(m, eb.BVV(3, 32))
+		q, _ := eb.Eq(e, eb.BVV(2, 8))
+		if s.CheckSat(q) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+
+		e, _ = eb.Select(m, i)
+		c, _ := eb.Eq(e, eb.BVV(1, 8))
+		s.Add(c)
+		c, _ = eb.Eq(i, eb.BVV(3, 32))
+		s.Add(c)
+		if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		e, _ = eb.Select(m, eb.BVV(3, 32))
+		if v := s.Eval(e); v == nil || v.AsULong() != 1 {
+			t.Error("unexpected value")
+			return
+		}
+	}
+}
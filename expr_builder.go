@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"unsafe"
 )
 
 type bvexpr struct {
@@ -23,22 +24,30 @@ type ExprBuilderStats struct {
 	CacheLookups uint
 	CachedBVs    uint
 	CachedBools  uint
+	CachedArrays uint
+	CachedFPs    uint
 }
 
 type ExprBuilder struct {
-	lock      sync.RWMutex
-	bvcache   map[uint64][]bvexpr
-	boolcache map[uint64][]boolexpr
+	lock       sync.RWMutex
+	bvcache    map[uint64][]bvexpr
+	boolcache  map[uint64][]boolexpr
+	arraycache map[uint64][]arrayexpr
+	fpcache    map[uint64][]fpexpr
+	funs       map[string]*FunDecl
 
 	Stats ExprBuilderStats
 }
 
 func NewExprBuilder() *ExprBuilder {
 	return &ExprBuilder{
-		lock:      sync.RWMutex{},
-		bvcache:   map[uint64][]bvexpr{},
-		boolcache: map[uint64][]boolexpr{},
-		Stats:     ExprBuilderStats{},
+		lock:       sync.RWMutex{},
+		bvcache:    map[uint64][]bvexpr{},
+		boolcache:  map[uint64][]boolexpr{},
+		arraycache: map[uint64][]arrayexpr{},
+		fpcache:    map[uint64][]fpexpr{},
+		funs:       map[string]*FunDecl{},
+		Stats:      ExprBuilderStats{},
 	}
 }
 
@@ -51,7 +60,7 @@ func (eb *ExprBuilder) PrintStats() {
 	fmt.Println("=====================")
 	fmt.Printf("hits:       %d\n", eb.Stats.CacheHits)
 	fmt.Printf("hit ratio:  %.03f %%\n", float64(eb.Stats.CacheHits)/float64(eb.Stats.CacheLookups)*100)
-	fmt.Printf("num cached: %d\n", eb.Stats.CachedBVs+eb.Stats.CachedBools)
+	fmt.Printf("num cached: %d\n", eb.Stats.CachedBVs+eb.Stats.CachedBools+eb.Stats.CachedArrays+eb.Stats.CachedFPs)
 	fmt.Printf("bv ratio:   %.03f %%\n", float64(eb.Stats.CachedBVs)/float64(eb.Stats.CachedBVs+eb.Stats.CachedBools)*100)
 	fmt.Println("=====================")
 }
@@ -187,6 +196,37 @@ func (eb *ExprBuilder) InvolvedInputs(e ExprPtr) []*BVExprPtr {
 	return symbols
 }
 
+// dependencyKeys returns the ids of the inputs of e for the analysis of the
+// dependencies between constraints: the bit-vector and the array symbols, and
+// the uninterpreted functions (their declarations are never released)
+func (eb *ExprBuilder) dependencyKeys(e ExprPtr) []uintptr {
+	queue := []internalExpr{e.getInternal()}
+	visited := make(map[uintptr]bool)
+	keys := make([]uintptr, 0)
+	for len(queue) > 0 {
+		el := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if _, ok := visited[el.rawPtr()]; ok {
+			continue
+		}
+		visited[el.rawPtr()] = true
+
+		if el.kind() == TY_SYM || el.kind() == TY_ARRAY_SYM {
+			keys = append(keys, el.rawPtr())
+			continue
+		}
+		if el.kind() == TY_APPLY {
+			fun := uintptr(unsafe.Pointer(el.(*internalBVExprApply).fun))
+			if !visited[fun] {
+				visited[fun] = true
+				keys = append(keys, fun)
+			}
+		}
+		queue = append(queue, el.subexprs()...)
+	}
+	return keys
+}
+
 // *** Constructors ***
 
 func flattenOrAddArithmeticArg(e *BVExprPtr, ty int, children []*BVExprPtr) []*BVExprPtr {
@@ -707,9 +747,10 @@ func (eb *ExprBuilder) AShr(lhs, rhs *BVExprPtr) (*BVExprPtr, error) {
 		c1, _ := lhs.GetConst()
 		c2, _ := rhs.GetConst()
 		if !c2.FitInLong() {
-			return eb.getOrCreateBV(mkinternalBVV(0, c1.Size)), nil
+			c1.AShr(c1.Size)
+		} else {
+			c1.AShr(uint(c2.AsULong()))
 		}
-		c1.LShr(uint(c2.AsULong()))
 		return eb.getOrCreateBV(mkinternalBVVFromConst(*c1)), nil
 	}
 
@@ -720,7 +761,8 @@ func (eb *ExprBuilder) AShr(lhs, rhs *BVExprPtr) (*BVExprPtr, error) {
 			return lhs, nil
 		}
 		if n.value.Cmp(big.NewInt(int64(lhs.Size()))) >= 0 {
-			return eb.getOrCreateBV(mkinternalBVV(0, lhs.Size())), nil
+			// all the bits are copies of the sign bit
+			return eb.AShr(lhs, eb.getOrCreateBV(mkinternalBVV(int64(lhs.Size()-1), lhs.Size())))
 		}
 	}
 
@@ -808,6 +850,14 @@ func (eb *ExprBuilder) Extract(e *BVExprPtr, high, low uint) (*BVExprPtr, error)
 		}
 	}
 
+	// Known bits
+	if e.Kind() != TY_SYM {
+		kb := newKnownBitsAnalysis().bv(e, knownBitsBuilderDepth).extract(high, low)
+		if c, err := kb.GetConst(); err == nil {
+			return eb.getOrCreateBV(mkinternalBVVFromConst(*c)), nil
+		}
+	}
+
 	ex, err := mkinternalBVExprExtract(e, high, low)
 	if err != nil {
 		return nil, err
@@ -1006,9 +1056,13 @@ func (eb *ExprBuilder) UDiv(lhs, rhs *BVExprPtr) (*BVExprPtr, error) {
 		return eb.getOrCreateBV(mkinternalBVVFromConst(*c1)), nil
 	}
 
-	// Div by myself
+	// Div by myself (zero divided by zero yields -1)
 	if lhs.Id() == rhs.Id() {
-		return eb.getOrCreateBV(mkinternalBVV(1, lhs.Size())), nil
+		isZero, err := eb.Eq(lhs, eb.getOrCreateBV(mkinternalBVV(0, lhs.Size())))
+		if err != nil {
+			return nil, err
+		}
+		return eb.ITE(isZero, eb.getOrCreateBV(mkinternalBVV(-1, lhs.Size())), eb.getOrCreateBV(mkinternalBVV(1, lhs.Size())))
 	}
 
 	ex, err := mkinternalBVExprUdiv(lhs, rhs)
@@ -1028,16 +1082,23 @@ func (eb *ExprBuilder) SDiv(lhs, rhs *BVExprPtr) (*BVExprPtr, error) {
 		c1, _ := lhs.GetConst()
 		c2, _ := rhs.GetConst()
 		if c2.IsZero() {
-			// We are consistent with Z3 (div by zero yelds -1)
+			// We are consistent with Z3 (div by zero yelds -1, or 1 if lhs is negative)
+			if c1.IsNegative() {
+				return eb.getOrCreateBV(mkinternalBVV(1, c1.Size)), nil
+			}
 			return eb.getOrCreateBV(mkinternalBVV(-1, c1.Size)), nil
 		}
 		c1.SDiv(c2)
 		return eb.getOrCreateBV(mkinternalBVVFromConst(*c1)), nil
 	}
 
-	// Div by myself
+	// Div by myself (zero divided by zero yields -1)
 	if lhs.Id() == rhs.Id() {
-		return eb.getOrCreateBV(mkinternalBVV(1, lhs.Size())), nil
+		isZero, err := eb.Eq(lhs, eb.getOrCreateBV(mkinternalBVV(0, lhs.Size())))
+		if err != nil {
+			return nil, err
+		}
+		return eb.ITE(isZero, eb.getOrCreateBV(mkinternalBVV(-1, lhs.Size())), eb.getOrCreateBV(mkinternalBVV(1, lhs.Size())))
 	}
 
 	ex, err := mkinternalBVExprSdiv(lhs, rhs)
@@ -1156,6 +1217,11 @@ func (eb *ExprBuilder) Ult(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_ULT, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprUlt(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1179,6 +1245,11 @@ func (eb *ExprBuilder) Ule(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_ULE, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprUle(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1202,6 +1273,11 @@ func (eb *ExprBuilder) UGt(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_UGT, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprUgt(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1225,6 +1301,11 @@ func (eb *ExprBuilder) UGe(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_UGE, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprUge(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1248,6 +1329,11 @@ func (eb *ExprBuilder) SLt(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_SLT, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprSlt(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1271,6 +1357,11 @@ func (eb *ExprBuilder) SLe(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_SLE, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprSle(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1294,6 +1385,11 @@ func (eb *ExprBuilder) SGt(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_SGT, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprSgt(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1317,6 +1413,11 @@ func (eb *ExprBuilder) SGe(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_SGE, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprSge(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -1340,6 +1441,11 @@ func (eb *ExprBuilder) Eq(lhs, rhs *BVExprPtr) (*BoolExprPtr, error) {
 		return eb.getOrCreateBool(mkinternalBoolConst(r.Value)), nil
 	}
 
+	// Known bits
+	if r := eb.knownCmpExpr(TY_EQ, lhs, rhs); r != nil {
+		return r, nil
+	}
+
 	ex, err := mkinternalBoolExprEq(lhs, rhs)
 	if err != nil {
 		return nil, err
@@ -23,6 +23,25 @@ func getByte(t *testing.T, eb *gosmt.ExprBuilder, expr *gosmt.BVExprPtr, i uint)
 	return b
 }
 
+/*
+ *  waitFinalizers waits for the finalizers queued by the garbage collector,
+ *  the ids are reused only after the finalizers of the expressions have run.
+ *  runtime.GC does not wait for them, and they run one at a time after the
+ *  ones left by the previous tests (e.g., the terms of a Z3 context). An
+ *  object becomes unreachable only after the finalizers of the objects that
+ *  reference it have run, so it takes a few rounds
+ */
+func waitFinalizers() {
+	for i := 0; i < 5; i++ {
+		done := make(chan bool)
+		sentinel := &[32]byte{}
+		runtime.SetFinalizer(sentinel, func(*[32]byte) { close(done) })
+		sentinel = nil
+		runtime.GC()
+		<-done
+	}
+}
+
 func TestCache1(t *testing.T) {
 	eb := gosmt.NewExprBuilder()
 
@@ -50,6 +69,7 @@ func TestCache1(t *testing.T) {
 	}
 
 	runtime.GC()
+	waitFinalizers()
 
 	for i := 0; i < 32; i++ {
 		// create noise...
@@ -57,6 +77,7 @@ func TestCache1(t *testing.T) {
 	}
 
 	runtime.GC()
+	waitFinalizers()
 
 	s1 := eb.BVS("s1", 32)
 	if s1.Id() == oldid {
@@ -93,6 +114,7 @@ func TestCache2(t *testing.T) {
 	}
 
 	runtime.GC()
+	waitFinalizers()
 
 	for i := 0; i < 32; i++ {
 		// create noise...
@@ -100,6 +122,7 @@ func TestCache2(t *testing.T) {
 	}
 
 	runtime.GC()
+	waitFinalizers()
 
 	s1_cpy := eb.BVS("s1", 32)
 	if s1.Id() != s1_cpy.Id() {
@@ -147,6 +170,7 @@ func TestCache3(t *testing.T) {
 	}
 
 	runtime.GC()
+	waitFinalizers()
 
 	for i := 0; i < 32; i++ {
 		// create noise...
@@ -154,6 +178,7 @@ func TestCache3(t *testing.T) {
 	}
 
 	runtime.GC()
+	waitFinalizers()
 
 	s1_cpy := eb.BVS("s1", 32)
 	if oldid1 != s1_cpy.Id() {
@@ -340,3 +365,43 @@ func TestAddConstProp1(t *testing.T) {
 		return
 	}
 }
+
+func TestShiftDivConstProp(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	x := eb.BVS("x", 8)
+
+	e, _ := eb.AShr(eb.BVV(0xd0, 8), eb.BVV(2, 8))
+	if c, err := e.GetConst(); err != nil || c.AsULong() != 0xf4 {
+		t.Error("wrong ashr folding")
+		return
+	}
+	e, _ = eb.AShr(eb.BVV(-128, 8), eb.BVV(9, 8))
+	if c, err := e.GetConst(); err != nil || c.AsULong() != 0xff {
+		t.Error("wrong ashr folding")
+		return
+	}
+	// the sign bit is copied when shifting by the width
+	e, _ = eb.AShr(x, eb.BVV(8, 8))
+	if v, err := eb.EvalConcreteBV(e, map[string]*gosmt.BVConst{"x": gosmt.MakeBVConst(-3, 8)}); err != nil || v.AsULong() != 0xff {
+		t.Error("wrong ashr folding")
+		return
+	}
+
+	e, _ = eb.SDiv(eb.BVV(-4, 8), eb.BVV(0, 8))
+	if c, err := e.GetConst(); err != nil || c.AsULong() != 1 {
+		t.Error("wrong sdiv folding")
+		return
+	}
+
+	// x / x is -1 when x is zero, as in Z3
+	for _, op := range []func(a, b *gosmt.BVExprPtr) (*gosmt.BVExprPtr, error){eb.UDiv, eb.SDiv} {
+		e, _ = op(x, x)
+		for v, expected := range map[int64]uint64{0: 0xff, 3: 1} {
+			r, err := eb.EvalConcreteBV(e, map[string]*gosmt.BVConst{"x": gosmt.MakeBVConst(v, 8)})
+			if err != nil || r.AsULong() != expected {
+				t.Errorf("wrong x / x folding with x = %d", v)
+				return
+			}
+		}
+	}
+}
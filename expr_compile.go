@@ -0,0 +1,752 @@
+package gosmt
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+/*
+ *  A Compiled expression evaluates an expression on concrete inputs without
+ *  going through the ExprBuilder. The expression is translated into a list of
+ *  steps, one for each node, that store the value of the node in a frame.
+ *  Values up to 64 bits are computed on uint64, wider ones on big.Int. The
+ *  value of the symbol Inputs[i] is read from the i-th element of the input
+ *  vector. A Compiled expression can be used by multiple goroutines
+ */
+type Compiled struct {
+	Inputs []*BVExprPtr
+
+	size   uint
+	isBool bool
+	wide   bool
+	steps  []func(f *compiledFrame)
+	frames sync.Pool
+}
+
+type compiledFrame struct {
+	in []*BVConst
+	n  []uint64
+	w  []*big.Int
+}
+
+func (f *compiledFrame) big(i int) *big.Int {
+	if f.w[i] == nil {
+		f.w[i] = new(big.Int)
+	}
+	return f.w[i]
+}
+
+type compiledNode struct {
+	idx  int
+	size uint
+	wide bool
+}
+
+type compiler struct {
+	c     *Compiled
+	nodes map[uintptr]compiledNode
+}
+
+func mask64(size uint) uint64 {
+	if size >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << size) - 1
+}
+
+func sext64(v uint64, size uint) int64 {
+	return int64(v<<(64-size)) >> (64 - size)
+}
+
+// Compile translates e into a Compiled expression. Arrays, uninterpreted
+// functions and floating-point expressions are not supported
+func (eb *ExprBuilder) Compile(e ExprPtr) (*Compiled, error) {
+	cc := &compiler{
+		c:     &Compiled{Inputs: make([]*BVExprPtr, 0)},
+		nodes: make(map[uintptr]compiledNode),
+	}
+	root, err := cc.compile(e)
+	if err != nil {
+		return nil, err
+	}
+	cc.c.size = root.size
+	cc.c.isBool = e.IsBool()
+	cc.c.wide = root.wide
+
+	n := len(cc.c.steps)
+	cc.c.frames.New = func() any {
+		return &compiledFrame{n: make([]uint64, n), w: make([]*big.Int, n)}
+	}
+	return cc.c, nil
+}
+
+// Slot returns the index of the symbol in the input vector, or -1 if the
+// expression does not depend on it
+func (c *Compiled) Slot(name string) int {
+	for i, sym := range c.Inputs {
+		if sym.e.(*internalBVS).name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Compiled) run(in []*BVConst) *compiledFrame {
+	if len(in) < len(c.Inputs) {
+		panic(fmt.Sprintf("expected %d inputs, got %d", len(c.Inputs), len(in)))
+	}
+	f := c.frames.Get().(*compiledFrame)
+	f.in = in
+	for _, step := range c.steps {
+		step(f)
+	}
+	f.in = nil
+	return f
+}
+
+// EvalBV evaluates a compiled bitvector expression
+func (c *Compiled) EvalBV(in []*BVConst) *BVConst {
+	if c.isBool {
+		panic("not a bitvector expression")
+	}
+	f := c.run(in)
+	defer c.frames.Put(f)
+
+	root := len(c.steps) - 1
+	if c.wide {
+		return MakeBVConstFromBigint(new(big.Int).Set(f.w[root]), c.size)
+	}
+	return MakeBVConstFromBigint(new(big.Int).SetUint64(f.n[root]), c.size)
+}
+
+// EvalUint64 evaluates a compiled bitvector expression and returns the 64
+// least significant bits of the result, it does not allocate
+func (c *Compiled) EvalUint64(in []*BVConst) uint64 {
+	if c.isBool {
+		panic("not a bitvector expression")
+	}
+	f := c.run(in)
+	defer c.frames.Put(f)
+
+	root := len(c.steps) - 1
+	if c.wide {
+		return f.w[root].Uint64()
+	}
+	return f.n[root]
+}
+
+// EvalBool evaluates a compiled boolean expression
+func (c *Compiled) EvalBool(in []*BVConst) bool {
+	if !c.isBool {
+		panic("not a boolean expression")
+	}
+	f := c.run(in)
+	defer c.frames.Put(f)
+
+	return f.n[len(c.steps)-1] != 0
+}
+
+func (cc *compiler) add(size uint, wide bool, step func(f *compiledFrame)) compiledNode {
+	cc.c.steps = append(cc.c.steps, step)
+	return compiledNode{idx: len(cc.c.steps) - 1, size: size, wide: wide}
+}
+
+// bigOf returns a function that reads the value of the node as a big.Int.
+// The value of a narrow node is copied to its scratch big.Int
+func bigOf(n compiledNode) func(f *compiledFrame) *big.Int {
+	if n.wide {
+		return func(f *compiledFrame) *big.Int { return f.w[n.idx] }
+	}
+	return func(f *compiledFrame) *big.Int { return f.big(n.idx).SetUint64(f.n[n.idx]) }
+}
+
+func (cc *compiler) compile(eptr ExprPtr) (compiledNode, error) {
+	e := eptr.getInternal()
+	if n, ok := cc.nodes[e.rawPtr()]; ok {
+		return n, nil
+	}
+
+	var n compiledNode
+	var err error
+	switch e.kind() {
+	case TY_SYM, TY_CONST, TY_EXTRACT, TY_CONCAT, TY_ZEXT, TY_SEXT, TY_ITE,
+		TY_NOT, TY_NEG, TY_SHL, TY_LSHR, TY_ASHR, TY_AND, TY_OR, TY_XOR, TY_ADD,
+		TY_MUL, TY_SDIV, TY_UDIV, TY_SREM, TY_UREM:
+		n, err = cc.compileBV(eptr.(*BVExprPtr))
+	case TY_ULT, TY_ULE, TY_UGT, TY_UGE, TY_SLT, TY_SLE, TY_SGT, TY_SGE, TY_EQ,
+		TY_BOOL_CONST, TY_BOOL_NOT, TY_BOOL_AND, TY_BOOL_OR:
+		n, err = cc.compileBool(eptr.(*BoolExprPtr))
+	default:
+		return n, fmt.Errorf("cannot compile %s", e.String())
+	}
+	if err != nil {
+		return n, err
+	}
+	cc.nodes[e.rawPtr()] = n
+	return n, nil
+}
+
+func (cc *compiler) compileChildren(children []*BVExprPtr) ([]compiledNode, error) {
+	res := make([]compiledNode, len(children))
+	for i, child := range children {
+		var err error
+		res[i], err = cc.compile(child)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (cc *compiler) compileBV(bv *BVExprPtr) (compiledNode, error) {
+	size := bv.Size()
+	wide := size > 64
+	mask := mask64(size)
+	bigMask := makeMask(size)
+
+	var children []compiledNode
+	var err error
+	switch e := bv.e.(type) {
+	case *internalBVExprExtract:
+		children, err = cc.compileChildren([]*BVExprPtr{e.child})
+	case *internalBVExprConcat:
+		children, err = cc.compileChildren(e.children)
+	case *internalBVExprExtend:
+		children, err = cc.compileChildren([]*BVExprPtr{e.child})
+	case *internalBVExprITE:
+		var cond compiledNode
+		cond, err = cc.compile(e.cond)
+		if err == nil {
+			children, err = cc.compileChildren([]*BVExprPtr{e.iftrue, e.iffalse})
+			children = append(children, cond)
+		}
+	case *internalBVExprUnArithmetic:
+		children, err = cc.compileChildren([]*BVExprPtr{e.child})
+	case *internalBVExprBinArithmetic:
+		children, err = cc.compileChildren(e.children)
+	}
+	if err != nil {
+		return compiledNode{}, err
+	}
+	idx := len(cc.c.steps)
+
+	switch bv.Kind() {
+	case TY_SYM:
+		slot := len(cc.c.Inputs)
+		cc.c.Inputs = append(cc.c.Inputs, bv)
+		if wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.big(idx).And(f.in[slot].value, bigMask)
+			}), nil
+		}
+		return cc.add(size, wide, func(f *compiledFrame) {
+			f.n[idx] = f.in[slot].value.Uint64() & mask
+		}), nil
+	case TY_CONST:
+		c := bv.e.(*internalBVV).Value.value
+		if wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.big(idx).Set(c)
+			}), nil
+		}
+		v := c.Uint64()
+		return cc.add(size, wide, func(f *compiledFrame) {
+			f.n[idx] = v
+		}), nil
+	case TY_EXTRACT:
+		low := bv.e.(*internalBVExprExtract).low
+		c := children[0]
+		if !c.wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.n[idx] = (f.n[c.idx] >> low) & mask
+			}), nil
+		}
+		if !wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.n[idx] = f.big(idx).Rsh(f.w[c.idx], low).Uint64() & mask
+			}), nil
+		}
+		return cc.add(size, wide, func(f *compiledFrame) {
+			r := f.big(idx).Rsh(f.w[c.idx], low)
+			r.And(r, bigMask)
+		}), nil
+	case TY_CONCAT:
+		if !wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				acc := uint64(0)
+				for _, c := range children {
+					acc = (acc << c.size) | f.n[c.idx]
+				}
+				f.n[idx] = acc
+			}), nil
+		}
+		getters := make([]func(f *compiledFrame) *big.Int, len(children))
+		for i, c := range children {
+			getters[i] = bigOf(c)
+		}
+		return cc.add(size, wide, func(f *compiledFrame) {
+			r := f.big(idx).SetUint64(0)
+			for i, c := range children {
+				r.Lsh(r, c.size)
+				r.Or(r, getters[i](f))
+			}
+		}), nil
+	case TY_ZEXT:
+		c := children[0]
+		if !wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.n[idx] = f.n[c.idx]
+			}), nil
+		}
+		get := bigOf(c)
+		return cc.add(size, wide, func(f *compiledFrame) {
+			f.big(idx).Set(get(f))
+		}), nil
+	case TY_SEXT:
+		c := children[0]
+		if !wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.n[idx] = uint64(sext64(f.n[c.idx], c.size)) & mask
+			}), nil
+		}
+		get := bigOf(c)
+		ext := new(big.Int).Xor(bigMask, makeMask(c.size))
+		return cc.add(size, wide, func(f *compiledFrame) {
+			v := get(f)
+			r := f.big(idx).Set(v)
+			if v.Bit(int(c.size-1)) == 1 {
+				r.Or(r, ext)
+			}
+		}), nil
+	case TY_ITE:
+		t, e, cond := children[0], children[1], children[2]
+		if !wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				if f.n[cond.idx] != 0 {
+					f.n[idx] = f.n[t.idx]
+				} else {
+					f.n[idx] = f.n[e.idx]
+				}
+			}), nil
+		}
+		return cc.add(size, wide, func(f *compiledFrame) {
+			if f.n[cond.idx] != 0 {
+				f.big(idx).Set(f.w[t.idx])
+			} else {
+				f.big(idx).Set(f.w[e.idx])
+			}
+		}), nil
+	case TY_NOT:
+		c := children[0]
+		if !wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.n[idx] = ^f.n[c.idx] & mask
+			}), nil
+		}
+		return cc.add(size, wide, func(f *compiledFrame) {
+			f.big(idx).Xor(f.w[c.idx], bigMask)
+		}), nil
+	case TY_NEG:
+		c := children[0]
+		if !wide {
+			return cc.add(size, wide, func(f *compiledFrame) {
+				f.n[idx] = -f.n[c.idx] & mask
+			}), nil
+		}
+		return cc.add(size, wide, func(f *compiledFrame) {
+			r := f.big(idx).Neg(f.w[c.idx])
+			r.And(r, bigMask)
+		}), nil
+	case TY_SHL, TY_LSHR, TY_ASHR:
+		return cc.compileShift(bv.Kind(), size, children[0], children[1], idx), nil
+	case TY_AND, TY_OR, TY_XOR, TY_ADD, TY_MUL:
+		return cc.compileNary(bv.Kind(), size, children, idx), nil
+	case TY_SDIV, TY_UDIV, TY_SREM, TY_UREM:
+		return cc.compileDiv(bv.Kind(), size, children[0], children[1], idx), nil
+	}
+	return compiledNode{}, fmt.Errorf("cannot compile %s", bv.String())
+}
+
+// shiftAmount returns the shift amount, capped to size
+func shiftAmount(f *compiledFrame, n compiledNode, size uint) uint {
+	if n.wide {
+		v := f.w[n.idx]
+		if v.BitLen() > 32 || v.Uint64() > uint64(size) {
+			return size
+		}
+		return uint(v.Uint64())
+	}
+	if f.n[n.idx] > uint64(size) {
+		return size
+	}
+	return uint(f.n[n.idx])
+}
+
+func (cc *compiler) compileShift(kind int, size uint, lhs, rhs compiledNode, idx int) compiledNode {
+	wide := size > 64
+	mask := mask64(size)
+	bigMask := makeMask(size)
+
+	if !wide {
+		switch kind {
+		case TY_SHL:
+			return cc.add(size, wide, func(f *compiledFrame) {
+				n := shiftAmount(f, rhs, size)
+				if n >= size {
+					f.n[idx] = 0
+					return
+				}
+				f.n[idx] = (f.n[lhs.idx] << n) & mask
+			})
+		case TY_LSHR:
+			return cc.add(size, wide, func(f *compiledFrame) {
+				n := shiftAmount(f, rhs, size)
+				if n >= size {
+					f.n[idx] = 0
+					return
+				}
+				f.n[idx] = f.n[lhs.idx] >> n
+			})
+		default:
+			return cc.add(size, wide, func(f *compiledFrame) {
+				// shifting by 63 fills the value with the sign bit
+				n := shiftAmount(f, rhs, size)
+				if n > 63 {
+					n = 63
+				}
+				f.n[idx] = uint64(sext64(f.n[lhs.idx], size)>>n) & mask
+			})
+		}
+	}
+
+	switch kind {
+	case TY_SHL:
+		return cc.add(size, wide, func(f *compiledFrame) {
+			r := f.big(idx).Lsh(f.w[lhs.idx], shiftAmount(f, rhs, size))
+			r.And(r, bigMask)
+		})
+	case TY_LSHR:
+		return cc.add(size, wide, func(f *compiledFrame) {
+			f.big(idx).Rsh(f.w[lhs.idx], shiftAmount(f, rhs, size))
+		})
+	default:
+		return cc.add(size, wide, func(f *compiledFrame) {
+			n := shiftAmount(f, rhs, size)
+			v := f.w[lhs.idx]
+			r := f.big(idx)
+			if v.Bit(int(size-1)) == 0 {
+				r.Rsh(v, n)
+				return
+			}
+			// ashr(v, n) = ~lshr(~v, n)
+			r.Xor(v, bigMask)
+			r.Rsh(r, n)
+			r.Xor(r, bigMask)
+		})
+	}
+}
+
+func (cc *compiler) compileNary(kind int, size uint, children []compiledNode, idx int) compiledNode {
+	wide := size > 64
+	mask := mask64(size)
+	bigMask := makeMask(size)
+
+	if !wide {
+		var op func(a, b uint64) uint64
+		switch kind {
+		case TY_AND:
+			op = func(a, b uint64) uint64 { return a & b }
+		case TY_OR:
+			op = func(a, b uint64) uint64 { return a | b }
+		case TY_XOR:
+			op = func(a, b uint64) uint64 { return a ^ b }
+		case TY_ADD:
+			op = func(a, b uint64) uint64 { return a + b }
+		default:
+			op = func(a, b uint64) uint64 { return a * b }
+		}
+		return cc.add(size, wide, func(f *compiledFrame) {
+			acc := f.n[children[0].idx]
+			for _, c := range children[1:] {
+				acc = op(acc, f.n[c.idx])
+			}
+			f.n[idx] = acc & mask
+		})
+	}
+
+	var op func(r, a, b *big.Int) *big.Int
+	switch kind {
+	case TY_AND:
+		op = (*big.Int).And
+	case TY_OR:
+		op = (*big.Int).Or
+	case TY_XOR:
+		op = (*big.Int).Xor
+	case TY_ADD:
+		op = (*big.Int).Add
+	default:
+		op = (*big.Int).Mul
+	}
+	return cc.add(size, wide, func(f *compiledFrame) {
+		r := f.big(idx).Set(f.w[children[0].idx])
+		for _, c := range children[1:] {
+			op(r, r, f.w[c.idx])
+			r.And(r, bigMask)
+		}
+	})
+}
+
+/*
+ *  The division by zero follows the SMT-LIB semantics: udiv yields -1, sdiv
+ *  yields -1 or 1 if the dividend is negative, and urem and srem yield the
+ *  dividend
+ */
+func (cc *compiler) compileDiv(kind int, size uint, lhs, rhs compiledNode, idx int) compiledNode {
+	wide := size > 64
+	mask := mask64(size)
+	bigMask := makeMask(size)
+
+	if !wide {
+		switch kind {
+		case TY_UDIV:
+			return cc.add(size, wide, func(f *compiledFrame) {
+				a, b := f.n[lhs.idx], f.n[rhs.idx]
+				if b == 0 {
+					f.n[idx] = mask
+					return
+				}
+				f.n[idx] = a / b
+			})
+		case TY_UREM:
+			return cc.add(size, wide, func(f *compiledFrame) {
+				a, b := f.n[lhs.idx], f.n[rhs.idx]
+				if b == 0 {
+					f.n[idx] = a
+					return
+				}
+				f.n[idx] = a % b
+			})
+		case TY_SDIV:
+			return cc.add(size, wide, func(f *compiledFrame) {
+				a, b := sext64(f.n[lhs.idx], size), sext64(f.n[rhs.idx], size)
+				if b == 0 {
+					if a < 0 {
+						f.n[idx] = 1
+					} else {
+						f.n[idx] = mask
+					}
+					return
+				}
+				q := absInt64(a) / absInt64(b)
+				if (a < 0) != (b < 0) {
+					q = -q
+				}
+				f.n[idx] = q & mask
+			})
+		default:
+			return cc.add(size, wide, func(f *compiledFrame) {
+				a, b := sext64(f.n[lhs.idx], size), sext64(f.n[rhs.idx], size)
+				if b == 0 {
+					f.n[idx] = f.n[lhs.idx]
+					return
+				}
+				r := absInt64(a) % absInt64(b)
+				if a < 0 {
+					r = -r
+				}
+				f.n[idx] = r & mask
+			})
+		}
+	}
+
+	modulus := new(big.Int).Add(bigMask, one)
+	abs := func(v *big.Int) (*big.Int, bool) {
+		if v.Bit(int(size-1)) == 0 {
+			return v, false
+		}
+		return new(big.Int).Sub(modulus, v), true
+	}
+	switch kind {
+	case TY_UDIV:
+		return cc.add(size, wide, func(f *compiledFrame) {
+			a, b := f.w[lhs.idx], f.w[rhs.idx]
+			if b.Sign() == 0 {
+				f.big(idx).Set(bigMask)
+				return
+			}
+			f.big(idx).Quo(a, b)
+		})
+	case TY_UREM:
+		return cc.add(size, wide, func(f *compiledFrame) {
+			a, b := f.w[lhs.idx], f.w[rhs.idx]
+			if b.Sign() == 0 {
+				f.big(idx).Set(a)
+				return
+			}
+			f.big(idx).Rem(a, b)
+		})
+	case TY_SDIV:
+		return cc.add(size, wide, func(f *compiledFrame) {
+			a, na := abs(f.w[lhs.idx])
+			b, nb := abs(f.w[rhs.idx])
+			r := f.big(idx)
+			if b.Sign() == 0 {
+				if na {
+					r.SetUint64(1)
+				} else {
+					r.Set(bigMask)
+				}
+				return
+			}
+			r.Quo(a, b)
+			if na != nb {
+				r.Neg(r)
+				r.And(r, bigMask)
+			}
+		})
+	default:
+		return cc.add(size, wide, func(f *compiledFrame) {
+			a, na := abs(f.w[lhs.idx])
+			b, _ := abs(f.w[rhs.idx])
+			r := f.big(idx)
+			if b.Sign() == 0 {
+				r.Set(f.w[lhs.idx])
+				return
+			}
+			r.Rem(a, b)
+			if na {
+				r.Neg(r)
+				r.And(r, bigMask)
+			}
+		})
+	}
+}
+
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
+}
+
+func (cc *compiler) compileBool(b *BoolExprPtr) (compiledNode, error) {
+	switch e := b.e.(type) {
+	case *internalBoolVal:
+		v := uint64(0)
+		if e.Value.Value {
+			v = 1
+		}
+		idx := len(cc.c.steps)
+		return cc.add(0, false, func(f *compiledFrame) {
+			f.n[idx] = v
+		}), nil
+	case *internalBoolUnArithmetic:
+		c, err := cc.compile(e.child)
+		if err != nil {
+			return c, err
+		}
+		idx := len(cc.c.steps)
+		return cc.add(0, false, func(f *compiledFrame) {
+			f.n[idx] = f.n[c.idx] ^ 1
+		}), nil
+	case *internalBoolExprNaryOp:
+		children := make([]compiledNode, len(e.children))
+		for i, child := range e.children {
+			var err error
+			children[i], err = cc.compile(child)
+			if err != nil {
+				return compiledNode{}, err
+			}
+		}
+		idx := len(cc.c.steps)
+		if b.Kind() == TY_BOOL_AND {
+			return cc.add(0, false, func(f *compiledFrame) {
+				v := uint64(1)
+				for _, c := range children {
+					v &= f.n[c.idx]
+				}
+				f.n[idx] = v
+			}), nil
+		}
+		return cc.add(0, false, func(f *compiledFrame) {
+			v := uint64(0)
+			for _, c := range children {
+				v |= f.n[c.idx]
+			}
+			f.n[idx] = v
+		}), nil
+	case *internalBoolExprCmp:
+		children, err := cc.compileChildren([]*BVExprPtr{e.lhs, e.rhs})
+		if err != nil {
+			return compiledNode{}, err
+		}
+		return cc.compileCmp(b.Kind(), children[0], children[1]), nil
+	}
+	return compiledNode{}, fmt.Errorf("cannot compile %s", b.String())
+}
+
+func (cc *compiler) compileCmp(kind int, lhs, rhs compiledNode) compiledNode {
+	idx := len(cc.c.steps)
+	size := lhs.size
+
+	var cmp func(f *compiledFrame) bool
+	if !lhs.wide {
+		switch kind {
+		case TY_ULT:
+			cmp = func(f *compiledFrame) bool { return f.n[lhs.idx] < f.n[rhs.idx] }
+		case TY_ULE:
+			cmp = func(f *compiledFrame) bool { return f.n[lhs.idx] <= f.n[rhs.idx] }
+		case TY_UGT:
+			cmp = func(f *compiledFrame) bool { return f.n[lhs.idx] > f.n[rhs.idx] }
+		case TY_UGE:
+			cmp = func(f *compiledFrame) bool { return f.n[lhs.idx] >= f.n[rhs.idx] }
+		case TY_SLT:
+			cmp = func(f *compiledFrame) bool { return sext64(f.n[lhs.idx], size) < sext64(f.n[rhs.idx], size) }
+		case TY_SLE:
+			cmp = func(f *compiledFrame) bool { return sext64(f.n[lhs.idx], size) <= sext64(f.n[rhs.idx], size) }
+		case TY_SGT:
+			cmp = func(f *compiledFrame) bool { return sext64(f.n[lhs.idx], size) > sext64(f.n[rhs.idx], size) }
+		case TY_SGE:
+			cmp = func(f *compiledFrame) bool { return sext64(f.n[lhs.idx], size) >= sext64(f.n[rhs.idx], size) }
+		default:
+			cmp = func(f *compiledFrame) bool { return f.n[lhs.idx] == f.n[rhs.idx] }
+		}
+	} else {
+		// flipping the sign bit turns a signed comparison into an unsigned one
+		signBit := new(big.Int).Lsh(one, size-1)
+		ucmp := func(f *compiledFrame) int { return f.w[lhs.idx].Cmp(f.w[rhs.idx]) }
+		scmp := func(f *compiledFrame) int {
+			a := new(big.Int).Xor(f.w[lhs.idx], signBit)
+			b := new(big.Int).Xor(f.w[rhs.idx], signBit)
+			return a.Cmp(b)
+		}
+		switch kind {
+		case TY_ULT:
+			cmp = func(f *compiledFrame) bool { return ucmp(f) < 0 }
+		case TY_ULE:
+			cmp = func(f *compiledFrame) bool { return ucmp(f) <= 0 }
+		case TY_UGT:
+			cmp = func(f *compiledFrame) bool { return ucmp(f) > 0 }
+		case TY_UGE:
+			cmp = func(f *compiledFrame) bool { return ucmp(f) >= 0 }
+		case TY_SLT:
+			cmp = func(f *compiledFrame) bool { return scmp(f) < 0 }
+		case TY_SLE:
+			cmp = func(f *compiledFrame) bool { return scmp(f) <= 0 }
+		case TY_SGT:
+			cmp = func(f *compiledFrame) bool { return scmp(f) > 0 }
+		case TY_SGE:
+			cmp = func(f *compiledFrame) bool { return scmp(f) >= 0 }
+		default:
+			cmp = func(f *compiledFrame) bool { return ucmp(f) == 0 }
+		}
+	}
+	return cc.add(0, false, func(f *compiledFrame) {
+		if cmp(f) {
+			f.n[idx] = 1
+		} else {
+			f.n[idx] = 0
+		}
+	})
+}
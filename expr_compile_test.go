@@ -0,0 +1,202 @@
+package gosmt_test
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+type binOp func(lhs, rhs *gosmt.BVExprPtr) (*gosmt.BVExprPtr, error)
+type cmpOp func(lhs, rhs *gosmt.BVExprPtr) (*gosmt.BoolExprPtr, error)
+
+func compileTestExprs(eb *gosmt.ExprBuilder, size uint) ([]*gosmt.BVExprPtr, []*gosmt.BoolExprPtr) {
+	a := eb.BVS("a", size)
+	b := eb.BVS("b", size)
+	c := eb.BVS("c", size)
+
+	bvs := []*gosmt.BVExprPtr{eb.Not(a), eb.Neg(b)}
+	for _, op := range []binOp{eb.Add, eb.Mul, eb.And, eb.Or, eb.Xor, eb.Shl, eb.LShr, eb.AShr,
+		eb.UDiv, eb.SDiv, eb.URem, eb.SRem} {
+		e, _ := op(a, b)
+		bvs = append(bvs, e)
+		e, _ = op(a, a)
+		bvs = append(bvs, e)
+	}
+	e, _ := eb.Add(a, b)
+	e, _ = eb.Mul(e, c)
+	e, _ = eb.Xor(e, eb.BVV(0x55, size))
+	bvs = append(bvs, e)
+
+	hi, _ := eb.Extract(a, size-1, size/2)
+	lo, _ := eb.Extract(b, size/2-1, 0)
+	e, _ = eb.Concat(hi, lo)
+	bvs = append(bvs, e)
+	e, _ = eb.Concat(e, c)
+	e, _ = eb.Extract(e, size+3, 3)
+	bvs = append(bvs, e)
+	e, _ = eb.SExt(lo, size-size/2)
+	bvs = append(bvs, e)
+	e, _ = eb.ZExt(lo, size-size/2)
+	bvs = append(bvs, e)
+	e, _ = eb.SExt(a, 40)
+	e, _ = eb.Extract(e, size+39, 20)
+	bvs = append(bvs, e)
+
+	bools := make([]*gosmt.BoolExprPtr, 0)
+	for _, op := range []cmpOp{eb.Ult, eb.Ule, eb.UGt, eb.UGe, eb.SLt, eb.SLe, eb.SGt, eb.SGe, eb.Eq} {
+		e, _ := op(a, b)
+		bools = append(bools, e)
+	}
+	g, _ := eb.BoolAnd(bools[0], bools[5])
+	g, _ = eb.BoolOr(g, bools[8])
+	g, _ = eb.BoolNot(g)
+	bools = append(bools, g)
+	e, _ = eb.ITE(g, a, c)
+	bvs = append(bvs, e)
+	return bvs, bools
+}
+
+func randomInput(r *rand.Rand, size uint) *gosmt.BVConst {
+	switch r.Intn(6) {
+	case 0:
+		return gosmt.MakeBVConst(0, size)
+	case 1:
+		return gosmt.MakeBVConst(-1, size)
+	case 2:
+		return gosmt.MakeBVConst(int64(r.Intn(int(size)+2)), size)
+	case 3:
+		v := new(big.Int).Lsh(big.NewInt(1), size-1)
+		return gosmt.MakeBVConstFromBigint(v, size)
+	}
+	v := new(big.Int).Rand(r, new(big.Int).Lsh(big.NewInt(1), size))
+	return gosmt.MakeBVConstFromBigint(v, size)
+}
+
+func TestCompile(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	r := rand.New(rand.NewSource(11))
+	for _, size := range []uint{8, 64, 100} {
+		bvs, bools := compileTestExprs(eb, size)
+		for i := 0; i < 200; i++ {
+			model := map[string]*gosmt.BVConst{
+				"a": randomInput(r, size),
+				"b": randomInput(r, size),
+				"c": randomInput(r, size),
+			}
+			for _, e := range bvs {
+				c, err := eb.Compile(e)
+				if isErr(t, err) {
+					return
+				}
+				in := make([]*gosmt.BVConst, len(c.Inputs))
+				for j, sym := range c.Inputs {
+					in[j] = model[sym.String()]
+				}
+				expected, err := eb.EvalConcreteBV(e, model)
+				if isErr(t, err) {
+					return
+				}
+				if v := c.EvalBV(in); v.String() != expected.String() {
+					t.Errorf("%s with %v: %s != %s", e.String(), model, v.String(), expected.String())
+					return
+				}
+				if v := c.EvalUint64(in); v != expected.Slice(min(63, expected.Size-1), 0).AsULong() {
+					t.Errorf("%s: wrong low bits", e.String())
+					return
+				}
+			}
+			for _, e := range bools {
+				c, err := eb.Compile(e)
+				if isErr(t, err) {
+					return
+				}
+				in := make([]*gosmt.BVConst, len(c.Inputs))
+				for j, sym := range c.Inputs {
+					in[j] = model[sym.String()]
+				}
+				expected, err := eb.EvalConcreteBool(e, model)
+				if isErr(t, err) {
+					return
+				}
+				if c.EvalBool(in) != expected {
+					t.Errorf("%s with %v: %v", e.String(), model, !expected)
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestCompileZ3CrossCheck(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+	r := rand.New(rand.NewSource(5))
+	for _, size := range []uint{8, 100} {
+		bvs, _ := compileTestExprs(eb, size)
+		for i := 0; i < 10; i++ {
+			s.Push()
+			model := make(map[string]*gosmt.BVConst)
+			for _, name := range []string{"a", "b", "c"} {
+				model[name] = randomInput(r, size)
+				c, _ := eb.Eq(eb.BVS(name, size), bvvOf(eb, model[name]))
+				s.Add(c)
+			}
+			for _, e := range bvs {
+				c, _ := eb.Compile(e)
+				in := make([]*gosmt.BVConst, len(c.Inputs))
+				for j, sym := range c.Inputs {
+					in[j] = model[sym.String()]
+				}
+				eq, _ := eb.Eq(e, bvvOf(eb, c.EvalBV(in)))
+				differ, _ := eb.BoolNot(eq)
+				if s.CheckSat(differ) != gosmt.RESULT_UNSAT {
+					t.Errorf("%s with %v", e.String(), model)
+					return
+				}
+			}
+			s.Pop(1)
+		}
+	}
+}
+
+// bvvOf returns the constant expression with value v
+func bvvOf(eb *gosmt.ExprBuilder, v *gosmt.BVConst) *gosmt.BVExprPtr {
+	r, _ := eb.Substitute(eb.BVS("v", v.Size), map[string]*gosmt.BVConst{"v": v})
+	return r.(*gosmt.BVExprPtr)
+}
+
+func TestCompileErrors(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	arr := eb.ArrayS("m", 32, 8)
+	e, _ := eb.Select(arr, eb.BVS("i", 32))
+	if _, err := eb.Compile(e); err == nil {
+		t.Error("should fail")
+		return
+	}
+
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	e, _ = eb.Add(a, b)
+	e, _ = eb.Mul(e, e)
+	c, err := eb.Compile(e)
+	if isErr(t, err) {
+		return
+	}
+	if len(c.Inputs) != 2 || c.Slot("b") < 0 || c.Slot("x") != -1 {
+		t.Error("wrong slots")
+		return
+	}
+	in := make([]*gosmt.BVConst, 2)
+	in[c.Slot("a")] = gosmt.MakeBVConst(3, 32)
+	in[c.Slot("b")] = gosmt.MakeBVConst(4, 32)
+	if c.EvalUint64(in) != 49 {
+		t.Error("wrong value")
+		return
+	}
+	if n := testing.AllocsPerRun(100, func() { c.EvalUint64(in) }); n != 0 {
+		t.Errorf("%v allocations", n)
+		return
+	}
+}
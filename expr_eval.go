@@ -1,13 +1,118 @@
 package gosmt
 
+import "fmt"
+
+/*
+ *  An evaluator rebuilds an expression replacing the symbols with the
+ *  expressions returned by `lookup` (nil to keep the symbol). The builder
+ *  simplifies the result, so that an expression with all its symbols replaced
+ *  by constants becomes a constant. The first error stops the evaluation
+ */
+type evaluator struct {
+	eb     *ExprBuilder
+	cache  map[uintptr]ExprPtr
+	lookup func(sym *internalBVS) (*BVExprPtr, error)
+	err    error
+}
+
+func (eb *ExprBuilder) newEvaluator(lookup func(sym *internalBVS) (*BVExprPtr, error)) *evaluator {
+	return &evaluator{
+		eb:     eb,
+		cache:  make(map[uintptr]ExprPtr),
+		lookup: lookup,
+	}
+}
+
+func constLookup(eb *ExprBuilder, interpr map[string]*BVConst) func(sym *internalBVS) (*BVExprPtr, error) {
+	return func(sym *internalBVS) (*BVExprPtr, error) {
+		c, ok := interpr[sym.name]
+		if !ok {
+			return nil, nil
+		}
+		if c.Size != sym.sz {
+			return nil, fmt.Errorf("wrong size for symbol %s", sym.name)
+		}
+		return eb.getOrCreateBV(mkinternalBVVFromConst(*c)), nil
+	}
+}
+
 func (eb *ExprBuilder) eval(e ExprPtr, interpr map[string]*BVConst) ExprPtr {
-	cache := make(map[uintptr]ExprPtr)
-	return eb.eval_internal(e, cache, interpr)
+	r, err := eb.Substitute(e, interpr)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Substitute replaces the symbols in e with their value in m, the symbols
+// that are not in m are left unchanged
+func (eb *ExprBuilder) Substitute(e ExprPtr, m map[string]*BVConst) (ExprPtr, error) {
+	ev := eb.newEvaluator(constLookup(eb, m))
+	r := ev.eval(e)
+	return r, ev.err
+}
+
+// SubstituteExpr replaces the symbols in e with the expressions in m, that
+// must have the same size of the symbols
+func (eb *ExprBuilder) SubstituteExpr(e ExprPtr, m map[string]*BVExprPtr) (ExprPtr, error) {
+	ev := eb.newEvaluator(func(sym *internalBVS) (*BVExprPtr, error) {
+		r, ok := m[sym.name]
+		if !ok {
+			return nil, nil
+		}
+		if r.Size() != sym.sz {
+			return nil, fmt.Errorf("wrong size for symbol %s", sym.name)
+		}
+		return r, nil
+	})
+	r := ev.eval(e)
+	return r, ev.err
+}
+
+func (eb *ExprBuilder) evalConcrete(e ExprPtr, m map[string]*BVConst) (ExprPtr, error) {
+	ev := eb.newEvaluator(func(sym *internalBVS) (*BVExprPtr, error) {
+		if _, ok := m[sym.name]; !ok {
+			return nil, fmt.Errorf("missing value for symbol %s", sym.name)
+		}
+		return constLookup(eb, m)(sym)
+	})
+	r := ev.eval(e)
+	if ev.err != nil {
+		return nil, ev.err
+	}
+	if k := r.getInternal().kind(); k != TY_CONST && k != TY_BOOL_CONST {
+		// e.g., uninterpreted functions and unspecified FP conversions
+		return nil, fmt.Errorf("the expression does not evaluate to a constant")
+	}
+	return r, nil
 }
 
-func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, interpr map[string]*BVConst) ExprPtr {
+// EvalConcreteBV evaluates e with the values in m, it fails if a symbol in e
+// has no value
+func (eb *ExprBuilder) EvalConcreteBV(e *BVExprPtr, m map[string]*BVConst) (*BVConst, error) {
+	r, err := eb.evalConcrete(e, m)
+	if err != nil {
+		return nil, err
+	}
+	return r.(*BVExprPtr).GetConst()
+}
+
+// EvalConcreteBool evaluates e with the values in m, it fails if a symbol in
+// e has no value
+func (eb *ExprBuilder) EvalConcreteBool(e *BoolExprPtr, m map[string]*BVConst) (bool, error) {
+	r, err := eb.evalConcrete(e, m)
+	if err != nil {
+		return false, err
+	}
+	return r.(*BoolExprPtr).GetConst()
+}
+
+func (ev *evaluator) eval(eptr ExprPtr) ExprPtr {
+	if ev.err != nil {
+		return eptr
+	}
 	e := eptr.getInternal()
-	if r, ok := cache[e.rawPtr()]; ok {
+	if r, ok := ev.cache[e.rawPtr()]; ok {
 		return r
 	}
 
@@ -16,68 +121,72 @@ func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, in
 	switch e.kind() {
 	case TY_SYM:
 		bv := e.(*internalBVS)
-		if c, ok := interpr[bv.name]; ok {
-			cInt := mkinternalBVVFromConst(*c)
-			return eb.getOrCreateBV(cInt)
+		r, err := ev.lookup(bv)
+		if err != nil {
+			ev.err = err
+			return eptr
 		}
-		return eptr
+		if r == nil {
+			return eptr
+		}
+		result = r
 	case TY_CONST:
 		return eptr
 	case TY_EXTRACT:
 		e := e.(*internalBVExprExtract)
-		child := eb.eval_internal(e.child, cache, interpr).(*BVExprPtr)
-		result, err = eb.Extract(child, e.high, e.low)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result, err = ev.eb.Extract(child, e.high, e.low)
 	case TY_CONCAT:
 		e := e.(*internalBVExprConcat)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
+		res := ev.eval(e.children[0]).(*BVExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BVExprPtr)
-			res, err = eb.Concat(res, child)
+			child := ev.eval(e.children[i]).(*BVExprPtr)
+			res, err = ev.eb.Concat(res, child)
 		}
 		result = res
 	case TY_ZEXT:
 		e := e.(*internalBVExprExtend)
-		child := eb.eval_internal(e.child, cache, interpr).(*BVExprPtr)
-		result, err = eb.ZExt(child, e.n)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result, err = ev.eb.ZExt(child, e.n)
 	case TY_SEXT:
 		e := e.(*internalBVExprExtend)
-		child := eb.eval_internal(e.child, cache, interpr).(*BVExprPtr)
-		result, err = eb.SExt(child, e.n)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result, err = ev.eb.SExt(child, e.n)
 	case TY_ITE:
 		e := e.(*internalBVExprITE)
-		guard := eb.eval_internal(e.cond, cache, interpr).(*BoolExprPtr)
-		iftrue := eb.eval_internal(e.iftrue, cache, interpr).(*BVExprPtr)
-		iffalse := eb.eval_internal(e.iffalse, cache, interpr).(*BVExprPtr)
-		result, err = eb.ITE(guard, iftrue, iffalse)
+		guard := ev.eval(e.cond).(*BoolExprPtr)
+		iftrue := ev.eval(e.iftrue).(*BVExprPtr)
+		iffalse := ev.eval(e.iffalse).(*BVExprPtr)
+		result, err = ev.eb.ITE(guard, iftrue, iffalse)
 	case TY_NOT:
 		e := e.(*internalBVExprUnArithmetic)
-		child := eb.eval_internal(e.child, cache, interpr).(*BVExprPtr)
-		result = eb.Not(child)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result = ev.eb.Not(child)
 	case TY_NEG:
 		e := e.(*internalBVExprUnArithmetic)
-		child := eb.eval_internal(e.child, cache, interpr).(*BVExprPtr)
-		result = eb.Neg(child)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result = ev.eb.Neg(child)
 	case TY_SHL:
 		e := e.(*internalBVExprBinArithmetic)
-		lhs := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.children[1], cache, interpr).(*BVExprPtr)
-		result, err = eb.Shl(lhs, rhs)
+		lhs := ev.eval(e.children[0]).(*BVExprPtr)
+		rhs := ev.eval(e.children[1]).(*BVExprPtr)
+		result, err = ev.eb.Shl(lhs, rhs)
 	case TY_LSHR:
 		e := e.(*internalBVExprBinArithmetic)
-		lhs := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.children[1], cache, interpr).(*BVExprPtr)
-		result, err = eb.LShr(lhs, rhs)
+		lhs := ev.eval(e.children[0]).(*BVExprPtr)
+		rhs := ev.eval(e.children[1]).(*BVExprPtr)
+		result, err = ev.eb.LShr(lhs, rhs)
 	case TY_ASHR:
 		e := e.(*internalBVExprBinArithmetic)
-		lhs := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.children[1], cache, interpr).(*BVExprPtr)
-		result, err = eb.AShr(lhs, rhs)
+		lhs := ev.eval(e.children[0]).(*BVExprPtr)
+		rhs := ev.eval(e.children[1]).(*BVExprPtr)
+		result, err = ev.eb.AShr(lhs, rhs)
 	case TY_AND:
 		e := e.(*internalBVExprBinArithmetic)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
+		res := ev.eval(e.children[0]).(*BVExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BVExprPtr)
-			res, err = eb.And(res, child)
+			child := ev.eval(e.children[i]).(*BVExprPtr)
+			res, err = ev.eb.And(res, child)
 			if err != nil {
 				break
 			}
@@ -85,10 +194,10 @@ func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, in
 		result = res
 	case TY_OR:
 		e := e.(*internalBVExprBinArithmetic)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
+		res := ev.eval(e.children[0]).(*BVExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BVExprPtr)
-			res, err = eb.Or(res, child)
+			child := ev.eval(e.children[i]).(*BVExprPtr)
+			res, err = ev.eb.Or(res, child)
 			if err != nil {
 				break
 			}
@@ -96,10 +205,10 @@ func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, in
 		result = res
 	case TY_XOR:
 		e := e.(*internalBVExprBinArithmetic)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
+		res := ev.eval(e.children[0]).(*BVExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BVExprPtr)
-			res, err = eb.Xor(res, child)
+			child := ev.eval(e.children[i]).(*BVExprPtr)
+			res, err = ev.eb.Xor(res, child)
 			if err != nil {
 				break
 			}
@@ -107,10 +216,10 @@ func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, in
 		result = res
 	case TY_ADD:
 		e := e.(*internalBVExprBinArithmetic)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
+		res := ev.eval(e.children[0]).(*BVExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BVExprPtr)
-			res, err = eb.Add(res, child)
+			child := ev.eval(e.children[i]).(*BVExprPtr)
+			res, err = ev.eb.Add(res, child)
 			if err != nil {
 				break
 			}
@@ -118,10 +227,10 @@ func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, in
 		result = res
 	case TY_MUL:
 		e := e.(*internalBVExprBinArithmetic)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
+		res := ev.eval(e.children[0]).(*BVExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BVExprPtr)
-			res, err = eb.Mul(res, child)
+			child := ev.eval(e.children[i]).(*BVExprPtr)
+			res, err = ev.eb.Mul(res, child)
 			if err != nil {
 				break
 			}
@@ -129,82 +238,82 @@ func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, in
 		result = res
 	case TY_SDIV:
 		e := e.(*internalBVExprBinArithmetic)
-		lhs := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.children[1], cache, interpr).(*BVExprPtr)
-		result, err = eb.SDiv(lhs, rhs)
+		lhs := ev.eval(e.children[0]).(*BVExprPtr)
+		rhs := ev.eval(e.children[1]).(*BVExprPtr)
+		result, err = ev.eb.SDiv(lhs, rhs)
 	case TY_UDIV:
 		e := e.(*internalBVExprBinArithmetic)
-		lhs := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.children[1], cache, interpr).(*BVExprPtr)
-		result, err = eb.UDiv(lhs, rhs)
+		lhs := ev.eval(e.children[0]).(*BVExprPtr)
+		rhs := ev.eval(e.children[1]).(*BVExprPtr)
+		result, err = ev.eb.UDiv(lhs, rhs)
 	case TY_SREM:
 		e := e.(*internalBVExprBinArithmetic)
-		lhs := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.children[1], cache, interpr).(*BVExprPtr)
-		result, err = eb.SRem(lhs, rhs)
+		lhs := ev.eval(e.children[0]).(*BVExprPtr)
+		rhs := ev.eval(e.children[1]).(*BVExprPtr)
+		result, err = ev.eb.SRem(lhs, rhs)
 	case TY_UREM:
 		e := e.(*internalBVExprBinArithmetic)
-		lhs := eb.eval_internal(e.children[0], cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.children[1], cache, interpr).(*BVExprPtr)
-		result, err = eb.URem(lhs, rhs)
+		lhs := ev.eval(e.children[0]).(*BVExprPtr)
+		rhs := ev.eval(e.children[1]).(*BVExprPtr)
+		result, err = ev.eb.URem(lhs, rhs)
 	case TY_ULT:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.Ult(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.Ult(lhs, rhs)
 	case TY_ULE:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.Ule(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.Ule(lhs, rhs)
 	case TY_UGT:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.UGt(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.UGt(lhs, rhs)
 	case TY_UGE:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.UGe(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.UGe(lhs, rhs)
 	case TY_SLT:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.SLt(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.SLt(lhs, rhs)
 	case TY_SLE:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.SLe(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.SLe(lhs, rhs)
 	case TY_SGT:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.SGt(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.SGt(lhs, rhs)
 	case TY_SGE:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.SGe(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.SGe(lhs, rhs)
 	case TY_EQ:
 		e := e.(*internalBoolExprCmp)
-		lhs := eb.eval_internal(e.lhs, cache, interpr).(*BVExprPtr)
-		rhs := eb.eval_internal(e.rhs, cache, interpr).(*BVExprPtr)
-		result, err = eb.Eq(lhs, rhs)
+		lhs := ev.eval(e.lhs).(*BVExprPtr)
+		rhs := ev.eval(e.rhs).(*BVExprPtr)
+		result, err = ev.eb.Eq(lhs, rhs)
 	case TY_BOOL_CONST:
 		e := e.(*internalBoolVal)
-		result = eb.BoolVal(e.Value.Value)
+		result = ev.eb.BoolVal(e.Value.Value)
 	case TY_BOOL_NOT:
 		e := e.(*internalBoolUnArithmetic)
-		child := eb.eval_internal(e.child, cache, interpr).(*BoolExprPtr)
-		result, err = eb.BoolNot(child)
+		child := ev.eval(e.child).(*BoolExprPtr)
+		result, err = ev.eb.BoolNot(child)
 	case TY_BOOL_AND:
 		e := e.(*internalBoolExprNaryOp)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BoolExprPtr)
+		res := ev.eval(e.children[0]).(*BoolExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BoolExprPtr)
-			res, err = eb.BoolAnd(res, child)
+			child := ev.eval(e.children[i]).(*BoolExprPtr)
+			res, err = ev.eb.BoolAnd(res, child)
 			if err != nil {
 				break
 			}
@@ -212,20 +321,97 @@ func (eb *ExprBuilder) eval_internal(eptr ExprPtr, cache map[uintptr]ExprPtr, in
 		result = res
 	case TY_BOOL_OR:
 		e := e.(*internalBoolExprNaryOp)
-		res := eb.eval_internal(e.children[0], cache, interpr).(*BoolExprPtr)
+		res := ev.eval(e.children[0]).(*BoolExprPtr)
 		for i := 1; i < len(e.children); i++ {
-			child := eb.eval_internal(e.children[i], cache, interpr).(*BoolExprPtr)
-			res, err = eb.BoolOr(res, child)
+			child := ev.eval(e.children[i]).(*BoolExprPtr)
+			res, err = ev.eb.BoolOr(res, child)
 		}
 		result = res
+	case TY_ARRAY_SYM:
+		return eptr
+	case TY_ARRAY_CONST:
+		e := e.(*internalArrayConst)
+		value := ev.eval(e.value).(*BVExprPtr)
+		result = ev.eb.ConstArray(e.idxSize, value)
+	case TY_STORE:
+		e := e.(*internalArrayStore)
+		array := ev.eval(e.array).(*ArrayExprPtr)
+		index := ev.eval(e.index).(*BVExprPtr)
+		value := ev.eval(e.value).(*BVExprPtr)
+		result, err = ev.eb.Store(array, index, value)
+	case TY_SELECT:
+		e := e.(*internalBVExprSelect)
+		array := ev.eval(e.array).(*ArrayExprPtr)
+		index := ev.eval(e.index).(*BVExprPtr)
+		result, err = ev.eb.Select(array, index)
+	case TY_APPLY:
+		e := e.(*internalBVExprApply)
+		args := make([]*BVExprPtr, len(e.args))
+		for i, a := range e.args {
+			args[i] = ev.eval(a).(*BVExprPtr)
+		}
+		result, err = ev.eb.Apply(e.fun, args...)
+	case TY_FP_CONST:
+		return eptr
+	case TY_FP_FROM_BITS:
+		e := e.(*internalFPExprConvert)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result, err = ev.eb.FPFromBits(child, e.s)
+	case TY_FP_FROM_SBV:
+		e := e.(*internalFPExprConvert)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result = ev.eb.FPFromSBV(e.rm, child, e.s)
+	case TY_FP_FROM_UBV:
+		e := e.(*internalFPExprConvert)
+		child := ev.eval(e.child).(*BVExprPtr)
+		result = ev.eb.FPFromUBV(e.rm, child, e.s)
+	case TY_FP_TO_FP:
+		e := e.(*internalFPExprConvert)
+		child := ev.eval(e.child).(*FPExprPtr)
+		result = ev.eb.FPToFP(e.rm, child, e.s)
+	case TY_FP_NEG:
+		e := e.(*internalFPExprArith)
+		child := ev.eval(e.children[0]).(*FPExprPtr)
+		result = ev.eb.FPNeg(child)
+	case TY_FP_ABS:
+		e := e.(*internalFPExprArith)
+		child := ev.eval(e.children[0]).(*FPExprPtr)
+		result = ev.eb.FPAbs(child)
+	case TY_FP_SQRT:
+		e := e.(*internalFPExprArith)
+		child := ev.eval(e.children[0]).(*FPExprPtr)
+		result = ev.eb.FPSqrt(e.rm, child)
+	case TY_FP_ADD, TY_FP_SUB, TY_FP_MUL, TY_FP_DIV:
+		e := e.(*internalFPExprArith)
+		lhs := ev.eval(e.children[0]).(*FPExprPtr)
+		rhs := ev.eval(e.children[1]).(*FPExprPtr)
+		result, err = ev.eb.fpBinArith(e.ty, e.rm, lhs, rhs)
+	case TY_FP_LT, TY_FP_LE, TY_FP_GT, TY_FP_GE, TY_FP_EQ:
+		e := e.(*internalBoolExprFPCmp)
+		lhs := ev.eval(e.lhs).(*FPExprPtr)
+		rhs := ev.eval(e.rhs).(*FPExprPtr)
+		result, err = ev.eb.fpCmp(e.ty, lhs, rhs)
+	case TY_FP_TO_BITS:
+		e := e.(*internalBVExprFromFP)
+		child := ev.eval(e.child).(*FPExprPtr)
+		result = ev.eb.FPToBits(child)
+	case TY_FP_TO_UBV:
+		e := e.(*internalBVExprFromFP)
+		child := ev.eval(e.child).(*FPExprPtr)
+		result = ev.eb.FPToUBV(e.rm, child, e.n)
+	case TY_FP_TO_SBV:
+		e := e.(*internalBVExprFromFP)
+		child := ev.eval(e.child).(*FPExprPtr)
+		result = ev.eb.FPToSBV(e.rm, child, e.n)
 	default:
 		panic("invalid expression type")
 	}
 
 	if err != nil {
-		panic(err)
+		ev.err = err
+		return eptr
 	}
 
-	cache[e.rawPtr()] = result
+	ev.cache[e.rawPtr()] = result
 	return result
 }
@@ -18,3 +18,84 @@ func TestEval1(t *testing.T) {
 		t.Error("invalid eval")
 	}
 }
+
+func TestSubstitute(t *testing.T) {
+	eb := NewExprBuilder()
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	e, _ := eb.Add(a, b)
+	c, _ := eb.Ult(e, eb.BVV(10, 32))
+
+	r, err := eb.Substitute(c, map[string]*BVConst{"b": MakeBVConst(3, 32)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the operands of the sum are ordered by id, the strings can differ
+	a3, _ := eb.Add(a, eb.BVV(3, 32))
+	expected, _ := eb.Ult(a3, eb.BVV(10, 32))
+	if r.(*BoolExprPtr).Id() != expected.Id() {
+		t.Errorf("invalid substitution %s", r.(*BoolExprPtr).String())
+		return
+	}
+	if _, err := eb.Substitute(c, map[string]*BVConst{"b": MakeBVConst(3, 8)}); err == nil {
+		t.Error("should fail")
+		return
+	}
+
+	r, err = eb.SubstituteExpr(c, map[string]*BVExprPtr{"b": a})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	aa, _ := eb.Add(a, a)
+	expected, _ = eb.Ult(aa, eb.BVV(10, 32))
+	if r.(*BoolExprPtr).Id() != expected.Id() {
+		t.Error("invalid substitution")
+		return
+	}
+	if _, err := eb.SubstituteExpr(c, map[string]*BVExprPtr{"b": eb.BVS("c", 16)}); err == nil {
+		t.Error("should fail")
+		return
+	}
+}
+
+func TestEvalConcrete(t *testing.T) {
+	eb := NewExprBuilder()
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	e, _ := eb.Mul(a, b)
+	c, _ := eb.Eq(e, eb.BVV(42, 32))
+
+	m := map[string]*BVConst{"a": MakeBVConst(6, 32), "b": MakeBVConst(7, 32)}
+	v, err := eb.EvalConcreteBV(e, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v.AsULong() != 42 {
+		t.Error("invalid eval")
+		return
+	}
+	bv, err := eb.EvalConcreteBool(c, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bv {
+		t.Error("invalid eval")
+		return
+	}
+
+	if _, err := eb.EvalConcreteBV(e, map[string]*BVConst{"a": MakeBVConst(0, 32)}); err == nil {
+		t.Error("should fail on missing symbols")
+		return
+	}
+
+	f, _ := eb.DeclareFun("f", []uint{32}, 32)
+	fa, _ := eb.Apply(f, a)
+	if _, err := eb.EvalConcreteBV(fa, m); err == nil {
+		t.Error("should fail on uninterpreted functions")
+		return
+	}
+}
@@ -0,0 +1,774 @@
+package gosmt
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+/*
+ *   Public Interface
+ */
+
+type FPExprPtr struct {
+	e internalFPExpr
+}
+
+func (f *FPExprPtr) getInternal() internalExpr {
+	return f.e
+}
+
+func (f *FPExprPtr) IsBV() bool {
+	return false
+}
+
+func (f *FPExprPtr) IsBool() bool {
+	return false
+}
+
+func (f *FPExprPtr) IsArray() bool {
+	return false
+}
+
+func (f *FPExprPtr) IsFP() bool {
+	return true
+}
+
+func (f *FPExprPtr) Sort() FPSort {
+	return f.e.sort()
+}
+
+func (f *FPExprPtr) IsConst() bool {
+	return f.e.kind() == TY_FP_CONST
+}
+
+func (f *FPExprPtr) GetConst() (*FPConst, error) {
+	if f.e.kind() != TY_FP_CONST {
+		return nil, fmt.Errorf("not a constant")
+	}
+	c := f.e.(*internalFPV)
+	return c.Value.Copy(), nil
+}
+
+func (f *FPExprPtr) String() string {
+	return f.e.String()
+}
+
+func (f *FPExprPtr) Id() uintptr {
+	return f.e.rawPtr()
+}
+
+func (f *FPExprPtr) Kind() int {
+	return f.e.kind()
+}
+
+/*
+ *   Private Interface
+ */
+
+type internalFPExpr interface {
+	internalExpr
+
+	sort() FPSort
+	deepEq(internalFPExpr) bool
+	shallowEq(internalFPExpr) bool
+}
+
+var fpOpNames = map[int]string{
+	TY_FP_FROM_BITS: "FPFromBits",
+	TY_FP_FROM_SBV:  "FPFromSBV",
+	TY_FP_FROM_UBV:  "FPFromUBV",
+	TY_FP_TO_FP:     "FPToFP",
+	TY_FP_ABS:       "FPAbs",
+	TY_FP_SQRT:      "FPSqrt",
+	TY_FP_ADD:       "FPAdd",
+	TY_FP_SUB:       "FPSub",
+	TY_FP_MUL:       "FPMul",
+	TY_FP_DIV:       "FPDiv",
+	TY_FP_LT:        "FPLt",
+	TY_FP_LE:        "FPLe",
+	TY_FP_GT:        "FPGt",
+	TY_FP_GE:        "FPGe",
+	TY_FP_EQ:        "FPEq",
+	TY_FP_TO_BITS:   "FPToBits",
+	TY_FP_TO_UBV:    "FPToUBV",
+	TY_FP_TO_SBV:    "FPToSBV",
+}
+
+// The operations that are affected by the rounding mode
+func fpHasRoundingMode(ty int) bool {
+	switch ty {
+	case TY_FP_FROM_SBV, TY_FP_FROM_UBV, TY_FP_TO_FP, TY_FP_SQRT,
+		TY_FP_ADD, TY_FP_SUB, TY_FP_MUL, TY_FP_DIV, TY_FP_TO_UBV, TY_FP_TO_SBV:
+		return true
+	}
+	return false
+}
+
+func fpCall(ty int, rm RoundingMode, args ...string) string {
+	if fpHasRoundingMode(ty) {
+		args = append([]string{rm.String()}, args...)
+	}
+	return fmt.Sprintf("%s(%s)", fpOpNames[ty], strings.Join(args, ", "))
+}
+
+/*
+ *  TY_FP_CONST
+ */
+
+type internalFPV struct {
+	Value FPConst
+}
+
+func mkinternalFPVFromConst(c FPConst) *internalFPV {
+	return &internalFPV{Value: c}
+}
+
+func (e *internalFPV) String() string {
+	return e.Value.Text()
+}
+
+func (e *internalFPV) sort() FPSort {
+	return e.Value.Sort
+}
+
+func (e *internalFPV) subexprs() []internalExpr {
+	return make([]internalExpr, 0)
+}
+
+func (e *internalFPV) kind() int {
+	return TY_FP_CONST
+}
+
+func (e *internalFPV) hash() uint64 {
+	return hashPtrs("TY_FP_CONST", uintptr(e.Value.Sort.EBits), uintptr(e.Value.Sort.SBits), uintptr(e.Value.value.Uint64()))
+}
+
+func (e *internalFPV) deepEq(other internalFPExpr) bool {
+	if other.kind() != TY_FP_CONST {
+		return false
+	}
+	oe := other.(*internalFPV)
+	return e.Value.Sort == oe.Value.Sort && e.Value.value.Cmp(oe.Value.value) == 0
+}
+
+func (e *internalFPV) shallowEq(other internalFPExpr) bool {
+	return e.deepEq(other)
+}
+
+func (e *internalFPV) isLeaf() bool {
+	return true
+}
+
+func (e *internalFPV) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(e))
+}
+
+/*
+ *  TY_FP_FROM_BITS, TY_FP_FROM_SBV, TY_FP_FROM_UBV, TY_FP_TO_FP
+ */
+
+type internalFPExprConvert struct {
+	ty    int
+	rm    RoundingMode
+	child ExprPtr
+	s     FPSort
+}
+
+func mkinternalFPExprConvert(ty int, rm RoundingMode, child ExprPtr, sort FPSort) *internalFPExprConvert {
+	return &internalFPExprConvert{ty: ty, rm: rm, child: child, s: sort}
+}
+
+func (e *internalFPExprConvert) String() string {
+	return fpCall(e.ty, e.rm, e.child.getInternal().String(), e.s.String())
+}
+
+func (e *internalFPExprConvert) sort() FPSort {
+	return e.s
+}
+
+func (e *internalFPExprConvert) subexprs() []internalExpr {
+	return []internalExpr{e.child.getInternal()}
+}
+
+func (e *internalFPExprConvert) kind() int {
+	return e.ty
+}
+
+func (e *internalFPExprConvert) hash() uint64 {
+	return hashPtrs("TY_FP_CONVERT", uintptr(e.ty), uintptr(e.rm), uintptr(e.s.EBits), uintptr(e.s.SBits), e.child.getInternal().rawPtr())
+}
+
+func (e *internalFPExprConvert) deepEq(other internalFPExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalFPExprConvert)
+	if oe.rm != e.rm || oe.s != e.s {
+		return false
+	}
+	switch child := e.child.getInternal().(type) {
+	case internalBVExpr:
+		ochild, ok := oe.child.getInternal().(internalBVExpr)
+		return ok && child.deepEq(ochild)
+	case internalFPExpr:
+		ochild, ok := oe.child.getInternal().(internalFPExpr)
+		return ok && child.deepEq(ochild)
+	}
+	return false
+}
+
+func (e *internalFPExprConvert) shallowEq(other internalFPExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalFPExprConvert)
+	return oe.rm == e.rm && oe.s == e.s && oe.child.getInternal().rawPtr() == e.child.getInternal().rawPtr()
+}
+
+func (e *internalFPExprConvert) isLeaf() bool {
+	return false
+}
+
+func (e *internalFPExprConvert) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(e))
+}
+
+/*
+ *  TY_FP_NEG, TY_FP_ABS, TY_FP_SQRT, TY_FP_ADD, TY_FP_SUB, TY_FP_MUL, TY_FP_DIV
+ */
+
+type internalFPExprArith struct {
+	ty       int
+	rm       RoundingMode
+	children []*FPExprPtr
+}
+
+func mkinternalFPExprArith(ty int, rm RoundingMode, children ...*FPExprPtr) (*internalFPExprArith, error) {
+	for _, c := range children[1:] {
+		if c.Sort() != children[0].Sort() {
+			return nil, fmt.Errorf("mkinternalFPExprArith(): different sorts")
+		}
+	}
+	return &internalFPExprArith{ty: ty, rm: rm, children: children}, nil
+}
+
+func (e *internalFPExprArith) String() string {
+	if e.ty == TY_FP_NEG {
+		if e.children[0].e.isLeaf() {
+			return fmt.Sprintf("-%s", e.children[0].String())
+		}
+		return fmt.Sprintf("-(%s)", e.children[0].String())
+	}
+	args := make([]string, len(e.children))
+	for i, c := range e.children {
+		args[i] = c.String()
+	}
+	return fpCall(e.ty, e.rm, args...)
+}
+
+func (e *internalFPExprArith) sort() FPSort {
+	return e.children[0].Sort()
+}
+
+func (e *internalFPExprArith) subexprs() []internalExpr {
+	res := make([]internalExpr, len(e.children))
+	for i, c := range e.children {
+		res[i] = c.e
+	}
+	return res
+}
+
+func (e *internalFPExprArith) kind() int {
+	return e.ty
+}
+
+func (e *internalFPExprArith) hash() uint64 {
+	ptrs := []uintptr{uintptr(e.ty), uintptr(e.rm)}
+	for _, c := range e.children {
+		ptrs = append(ptrs, c.e.rawPtr())
+	}
+	return hashPtrs("TY_FP_ARITH", ptrs...)
+}
+
+func (e *internalFPExprArith) deepEq(other internalFPExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalFPExprArith)
+	if oe.rm != e.rm {
+		return false
+	}
+	for i := range e.children {
+		if !e.children[i].e.deepEq(oe.children[i].e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *internalFPExprArith) shallowEq(other internalFPExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalFPExprArith)
+	if oe.rm != e.rm {
+		return false
+	}
+	for i := range e.children {
+		if e.children[i].e.rawPtr() != oe.children[i].e.rawPtr() {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *internalFPExprArith) isLeaf() bool {
+	return false
+}
+
+func (e *internalFPExprArith) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(e))
+}
+
+/*
+ *  TY_FP_LT, TY_FP_LE, TY_FP_GT, TY_FP_GE, TY_FP_EQ
+ */
+
+type internalBoolExprFPCmp struct {
+	ty  int
+	lhs *FPExprPtr
+	rhs *FPExprPtr
+}
+
+func mkinternalBoolExprFPCmp(ty int, lhs, rhs *FPExprPtr) (*internalBoolExprFPCmp, error) {
+	if lhs.Sort() != rhs.Sort() {
+		return nil, fmt.Errorf("mkinternalBoolExprFPCmp(): different sorts")
+	}
+	return &internalBoolExprFPCmp{ty: ty, lhs: lhs, rhs: rhs}, nil
+}
+
+func (e *internalBoolExprFPCmp) String() string {
+	return fpCall(e.ty, RM_RNE, e.lhs.String(), e.rhs.String())
+}
+
+func (e *internalBoolExprFPCmp) subexprs() []internalExpr {
+	return []internalExpr{e.lhs.e, e.rhs.e}
+}
+
+func (e *internalBoolExprFPCmp) kind() int {
+	return e.ty
+}
+
+func (e *internalBoolExprFPCmp) hash() uint64 {
+	return hashPtrs("TY_FP_CMP", uintptr(e.ty), e.lhs.e.rawPtr(), e.rhs.e.rawPtr())
+}
+
+func (e *internalBoolExprFPCmp) deepEq(other internalBoolExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalBoolExprFPCmp)
+	return e.lhs.e.deepEq(oe.lhs.e) && e.rhs.e.deepEq(oe.rhs.e)
+}
+
+func (e *internalBoolExprFPCmp) shallowEq(other internalBoolExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalBoolExprFPCmp)
+	return e.lhs.e.rawPtr() == oe.lhs.e.rawPtr() && e.rhs.e.rawPtr() == oe.rhs.e.rawPtr()
+}
+
+func (e *internalBoolExprFPCmp) isLeaf() bool {
+	return false
+}
+
+func (e *internalBoolExprFPCmp) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(e))
+}
+
+/*
+ *  TY_FP_TO_BITS, TY_FP_TO_UBV, TY_FP_TO_SBV
+ */
+
+type internalBVExprFromFP struct {
+	ty    int
+	rm    RoundingMode
+	child *FPExprPtr
+	n     uint
+}
+
+func mkinternalBVExprFromFP(ty int, rm RoundingMode, child *FPExprPtr, n uint) *internalBVExprFromFP {
+	return &internalBVExprFromFP{ty: ty, rm: rm, child: child, n: n}
+}
+
+func (e *internalBVExprFromFP) String() string {
+	if e.ty == TY_FP_TO_BITS {
+		return fpCall(e.ty, e.rm, e.child.String())
+	}
+	return fpCall(e.ty, e.rm, e.child.String(), fmt.Sprintf("%d", e.n))
+}
+
+func (e *internalBVExprFromFP) size() uint {
+	return e.n
+}
+
+func (e *internalBVExprFromFP) subexprs() []internalExpr {
+	return []internalExpr{e.child.e}
+}
+
+func (e *internalBVExprFromFP) kind() int {
+	return e.ty
+}
+
+func (e *internalBVExprFromFP) hash() uint64 {
+	return hashPtrs("TY_FP_TO_BV", uintptr(e.ty), uintptr(e.rm), uintptr(e.n), e.child.e.rawPtr())
+}
+
+func (e *internalBVExprFromFP) deepEq(other internalBVExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalBVExprFromFP)
+	return oe.rm == e.rm && oe.n == e.n && e.child.e.deepEq(oe.child.e)
+}
+
+func (e *internalBVExprFromFP) shallowEq(other internalBVExpr) bool {
+	if other.kind() != e.ty {
+		return false
+	}
+	oe := other.(*internalBVExprFromFP)
+	return oe.rm == e.rm && oe.n == e.n && e.child.e.rawPtr() == oe.child.e.rawPtr()
+}
+
+func (e *internalBVExprFromFP) isLeaf() bool {
+	return false
+}
+
+func (e *internalBVExprFromFP) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(e))
+}
+
+/*
+ *  Builder
+ */
+
+type fpexpr struct {
+	exp     internalFPExpr
+	counter int
+}
+
+func (eb *ExprBuilder) fpFinalizer(e *FPExprPtr) {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	h := e.e.hash()
+	if _, ok := eb.fpcache[h]; !ok {
+		return
+	}
+	buck := eb.fpcache[h]
+	newBuck := make([]fpexpr, 0)
+	for i := 0; i < len(buck); i++ {
+		if buck[i].exp.rawPtr() == e.e.rawPtr() {
+			buck[i].counter -= 1
+			if buck[i].counter <= 0 {
+				eb.Stats.CachedFPs -= 1
+				continue
+			}
+		}
+		newBuck = append(newBuck, buck[i])
+	}
+	eb.fpcache[h] = newBuck
+}
+
+func (eb *ExprBuilder) getOrCreateFP(e internalFPExpr) *FPExprPtr {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+	eb.Stats.CacheLookups += 1
+
+	h := e.hash()
+	if _, ok := eb.fpcache[h]; !ok {
+		eb.fpcache[h] = make([]fpexpr, 0)
+	}
+
+	bucket := eb.fpcache[h]
+	for i := 0; i < len(bucket); i++ {
+		if bucket[i].exp.shallowEq(e) {
+			eb.Stats.CacheHits += 1
+
+			bucket[i].counter += 1
+			r := &FPExprPtr{bucket[i].exp}
+			runtime.SetFinalizer(r, eb.fpFinalizer)
+			return r
+		}
+	}
+	eb.Stats.CachedFPs += 1
+
+	bucket = append(bucket, fpexpr{e, 1})
+	eb.fpcache[h] = bucket
+	r := &FPExprPtr{e}
+	runtime.SetFinalizer(r, eb.fpFinalizer)
+	return r
+}
+
+func (eb *ExprBuilder) fpConst(c *FPConst) *FPExprPtr {
+	return eb.getOrCreateFP(mkinternalFPVFromConst(*c))
+}
+
+func (eb *ExprBuilder) FPV(value float64, sort FPSort) *FPExprPtr {
+	return eb.fpConst(MakeFPConst(value, sort))
+}
+
+// FPS returns the floating-point reinterpretation of the bit-vector symbol
+// name, so that models, dependencies and evaluations go through the symbol
+func (eb *ExprBuilder) FPS(name string, sort FPSort) *FPExprPtr {
+	r, _ := eb.FPFromBits(eb.BVS(name, sort.Size()), sort)
+	return r
+}
+
+func (eb *ExprBuilder) FPFromBits(bv *BVExprPtr, sort FPSort) (*FPExprPtr, error) {
+	if bv.Size() != sort.Size() {
+		return nil, fmt.Errorf("invalid size")
+	}
+
+	// Constant propagation
+	if bv.IsConst() {
+		c, _ := bv.GetConst()
+		fc, err := MakeFPConstFromBits(c, sort)
+		if err != nil {
+			return nil, err
+		}
+		return eb.fpConst(fc), nil
+	}
+	return eb.getOrCreateFP(mkinternalFPExprConvert(TY_FP_FROM_BITS, RM_RNE, bv, sort)), nil
+}
+
+func (eb *ExprBuilder) FPFromSBV(rm RoundingMode, bv *BVExprPtr, sort FPSort) *FPExprPtr {
+	// Constant propagation
+	if bv.IsConst() {
+		c, _ := bv.GetConst()
+		return eb.fpConst(FPConstFromSBV(rm, c, sort))
+	}
+	return eb.getOrCreateFP(mkinternalFPExprConvert(TY_FP_FROM_SBV, rm, bv, sort))
+}
+
+func (eb *ExprBuilder) FPFromUBV(rm RoundingMode, bv *BVExprPtr, sort FPSort) *FPExprPtr {
+	// Constant propagation
+	if bv.IsConst() {
+		c, _ := bv.GetConst()
+		return eb.fpConst(FPConstFromUBV(rm, c, sort))
+	}
+	return eb.getOrCreateFP(mkinternalFPExprConvert(TY_FP_FROM_UBV, rm, bv, sort))
+}
+
+func (eb *ExprBuilder) FPToFP(rm RoundingMode, e *FPExprPtr, sort FPSort) *FPExprPtr {
+	if e.Sort() == sort {
+		return e
+	}
+
+	// Constant propagation
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		return eb.fpConst(c.ToFP(rm, sort))
+	}
+	return eb.getOrCreateFP(mkinternalFPExprConvert(TY_FP_TO_FP, rm, e, sort))
+}
+
+func (eb *ExprBuilder) FPNeg(e *FPExprPtr) *FPExprPtr {
+	// Constant propagation
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		c.Neg()
+		return eb.fpConst(c)
+	}
+
+	// Double negation
+	if e.Kind() == TY_FP_NEG {
+		return e.e.(*internalFPExprArith).children[0]
+	}
+
+	ex, _ := mkinternalFPExprArith(TY_FP_NEG, RM_RNE, e)
+	return eb.getOrCreateFP(ex)
+}
+
+func (eb *ExprBuilder) FPAbs(e *FPExprPtr) *FPExprPtr {
+	// Constant propagation
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		c.Abs()
+		return eb.fpConst(c)
+	}
+
+	if e.Kind() == TY_FP_ABS {
+		return e
+	}
+	if e.Kind() == TY_FP_NEG {
+		e = e.e.(*internalFPExprArith).children[0]
+	}
+
+	ex, _ := mkinternalFPExprArith(TY_FP_ABS, RM_RNE, e)
+	return eb.getOrCreateFP(ex)
+}
+
+func (eb *ExprBuilder) FPSqrt(rm RoundingMode, e *FPExprPtr) *FPExprPtr {
+	// Constant propagation
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		c.Sqrt(rm)
+		return eb.fpConst(c)
+	}
+
+	ex, _ := mkinternalFPExprArith(TY_FP_SQRT, rm, e)
+	return eb.getOrCreateFP(ex)
+}
+
+func (eb *ExprBuilder) fpBinArith(ty int, rm RoundingMode, lhs, rhs *FPExprPtr) (*FPExprPtr, error) {
+	if lhs.Sort() != rhs.Sort() {
+		return nil, fmt.Errorf("different sorts")
+	}
+
+	// Constant propagation
+	if lhs.IsConst() && rhs.IsConst() {
+		c, _ := lhs.GetConst()
+		o, _ := rhs.GetConst()
+		var err error
+		switch ty {
+		case TY_FP_ADD:
+			err = c.Add(rm, o)
+		case TY_FP_SUB:
+			err = c.Sub(rm, o)
+		case TY_FP_MUL:
+			err = c.Mul(rm, o)
+		case TY_FP_DIV:
+			err = c.Div(rm, o)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return eb.fpConst(c), nil
+	}
+
+	ex, err := mkinternalFPExprArith(ty, rm, lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return eb.getOrCreateFP(ex), nil
+}
+
+func (eb *ExprBuilder) FPAdd(rm RoundingMode, lhs, rhs *FPExprPtr) (*FPExprPtr, error) {
+	return eb.fpBinArith(TY_FP_ADD, rm, lhs, rhs)
+}
+
+func (eb *ExprBuilder) FPSub(rm RoundingMode, lhs, rhs *FPExprPtr) (*FPExprPtr, error) {
+	return eb.fpBinArith(TY_FP_SUB, rm, lhs, rhs)
+}
+
+func (eb *ExprBuilder) FPMul(rm RoundingMode, lhs, rhs *FPExprPtr) (*FPExprPtr, error) {
+	return eb.fpBinArith(TY_FP_MUL, rm, lhs, rhs)
+}
+
+func (eb *ExprBuilder) FPDiv(rm RoundingMode, lhs, rhs *FPExprPtr) (*FPExprPtr, error) {
+	return eb.fpBinArith(TY_FP_DIV, rm, lhs, rhs)
+}
+
+func (eb *ExprBuilder) fpCmp(ty int, lhs, rhs *FPExprPtr) (*BoolExprPtr, error) {
+	if lhs.Sort() != rhs.Sort() {
+		return nil, fmt.Errorf("different sorts")
+	}
+
+	// Constant propagation
+	if lhs.IsConst() && rhs.IsConst() {
+		c, _ := lhs.GetConst()
+		o, _ := rhs.GetConst()
+		var r BoolConst
+		var err error
+		switch ty {
+		case TY_FP_LT:
+			r, err = c.Lt(o)
+		case TY_FP_LE:
+			r, err = c.Le(o)
+		case TY_FP_GT:
+			r, err = c.Gt(o)
+		case TY_FP_GE:
+			r, err = c.Ge(o)
+		case TY_FP_EQ:
+			r, err = c.Eq(o)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return eb.BoolVal(r.Value), nil
+	}
+
+	ex, err := mkinternalBoolExprFPCmp(ty, lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return eb.getOrCreateBool(ex), nil
+}
+
+func (eb *ExprBuilder) FPLt(lhs, rhs *FPExprPtr) (*BoolExprPtr, error) {
+	return eb.fpCmp(TY_FP_LT, lhs, rhs)
+}
+
+func (eb *ExprBuilder) FPLe(lhs, rhs *FPExprPtr) (*BoolExprPtr, error) {
+	return eb.fpCmp(TY_FP_LE, lhs, rhs)
+}
+
+func (eb *ExprBuilder) FPGt(lhs, rhs *FPExprPtr) (*BoolExprPtr, error) {
+	return eb.fpCmp(TY_FP_GT, lhs, rhs)
+}
+
+func (eb *ExprBuilder) FPGe(lhs, rhs *FPExprPtr) (*BoolExprPtr, error) {
+	return eb.fpCmp(TY_FP_GE, lhs, rhs)
+}
+
+// FPEq is the IEEE equality: NaN is different from itself and the two zeros
+// are equal
+func (eb *ExprBuilder) FPEq(lhs, rhs *FPExprPtr) (*BoolExprPtr, error) {
+	return eb.fpCmp(TY_FP_EQ, lhs, rhs)
+}
+
+func (eb *ExprBuilder) FPIsNaN(e *FPExprPtr) *BoolExprPtr {
+	eq, _ := eb.FPEq(e, e)
+	r, _ := eb.BoolNot(eq)
+	return r
+}
+
+// The encoding of NaN is unspecified, so it is never folded
+func (eb *ExprBuilder) FPToBits(e *FPExprPtr) *BVExprPtr {
+	// Constant propagation
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		if !c.IsNaN() {
+			return eb.getOrCreateBV(mkinternalBVVFromConst(*c.Bits()))
+		}
+	}
+	return eb.getOrCreateBV(mkinternalBVExprFromFP(TY_FP_TO_BITS, RM_RNE, e, e.Sort().Size()))
+}
+
+// The result of the conversion is unspecified for NaN, infinities and
+// out-of-range values, that are never folded
+func (eb *ExprBuilder) FPToUBV(rm RoundingMode, e *FPExprPtr, size uint) *BVExprPtr {
+	// Constant propagation
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		if v, ok := c.ToUBV(rm, size); ok {
+			return eb.getOrCreateBV(mkinternalBVVFromConst(*v))
+		}
+	}
+	return eb.getOrCreateBV(mkinternalBVExprFromFP(TY_FP_TO_UBV, rm, e, size))
+}
+
+func (eb *ExprBuilder) FPToSBV(rm RoundingMode, e *FPExprPtr, size uint) *BVExprPtr {
+	// Constant propagation
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		if v, ok := c.ToSBV(rm, size); ok {
+			return eb.getOrCreateBV(mkinternalBVVFromConst(*v))
+		}
+	}
+	return eb.getOrCreateBV(mkinternalBVExprFromFP(TY_FP_TO_SBV, rm, e, size))
+}
@@ -0,0 +1,177 @@
+package gosmt_test
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestFPBuilder(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	a := eb.FPV(1.5, gosmt.Float32Sort)
+	b := eb.FPV(2.25, gosmt.Float32Sort)
+	e, err := eb.FPAdd(gosmt.RM_RNE, a, b)
+	if isErr(t, err) {
+		return
+	}
+	if !e.IsConst() || e.String() != "3.75" {
+		t.Error("unexpected add")
+		return
+	}
+	if _, err := eb.FPAdd(gosmt.RM_RNE, a, eb.FPV(1, gosmt.Float64Sort)); err == nil {
+		t.Error("should fail")
+		return
+	}
+
+	x := eb.FPS("x", gosmt.Float32Sort)
+	if x.String() != "FPFromBits(x, FP8/24)" {
+		t.Error("unexpected symbol")
+		return
+	}
+	e, _ = eb.FPMul(gosmt.RM_RTZ, x, b)
+	if e.String() != "FPMul(RTZ, FPFromBits(x, FP8/24), 2.25)" {
+		t.Error("unexpected mul")
+		return
+	}
+	if eb.FPNeg(eb.FPNeg(x)).Id() != x.Id() {
+		t.Error("unexpected neg")
+		return
+	}
+
+	n, _ := eb.FPDiv(gosmt.RM_RNE, eb.FPV(0, gosmt.Float32Sort), eb.FPV(0, gosmt.Float32Sort))
+	if c := eb.FPIsNaN(n); c.String() != "T" {
+		t.Error("should be NaN")
+		return
+	}
+	if eb.FPToBits(n).IsConst() || eb.FPToUBV(gosmt.RM_RNE, eb.FPV(-1, gosmt.Float32Sort), 8).IsConst() {
+		t.Error("unspecified conversions should not be folded")
+		return
+	}
+	if v := eb.FPToSBV(gosmt.RM_RNE, b, 8); !v.IsConst() || v.String() != "0x2" {
+		t.Error("unexpected conversion")
+		return
+	}
+}
+
+func TestFPSolver(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+
+	x := eb.FPS("x", gosmt.Float32Sort)
+	c, _ := eb.FPGt(x, eb.FPV(1, gosmt.Float32Sort))
+	s.Add(c)
+	xx, _ := eb.FPMul(gosmt.RM_RNE, x, x)
+	c, _ = eb.FPLt(xx, eb.FPV(2, gosmt.Float32Sort))
+	s.Add(c)
+
+	bits := s.Eval(eb.BVS("x", 32))
+	if bits == nil {
+		t.Error("should be sat")
+		return
+	}
+	v := math.Float32frombits(uint32(bits.AsULong()))
+	if !(v > 1 && v*v < 2) {
+		t.Errorf("wrong model %v", v)
+		return
+	}
+
+	y := eb.FPS("y", gosmt.Float64Sort)
+	c, _ = eb.Eq(eb.FPToSBV(gosmt.RM_RTZ, y, 32), eb.BVV(-42, 32))
+	s.Add(c)
+	// the conversion of infinities is unspecified
+	c, _ = eb.FPGt(y, eb.FPV(-100, gosmt.Float64Sort))
+	s.Add(c)
+	c, _ = eb.FPLt(y, eb.FPV(-42.5, gosmt.Float64Sort))
+	s.Add(c)
+	bits = s.Eval(eb.FPToBits(y))
+	if w := math.Float64frombits(bits.AsULong()); !(w < -42.5 && w > -43) {
+		t.Errorf("wrong model %v", w)
+		return
+	}
+
+	out := strings.Builder{}
+	s.DumpSMTLIB2(&out)
+	if !strings.Contains(out.String(), "(set-logic QF_BVFP)") ||
+		!strings.Contains(out.String(), "((_ to_fp 11 53) y)") ||
+		!strings.Contains(out.String(), "((_ fp.to_sbv 32) RTZ ") {
+		t.Error("unexpected dump")
+		return
+	}
+
+	bs := gosmt.NewBitblastSolver(eb)
+	bs.Add(c)
+	if r, err := bs.Satisfiable(); r != gosmt.RESULT_UNKNOWN || err == nil {
+		t.Error("should be unknown")
+		return
+	}
+}
+
+func TestFPZ3CrossCheck(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+	half := gosmt.FPSort{EBits: 5, SBits: 11}
+	rms := []gosmt.RoundingMode{gosmt.RM_RNE, gosmt.RM_RNA, gosmt.RM_RTP, gosmt.RM_RTN, gosmt.RM_RTZ}
+
+	x := eb.FPS("x", half)
+	y := eb.FPS("y", half)
+	r := rand.New(rand.NewSource(7))
+	for i := 0; i < 40; i++ {
+		cx := eb.BVV(int64(r.Intn(1<<16)), 16)
+		cy := eb.BVV(int64(r.Intn(1<<16)), 16)
+		s.Push()
+		c, _ := eb.Eq(eb.BVS("x", 16), cx)
+		s.Add(c)
+		c, _ = eb.Eq(eb.BVS("y", 16), cy)
+		s.Add(c)
+		fx, _ := eb.FPFromBits(cx, half)
+		fy, _ := eb.FPFromBits(cy, half)
+
+		for _, rm := range rms {
+			symbolic := make([]*gosmt.FPExprPtr, 0)
+			concrete := make([]*gosmt.FPExprPtr, 0)
+			for _, op := range []func(rm gosmt.RoundingMode, a, b *gosmt.FPExprPtr) (*gosmt.FPExprPtr, error){
+				eb.FPAdd, eb.FPSub, eb.FPMul, eb.FPDiv,
+			} {
+				e, _ := op(rm, x, y)
+				symbolic = append(symbolic, e)
+				e, _ = op(rm, fx, fy)
+				concrete = append(concrete, e)
+			}
+			symbolic = append(symbolic, eb.FPSqrt(rm, x), eb.FPToFP(rm, eb.FPFromSBV(rm, eb.BVS("y", 16), gosmt.Float32Sort), half))
+			concrete = append(concrete, eb.FPSqrt(rm, fx), eb.FPToFP(rm, eb.FPFromSBV(rm, cy, gosmt.Float32Sort), half))
+
+			for j := range symbolic {
+				if !concrete[j].IsConst() {
+					t.Error("should be constant")
+					return
+				}
+				var differ *gosmt.BoolExprPtr
+				if cj, _ := concrete[j].GetConst(); cj.IsNaN() {
+					differ, _ = eb.BoolNot(eb.FPIsNaN(symbolic[j]))
+				} else {
+					eq, _ := eb.Eq(eb.FPToBits(symbolic[j]), eb.FPToBits(concrete[j]))
+					differ, _ = eb.BoolNot(eq)
+				}
+				if s.CheckSat(differ) != gosmt.RESULT_UNSAT {
+					t.Errorf("%s %s: %s", rm.String(), symbolic[j].String(), concrete[j].String())
+					return
+				}
+			}
+
+			c, _ := eb.FPLe(x, y)
+			cc, _ := eb.FPLe(fx, fy)
+			if v, _ := cc.GetConst(); v {
+				c, _ = eb.BoolNot(c)
+			}
+			if s.CheckSat(c) != gosmt.RESULT_UNSAT {
+				t.Errorf("fp.leq %s %s", fx.String(), fy.String())
+				return
+			}
+		}
+		s.Pop(1)
+	}
+}
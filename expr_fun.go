@@ -0,0 +1,242 @@
+package gosmt
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+/*
+ *   Public Interface
+ */
+
+type FunDecl struct {
+	name     string
+	argSizes []uint
+	retSize  uint
+}
+
+func (f *FunDecl) Name() string {
+	return f.name
+}
+
+func (f *FunDecl) ArgSizes() []uint {
+	return append([]uint{}, f.argSizes...)
+}
+
+func (f *FunDecl) RetSize() uint {
+	return f.retSize
+}
+
+func (f *FunDecl) String() string {
+	sizes := make([]string, len(f.argSizes))
+	for i, s := range f.argSizes {
+		sizes[i] = fmt.Sprintf("%d", s)
+	}
+	return fmt.Sprintf("%s: (%s) -> %d", f.name, strings.Join(sizes, ", "), f.retSize)
+}
+
+type FunEntry struct {
+	Args  []*BVConst
+	Value *BVConst
+}
+
+// A FunInterp is a finite interpretation of an uninterpreted function: the
+// applications listed in Entries take the corresponding value, every other
+// application takes the Default one
+type FunInterp struct {
+	Entries []FunEntry
+	Default *BVConst
+}
+
+func funArgsKey(args []*BVConst) string {
+	key := make([]string, len(args))
+	for i, a := range args {
+		key[i] = a.String()
+	}
+	return strings.Join(key, ",")
+}
+
+func (f *FunInterp) Apply(args []*BVConst) *BVConst {
+	key := funArgsKey(args)
+	for _, entry := range f.Entries {
+		if funArgsKey(entry.Args) == key {
+			return entry.Value.Copy()
+		}
+	}
+	return f.Default.Copy()
+}
+
+func (f *FunInterp) String() string {
+	b := strings.Builder{}
+	b.WriteString("[")
+	for _, entry := range f.Entries {
+		args := make([]string, len(entry.Args))
+		for i, a := range entry.Args {
+			args[i] = a.String()
+		}
+		b.WriteString(fmt.Sprintf("(%s) -> %s, ", strings.Join(args, ", "), entry.Value.String()))
+	}
+	b.WriteString(fmt.Sprintf("else -> %s]", f.Default.String()))
+	return b.String()
+}
+
+// funInterpBuilder collects the entries of the interpretations, discarding
+// the duplicated applications
+type funInterpBuilder struct {
+	interps map[string]*FunInterp
+	seen    map[string]bool
+}
+
+func newFunInterpBuilder() *funInterpBuilder {
+	return &funInterpBuilder{
+		interps: make(map[string]*FunInterp),
+		seen:    make(map[string]bool),
+	}
+}
+
+func (b *funInterpBuilder) add(fun *FunDecl, args []*BVConst, value *BVConst) {
+	key := fun.name + "(" + funArgsKey(args) + ")"
+	if b.seen[key] {
+		return
+	}
+	b.seen[key] = true
+
+	interp, ok := b.interps[fun.name]
+	if !ok {
+		interp = &FunInterp{Entries: make([]FunEntry, 0), Default: MakeBVConst(0, fun.retSize)}
+		b.interps[fun.name] = interp
+	}
+	interp.Entries = append(interp.Entries, FunEntry{Args: args, Value: value})
+}
+
+/*
+ *  TY_APPLY
+ */
+
+type internalBVExprApply struct {
+	fun  *FunDecl
+	args []*BVExprPtr
+}
+
+func mkinternalBVExprApply(fun *FunDecl, args []*BVExprPtr) (*internalBVExprApply, error) {
+	if len(args) != len(fun.argSizes) {
+		return nil, fmt.Errorf("mkinternalBVExprApply(): wrong number of arguments")
+	}
+	for i, a := range args {
+		if a.Size() != fun.argSizes[i] {
+			return nil, fmt.Errorf("mkinternalBVExprApply(): invalid sizes")
+		}
+	}
+	return &internalBVExprApply{fun: fun, args: args}, nil
+}
+
+func (e *internalBVExprApply) String() string {
+	args := make([]string, len(e.args))
+	for i, a := range e.args {
+		args[i] = a.String()
+	}
+	return fmt.Sprintf("%s(%s)", e.fun.name, strings.Join(args, ", "))
+}
+
+func (e *internalBVExprApply) size() uint {
+	return e.fun.retSize
+}
+
+func (e *internalBVExprApply) subexprs() []internalExpr {
+	res := make([]internalExpr, len(e.args))
+	for i, a := range e.args {
+		res[i] = a.e
+	}
+	return res
+}
+
+func (e *internalBVExprApply) kind() int {
+	return TY_APPLY
+}
+
+func (e *internalBVExprApply) hash() uint64 {
+	ptrs := make([]uintptr, 0, len(e.args)+1)
+	ptrs = append(ptrs, uintptr(unsafe.Pointer(e.fun)))
+	for _, a := range e.args {
+		ptrs = append(ptrs, a.e.rawPtr())
+	}
+	return hashPtrs("TY_APPLY", ptrs...)
+}
+
+func (e *internalBVExprApply) deepEq(other internalBVExpr) bool {
+	if other.kind() != TY_APPLY {
+		return false
+	}
+	oe := other.(*internalBVExprApply)
+	if oe.fun != e.fun {
+		return false
+	}
+	for i := range e.args {
+		if !e.args[i].e.deepEq(oe.args[i].e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *internalBVExprApply) shallowEq(other internalBVExpr) bool {
+	if other.kind() != TY_APPLY {
+		return false
+	}
+	oe := other.(*internalBVExprApply)
+	if oe.fun != e.fun {
+		return false
+	}
+	for i := range e.args {
+		if e.args[i].e.rawPtr() != oe.args[i].e.rawPtr() {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *internalBVExprApply) isLeaf() bool {
+	return false
+}
+
+func (e *internalBVExprApply) rawPtr() uintptr {
+	return uintptr(unsafe.Pointer(e))
+}
+
+/*
+ *  Builder
+ */
+
+func (eb *ExprBuilder) DeclareFun(name string, argSizes []uint, retSize uint) (*FunDecl, error) {
+	if len(argSizes) == 0 {
+		return nil, fmt.Errorf("a function must have at least one argument")
+	}
+
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	if f, ok := eb.funs[name]; ok {
+		if f.retSize != retSize || len(f.argSizes) != len(argSizes) {
+			return nil, fmt.Errorf("%s already declared with a different signature", name)
+		}
+		for i := range argSizes {
+			if f.argSizes[i] != argSizes[i] {
+				return nil, fmt.Errorf("%s already declared with a different signature", name)
+			}
+		}
+		return f, nil
+	}
+
+	f := &FunDecl{name: name, argSizes: append([]uint{}, argSizes...), retSize: retSize}
+	eb.funs[name] = f
+	return f, nil
+}
+
+func (eb *ExprBuilder) Apply(fun *FunDecl, args ...*BVExprPtr) (*BVExprPtr, error) {
+	ex, err := mkinternalBVExprApply(fun, append([]*BVExprPtr{}, args...))
+	if err != nil {
+		return nil, err
+	}
+	return eb.getOrCreateBV(ex), nil
+}
@@ -0,0 +1,135 @@
+package gosmt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestFunDecl(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	f, err := eb.DeclareFun("f", []uint{32, 8}, 16)
+	if isErr(t, err) {
+		return
+	}
+	g, err := eb.DeclareFun("f", []uint{32, 8}, 16)
+	if isErr(t, err) {
+		return
+	}
+	if f != g {
+		t.Error("should be the same declaration")
+		return
+	}
+	if _, err := eb.DeclareFun("f", []uint{32}, 16); err == nil {
+		t.Error("should fail")
+		return
+	}
+
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 8)
+	e1, _ := eb.Apply(f, a, b)
+	e2, _ := eb.Apply(f, a, b)
+	if e1.Id() != e2.Id() {
+		t.Error("should be the same object")
+		return
+	}
+	if e1.String() != "f(a, b)" || e1.Size() != 16 {
+		t.Error("unexpected application")
+		return
+	}
+	if _, err := eb.Apply(f, a); err == nil {
+		t.Error("should fail")
+		return
+	}
+	if _, err := eb.Apply(f, b, a); err == nil {
+		t.Error("should fail")
+		return
+	}
+}
+
+func TestFunSolver(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		h, _ := eb.DeclareFun("h", []uint{32}, 32)
+		a := eb.BVS("a", 32)
+		b := eb.BVS("b", 32)
+
+		ha, _ := eb.Apply(h, a)
+		hb, _ := eb.Apply(h, b)
+		c, _ := eb.Eq(ha, eb.BVV(0xdead, 32))
+		s.Add(c)
+		c, _ = eb.Eq(hb, eb.BVV(0xbeef, 32))
+		s.Add(c)
+
+		c, _ = eb.Eq(a, b)
+		if s.CheckSat(c) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+
+		c, _ = eb.Eq(a, eb.BVV(1, 32))
+		s.Add(c)
+		if v := s.Eval(ha); v.AsULong() != 0xdead {
+			t.Error("unexpected value")
+			return
+		}
+
+		interp, ok := s.FunModel()["h"]
+		if !ok || len(interp.Entries) != 2 {
+			t.Error("unable to find the interpretation")
+			return
+		}
+		if interp.Apply([]*gosmt.BVConst{gosmt.MakeBVConst(1, 32)}).AsULong() != 0xdead {
+			t.Error("unexpected interpretation")
+			return
+		}
+		bv := s.Model()["b"]
+		if interp.Apply([]*gosmt.BVConst{bv}).AsULong() != 0xbeef {
+			t.Error("unexpected interpretation")
+			return
+		}
+
+		out := strings.Builder{}
+		s.DumpSMTLIB2(&out)
+		if !strings.Contains(out.String(), "(set-logic QF_UFBV)") ||
+			!strings.Contains(out.String(), "(declare-fun h ((_ BitVec 32)) (_ BitVec 32))") ||
+			!strings.Contains(out.String(), "(h a)") {
+			t.Error("unexpected dump")
+			return
+		}
+	}
+}
+
+func TestFunDependencies(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		f, _ := eb.DeclareFun("f", []uint{32}, 32)
+		x := eb.BVS("x", 32)
+
+		// the query has no bit-vector symbols, it depends on the constraints
+		// only through the function
+		e, _ := eb.Apply(f, eb.BVV(3, 32))
+		q, _ := eb.Eq(e, eb.BVV(6, 32))
+		if s.CheckSat(q) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+
+		e, _ = eb.Apply(f, x)
+		c, _ := eb.Eq(e, eb.BVV(5, 32))
+		s.Add(c)
+		c, _ = eb.Eq(x, eb.BVV(3, 32))
+		s.Add(c)
+		if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		e, _ = eb.Apply(f, eb.BVV(3, 32))
+		if v := s.Eval(e); v == nil || v.AsULong() != 5 {
+			t.Error("unexpected value")
+			return
+		}
+	}
+}
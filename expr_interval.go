@@ -0,0 +1,629 @@
+package gosmt
+
+import (
+	"fmt"
+	"math/big"
+)
+
+/*
+ *  A strided interval represents the unsigned values Low, Low+Stride, ...,
+ *  High. The interval never wraps around, and the stride is zero only when
+ *  Low == High
+ */
+type Interval struct {
+	Size   uint
+	Low    *big.Int
+	High   *big.Int
+	Stride *big.Int
+}
+
+// maximum number of times the constraints are used to refine the intervals
+// of the symbols
+const intervalRounds = 4
+
+func newInterval(size uint, low, high, stride *big.Int) *Interval {
+	if low.Cmp(high) == 0 {
+		return &Interval{Size: size, Low: low, High: new(big.Int).Set(low), Stride: big.NewInt(0)}
+	}
+	if stride == nil || stride.Sign() == 0 {
+		stride = big.NewInt(1)
+	}
+	// make high reachable from low
+	d := new(big.Int).Sub(high, low)
+	d.Mod(d, stride)
+	return &Interval{Size: size, Low: low, High: d.Sub(high, d), Stride: stride}
+}
+
+func fullInterval(size uint) *Interval {
+	return &Interval{Size: size, Low: big.NewInt(0), High: makeMask(size), Stride: big.NewInt(1)}
+}
+
+func constInterval(c *BVConst) *Interval {
+	return newInterval(c.Size, new(big.Int).Set(c.value), new(big.Int).Set(c.value), nil)
+}
+
+/*
+ *  fitInterval returns the interval of the values low, low+stride, ...,
+ *  high truncated to size bits. When the values overflow, only their
+ *  remainder modulo the largest power of two dividing the stride is kept
+ */
+func fitInterval(size uint, low, high, stride *big.Int) *Interval {
+	if high.Cmp(makeMask(size)) <= 0 {
+		return newInterval(size, low, high, stride)
+	}
+	g := size
+	if low.Cmp(high) != 0 && stride.Sign() != 0 {
+		g = min(size, stride.TrailingZeroBits())
+	}
+	r := new(big.Int).And(low, makeMask(g))
+	if g == size {
+		return newInterval(size, r, new(big.Int).Set(r), nil)
+	}
+	high = new(big.Int).Sub(makeMask(size), makeMask(g))
+	return newInterval(size, r, high.Add(high, r), new(big.Int).Lsh(one, g))
+}
+
+func gcd(values ...*big.Int) *big.Int {
+	r := big.NewInt(0)
+	for _, v := range values {
+		r.GCD(nil, nil, r, v)
+	}
+	return r
+}
+
+func minBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return a
+	}
+	return b
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) > 0 {
+		return a
+	}
+	return b
+}
+
+func (iv *Interval) IsConst() bool {
+	return iv.Low.Cmp(iv.High) == 0
+}
+
+func (iv *Interval) GetConst() (*BVConst, error) {
+	if !iv.IsConst() {
+		return nil, fmt.Errorf("not a constant")
+	}
+	return MakeBVConstFromBigint(new(big.Int).Set(iv.Low), iv.Size), nil
+}
+
+// Count returns the number of values in the interval
+func (iv *Interval) Count() *big.Int {
+	if iv.IsConst() {
+		return big.NewInt(1)
+	}
+	n := new(big.Int).Sub(iv.High, iv.Low)
+	n.Div(n, iv.Stride)
+	return n.Add(n, one)
+}
+
+func (iv *Interval) Contains(v *BVConst) bool {
+	return v.Size == iv.Size && iv.contains(v.value)
+}
+
+func (iv *Interval) contains(v *big.Int) bool {
+	if v.Cmp(iv.Low) < 0 || v.Cmp(iv.High) > 0 {
+		return false
+	}
+	if iv.IsConst() {
+		return true
+	}
+	d := new(big.Int).Sub(v, iv.Low)
+	return d.Mod(d, iv.Stride).Sign() == 0
+}
+
+func (iv *Interval) String() string {
+	if iv.Stride.Cmp(one) <= 0 {
+		return fmt.Sprintf("[0x%x, 0x%x]", iv.Low, iv.High)
+	}
+	return fmt.Sprintf("%d[0x%x, 0x%x]", iv.Stride, iv.Low, iv.High)
+}
+
+// signedKeys returns the interval of the values with the sign bit flipped,
+// whose unsigned order is the signed order of the values
+func (iv *Interval) signedKeys() *Interval {
+	half := new(big.Int).Lsh(one, iv.Size-1)
+	if iv.High.Cmp(half) < 0 {
+		return newInterval(iv.Size, new(big.Int).Add(iv.Low, half), new(big.Int).Add(iv.High, half), iv.Stride)
+	}
+	if iv.Low.Cmp(half) >= 0 {
+		return newInterval(iv.Size, new(big.Int).Sub(iv.Low, half), new(big.Int).Sub(iv.High, half), iv.Stride)
+	}
+	return fullInterval(iv.Size)
+}
+
+// intersect returns the values of the interval in [lo, hi], nil if there
+// are none
+func (iv *Interval) intersect(lo, hi *big.Int) *Interval {
+	low := new(big.Int).Set(maxBig(iv.Low, lo))
+	high := new(big.Int).Set(minBig(iv.High, hi))
+	if !iv.IsConst() {
+		// round low up to the next value of the interval
+		d := new(big.Int).Sub(low, iv.Low)
+		d.Mod(d, iv.Stride)
+		if d.Sign() != 0 {
+			low.Add(low, iv.Stride)
+			low.Sub(low, d)
+		}
+	}
+	if low.Cmp(high) > 0 {
+		return nil
+	}
+	return newInterval(iv.Size, low, high, iv.Stride)
+}
+
+func intervalAdd(a, b *Interval) *Interval {
+	low := new(big.Int).Add(a.Low, b.Low)
+	high := new(big.Int).Add(a.High, b.High)
+	return fitInterval(a.Size, low, high, gcd(a.Stride, b.Stride))
+}
+
+func intervalMul(a, b *Interval) *Interval {
+	// (a.Low + i*a.Stride) * (b.Low + j*b.Stride)
+	stride := gcd(new(big.Int).Mul(a.Low, b.Stride), new(big.Int).Mul(b.Low, a.Stride),
+		new(big.Int).Mul(a.Stride, b.Stride))
+	low := new(big.Int).Mul(a.Low, b.Low)
+	high := new(big.Int).Mul(a.High, b.High)
+	return fitInterval(a.Size, low, high, stride)
+}
+
+func intervalShift(kind int, a, amount *Interval) *Interval {
+	size := a.Size
+	bound := big.NewInt(int64(size))
+	lo := uint(minBig(amount.Low, bound).Uint64())
+	hi := uint(minBig(amount.High, bound).Uint64())
+
+	switch kind {
+	case TY_SHL:
+		if lo != hi {
+			return fullInterval(size)
+		}
+		if lo == size {
+			return newInterval(size, big.NewInt(0), big.NewInt(0), nil)
+		}
+		p := new(big.Int).Lsh(one, lo)
+		return intervalMul(a, newInterval(size, p, new(big.Int).Set(p), nil))
+	case TY_ASHR:
+		// only non negative values are shifted like in LShr
+		if uint(a.High.BitLen()) == size {
+			return fullInterval(size)
+		}
+		fallthrough
+	case TY_LSHR:
+		low := new(big.Int).Rsh(a.Low, hi)
+		high := new(big.Int).Rsh(a.High, lo)
+		stride := big.NewInt(1)
+		if lo == hi && !a.IsConst() && a.Stride.TrailingZeroBits() >= lo {
+			stride.Rsh(a.Stride, lo)
+		}
+		return newInterval(size, low, high, stride)
+	}
+	return fullInterval(size)
+}
+
+func intervalDiv(kind int, a, b *Interval) *Interval {
+	size := a.Size
+	switch kind {
+	case TY_UDIV:
+		if b.Low.Sign() == 0 {
+			return fullInterval(size)
+		}
+		return newInterval(size, new(big.Int).Div(a.Low, b.High), new(big.Int).Div(a.High, b.Low), nil)
+	case TY_UREM:
+		// the remainder is not greater than the dividend, and it is smaller
+		// than the divisor if this is not zero
+		if b.Low.Sign() == 0 {
+			return newInterval(size, big.NewInt(0), new(big.Int).Set(a.High), nil)
+		}
+		if a.High.Cmp(b.Low) < 0 {
+			return a
+		}
+		high := new(big.Int).Sub(b.High, one)
+		return newInterval(size, big.NewInt(0), high.Set(minBig(a.High, high)), nil)
+	}
+	return fullInterval(size)
+}
+
+func intervalBinOp(kind int, a, b *Interval) *Interval {
+	size := a.Size
+	switch kind {
+	case TY_ADD:
+		return intervalAdd(a, b)
+	case TY_MUL:
+		return intervalMul(a, b)
+	case TY_AND:
+		return newInterval(size, big.NewInt(0), new(big.Int).Set(minBig(a.High, b.High)), nil)
+	case TY_OR:
+		// the result has no more bits than the largest operand
+		high := makeMask(uint(maxBig(a.High, b.High).BitLen()))
+		return newInterval(size, new(big.Int).Set(maxBig(a.Low, b.Low)), high, nil)
+	case TY_XOR:
+		high := makeMask(uint(maxBig(a.High, b.High).BitLen()))
+		return newInterval(size, big.NewInt(0), high, nil)
+	}
+	return fullInterval(size)
+}
+
+type intervalAnalysis struct {
+	syms       map[uintptr]*Interval
+	bvs        map[uintptr]*Interval
+	changed    bool
+	infeasible bool
+}
+
+/*
+ *  newIntervalAnalysis refines the intervals of the symbols using the
+ *  constraints. If they cannot be satisfied by the intervals the analysis
+ *  is marked as infeasible
+ */
+func newIntervalAnalysis(constraints []*BoolExprPtr) *intervalAnalysis {
+	ia := &intervalAnalysis{
+		syms: make(map[uintptr]*Interval),
+		bvs:  make(map[uintptr]*Interval),
+	}
+	for round := 0; round < intervalRounds; round++ {
+		ia.changed = false
+		for _, c := range constraints {
+			ia.refine(c, true)
+			if ia.infeasible {
+				return ia
+			}
+		}
+		if !ia.changed {
+			break
+		}
+	}
+	for _, c := range constraints {
+		if ia.bool(c) == knownFalse {
+			ia.infeasible = true
+			break
+		}
+	}
+	return ia
+}
+
+// Interval returns a strided interval containing every value of e
+func (eb *ExprBuilder) Interval(e *BVExprPtr) *Interval {
+	return newIntervalAnalysis(nil).bv(e)
+}
+
+func (ia *intervalAnalysis) bv(e *BVExprPtr) *Interval {
+	if r, ok := ia.bvs[e.Id()]; ok {
+		return r
+	}
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		return constInterval(c)
+	}
+
+	size := e.Size()
+	var r *Interval
+	switch ex := e.e.(type) {
+	case *internalBVS:
+		r = fullInterval(size)
+		if s, ok := ia.syms[e.Id()]; ok {
+			r = s
+		}
+	case *internalBVExprExtract:
+		c := ia.bv(ex.child)
+		c = intervalShift(TY_LSHR, c, constInterval(MakeBVConst(int64(ex.low), c.Size)))
+		r = fitInterval(size, c.Low, c.High, c.Stride)
+	case *internalBVExprConcat:
+		r = ia.bv(ex.children[0])
+		for _, child := range ex.children[1:] {
+			c := ia.bv(child)
+			low := new(big.Int).Lsh(r.Low, c.Size)
+			high := new(big.Int).Lsh(r.High, c.Size)
+			stride := gcd(new(big.Int).Lsh(r.Stride, c.Size), c.Stride)
+			r = newInterval(r.Size+c.Size, low.Add(low, c.Low), high.Add(high, c.High), stride)
+		}
+	case *internalBVExprExtend:
+		c := ia.bv(ex.child)
+		switch {
+		case !ex.signed || uint(c.High.BitLen()) < c.Size:
+			r = newInterval(size, c.Low, c.High, c.Stride)
+		case uint(c.Low.BitLen()) == c.Size:
+			// the values are all negative
+			ext := new(big.Int).Sub(makeMask(size), makeMask(c.Size))
+			r = newInterval(size, new(big.Int).Add(c.Low, ext), new(big.Int).Add(c.High, ext), c.Stride)
+		default:
+			r = fullInterval(size)
+		}
+	case *internalBVExprITE:
+		switch ia.bool(ex.cond) {
+		case knownTrue:
+			r = ia.bv(ex.iftrue)
+		case knownFalse:
+			r = ia.bv(ex.iffalse)
+		default:
+			t := ia.bv(ex.iftrue)
+			f := ia.bv(ex.iffalse)
+			d := new(big.Int).Sub(t.Low, f.Low)
+			stride := gcd(t.Stride, f.Stride, d.Abs(d))
+			r = newInterval(size, new(big.Int).Set(minBig(t.Low, f.Low)), new(big.Int).Set(maxBig(t.High, f.High)), stride)
+		}
+	case *internalBVExprUnArithmetic:
+		c := ia.bv(ex.child)
+		mask := makeMask(size)
+		if e.Kind() == TY_NOT {
+			r = newInterval(size, new(big.Int).Sub(mask, c.High), new(big.Int).Sub(mask, c.Low), c.Stride)
+		} else {
+			// 2^size - x, that overflows only for x = 0
+			mod := mask.Add(mask, one)
+			r = fitInterval(size, new(big.Int).Sub(mod, c.High), new(big.Int).Sub(mod, c.Low), c.Stride)
+		}
+	case *internalBVExprBinArithmetic:
+		children := make([]*Interval, len(ex.children))
+		for i, child := range ex.children {
+			children[i] = ia.bv(child)
+		}
+		switch e.Kind() {
+		case TY_SHL, TY_LSHR, TY_ASHR:
+			r = intervalShift(e.Kind(), children[0], children[1])
+		case TY_UDIV, TY_UREM, TY_SDIV, TY_SREM:
+			r = intervalDiv(e.Kind(), children[0], children[1])
+		default:
+			r = children[0]
+			for _, c := range children[1:] {
+				r = intervalBinOp(e.Kind(), r, c)
+			}
+		}
+	default:
+		r = fullInterval(size)
+	}
+	ia.bvs[e.Id()] = r
+	return r
+}
+
+func (ia *intervalAnalysis) bool(e *BoolExprPtr) int {
+	if e.IsConst() {
+		v, _ := e.GetConst()
+		if v {
+			return knownTrue
+		}
+		return knownFalse
+	}
+
+	r := knownUnknown
+	switch ex := e.e.(type) {
+	case *internalBoolUnArithmetic:
+		r = ia.bool(ex.child)
+		if r != knownUnknown {
+			r = 1 - r
+		}
+	case *internalBoolExprNaryOp:
+		// the absorbing value of the operation
+		absorbing := knownFalse
+		if e.Kind() == TY_BOOL_OR {
+			absorbing = knownTrue
+		}
+		r = 1 - absorbing
+		for _, child := range ex.children {
+			c := ia.bool(child)
+			if c == absorbing {
+				r = absorbing
+				break
+			}
+			if c == knownUnknown {
+				r = knownUnknown
+			}
+		}
+	case *internalBoolExprCmp:
+		r = intervalCmp(e.Kind(), ia.bv(ex.lhs), ia.bv(ex.rhs))
+	}
+	return r
+}
+
+func intervalCmp(kind int, a, b *Interval) int {
+	switch kind {
+	case TY_EQ:
+		if a.High.Cmp(b.Low) < 0 || b.High.Cmp(a.Low) < 0 {
+			return knownFalse
+		}
+		if a.IsConst() && b.IsConst() {
+			return knownTrue
+		}
+		if (a.IsConst() && !b.contains(a.Low)) || (b.IsConst() && !a.contains(b.Low)) {
+			return knownFalse
+		}
+	case TY_SLT, TY_SLE, TY_SGT, TY_SGE:
+		return intervalCmp(kind-TY_SLT+TY_ULT, a.signedKeys(), b.signedKeys())
+	case TY_UGT:
+		return intervalCmp(TY_ULT, b, a)
+	case TY_UGE:
+		return intervalCmp(TY_ULE, b, a)
+	case TY_ULT:
+		if a.High.Cmp(b.Low) < 0 {
+			return knownTrue
+		}
+		if a.Low.Cmp(b.High) >= 0 {
+			return knownFalse
+		}
+	case TY_ULE:
+		if a.High.Cmp(b.Low) <= 0 {
+			return knownTrue
+		}
+		if a.Low.Cmp(b.High) > 0 {
+			return knownFalse
+		}
+	}
+	return knownUnknown
+}
+
+var negatedCmp = map[int]int{
+	TY_ULT: TY_UGE, TY_ULE: TY_UGT, TY_UGT: TY_ULE, TY_UGE: TY_ULT,
+	TY_SLT: TY_SGE, TY_SLE: TY_SGT, TY_SGT: TY_SLE, TY_SGE: TY_SLT,
+}
+
+// refine restricts the intervals of the symbols assuming that e has the
+// given value
+func (ia *intervalAnalysis) refine(e *BoolExprPtr, value bool) {
+	switch ex := e.e.(type) {
+	case *internalBoolUnArithmetic:
+		ia.refine(ex.child, !value)
+	case *internalBoolExprNaryOp:
+		// only a true conjunction or a false disjunction constrains every
+		// child
+		if (e.Kind() == TY_BOOL_AND) == value {
+			for _, child := range ex.children {
+				ia.refine(child, value)
+			}
+		}
+	case *internalBoolExprCmp:
+		kind := e.Kind()
+		if kind == TY_EQ {
+			if value {
+				ia.refineEq(ex.lhs, ex.rhs)
+			} else {
+				ia.refineNe(ex.lhs, ex.rhs)
+			}
+			return
+		}
+		if !value {
+			kind = negatedCmp[kind]
+		}
+		ia.refineCmp(kind, ex.lhs, ex.rhs)
+	}
+}
+
+func (ia *intervalAnalysis) refineEq(lhs, rhs *BVExprPtr) {
+	a := ia.bv(lhs)
+	b := ia.bv(rhs)
+	ia.restrict(lhs, b.Low, b.High)
+	ia.restrict(rhs, a.Low, a.High)
+}
+
+func (ia *intervalAnalysis) refineNe(lhs, rhs *BVExprPtr) {
+	a := ia.bv(lhs)
+	b := ia.bv(rhs)
+	if b.IsConst() {
+		ia.exclude(lhs, b.Low)
+	}
+	if a.IsConst() {
+		ia.exclude(rhs, a.Low)
+	}
+}
+
+func (ia *intervalAnalysis) refineCmp(kind int, lhs, rhs *BVExprPtr) {
+	switch kind {
+	case TY_UGT, TY_UGE, TY_SGT, TY_SGE:
+		ia.refineCmp(kind-2, rhs, lhs)
+		return
+	}
+
+	a := ia.bv(lhs)
+	b := ia.bv(rhs)
+	signed := kind == TY_SLT || kind == TY_SLE
+	if signed {
+		a = a.signedKeys()
+		b = b.signedKeys()
+	}
+	// lhs <= aHigh and rhs >= bLow
+	aHigh := new(big.Int).Set(b.High)
+	bLow := new(big.Int).Set(a.Low)
+	if kind == TY_ULT || kind == TY_SLT {
+		aHigh.Sub(aHigh, one)
+		bLow.Add(bLow, one)
+	}
+	if aHigh.Sign() < 0 {
+		ia.infeasible = true
+		return
+	}
+	zero := big.NewInt(0)
+	mask := makeMask(a.Size)
+	if signed {
+		ia.restrictSigned(lhs, zero, aHigh)
+		ia.restrictSigned(rhs, bLow, mask)
+	} else {
+		ia.restrict(lhs, zero, aHigh)
+		ia.restrict(rhs, bLow, mask)
+	}
+}
+
+// restrictSigned restricts e to the values whose keys are in [lo, hi]
+func (ia *intervalAnalysis) restrictSigned(e *BVExprPtr, lo, hi *big.Int) {
+	half := new(big.Int).Lsh(one, e.Size()-1)
+	if lo.Cmp(makeMask(e.Size())) > 0 {
+		ia.infeasible = true
+		return
+	}
+	if hi.Cmp(half) < 0 {
+		ia.restrict(e, new(big.Int).Add(lo, half), new(big.Int).Add(hi, half))
+		return
+	}
+	if lo.Cmp(half) >= 0 {
+		ia.restrict(e, new(big.Int).Sub(lo, half), new(big.Int).Sub(hi, half))
+		return
+	}
+
+	// the values are [lo+half, 2^size-1] and [0, hi-half], restrict e only
+	// if it is contained in one of them
+	cur := ia.bv(e)
+	negatives := cur.intersect(new(big.Int).Add(lo, half), makeMask(e.Size()))
+	positives := cur.intersect(big.NewInt(0), new(big.Int).Sub(hi, half))
+	switch {
+	case negatives == nil && positives == nil:
+		ia.infeasible = true
+	case negatives == nil:
+		ia.restrict(e, positives.Low, positives.High)
+	case positives == nil:
+		ia.restrict(e, negatives.Low, negatives.High)
+	}
+}
+
+// exclude removes v from the interval of e if it is one of its bounds
+func (ia *intervalAnalysis) exclude(e *BVExprPtr, v *big.Int) {
+	cur := ia.bv(e)
+	stride := maxBig(cur.Stride, one)
+	if cur.Low.Cmp(v) == 0 {
+		ia.restrict(e, new(big.Int).Add(cur.Low, stride), cur.High)
+	} else if cur.High.Cmp(v) == 0 {
+		ia.restrict(e, cur.Low, new(big.Int).Sub(cur.High, stride))
+	}
+}
+
+// restrict restricts e to the values in [lo, hi], propagating the
+// restriction to the symbols
+func (ia *intervalAnalysis) restrict(e *BVExprPtr, lo, hi *big.Int) {
+	cur := ia.bv(e)
+	r := cur.intersect(lo, hi)
+	if r == nil {
+		ia.infeasible = true
+		return
+	}
+	if r.Low.Cmp(cur.Low) == 0 && r.High.Cmp(cur.High) == 0 {
+		return
+	}
+
+	switch ex := e.e.(type) {
+	case *internalBVS:
+		ia.syms[e.Id()] = r
+		ia.bvs = make(map[uintptr]*Interval)
+		ia.changed = true
+	case *internalBVExprExtend:
+		if !ex.signed {
+			ia.restrict(ex.child, r.Low, r.High)
+		}
+	case *internalBVExprBinArithmetic:
+		// x + c, if it does not overflow
+		if e.Kind() != TY_ADD || len(ex.children) != 2 || !ex.children[1].IsConst() {
+			return
+		}
+		c, _ := ex.children[1].GetConst()
+		x := ia.bv(ex.children[0])
+		if new(big.Int).Add(x.High, c.value).Cmp(makeMask(e.Size())) > 0 {
+			return
+		}
+		low := new(big.Int).Sub(r.Low, c.value)
+		ia.restrict(ex.children[0], maxBig(low, big.NewInt(0)), new(big.Int).Sub(r.High, c.value))
+	}
+}
@@ -0,0 +1,160 @@
+package gosmt_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestInterval(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	x := eb.BVS("x", 32)
+	y := eb.BVS("y", 8)
+
+	e, _ := eb.ZExt(y, 24)
+	if iv := eb.Interval(e); iv.String() != "[0x0, 0xff]" {
+		t.Errorf("wrong interval: %s", iv.String())
+		return
+	}
+
+	e, _ = eb.Mul(e, eb.BVV(4, 32))
+	e, _ = eb.Add(e, eb.BVV(2, 32))
+	iv := eb.Interval(e)
+	if iv.String() != "4[0x2, 0x3fe]" || iv.Count().Int64() != 256 {
+		t.Errorf("wrong interval: %s", iv.String())
+		return
+	}
+	if !iv.Contains(gosmt.MakeBVConst(6, 32)) || iv.Contains(gosmt.MakeBVConst(7, 32)) {
+		t.Error("wrong contains")
+		return
+	}
+
+	// the multiplication overflows, but the values are still even
+	e, _ = eb.Mul(x, eb.BVV(2, 32))
+	if iv := eb.Interval(e); iv.String() != "2[0x0, 0xfffffffe]" {
+		t.Errorf("wrong interval: %s", iv.String())
+		return
+	}
+
+	e, _ = eb.Concat(y, eb.BVV(0x10, 8))
+	e, _ = eb.LShr(e, eb.BVV(4, 16))
+	if iv := eb.Interval(e); iv.String() != "16[0x1, 0xff1]" {
+		t.Errorf("wrong interval: %s", iv.String())
+		return
+	}
+
+	e, _ = eb.SExt(y, 8)
+	e, _ = eb.Extract(e, 11, 4)
+	if iv := eb.Interval(e); iv.String() != "[0x0, 0xff]" {
+		t.Errorf("wrong interval: %s", iv.String())
+		return
+	}
+}
+
+func TestIntervalSoundness(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	r := rand.New(rand.NewSource(7))
+	for _, size := range []uint{8, 64} {
+		bvs, _ := compileTestExprs(eb, size)
+		bounded := make([]*gosmt.BVExprPtr, 0)
+		for _, e := range bvs {
+			m, _ := eb.URem(e, eb.BVV(100, e.Size()))
+			m2, _ := eb.Mul(m, eb.BVV(6, e.Size()))
+			m3, _ := eb.Add(m2, m)
+			m4, _ := eb.LShr(m3, eb.BVV(1, e.Size()))
+			m5, _ := eb.UDiv(m4, eb.BVV(3, e.Size()))
+			m6 := eb.Neg(m2)
+			bounded = append(bounded, m, m2, m3, m4, m5, m6)
+		}
+		bvs = append(bvs, bounded...)
+		for _, e := range bvs {
+			iv := eb.Interval(e)
+			for i := 0; i < 50; i++ {
+				model := map[string]*gosmt.BVConst{
+					"a": randomInput(r, size),
+					"b": randomInput(r, size),
+					"c": randomInput(r, size),
+				}
+				v, err := eb.EvalConcreteBV(e, model)
+				if isErr(t, err) {
+					return
+				}
+				if !iv.Contains(v) {
+					t.Errorf("%s with %v: %s, %s", e.String(), model, iv.String(), v.String())
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestIntervalSolver(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		b := eb.BVS("b", 32)
+		e, _ := eb.Ule(a, eb.BVV(42, 32))
+		s.Add(e)
+		e, _ = eb.UGe(a, eb.BVV(21, 32))
+		s.Add(e)
+		e, _ = eb.SLt(b, eb.BVV(10, 32))
+		s.Add(e)
+		e, _ = eb.SGe(b, eb.BVV(-5, 32))
+		s.Add(e)
+
+		if iv := s.Interval(a); iv.String() != "[0x15, 0x2a]" {
+			t.Errorf("wrong interval: %s", iv.String())
+			return
+		}
+		c := eb.BVS("c", 32)
+		e, _ = eb.SGe(c, eb.BVV(0, 32))
+		s.Add(e)
+		e, _ = eb.SLt(c, eb.BVV(10, 32))
+		s.Add(e)
+		if iv := s.Interval(c); iv.String() != "[0x0, 0x9]" {
+			t.Errorf("wrong interval: %s", iv.String())
+			return
+		}
+
+		lookups := s.CexCache().Stats().Lookups
+		q, _ := eb.Eq(a, eb.BVV(50, 32))
+		if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		x, _ := eb.Add(a, eb.BVV(1, 32))
+		q, _ = eb.Ult(x, eb.BVV(20, 32))
+		if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		x, _ = eb.Mul(a, eb.BVV(3, 32))
+		q, _ = eb.Eq(x, eb.BVV(100, 32))
+		if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		if s.CexCache().Stats().Lookups != lookups {
+			t.Error("the cache should not be used")
+			return
+		}
+
+		if len(s.EvalUpto(a, 100)) != 42-21+1 {
+			t.Error("wrong number of values")
+			return
+		}
+		if v, err := s.Min(a, false); err != nil || v.AsULong() != 21 {
+			t.Error("wrong min")
+			return
+		}
+		if v, err := s.Max(b, true); err != nil || v.AsLong() != 9 {
+			t.Error("wrong max")
+			return
+		}
+		if v, err := s.Min(b, true); err != nil || v.AsLong() != -5 {
+			t.Error("wrong min")
+			return
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package gosmt
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// The depth of the known-bits analysis performed while building expressions
+const knownBitsBuilderDepth = 6
+
+/*
+ *  KnownBits is the result of the known-bits analysis of a bitvector
+ *  expression: the bits set in Zeros (Ones) are 0 (1) in every value of the
+ *  expression, the other bits are unknown
+ */
+type KnownBits struct {
+	Size  uint
+	Zeros *big.Int
+	Ones  *big.Int
+}
+
+func unknownBits(size uint) *KnownBits {
+	return &KnownBits{Size: size, Zeros: big.NewInt(0), Ones: big.NewInt(0)}
+}
+
+func constBits(c *BVConst) *KnownBits {
+	ones := new(big.Int).Set(c.value)
+	zeros := new(big.Int).Xor(c.mask, c.value)
+	return &KnownBits{Size: c.Size, Zeros: zeros, Ones: ones}
+}
+
+func (k *KnownBits) known() *big.Int {
+	return new(big.Int).Or(k.Zeros, k.Ones)
+}
+
+func (k *KnownBits) IsConst() bool {
+	return k.known().Cmp(makeMask(k.Size)) == 0
+}
+
+func (k *KnownBits) GetConst() (*BVConst, error) {
+	if !k.IsConst() {
+		return nil, fmt.Errorf("not a constant")
+	}
+	return MakeBVConstFromBigint(new(big.Int).Set(k.Ones), k.Size), nil
+}
+
+// String returns the bits from the most significant one, unknown bits are
+// printed as '?'
+func (k *KnownBits) String() string {
+	b := strings.Builder{}
+	for i := int(k.Size) - 1; i >= 0; i-- {
+		if k.Zeros.Bit(i) == 1 {
+			b.WriteByte('0')
+		} else if k.Ones.Bit(i) == 1 {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func (k *KnownBits) umin() *big.Int {
+	return k.Ones
+}
+
+func (k *KnownBits) umax() *big.Int {
+	return new(big.Int).Xor(k.Zeros, makeMask(k.Size))
+}
+
+// flipSign maps the signed order to the unsigned one
+func (k *KnownBits) flipSign() *KnownBits {
+	sign := new(big.Int).Lsh(one, k.Size-1)
+	return &KnownBits{
+		Size:  k.Size,
+		Zeros: swapBit(k.Zeros, k.Ones, sign),
+		Ones:  swapBit(k.Ones, k.Zeros, sign),
+	}
+}
+
+// swapBit returns a with the bit set in bit replaced by the one in b
+func swapBit(a, b, bit *big.Int) *big.Int {
+	r := new(big.Int).AndNot(a, bit)
+	return r.Or(r, new(big.Int).And(b, bit))
+}
+
+func (k *KnownBits) extract(high, low uint) *KnownBits {
+	mask := makeMask(high - low + 1)
+	zeros := new(big.Int).Rsh(k.Zeros, low)
+	ones := new(big.Int).Rsh(k.Ones, low)
+	return &KnownBits{Size: high - low + 1, Zeros: zeros.And(zeros, mask), Ones: ones.And(ones, mask)}
+}
+
+func (k *KnownBits) signBit() (known bool, value uint) {
+	if k.Zeros.Bit(int(k.Size-1)) == 1 {
+		return true, 0
+	}
+	if k.Ones.Bit(int(k.Size-1)) == 1 {
+		return true, 1
+	}
+	return false, 0
+}
+
+// leading returns the number of consecutive bits set in v, starting from the
+// most significant bit
+func leading(v *big.Int, size uint) uint {
+	n := uint(0)
+	for i := int(size) - 1; i >= 0 && v.Bit(i) == 1; i-- {
+		n++
+	}
+	return n
+}
+
+// trailing returns the number of consecutive bits set in v, starting from
+// the least significant bit
+func trailing(v *big.Int, size uint) uint {
+	n := uint(0)
+	for i := 0; i < int(size) && v.Bit(i) == 1; i++ {
+		n++
+	}
+	return n
+}
+
+// highBits returns a value of size bits with the n most significant bits set
+func highBits(n, size uint) *big.Int {
+	r := makeMask(n)
+	return r.Lsh(r, size-n)
+}
+
+func knownAdd(a, b *KnownBits) *KnownBits {
+	mask := makeMask(a.Size)
+	notZa := new(big.Int).Xor(a.Zeros, mask)
+	notZb := new(big.Int).Xor(b.Zeros, mask)
+
+	// the largest and smallest possible sums
+	sumZero := new(big.Int).Add(notZa, notZb)
+	sumZero.And(sumZero, mask)
+	sumOne := new(big.Int).Add(a.Ones, b.Ones)
+	sumOne.And(sumOne, mask)
+
+	// the carry into a bit is known if it is the same in both sums
+	carryZero := new(big.Int).Xor(sumZero, a.Zeros)
+	carryZero.Xor(carryZero, b.Zeros)
+	carryZero.Xor(carryZero, mask)
+	carryOne := new(big.Int).Xor(sumOne, a.Ones)
+	carryOne.Xor(carryOne, b.Ones)
+
+	known := new(big.Int).Or(carryZero, carryOne)
+	known.And(known, a.known())
+	known.And(known, b.known())
+
+	zeros := new(big.Int).Xor(sumZero, mask)
+	return &KnownBits{Size: a.Size, Zeros: zeros.And(zeros, known), Ones: sumOne.And(sumOne, known)}
+}
+
+func knownMul(a, b *KnownBits) *KnownBits {
+	size := a.Size
+	// the trailing zeros add up
+	tz := min(trailing(a.Zeros, size)+trailing(b.Zeros, size), size)
+	zeros := makeMask(tz)
+	ones := big.NewInt(0)
+
+	// the low bits of the product depend only on the low bits of the operands
+	n := min(trailing(a.known(), size), trailing(b.known(), size))
+	if n > 0 {
+		low := makeMask(n)
+		p := new(big.Int).Mul(new(big.Int).And(a.Ones, low), new(big.Int).And(b.Ones, low))
+		p.And(p, low)
+		ones.Or(ones, p)
+		zeros.Or(zeros, new(big.Int).Xor(p, low))
+	}
+	return &KnownBits{Size: size, Zeros: zeros, Ones: ones}
+}
+
+func knownShift(kind int, a, amount *KnownBits) *KnownBits {
+	size := a.Size
+	mask := makeMask(size)
+	signKnown, sign := a.signBit()
+
+	if !amount.IsConst() {
+		switch kind {
+		case TY_SHL:
+			return &KnownBits{Size: size, Zeros: makeMask(trailing(a.Zeros, size)), Ones: big.NewInt(0)}
+		case TY_LSHR:
+			return &KnownBits{Size: size, Zeros: highBits(leading(a.Zeros, size), size), Ones: big.NewInt(0)}
+		}
+		r := unknownBits(size)
+		if signKnown && sign == 0 {
+			r.Zeros = highBits(leading(a.Zeros, size), size)
+		} else if signKnown {
+			r.Ones = highBits(leading(a.Ones, size), size)
+		}
+		return r
+	}
+
+	n := size
+	if amount.Ones.Cmp(big.NewInt(int64(size))) < 0 {
+		n = uint(amount.Ones.Uint64())
+	}
+	switch kind {
+	case TY_SHL:
+		zeros := new(big.Int).Lsh(a.Zeros, n)
+		zeros.Or(zeros, makeMask(n))
+		ones := new(big.Int).Lsh(a.Ones, n)
+		return &KnownBits{Size: size, Zeros: zeros.And(zeros, mask), Ones: ones.And(ones, mask)}
+	case TY_LSHR:
+		zeros := new(big.Int).Rsh(a.Zeros, n)
+		zeros.Or(zeros, highBits(n, size))
+		return &KnownBits{Size: size, Zeros: zeros, Ones: new(big.Int).Rsh(a.Ones, n)}
+	}
+	zeros := new(big.Int).Rsh(a.Zeros, n)
+	ones := new(big.Int).Rsh(a.Ones, n)
+	if signKnown && sign == 0 {
+		zeros.Or(zeros, highBits(n, size))
+	} else if signKnown {
+		ones.Or(ones, highBits(n, size))
+	}
+	return &KnownBits{Size: size, Zeros: zeros, Ones: ones}
+}
+
+func knownDiv(kind int, a, b *KnownBits) *KnownBits {
+	size := a.Size
+	switch kind {
+	case TY_UDIV:
+		if b.Ones.Sign() == 0 {
+			// the divisor can be zero
+			return unknownBits(size)
+		}
+		maxQ := new(big.Int).Rsh(a.umax(), uint(b.Ones.BitLen()-1))
+		return &KnownBits{Size: size, Zeros: highBits(size-uint(maxQ.BitLen()), size), Ones: big.NewInt(0)}
+	case TY_UREM:
+		// the remainder is not greater than the dividend, and it is smaller
+		// than the divisor if this is not zero
+		lz := size - uint(a.umax().BitLen())
+		if b.Ones.Sign() != 0 {
+			maxR := new(big.Int).Sub(b.umax(), one)
+			lz = max(lz, size-uint(maxR.BitLen()))
+		}
+		return &KnownBits{Size: size, Zeros: highBits(lz, size), Ones: big.NewInt(0)}
+	}
+	return unknownBits(size)
+}
+
+type knownBitsAnalysis struct {
+	bvs   map[uintptr]*KnownBits
+	bools map[uintptr]int
+}
+
+const (
+	knownFalse   = 0
+	knownTrue    = 1
+	knownUnknown = 2
+)
+
+func newKnownBitsAnalysis() *knownBitsAnalysis {
+	return &knownBitsAnalysis{
+		bvs:   make(map[uintptr]*KnownBits),
+		bools: make(map[uintptr]int),
+	}
+}
+
+// KnownBits returns the bits of e that have the same value for every
+// assignment of the symbols
+func (eb *ExprBuilder) KnownBits(e *BVExprPtr) *KnownBits {
+	return newKnownBitsAnalysis().bv(e, -1)
+}
+
+// bv analyses e up to the given depth, a negative depth means no limit
+func (ka *knownBitsAnalysis) bv(e *BVExprPtr, depth int) *KnownBits {
+	if r, ok := ka.bvs[e.Id()]; ok {
+		return r
+	}
+	if e.IsConst() {
+		c, _ := e.GetConst()
+		return constBits(c)
+	}
+	if depth == 0 {
+		return unknownBits(e.Size())
+	}
+	depth -= 1
+
+	size := e.Size()
+	var r *KnownBits
+	switch ex := e.e.(type) {
+	case *internalBVExprExtract:
+		r = ka.bv(ex.child, depth).extract(ex.high, ex.low)
+	case *internalBVExprConcat:
+		r = ka.bv(ex.children[0], depth)
+		for _, child := range ex.children[1:] {
+			c := ka.bv(child, depth)
+			zeros := new(big.Int).Lsh(r.Zeros, c.Size)
+			ones := new(big.Int).Lsh(r.Ones, c.Size)
+			r = &KnownBits{Size: r.Size + c.Size, Zeros: zeros.Or(zeros, c.Zeros), Ones: ones.Or(ones, c.Ones)}
+		}
+	case *internalBVExprExtend:
+		c := ka.bv(ex.child, depth)
+		ext := highBits(ex.n, size)
+		r = &KnownBits{Size: size, Zeros: new(big.Int).Set(c.Zeros), Ones: new(big.Int).Set(c.Ones)}
+		signKnown, sign := c.signBit()
+		if !ex.signed || (signKnown && sign == 0) {
+			r.Zeros.Or(r.Zeros, ext)
+		} else if signKnown {
+			r.Ones.Or(r.Ones, ext)
+		}
+	case *internalBVExprITE:
+		switch ka.bool(ex.cond, depth) {
+		case knownTrue:
+			r = ka.bv(ex.iftrue, depth)
+		case knownFalse:
+			r = ka.bv(ex.iffalse, depth)
+		default:
+			t := ka.bv(ex.iftrue, depth)
+			f := ka.bv(ex.iffalse, depth)
+			r = &KnownBits{Size: size, Zeros: new(big.Int).And(t.Zeros, f.Zeros), Ones: new(big.Int).And(t.Ones, f.Ones)}
+		}
+	case *internalBVExprUnArithmetic:
+		c := ka.bv(ex.child, depth)
+		not := &KnownBits{Size: size, Zeros: c.Ones, Ones: c.Zeros}
+		if e.Kind() == TY_NOT {
+			r = not
+		} else {
+			r = knownAdd(not, constBits(MakeBVConst(1, size)))
+		}
+	case *internalBVExprBinArithmetic:
+		children := make([]*KnownBits, len(ex.children))
+		for i, child := range ex.children {
+			children[i] = ka.bv(child, depth)
+		}
+		switch e.Kind() {
+		case TY_SHL, TY_LSHR, TY_ASHR:
+			r = knownShift(e.Kind(), children[0], children[1])
+		case TY_UDIV, TY_UREM, TY_SDIV, TY_SREM:
+			r = knownDiv(e.Kind(), children[0], children[1])
+		default:
+			r = children[0]
+			for _, c := range children[1:] {
+				r = knownBinOp(e.Kind(), r, c)
+			}
+		}
+	default:
+		r = unknownBits(size)
+	}
+	ka.bvs[e.Id()] = r
+	return r
+}
+
+func knownBinOp(kind int, a, b *KnownBits) *KnownBits {
+	switch kind {
+	case TY_AND:
+		return &KnownBits{Size: a.Size, Zeros: new(big.Int).Or(a.Zeros, b.Zeros), Ones: new(big.Int).And(a.Ones, b.Ones)}
+	case TY_OR:
+		return &KnownBits{Size: a.Size, Zeros: new(big.Int).And(a.Zeros, b.Zeros), Ones: new(big.Int).Or(a.Ones, b.Ones)}
+	case TY_XOR:
+		zeros := new(big.Int).And(a.Zeros, b.Zeros)
+		zeros.Or(zeros, new(big.Int).And(a.Ones, b.Ones))
+		ones := new(big.Int).And(a.Zeros, b.Ones)
+		ones.Or(ones, new(big.Int).And(a.Ones, b.Zeros))
+		return &KnownBits{Size: a.Size, Zeros: zeros, Ones: ones}
+	case TY_ADD:
+		return knownAdd(a, b)
+	case TY_MUL:
+		return knownMul(a, b)
+	}
+	return unknownBits(a.Size)
+}
+
+func (ka *knownBitsAnalysis) bool(e *BoolExprPtr, depth int) int {
+	if r, ok := ka.bools[e.Id()]; ok {
+		return r
+	}
+	if e.IsConst() {
+		v, _ := e.GetConst()
+		if v {
+			return knownTrue
+		}
+		return knownFalse
+	}
+	if depth == 0 {
+		return knownUnknown
+	}
+	depth -= 1
+
+	r := knownUnknown
+	switch ex := e.e.(type) {
+	case *internalBoolUnArithmetic:
+		r = ka.bool(ex.child, depth)
+		if r != knownUnknown {
+			r = 1 - r
+		}
+	case *internalBoolExprNaryOp:
+		// the absorbing value of the operation
+		absorbing := knownFalse
+		if e.Kind() == TY_BOOL_OR {
+			absorbing = knownTrue
+		}
+		r = 1 - absorbing
+		for _, child := range ex.children {
+			c := ka.bool(child, depth)
+			if c == absorbing {
+				r = absorbing
+				break
+			}
+			if c == knownUnknown {
+				r = knownUnknown
+			}
+		}
+	case *internalBoolExprCmp:
+		r = knownCmp(e.Kind(), ka.bv(ex.lhs, depth), ka.bv(ex.rhs, depth))
+	}
+	ka.bools[e.Id()] = r
+	return r
+}
+
+func knownCmp(kind int, a, b *KnownBits) int {
+	switch kind {
+	case TY_EQ:
+		differ := new(big.Int).And(a.Ones, b.Zeros)
+		differ.Or(differ, new(big.Int).And(a.Zeros, b.Ones))
+		if differ.Sign() != 0 {
+			return knownFalse
+		}
+		if a.IsConst() && b.IsConst() {
+			return knownTrue
+		}
+		return knownUnknown
+	case TY_SLT, TY_SLE, TY_SGT, TY_SGE:
+		return knownCmp(kind-TY_SLT+TY_ULT, a.flipSign(), b.flipSign())
+	case TY_UGT:
+		return knownCmp(TY_ULT, b, a)
+	case TY_UGE:
+		return knownCmp(TY_ULE, b, a)
+	case TY_ULT:
+		if a.umax().Cmp(b.umin()) < 0 {
+			return knownTrue
+		}
+		if a.umin().Cmp(b.umax()) >= 0 {
+			return knownFalse
+		}
+	case TY_ULE:
+		if a.umax().Cmp(b.umin()) <= 0 {
+			return knownTrue
+		}
+		if a.umin().Cmp(b.umax()) > 0 {
+			return knownFalse
+		}
+	}
+	return knownUnknown
+}
+
+// knownBool returns the value of e if it is determined by the known bits of
+// its operands
+func (eb *ExprBuilder) knownBool(e *BoolExprPtr, depth int) (bool, bool) {
+	r := newKnownBitsAnalysis().bool(e, depth)
+	return r == knownTrue, r != knownUnknown
+}
+
+// knownCmpExpr returns the constant value of the comparison between lhs and
+// rhs if it is determined by their known bits, nil otherwise
+func (eb *ExprBuilder) knownCmpExpr(kind int, lhs, rhs *BVExprPtr) *BoolExprPtr {
+	if lhs.Kind() == TY_SYM && rhs.Kind() == TY_SYM {
+		return nil
+	}
+	ka := newKnownBitsAnalysis()
+	r := knownCmp(kind, ka.bv(lhs, knownBitsBuilderDepth), ka.bv(rhs, knownBitsBuilderDepth))
+	if r == knownUnknown {
+		return nil
+	}
+	return eb.getOrCreateBool(mkinternalBoolConst(r == knownTrue))
+}
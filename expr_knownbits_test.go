@@ -0,0 +1,184 @@
+package gosmt_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestKnownBits(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	x := eb.BVS("x", 16)
+	y := eb.BVS("y", 8)
+
+	e, _ := eb.And(x, eb.BVV(0xff00, 16))
+	if kb := eb.KnownBits(e); kb.String() != "????????00000000" {
+		t.Errorf("wrong known bits: %s", kb.String())
+		return
+	}
+
+	e, _ = eb.ZExt(y, 8)
+	e, _ = eb.Shl(e, eb.BVV(8, 16))
+	e, _ = eb.Or(e, eb.BVV(1, 16))
+	if kb := eb.KnownBits(e); kb.String() != "????????00000001" {
+		t.Errorf("wrong known bits: %s", kb.String())
+		return
+	}
+
+	e, _ = eb.Mul(x, eb.BVV(4, 16))
+	e, _ = eb.Add(e, eb.BVV(2, 16))
+	if kb := eb.KnownBits(e); kb.String() != "??????????????10" {
+		t.Errorf("wrong known bits: %s", kb.String())
+		return
+	}
+
+	e, _ = eb.Or(x, eb.BVV(0xffff, 16))
+	kb := eb.KnownBits(e)
+	c, err := kb.GetConst()
+	if isErr(t, err) {
+		return
+	}
+	if !kb.IsConst() || c.AsULong() != 0xffff {
+		t.Error("should be constant")
+		return
+	}
+}
+
+func TestKnownBitsFolding(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	x := eb.BVS("x", 32)
+	y := eb.BVS("y", 8)
+
+	// the top bits of zext(y) are zero
+	e, _ := eb.ZExt(y, 24)
+	c, _ := eb.Ult(e, eb.BVV(0x100, 32))
+	if !c.IsConst() {
+		t.Errorf("not folded: %s", c.String())
+		return
+	}
+	if v, _ := c.GetConst(); !v {
+		t.Error("should be true")
+		return
+	}
+
+	// x | 1 is never zero
+	e, _ = eb.Or(x, eb.BVV(1, 32))
+	c, _ = eb.Eq(e, eb.BVV(0, 32))
+	if v, _ := c.GetConst(); !c.IsConst() || v {
+		t.Errorf("not folded: %s", c.String())
+		return
+	}
+
+	// the sign bit of x & 0x7fffffff is zero
+	e, _ = eb.And(x, eb.BVV(0x7fffffff, 32))
+	c, _ = eb.SLt(e, eb.BVV(0, 32))
+	if v, _ := c.GetConst(); !c.IsConst() || v {
+		t.Errorf("not folded: %s", c.String())
+		return
+	}
+
+	// the low byte of x << 8 is zero
+	e, _ = eb.Shl(x, eb.BVV(8, 32))
+	e, _ = eb.Add(e, eb.BVV(3, 32))
+	e, _ = eb.Extract(e, 7, 0)
+	if !e.IsConst() {
+		t.Errorf("not folded: %s", e.String())
+		return
+	}
+	if v, _ := e.GetConst(); v.AsULong() != 3 {
+		t.Error("wrong value")
+		return
+	}
+
+	c, _ = eb.Ult(x, eb.BVV(10, 32))
+	if c.IsConst() {
+		t.Error("should not be folded")
+		return
+	}
+}
+
+// knownBitsAgree checks that the known bits agree with the value v
+func knownBitsAgree(kb *gosmt.KnownBits, v *gosmt.BVConst) bool {
+	bits := kb.String()
+	for i := uint(0); i < kb.Size; i++ {
+		b := bits[kb.Size-1-i]
+		if b != '?' && uint64(b-'0') != v.Slice(i, i).AsULong() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestKnownBitsSoundness(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	r := rand.New(rand.NewSource(3))
+	for _, size := range []uint{8, 64} {
+		bvs, _ := compileTestExprs(eb, size)
+		// add some structure to the symbols so that the analysis has
+		// something to propagate
+		masked := make([]*gosmt.BVExprPtr, 0)
+		for _, e := range bvs {
+			m, _ := eb.And(e, eb.BVV(0xf0, e.Size()))
+			m, _ = eb.Or(m, eb.BVV(0x3, e.Size()))
+			m2, _ := eb.Mul(m, m)
+			m3, _ := eb.Add(m, m2)
+			m4, _ := eb.LShr(m3, eb.BVV(2, e.Size()))
+			m5, _ := eb.UDiv(m4, m)
+			masked = append(masked, m, m2, m3, m4, m5)
+		}
+		bvs = append(bvs, masked...)
+		for _, e := range bvs {
+			kb := eb.KnownBits(e)
+			for i := 0; i < 50; i++ {
+				model := map[string]*gosmt.BVConst{
+					"a": randomInput(r, size),
+					"b": randomInput(r, size),
+					"c": randomInput(r, size),
+				}
+				v, err := eb.EvalConcreteBV(e, model)
+				if isErr(t, err) {
+					return
+				}
+				if !knownBitsAgree(kb, v) {
+					t.Errorf("%s with %v: %s, %s", e.String(), model, kb.String(), v.String())
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestKnownBitsCheckSat(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+	x := eb.BVS("x", 32)
+	y := eb.BVS("y", 32)
+
+	// the low bit of lhs is zero, but it is too deep for the builder
+	x2, _ := eb.Shl(x, eb.BVV(1, 32))
+	lhs := x2
+	for i := 0; i < 8; i++ {
+		sh, _ := eb.Shl(y, eb.BVV(int64(i+1), 32))
+		lhs, _ = eb.Add(lhs, sh)
+		lhs, _ = eb.Mul(lhs, y)
+		lhs, _ = eb.Xor(lhs, x2)
+	}
+	rhs, _ := eb.Or(y, eb.BVV(1, 32))
+	q, _ := eb.Eq(lhs, rhs)
+	if q.IsConst() {
+		t.Error("should not be folded")
+		return
+	}
+	c, _ := eb.Ult(x, eb.BVV(10, 32))
+	s.Add(c)
+	if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+	stats := s.CexCache().Stats()
+	if stats.Lookups != 0 {
+		t.Error("the cache should not be used")
+		return
+	}
+}
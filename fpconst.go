@@ -0,0 +1,552 @@
+package gosmt
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+type FPSort struct {
+	EBits uint
+	SBits uint // including the hidden bit
+}
+
+var Float32Sort = FPSort{EBits: 8, SBits: 24}
+var Float64Sort = FPSort{EBits: 11, SBits: 53}
+
+func (s FPSort) Size() uint {
+	return s.EBits + s.SBits
+}
+
+func (s FPSort) String() string {
+	return fmt.Sprintf("FP%d/%d", s.EBits, s.SBits)
+}
+
+func (s FPSort) bias() int {
+	return 1<<(s.EBits-1) - 1
+}
+
+func (s FPSort) emin() int {
+	return 1 - s.bias()
+}
+
+func (s FPSort) emax() int {
+	return s.bias()
+}
+
+type RoundingMode int
+
+const (
+	RM_RNE RoundingMode = iota // to nearest, ties to even
+	RM_RNA                     // to nearest, ties away from zero
+	RM_RTP                     // toward positive
+	RM_RTN                     // toward negative
+	RM_RTZ                     // toward zero
+)
+
+func (rm RoundingMode) String() string {
+	switch rm {
+	case RM_RNE:
+		return "RNE"
+	case RM_RNA:
+		return "RNA"
+	case RM_RTP:
+		return "RTP"
+	case RM_RTN:
+		return "RTN"
+	case RM_RTZ:
+		return "RTZ"
+	}
+	return "invalid"
+}
+
+const (
+	fpZero = iota
+	fpFinite
+	fpInf
+	fpNaN
+)
+
+// FPConst is an IEEE-754 value, stored as its encoding. NaNs are always
+// represented by the same (quiet) encoding
+type FPConst struct {
+	Sort  FPSort
+	value *big.Int
+}
+
+func fpEncode(sort FPSort, sign bool, field uint64, frac *big.Int) *FPConst {
+	v := new(big.Int).Lsh(new(big.Int).SetUint64(field), sort.SBits-1)
+	v.Or(v, frac)
+	if sign {
+		v.SetBit(v, int(sort.Size()-1), 1)
+	}
+	return &FPConst{Sort: sort, value: v}
+}
+
+func fpMakeNaN(sort FPSort) *FPConst {
+	frac := new(big.Int).Lsh(one, sort.SBits-2)
+	return fpEncode(sort, false, 1<<sort.EBits-1, frac)
+}
+
+func fpMakeInf(sort FPSort, sign bool) *FPConst {
+	return fpEncode(sort, sign, 1<<sort.EBits-1, big.NewInt(0))
+}
+
+func fpMakeZero(sort FPSort, sign bool) *FPConst {
+	return fpEncode(sort, sign, 0, big.NewInt(0))
+}
+
+func fpMakeMax(sort FPSort, sign bool) *FPConst {
+	return fpEncode(sort, sign, 1<<sort.EBits-2, makeMask(sort.SBits-1))
+}
+
+func MakeFPConstFromBits(bits *BVConst, sort FPSort) (*FPConst, error) {
+	if bits.Size != sort.Size() {
+		return nil, fmt.Errorf("invalid size")
+	}
+	c := &FPConst{Sort: sort, value: new(big.Int).Set(bits.value)}
+	if c.IsNaN() {
+		return fpMakeNaN(sort), nil
+	}
+	return c, nil
+}
+
+func MakeFPConst(value float64, sort FPSort) *FPConst {
+	bits := MakeBVConstFromBigint(new(big.Int).SetUint64(math.Float64bits(value)), 64)
+	c, _ := MakeFPConstFromBits(bits, Float64Sort)
+	return c.ToFP(RM_RNE, sort)
+}
+
+// unpack returns the class of the value and, for finite values, its
+// magnitude as mant * 2^exp
+func (f *FPConst) unpack() (int, bool, *big.Int, int) {
+	sort := f.Sort
+	sign := f.value.Bit(int(sort.Size()-1)) == 1
+	frac := new(big.Int).And(f.value, makeMask(sort.SBits-1))
+	field := new(big.Int).Rsh(f.value, sort.SBits-1)
+	field.And(field, makeMask(sort.EBits))
+
+	e := int(field.Int64())
+	switch {
+	case e == 1<<sort.EBits-1 && frac.Sign() == 0:
+		return fpInf, sign, nil, 0
+	case e == 1<<sort.EBits-1:
+		return fpNaN, sign, nil, 0
+	case e == 0 && frac.Sign() == 0:
+		return fpZero, sign, nil, 0
+	case e == 0:
+		return fpFinite, sign, frac, sort.emin() - int(sort.SBits-1)
+	}
+	frac.SetBit(frac, int(sort.SBits-1), 1)
+	return fpFinite, sign, frac, e - sort.bias() - int(sort.SBits-1)
+}
+
+// fpShiftRound returns mant >> shift rounded with rm; sticky tells whether
+// the exact value has non-zero bits below mant
+func fpShiftRound(rm RoundingMode, sign bool, mant *big.Int, shift uint, sticky bool) *big.Int {
+	q := new(big.Int).Rsh(mant, shift)
+	rem := new(big.Int).And(mant, makeMask(shift))
+	if rem.Sign() == 0 && !sticky {
+		return q
+	}
+
+	cmp := -1
+	if shift > 0 {
+		cmp = rem.Cmp(new(big.Int).Lsh(one, shift-1))
+	}
+	up := false
+	switch rm {
+	case RM_RNE:
+		up = cmp > 0 || (cmp == 0 && (sticky || q.Bit(0) == 1))
+	case RM_RNA:
+		up = cmp >= 0
+	case RM_RTP:
+		up = !sign
+	case RM_RTN:
+		up = sign
+	}
+	if up {
+		q.Add(q, one)
+	}
+	return q
+}
+
+// fpRound rounds (-1)^sign * mant * 2^exp to sort, where sticky tells
+// whether the exact value has non-zero bits below mant
+func fpRound(rm RoundingMode, sort FPSort, sign bool, mant *big.Int, exp int, sticky bool) *FPConst {
+	mant = new(big.Int).Set(mant)
+	p := int(sort.SBits)
+	if l := mant.BitLen(); l < p+2 {
+		mant.Lsh(mant, uint(p+2-l))
+		exp -= p + 2 - l
+	}
+
+	// subnormal results have a reduced precision
+	l := mant.BitLen()
+	if e := exp + l - 1; e < sort.emin() {
+		p -= sort.emin() - e
+	}
+	shift := l - p
+	q := fpShiftRound(rm, sign, mant, uint(shift), sticky)
+	exp += shift
+
+	if q.Sign() == 0 {
+		return fpMakeZero(sort, sign)
+	}
+	l = q.BitLen()
+	e := exp + l - 1
+	if e > sort.emax() {
+		switch {
+		case rm == RM_RTZ, rm == RM_RTP && sign, rm == RM_RTN && !sign:
+			return fpMakeMax(sort, sign)
+		}
+		return fpMakeInf(sort, sign)
+	}
+	if e < sort.emin() {
+		return fpEncode(sort, sign, 0, q.Lsh(q, uint(exp-(sort.emin()-int(sort.SBits-1)))))
+	}
+	if l > int(sort.SBits) {
+		q.Rsh(q, uint(l-int(sort.SBits)))
+	} else {
+		q.Lsh(q, uint(int(sort.SBits)-l))
+	}
+	q.SetBit(q, int(sort.SBits-1), 0)
+	return fpEncode(sort, sign, uint64(e+sort.bias()), q)
+}
+
+func (f *FPConst) set(o *FPConst) {
+	f.Sort = o.Sort
+	f.value = o.value
+}
+
+func (f *FPConst) Copy() *FPConst {
+	return &FPConst{Sort: f.Sort, value: new(big.Int).Set(f.value)}
+}
+
+func (f *FPConst) Bits() *BVConst {
+	return MakeBVConstFromBigint(new(big.Int).Set(f.value), f.Sort.Size())
+}
+
+func (f *FPConst) IsNaN() bool {
+	cls, _, _, _ := f.unpack()
+	return cls == fpNaN
+}
+
+func (f *FPConst) IsInf() bool {
+	cls, _, _, _ := f.unpack()
+	return cls == fpInf
+}
+
+func (f *FPConst) IsZero() bool {
+	cls, _, _, _ := f.unpack()
+	return cls == fpZero
+}
+
+func (f *FPConst) IsNegative() bool {
+	cls, sign, _, _ := f.unpack()
+	return cls != fpNaN && sign
+}
+
+func (f *FPConst) Float64() float64 {
+	if f.IsNaN() {
+		return math.NaN()
+	}
+	c := f.ToFP(RM_RNE, Float64Sort)
+	return math.Float64frombits(c.value.Uint64())
+}
+
+func (f *FPConst) Text() string {
+	cls, sign, mant, exp := f.unpack()
+	s := ""
+	if sign {
+		s = "-"
+	}
+	switch cls {
+	case fpNaN:
+		return "nan"
+	case fpInf:
+		return s + "inf"
+	case fpZero:
+		return s + "0"
+	}
+	v := new(big.Float).SetPrec(f.Sort.SBits).SetInt(mant)
+	v.SetMantExp(v, exp)
+	return s + v.Text('g', -1)
+}
+
+func (f *FPConst) String() string {
+	return fmt.Sprintf("<%s %s>", f.Sort.String(), f.Text())
+}
+
+func (f *FPConst) Neg() {
+	if f.IsNaN() {
+		return
+	}
+	f.value.SetBit(f.value, int(f.Sort.Size()-1), f.value.Bit(int(f.Sort.Size()-1))^1)
+}
+
+func (f *FPConst) Abs() {
+	if f.IsNaN() {
+		return
+	}
+	f.value.SetBit(f.value, int(f.Sort.Size()-1), 0)
+}
+
+func (f *FPConst) Add(rm RoundingMode, o *FPConst) error {
+	if f.Sort != o.Sort {
+		return fmt.Errorf("different sorts")
+	}
+	c1, s1, m1, e1 := f.unpack()
+	c2, s2, m2, e2 := o.unpack()
+	switch {
+	case c1 == fpNaN || c2 == fpNaN:
+		f.set(fpMakeNaN(f.Sort))
+	case c1 == fpInf && c2 == fpInf && s1 != s2:
+		f.set(fpMakeNaN(f.Sort))
+	case c1 == fpInf:
+	case c2 == fpInf:
+		f.set(o.Copy())
+	case c1 == fpZero && c2 == fpZero:
+		if s1 != s2 {
+			f.set(fpMakeZero(f.Sort, rm == RM_RTN))
+		}
+	case c2 == fpZero:
+	case c1 == fpZero:
+		f.set(o.Copy())
+	default:
+		e := e1
+		if e2 < e {
+			e = e2
+		}
+		v1 := new(big.Int).Lsh(m1, uint(e1-e))
+		v2 := new(big.Int).Lsh(m2, uint(e2-e))
+		if s1 {
+			v1.Neg(v1)
+		}
+		if s2 {
+			v2.Neg(v2)
+		}
+		v1.Add(v1, v2)
+		if v1.Sign() == 0 {
+			f.set(fpMakeZero(f.Sort, rm == RM_RTN))
+			return nil
+		}
+		sign := v1.Sign() < 0
+		f.set(fpRound(rm, f.Sort, sign, v1.Abs(v1), e, false))
+	}
+	return nil
+}
+
+func (f *FPConst) Sub(rm RoundingMode, o *FPConst) error {
+	o = o.Copy()
+	o.Neg()
+	return f.Add(rm, o)
+}
+
+func (f *FPConst) Mul(rm RoundingMode, o *FPConst) error {
+	if f.Sort != o.Sort {
+		return fmt.Errorf("different sorts")
+	}
+	c1, s1, m1, e1 := f.unpack()
+	c2, s2, m2, e2 := o.unpack()
+	sign := s1 != s2
+	switch {
+	case c1 == fpNaN || c2 == fpNaN:
+		f.set(fpMakeNaN(f.Sort))
+	case c1 == fpInf && c2 == fpZero, c1 == fpZero && c2 == fpInf:
+		f.set(fpMakeNaN(f.Sort))
+	case c1 == fpInf || c2 == fpInf:
+		f.set(fpMakeInf(f.Sort, sign))
+	case c1 == fpZero || c2 == fpZero:
+		f.set(fpMakeZero(f.Sort, sign))
+	default:
+		f.set(fpRound(rm, f.Sort, sign, new(big.Int).Mul(m1, m2), e1+e2, false))
+	}
+	return nil
+}
+
+func (f *FPConst) Div(rm RoundingMode, o *FPConst) error {
+	if f.Sort != o.Sort {
+		return fmt.Errorf("different sorts")
+	}
+	c1, s1, m1, e1 := f.unpack()
+	c2, s2, m2, e2 := o.unpack()
+	sign := s1 != s2
+	switch {
+	case c1 == fpNaN || c2 == fpNaN:
+		f.set(fpMakeNaN(f.Sort))
+	case c1 == fpInf && c2 == fpInf, c1 == fpZero && c2 == fpZero:
+		f.set(fpMakeNaN(f.Sort))
+	case c1 == fpInf || c2 == fpZero:
+		f.set(fpMakeInf(f.Sort, sign))
+	case c1 == fpZero || c2 == fpInf:
+		f.set(fpMakeZero(f.Sort, sign))
+	default:
+		// enough quotient bits to round correctly
+		k := int(f.Sort.SBits) + 2 + m2.BitLen() - m1.BitLen()
+		if k < 0 {
+			k = 0
+		}
+		q, r := new(big.Int).QuoRem(new(big.Int).Lsh(m1, uint(k)), m2, new(big.Int))
+		f.set(fpRound(rm, f.Sort, sign, q, e1-e2-k, r.Sign() != 0))
+	}
+	return nil
+}
+
+func (f *FPConst) Sqrt(rm RoundingMode) {
+	cls, sign, mant, exp := f.unpack()
+	switch {
+	case cls == fpNaN || cls == fpZero:
+	case sign:
+		f.set(fpMakeNaN(f.Sort))
+	case cls == fpInf:
+	default:
+		k := 2*(int(f.Sort.SBits)+2) - mant.BitLen()
+		if k < 0 {
+			k = 0
+		}
+		if (exp-k)%2 != 0 {
+			k += 1
+		}
+		v := new(big.Int).Lsh(mant, uint(k))
+		r := new(big.Int).Sqrt(v)
+		sticky := new(big.Int).Mul(r, r).Cmp(v) != 0
+		f.set(fpRound(rm, f.Sort, false, r, (exp-k)/2, sticky))
+	}
+}
+
+func (f *FPConst) rat() *big.Rat {
+	cls, sign, mant, exp := f.unpack()
+	if cls == fpZero {
+		return new(big.Rat)
+	}
+	r := new(big.Rat).SetInt(mant)
+	if exp >= 0 {
+		r.Mul(r, new(big.Rat).SetInt(new(big.Int).Lsh(one, uint(exp))))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(new(big.Int).Lsh(one, uint(-exp))))
+	}
+	if sign {
+		r.Neg(r)
+	}
+	return r
+}
+
+// cmp compares two values, returning false if they are unordered
+func (f *FPConst) cmp(o *FPConst) (int, bool, error) {
+	if f.Sort != o.Sort {
+		return 0, false, fmt.Errorf("different sorts")
+	}
+	c1, s1, _, _ := f.unpack()
+	c2, s2, _, _ := o.unpack()
+	switch {
+	case c1 == fpNaN || c2 == fpNaN:
+		return 0, false, nil
+	case c1 == fpInf && c2 == fpInf && s1 == s2:
+		return 0, true, nil
+	case c1 == fpInf && s1, c2 == fpInf && !s2:
+		return -1, true, nil
+	case c1 == fpInf, c2 == fpInf:
+		return 1, true, nil
+	}
+	return f.rat().Cmp(o.rat()), true, nil
+}
+
+func (f *FPConst) Eq(o *FPConst) (BoolConst, error) {
+	c, ordered, err := f.cmp(o)
+	return BoolConst{ordered && c == 0}, err
+}
+
+func (f *FPConst) Lt(o *FPConst) (BoolConst, error) {
+	c, ordered, err := f.cmp(o)
+	return BoolConst{ordered && c < 0}, err
+}
+
+func (f *FPConst) Le(o *FPConst) (BoolConst, error) {
+	c, ordered, err := f.cmp(o)
+	return BoolConst{ordered && c <= 0}, err
+}
+
+func (f *FPConst) Gt(o *FPConst) (BoolConst, error) {
+	c, ordered, err := f.cmp(o)
+	return BoolConst{ordered && c > 0}, err
+}
+
+func (f *FPConst) Ge(o *FPConst) (BoolConst, error) {
+	c, ordered, err := f.cmp(o)
+	return BoolConst{ordered && c >= 0}, err
+}
+
+func (f *FPConst) ToFP(rm RoundingMode, sort FPSort) *FPConst {
+	cls, sign, mant, exp := f.unpack()
+	switch cls {
+	case fpNaN:
+		return fpMakeNaN(sort)
+	case fpInf:
+		return fpMakeInf(sort, sign)
+	case fpZero:
+		return fpMakeZero(sort, sign)
+	}
+	return fpRound(rm, sort, sign, mant, exp, false)
+}
+
+func FPConstFromUBV(rm RoundingMode, bv *BVConst, sort FPSort) *FPConst {
+	if bv.value.Sign() == 0 {
+		return fpMakeZero(sort, false)
+	}
+	return fpRound(rm, sort, false, bv.value, 0, false)
+}
+
+func FPConstFromSBV(rm RoundingMode, bv *BVConst, sort FPSort) *FPConst {
+	if !bv.IsNegative() {
+		return FPConstFromUBV(rm, bv, sort)
+	}
+	v := new(big.Int).Sub(new(big.Int).Lsh(one, bv.Size), bv.value)
+	return fpRound(rm, sort, true, v, 0, false)
+}
+
+// toInt rounds the value to an integer, returning false for NaN and infinities
+func (f *FPConst) toInt(rm RoundingMode) (*big.Int, bool) {
+	cls, sign, mant, exp := f.unpack()
+	switch cls {
+	case fpNaN, fpInf:
+		return nil, false
+	case fpZero:
+		return big.NewInt(0), true
+	}
+	var v *big.Int
+	if exp >= 0 {
+		v = new(big.Int).Lsh(mant, uint(exp))
+	} else {
+		v = fpShiftRound(rm, sign, mant, uint(-exp), false)
+	}
+	if sign {
+		v.Neg(v)
+	}
+	return v, true
+}
+
+// ToUBV returns false if the rounded value does not fit in size bits, in
+// which case the result of the conversion is unspecified
+func (f *FPConst) ToUBV(rm RoundingMode, size uint) (*BVConst, bool) {
+	v, ok := f.toInt(rm)
+	if !ok || v.Sign() < 0 || v.BitLen() > int(size) {
+		return nil, false
+	}
+	return MakeBVConstFromBigint(v, size), true
+}
+
+func (f *FPConst) ToSBV(rm RoundingMode, size uint) (*BVConst, bool) {
+	v, ok := f.toInt(rm)
+	if !ok {
+		return nil, false
+	}
+	bound := new(big.Int).Lsh(one, size-1)
+	if v.Cmp(bound) >= 0 || v.Cmp(new(big.Int).Neg(bound)) < 0 {
+		return nil, false
+	}
+	if v.Sign() < 0 {
+		v.Add(v, new(big.Int).Lsh(one, size))
+	}
+	return MakeBVConstFromBigint(v, size), true
+}
@@ -0,0 +1,174 @@
+package gosmt_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func fp64(v float64) *gosmt.FPConst {
+	return gosmt.MakeFPConst(v, gosmt.Float64Sort)
+}
+
+func fp32(v float32) *gosmt.FPConst {
+	return gosmt.MakeFPConst(float64(v), gosmt.Float32Sort)
+}
+
+func sameFloat64(c *gosmt.FPConst, v float64) bool {
+	if math.IsNaN(v) {
+		return c.IsNaN()
+	}
+	return c.Bits().AsULong() == math.Float64bits(v)
+}
+
+func sameFloat32(c *gosmt.FPConst, v float32) bool {
+	if v != v {
+		return c.IsNaN()
+	}
+	return c.Bits().AsULong() == uint64(math.Float32bits(v))
+}
+
+func TestFPConst(t *testing.T) {
+	c := fp32(1.5)
+	if c.String() != "<FP8/24 1.5>" || c.Bits().AsULong() != 0x3fc00000 {
+		t.Error("incorrect FP")
+		return
+	}
+	c = gosmt.MakeFPConst(0.1, gosmt.Float32Sort)
+	if c.Bits().AsULong() != uint64(math.Float32bits(0.1)) {
+		t.Error("incorrect rounding")
+		return
+	}
+	if gosmt.MakeFPConst(math.Inf(-1), gosmt.Float32Sort).Text() != "-inf" {
+		t.Error("incorrect FP")
+		return
+	}
+	if !gosmt.MakeFPConst(1e300, gosmt.Float32Sort).IsInf() {
+		t.Error("should overflow")
+		return
+	}
+
+	v, ok := fp64(-2.5).ToSBV(gosmt.RM_RNE, 8)
+	if !ok || v.AsLong() != -2 {
+		t.Error("incorrect conversion")
+		return
+	}
+	v, ok = fp64(-2.5).ToSBV(gosmt.RM_RNA, 8)
+	if !ok || v.AsLong() != -3 {
+		t.Error("incorrect conversion")
+		return
+	}
+	if _, ok := fp64(256).ToUBV(gosmt.RM_RNE, 8); ok {
+		t.Error("should be out of range")
+		return
+	}
+	if _, ok := fp64(-0.75).ToUBV(gosmt.RM_RTZ, 8); !ok {
+		t.Error("should be in range")
+		return
+	}
+
+	one := fp32(1)
+	one.Div(gosmt.RM_RTZ, fp32(3))
+	third := fp32(1)
+	third.Div(gosmt.RM_RTP, fp32(3))
+	if third.Bits().AsULong()-one.Bits().AsULong() != 1 {
+		t.Error("incorrect rounding")
+		return
+	}
+}
+
+func randomFloat64(r *rand.Rand) float64 {
+	special := []float64{0, math.Copysign(0, -1), 1, -1, math.Inf(1), math.Inf(-1), math.NaN(),
+		math.MaxFloat64, math.SmallestNonzeroFloat64, 0x1p-1022}
+	if r.Intn(4) == 0 {
+		return special[r.Intn(len(special))]
+	}
+	return math.Float64frombits(r.Uint64())
+}
+
+func randomFloat32(r *rand.Rand) float32 {
+	special := []float32{0, float32(math.Copysign(0, -1)), 1, -1, float32(math.Inf(1)), float32(math.Inf(-1)),
+		float32(math.NaN()), math.MaxFloat32, math.SmallestNonzeroFloat32, 0x1p-126}
+	if r.Intn(4) == 0 {
+		return special[r.Intn(len(special))]
+	}
+	return math.Float32frombits(r.Uint32())
+}
+
+func TestFPConstNative(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 2000; i++ {
+		a, b := randomFloat64(r), randomFloat64(r)
+		ops := []struct {
+			name string
+			res  float64
+			op   func(x *gosmt.FPConst)
+		}{
+			{"add", a + b, func(x *gosmt.FPConst) { x.Add(gosmt.RM_RNE, fp64(b)) }},
+			{"sub", a - b, func(x *gosmt.FPConst) { x.Sub(gosmt.RM_RNE, fp64(b)) }},
+			{"mul", a * b, func(x *gosmt.FPConst) { x.Mul(gosmt.RM_RNE, fp64(b)) }},
+			{"div", a / b, func(x *gosmt.FPConst) { x.Div(gosmt.RM_RNE, fp64(b)) }},
+			{"sqrt", math.Sqrt(a), func(x *gosmt.FPConst) { x.Sqrt(gosmt.RM_RNE) }},
+		}
+		for _, op := range ops {
+			x := fp64(a)
+			op.op(x)
+			if !sameFloat64(x, op.res) {
+				t.Errorf("%s %v %v: %s != %v", op.name, a, b, x.Text(), op.res)
+				return
+			}
+		}
+
+		lt, _ := fp64(a).Lt(fp64(b))
+		eq, _ := fp64(a).Eq(fp64(b))
+		if lt.Value != (a < b) || eq.Value != (a == b) {
+			t.Errorf("cmp %v %v", a, b)
+			return
+		}
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := randomFloat32(r), randomFloat32(r)
+		ops := []struct {
+			name string
+			res  float32
+			op   func(x *gosmt.FPConst)
+		}{
+			{"add", a + b, func(x *gosmt.FPConst) { x.Add(gosmt.RM_RNE, fp32(b)) }},
+			{"mul", a * b, func(x *gosmt.FPConst) { x.Mul(gosmt.RM_RNE, fp32(b)) }},
+			{"div", a / b, func(x *gosmt.FPConst) { x.Div(gosmt.RM_RNE, fp32(b)) }},
+			{"sqrt", float32(math.Sqrt(float64(a))), func(x *gosmt.FPConst) { x.Sqrt(gosmt.RM_RNE) }},
+		}
+		for _, op := range ops {
+			x := fp32(a)
+			op.op(x)
+			if !sameFloat32(x, op.res) {
+				t.Errorf("%s %v %v: %s != %v", op.name, a, b, x.Text(), op.res)
+				return
+			}
+		}
+
+		// float64 to float32 and back
+		c := fp64(float64(a)*3).ToFP(gosmt.RM_RNE, gosmt.Float32Sort)
+		if !sameFloat32(c, float32(float64(a)*3)) {
+			t.Errorf("conversion %v", a)
+			return
+		}
+		if !sameFloat64(fp32(a).ToFP(gosmt.RM_RNE, gosmt.Float64Sort), float64(a)) {
+			t.Errorf("conversion %v", a)
+			return
+		}
+
+		if v, ok := fp32(a).ToSBV(gosmt.RM_RTZ, 64); ok && v.AsLong() != int64(a) {
+			t.Errorf("to_sbv %v", a)
+			return
+		}
+		n := int32(r.Uint32())
+		if !sameFloat32(gosmt.FPConstFromSBV(gosmt.RM_RNE, gosmt.MakeBVConst(int64(n), 32), gosmt.Float32Sort), float32(n)) {
+			t.Errorf("from_sbv %v", n)
+			return
+		}
+	}
+}
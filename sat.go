@@ -0,0 +1,648 @@
+package gosmt
+
+import (
+	"context"
+	"sort"
+)
+
+/*
+ *  A CDCL SAT solver (in the style of MiniSat) with two watched literals,
+ *  first UIP clause learning, VSIDS, phase saving, Luby restarts and solving
+ *  under assumptions.
+ *
+ *  Literals are encoded as var<<1 | sign, where a sign of 1 is a negation
+ */
+
+const (
+	satVarDecay       = 0.95
+	satClauseDecay    = 0.999
+	satRestartBase    = 100
+	satCheckCancelled = 128
+)
+
+func satLit(v int, negated bool) int {
+	if negated {
+		return v<<1 | 1
+	}
+	return v << 1
+}
+
+func satVar(lit int) int {
+	return lit >> 1
+}
+
+type satClause struct {
+	lits     []int
+	learnt   bool
+	activity float64
+}
+
+type satSolver struct {
+	ok       bool
+	clauses  []*satClause
+	learnts  []*satClause
+	watches  [][]*satClause
+	assigns  []int8
+	level    []int
+	reason   []*satClause
+	phase    []bool
+	activity []float64
+	seen     []bool
+
+	trail    []int
+	trailLim []int
+	qhead    int
+
+	// binary max-heap of variables ordered by activity
+	order    []int
+	orderIdx []int
+
+	varInc      float64
+	clauseInc   float64
+	maxLearnts  float64
+	numConflict int
+
+	// the length of the trail at level 0 when the clauses were last simplified
+	simpTrail int
+
+	// the satisfying assignment of the last successful solve
+	model []bool
+	// the assumptions responsible for the last unsatisfiable solve
+	conflict []int
+}
+
+func newSatSolver() *satSolver {
+	return &satSolver{
+		ok:        true,
+		clauses:   make([]*satClause, 0),
+		learnts:   make([]*satClause, 0),
+		watches:   make([][]*satClause, 0),
+		trail:     make([]int, 0),
+		trailLim:  make([]int, 0),
+		order:     make([]int, 0),
+		varInc:    1,
+		clauseInc: 1,
+	}
+}
+
+func (s *satSolver) numVars() int {
+	return len(s.assigns)
+}
+
+func (s *satSolver) newVar() int {
+	v := len(s.assigns)
+	s.watches = append(s.watches, nil, nil)
+	s.assigns = append(s.assigns, 0)
+	s.level = append(s.level, 0)
+	s.reason = append(s.reason, nil)
+	s.phase = append(s.phase, false)
+	s.activity = append(s.activity, 0)
+	s.seen = append(s.seen, false)
+	s.orderIdx = append(s.orderIdx, -1)
+	s.heapInsert(v)
+	return v
+}
+
+// litValue returns 1 if the literal is true, -1 if it is false and 0 if it is
+// unassigned
+func (s *satSolver) litValue(lit int) int8 {
+	v := s.assigns[lit>>1]
+	if lit&1 == 1 {
+		return -v
+	}
+	return v
+}
+
+func (s *satSolver) modelValue(lit int) bool {
+	v := satVar(lit)
+	if v >= len(s.model) {
+		return lit&1 == 1
+	}
+	return s.model[v] != (lit&1 == 1)
+}
+
+func (s *satSolver) decisionLevel() int {
+	return len(s.trailLim)
+}
+
+func (s *satSolver) addClause(lits ...int) bool {
+	if !s.ok {
+		return false
+	}
+	s.cancelUntil(0)
+
+	sorted := append([]int{}, lits...)
+	sort.Ints(sorted)
+	clause := make([]int, 0, len(sorted))
+	for i, lit := range sorted {
+		if s.litValue(lit) == 1 || (i > 0 && sorted[i-1] == lit^1) {
+			// satisfied or tautological
+			return true
+		}
+		if s.litValue(lit) == -1 || (i > 0 && sorted[i-1] == lit) {
+			continue
+		}
+		clause = append(clause, lit)
+	}
+
+	switch len(clause) {
+	case 0:
+		s.ok = false
+	case 1:
+		s.enqueue(clause[0], nil)
+		s.ok = s.propagate() == nil
+	default:
+		c := &satClause{lits: clause}
+		s.clauses = append(s.clauses, c)
+		s.attach(c)
+	}
+	return s.ok
+}
+
+func (s *satSolver) attach(c *satClause) {
+	s.watches[c.lits[0]] = append(s.watches[c.lits[0]], c)
+	s.watches[c.lits[1]] = append(s.watches[c.lits[1]], c)
+}
+
+func (s *satSolver) enqueue(lit int, reason *satClause) {
+	v := satVar(lit)
+	if lit&1 == 1 {
+		s.assigns[v] = -1
+	} else {
+		s.assigns[v] = 1
+	}
+	s.level[v] = s.decisionLevel()
+	s.reason[v] = reason
+	s.trail = append(s.trail, lit)
+}
+
+func (s *satSolver) newDecisionLevel() {
+	s.trailLim = append(s.trailLim, len(s.trail))
+}
+
+func (s *satSolver) cancelUntil(level int) {
+	if s.decisionLevel() <= level {
+		return
+	}
+	for i := len(s.trail) - 1; i >= s.trailLim[level]; i-- {
+		v := satVar(s.trail[i])
+		s.phase[v] = s.assigns[v] == 1
+		s.assigns[v] = 0
+		s.reason[v] = nil
+		if s.orderIdx[v] < 0 {
+			s.heapInsert(v)
+		}
+	}
+	s.trail = s.trail[:s.trailLim[level]]
+	s.trailLim = s.trailLim[:level]
+	s.qhead = len(s.trail)
+}
+
+// propagate returns the conflicting clause, if any. The watches of a literal
+// are the clauses that must be visited when it becomes false
+func (s *satSolver) propagate() *satClause {
+	for s.qhead < len(s.trail) {
+		falseLit := s.trail[s.qhead] ^ 1
+		s.qhead += 1
+
+		ws := s.watches[falseLit]
+		i, j := 0, 0
+		for i < len(ws) {
+			c := ws[i]
+			i += 1
+			if c.lits[0] == falseLit {
+				c.lits[0], c.lits[1] = c.lits[1], c.lits[0]
+			}
+			if s.litValue(c.lits[0]) == 1 {
+				ws[j] = c
+				j += 1
+				continue
+			}
+
+			found := false
+			for k := 2; k < len(c.lits); k++ {
+				if s.litValue(c.lits[k]) != -1 {
+					c.lits[1], c.lits[k] = c.lits[k], c.lits[1]
+					s.watches[c.lits[1]] = append(s.watches[c.lits[1]], c)
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+
+			ws[j] = c
+			j += 1
+			if s.litValue(c.lits[0]) == -1 {
+				for i < len(ws) {
+					ws[j] = ws[i]
+					j += 1
+					i += 1
+				}
+				s.watches[falseLit] = ws[:j]
+				s.qhead = len(s.trail)
+				return c
+			}
+			s.enqueue(c.lits[0], c)
+		}
+		s.watches[falseLit] = ws[:j]
+	}
+	return nil
+}
+
+// analyze computes the first UIP learnt clause, with the asserting literal in
+// the first position, and the level to backjump to
+func (s *satSolver) analyze(confl *satClause) ([]int, int) {
+	learnt := []int{-1}
+	pathC := 0
+	p := -1
+	idx := len(s.trail) - 1
+
+	for {
+		if confl.learnt {
+			s.bumpClause(confl)
+		}
+		start := 0
+		if p != -1 {
+			start = 1
+		}
+		for _, q := range confl.lits[start:] {
+			v := satVar(q)
+			if s.seen[v] || s.level[v] == 0 {
+				continue
+			}
+			s.bumpVar(v)
+			s.seen[v] = true
+			if s.level[v] >= s.decisionLevel() {
+				pathC += 1
+			} else {
+				learnt = append(learnt, q)
+			}
+		}
+
+		for !s.seen[satVar(s.trail[idx])] {
+			idx -= 1
+		}
+		p = s.trail[idx]
+		idx -= 1
+		confl = s.reason[satVar(p)]
+		s.seen[satVar(p)] = false
+		pathC -= 1
+		if pathC == 0 {
+			break
+		}
+	}
+	learnt[0] = p ^ 1
+
+	// Remove the literals implied by the other literals of the clause
+	toClear := append([]int{}, learnt[1:]...)
+	j := 1
+	for i := 1; i < len(learnt); i++ {
+		r := s.reason[satVar(learnt[i])]
+		redundant := r != nil
+		if redundant {
+			for _, q := range r.lits[1:] {
+				if !s.seen[satVar(q)] && s.level[satVar(q)] > 0 {
+					redundant = false
+					break
+				}
+			}
+		}
+		if !redundant {
+			learnt[j] = learnt[i]
+			j += 1
+		}
+	}
+	learnt = learnt[:j]
+	for _, q := range toClear {
+		s.seen[satVar(q)] = false
+	}
+
+	btLevel := 0
+	if len(learnt) > 1 {
+		maxI := 1
+		for i := 2; i < len(learnt); i++ {
+			if s.level[satVar(learnt[i])] > s.level[satVar(learnt[maxI])] {
+				maxI = i
+			}
+		}
+		learnt[1], learnt[maxI] = learnt[maxI], learnt[1]
+		btLevel = s.level[satVar(learnt[1])]
+	}
+	return learnt, btLevel
+}
+
+// analyzeFinal collects the assumptions that imply lit, which is the negation
+// of an assumption
+func (s *satSolver) analyzeFinal(lit int) {
+	s.conflict = []int{lit ^ 1}
+	if s.decisionLevel() == 0 {
+		return
+	}
+	s.seen[satVar(lit)] = true
+	for i := len(s.trail) - 1; i >= s.trailLim[0]; i-- {
+		v := satVar(s.trail[i])
+		if !s.seen[v] {
+			continue
+		}
+		if s.reason[v] == nil {
+			if s.trail[i] != lit^1 {
+				s.conflict = append(s.conflict, s.trail[i])
+			}
+		} else {
+			for _, q := range s.reason[v].lits[1:] {
+				if s.level[satVar(q)] > 0 {
+					s.seen[satVar(q)] = true
+				}
+			}
+		}
+		s.seen[v] = false
+	}
+	s.seen[satVar(lit)] = false
+}
+
+func (s *satSolver) bumpVar(v int) {
+	s.activity[v] += s.varInc
+	if s.activity[v] > 1e100 {
+		for i := range s.activity {
+			s.activity[i] *= 1e-100
+		}
+		s.varInc *= 1e-100
+	}
+	if s.orderIdx[v] >= 0 {
+		s.heapUp(s.orderIdx[v])
+	}
+}
+
+func (s *satSolver) bumpClause(c *satClause) {
+	c.activity += s.clauseInc
+	if c.activity > 1e20 {
+		for _, l := range s.learnts {
+			l.activity *= 1e-20
+		}
+		s.clauseInc *= 1e-20
+	}
+}
+
+func (s *satSolver) locked(c *satClause) bool {
+	v := satVar(c.lits[0])
+	return s.reason[v] == c && s.litValue(c.lits[0]) == 1
+}
+
+// reduceDB removes half of the learnt clauses, the least active ones first
+func (s *satSolver) reduceDB() {
+	sort.Slice(s.learnts, func(i, j int) bool {
+		return s.learnts[i].activity < s.learnts[j].activity
+	})
+	removed := make(map[*satClause]bool)
+	kept := make([]*satClause, 0, len(s.learnts))
+	for i, c := range s.learnts {
+		if i < len(s.learnts)/2 && len(c.lits) > 2 && !s.locked(c) {
+			removed[c] = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	s.learnts = kept
+	s.detach(removed)
+}
+
+// detach removes the clauses from the watches
+func (s *satSolver) detach(removed map[*satClause]bool) {
+	for i, ws := range s.watches {
+		j := 0
+		for _, c := range ws {
+			if !removed[c] {
+				ws[j] = c
+				j += 1
+			}
+		}
+		s.watches[i] = ws[:j]
+	}
+}
+
+// simplify removes the clauses satisfied at level 0, e.g., the ones guarded by
+// a falsified activation literal. It does nothing if no literal was fixed at
+// level 0 since the previous call
+func (s *satSolver) simplify() {
+	if s.decisionLevel() != 0 || len(s.trail) == s.simpTrail {
+		return
+	}
+	if s.propagate() != nil {
+		s.ok = false
+		return
+	}
+	s.simpTrail = len(s.trail)
+
+	removed := make(map[*satClause]bool)
+	s.clauses = s.removeSatisfied(s.clauses, removed)
+	s.learnts = s.removeSatisfied(s.learnts, removed)
+	if len(removed) == 0 {
+		return
+	}
+	// the reasons of the literals fixed at level 0 are never analyzed
+	for _, lit := range s.trail {
+		if removed[s.reason[satVar(lit)]] {
+			s.reason[satVar(lit)] = nil
+		}
+	}
+	s.detach(removed)
+}
+
+func (s *satSolver) removeSatisfied(clauses []*satClause, removed map[*satClause]bool) []*satClause {
+	kept := clauses[:0]
+	for _, c := range clauses {
+		satisfied := false
+		for _, lit := range c.lits {
+			if s.litValue(lit) == 1 {
+				satisfied = true
+				break
+			}
+		}
+		if satisfied {
+			removed[c] = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	for i := len(kept); i < len(clauses); i++ {
+		clauses[i] = nil
+	}
+	return kept
+}
+
+func (s *satSolver) pickBranch() int {
+	for len(s.order) > 0 {
+		v := s.heapRemoveMax()
+		if s.assigns[v] == 0 {
+			return satLit(v, !s.phase[v])
+		}
+	}
+	return -1
+}
+
+func satLuby(i int) int {
+	size, seq := 1, 0
+	for size < i+1 {
+		seq += 1
+		size = 2*size + 1
+	}
+	for size-1 != i {
+		size = (size - 1) >> 1
+		seq -= 1
+		i = i % size
+	}
+	return 1 << seq
+}
+
+// solve checks the satisfiability of the clauses under the assumptions. The
+// returned error is set if the search is cancelled
+func (s *satSolver) solve(ctx context.Context, assumptions []int) (int, error) {
+	s.model = nil
+	s.conflict = nil
+	s.simplify()
+	if !s.ok {
+		return RESULT_UNSAT, nil
+	}
+	if s.maxLearnts == 0 {
+		s.maxLearnts = float64(len(s.clauses))/3 + 1000
+	}
+
+	defer s.cancelUntil(0)
+	for restart := 0; ; restart++ {
+		if err := ctx.Err(); err != nil {
+			return RESULT_UNKNOWN, err
+		}
+		r, err := s.search(ctx, satLuby(restart)*satRestartBase, assumptions)
+		if r != RESULT_UNKNOWN || err != nil {
+			return r, err
+		}
+		s.maxLearnts *= 1.05
+	}
+}
+
+func (s *satSolver) search(ctx context.Context, budget int, assumptions []int) (int, error) {
+	conflicts := 0
+	for {
+		confl := s.propagate()
+		if confl != nil {
+			conflicts += 1
+			s.numConflict += 1
+			if s.decisionLevel() == 0 {
+				s.ok = false
+				return RESULT_UNSAT, nil
+			}
+
+			learnt, btLevel := s.analyze(confl)
+			s.cancelUntil(btLevel)
+			if len(learnt) == 1 {
+				s.enqueue(learnt[0], nil)
+			} else {
+				c := &satClause{lits: learnt, learnt: true}
+				s.learnts = append(s.learnts, c)
+				s.attach(c)
+				s.bumpClause(c)
+				s.enqueue(learnt[0], c)
+			}
+			s.varInc /= satVarDecay
+			s.clauseInc /= satClauseDecay
+
+			if s.numConflict%satCheckCancelled == 0 {
+				if err := ctx.Err(); err != nil {
+					return RESULT_UNKNOWN, err
+				}
+			}
+			continue
+		}
+
+		if conflicts >= budget {
+			s.cancelUntil(0)
+			return RESULT_UNKNOWN, nil
+		}
+		if float64(len(s.learnts)-len(s.trail)) >= s.maxLearnts {
+			s.reduceDB()
+		}
+
+		next := -1
+		for s.decisionLevel() < len(assumptions) {
+			p := assumptions[s.decisionLevel()]
+			if s.litValue(p) == 1 {
+				s.newDecisionLevel()
+			} else if s.litValue(p) == -1 {
+				s.analyzeFinal(p ^ 1)
+				return RESULT_UNSAT, nil
+			} else {
+				next = p
+				break
+			}
+		}
+		if next == -1 {
+			next = s.pickBranch()
+			if next == -1 {
+				s.model = make([]bool, len(s.assigns))
+				for v, a := range s.assigns {
+					s.model[v] = a == 1
+				}
+				return RESULT_SAT, nil
+			}
+		}
+		s.newDecisionLevel()
+		s.enqueue(next, nil)
+	}
+}
+
+func (s *satSolver) heapLess(i, j int) bool {
+	return s.activity[s.order[i]] > s.activity[s.order[j]]
+}
+
+func (s *satSolver) heapSwap(i, j int) {
+	s.order[i], s.order[j] = s.order[j], s.order[i]
+	s.orderIdx[s.order[i]] = i
+	s.orderIdx[s.order[j]] = j
+}
+
+func (s *satSolver) heapUp(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !s.heapLess(i, parent) {
+			break
+		}
+		s.heapSwap(i, parent)
+		i = parent
+	}
+}
+
+func (s *satSolver) heapDown(i int) {
+	for {
+		child := 2*i + 1
+		if child >= len(s.order) {
+			break
+		}
+		if child+1 < len(s.order) && s.heapLess(child+1, child) {
+			child += 1
+		}
+		if !s.heapLess(child, i) {
+			break
+		}
+		s.heapSwap(i, child)
+		i = child
+	}
+}
+
+func (s *satSolver) heapInsert(v int) {
+	s.order = append(s.order, v)
+	s.orderIdx[v] = len(s.order) - 1
+	s.heapUp(len(s.order) - 1)
+}
+
+func (s *satSolver) heapRemoveMax() int {
+	v := s.order[0]
+	s.heapSwap(0, len(s.order)-1)
+	s.order = s.order[:len(s.order)-1]
+	s.orderIdx[v] = -1
+	if len(s.order) > 0 {
+		s.heapDown(0)
+	}
+	return v
+}
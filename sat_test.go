@@ -0,0 +1,176 @@
+package gosmt
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func pigeonhole(s *satSolver, pigeons, holes int) {
+	vars := make([][]int, pigeons)
+	for i := range vars {
+		vars[i] = make([]int, holes)
+		for j := range vars[i] {
+			vars[i][j] = s.newVar()
+		}
+	}
+	for i := 0; i < pigeons; i++ {
+		clause := make([]int, 0)
+		for j := 0; j < holes; j++ {
+			clause = append(clause, satLit(vars[i][j], false))
+		}
+		s.addClause(clause...)
+	}
+	for j := 0; j < holes; j++ {
+		for i1 := 0; i1 < pigeons; i1++ {
+			for i2 := i1 + 1; i2 < pigeons; i2++ {
+				s.addClause(satLit(vars[i1][j], true), satLit(vars[i2][j], true))
+			}
+		}
+	}
+}
+
+func TestSatPigeonhole(t *testing.T) {
+	s := newSatSolver()
+	pigeonhole(s, 7, 6)
+	if r, _ := s.solve(context.Background(), nil); r != RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+
+	s = newSatSolver()
+	pigeonhole(s, 6, 6)
+	if r, _ := s.solve(context.Background(), nil); r != RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+}
+
+func bruteForceSat(nvars int, clauses [][]int) bool {
+	for assignment := 0; assignment < 1<<nvars; assignment++ {
+		sat := true
+		for _, clause := range clauses {
+			clauseSat := false
+			for _, lit := range clause {
+				clauseSat = clauseSat || (assignment>>satVar(lit)&1 == 1) != (lit&1 == 1)
+			}
+			if !clauseSat {
+				sat = false
+				break
+			}
+		}
+		if sat {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSatRandom3Sat(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for round := 0; round < 200; round++ {
+		s := newSatSolver()
+		nvars := 12
+		for i := 0; i < nvars; i++ {
+			s.newVar()
+		}
+		clauses := make([][]int, 0)
+		for i := 0; i < 54; i++ {
+			clause := make([]int, 3)
+			for j := range clause {
+				clause[j] = satLit(rng.Intn(nvars), rng.Intn(2) == 0)
+			}
+			clauses = append(clauses, clause)
+			s.addClause(clause...)
+		}
+
+		r, _ := s.solve(context.Background(), nil)
+		if (r == RESULT_SAT) != bruteForceSat(nvars, clauses) {
+			t.Error("wrong result")
+			return
+		}
+		if r != RESULT_SAT {
+			continue
+		}
+		for _, clause := range clauses {
+			sat := false
+			for _, lit := range clause {
+				sat = sat || s.modelValue(lit)
+			}
+			if !sat {
+				t.Error("invalid model")
+				return
+			}
+		}
+	}
+}
+
+func TestSatAssumptions(t *testing.T) {
+	s := newSatSolver()
+	a := satLit(s.newVar(), false)
+	b := satLit(s.newVar(), false)
+	c := satLit(s.newVar(), false)
+	d := satLit(s.newVar(), false)
+
+	// a -> b, b -> c
+	s.addClause(a^1, b)
+	s.addClause(b^1, c)
+
+	if r, _ := s.solve(context.Background(), []int{d, a, c ^ 1}); r != RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+	if len(s.conflict) != 2 {
+		t.Error("unexpected failed assumptions")
+		return
+	}
+	for _, lit := range s.conflict {
+		if lit != a && lit != c^1 {
+			t.Error("unexpected failed assumptions")
+			return
+		}
+	}
+
+	if r, _ := s.solve(context.Background(), []int{a}); r != RESULT_SAT || !s.modelValue(c) {
+		t.Error("should be sat")
+		return
+	}
+}
+
+func TestSatSimplify(t *testing.T) {
+	s := newSatSolver()
+	act := satLit(s.newVar(), false)
+	a := satLit(s.newVar(), false)
+	b := satLit(s.newVar(), false)
+	c := satLit(s.newVar(), false)
+
+	// the clauses guarded by act are dropped once act is falsified
+	s.addClause(act^1, a, b)
+	s.addClause(act^1, a^1, c)
+	s.addClause(a, b, c)
+	if r, _ := s.solve(context.Background(), []int{act, b ^ 1}); r != RESULT_SAT || !s.modelValue(c) {
+		t.Error("should be sat")
+		return
+	}
+	s.addClause(act ^ 1)
+	if r, _ := s.solve(context.Background(), []int{a, c ^ 1}); r != RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	if len(s.clauses) != 1 {
+		t.Errorf("%d clauses after the simplification", len(s.clauses))
+		return
+	}
+}
+
+func TestSatCancel(t *testing.T) {
+	s := newSatSolver()
+	pigeonhole(s, 12, 11)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r, err := s.solve(ctx, nil); r != RESULT_UNKNOWN || err == nil {
+		t.Error("should be cancelled")
+		return
+	}
+}
@@ -0,0 +1,406 @@
+package gosmt
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var smtlib2Ops = map[int]string{
+	TY_NOT:  "bvnot",
+	TY_NEG:  "bvneg",
+	TY_SHL:  "bvshl",
+	TY_LSHR: "bvlshr",
+	TY_ASHR: "bvashr",
+	TY_AND:  "bvand",
+	TY_OR:   "bvor",
+	TY_XOR:  "bvxor",
+	TY_ADD:  "bvadd",
+	TY_MUL:  "bvmul",
+	TY_SDIV: "bvsdiv",
+	TY_UDIV: "bvudiv",
+	TY_SREM: "bvsrem",
+	TY_UREM: "bvurem",
+
+	TY_ULT: "bvult",
+	TY_ULE: "bvule",
+	TY_UGT: "bvugt",
+	TY_UGE: "bvuge",
+	TY_SLT: "bvslt",
+	TY_SLE: "bvsle",
+	TY_SGT: "bvsgt",
+	TY_SGE: "bvsge",
+	TY_EQ:  "=",
+
+	TY_BOOL_NOT: "not",
+	TY_BOOL_AND: "and",
+	TY_BOOL_OR:  "or",
+
+	TY_FP_NEG:  "fp.neg",
+	TY_FP_ABS:  "fp.abs",
+	TY_FP_SQRT: "fp.sqrt",
+	TY_FP_ADD:  "fp.add",
+	TY_FP_SUB:  "fp.sub",
+	TY_FP_MUL:  "fp.mul",
+	TY_FP_DIV:  "fp.div",
+	TY_FP_LT:   "fp.lt",
+	TY_FP_LE:   "fp.leq",
+	TY_FP_GT:   "fp.gt",
+	TY_FP_GE:   "fp.geq",
+	TY_FP_EQ:   "fp.eq",
+}
+
+var smtlib2RoundingModes = map[RoundingMode]string{
+	RM_RNE: "RNE",
+	RM_RNA: "RNA",
+	RM_RTP: "RTP",
+	RM_RTN: "RTN",
+	RM_RTZ: "RTZ",
+}
+
+func isSmtlib2SimpleSymbolChar(c rune) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	return strings.ContainsRune("~!@$%^&*_-+=<>.?/", c)
+}
+
+// The reserved words, the commands and the Boolean constants must be quoted to
+// be used as names
+var smtlib2Reserved = map[string]bool{
+	"!": true, "_": true, "as": true, "BINARY": true, "DECIMAL": true,
+	"exists": true, "HEXADECIMAL": true, "forall": true, "let": true,
+	"match": true, "NUMERAL": true, "par": true, "STRING": true,
+	"assert": true, "check-sat": true, "check-sat-assuming": true,
+	"declare-const": true, "declare-datatype": true, "declare-datatypes": true,
+	"declare-fun": true, "declare-sort": true, "define-fun": true,
+	"define-fun-rec": true, "define-funs-rec": true, "define-sort": true,
+	"echo": true, "exit": true, "get-assertions": true, "get-assignment": true,
+	"get-info": true, "get-model": true, "get-option": true, "get-proof": true,
+	"get-unsat-assumptions": true, "get-unsat-core": true, "get-value": true,
+	"pop": true, "push": true, "reset": true, "reset-assertions": true,
+	"set-info": true, "set-logic": true, "set-option": true,
+	"true": true, "false": true,
+}
+
+func smtlib2Symbol(name string) string {
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') || smtlib2Reserved[name] {
+		return "|" + name + "|"
+	}
+	for _, c := range name {
+		if !isSmtlib2SimpleSymbolChar(c) {
+			return "|" + name + "|"
+		}
+	}
+	return name
+}
+
+func smtlib2Const(c *BVConst) string {
+	if c.Size%4 == 0 {
+		return fmt.Sprintf("#x%0*x", c.Size/4, c.value)
+	}
+	return smtlib2Bits(c)
+}
+
+func smtlib2Bits(c *BVConst) string {
+	return fmt.Sprintf("#b%0*b", c.Size, c.value)
+}
+
+func smtlib2Sort(e internalExpr) string {
+	if bv, ok := e.(internalBVExpr); ok {
+		return fmt.Sprintf("(_ BitVec %d)", bv.size())
+	}
+	if f, ok := e.(internalFPExpr); ok {
+		return fmt.Sprintf("(_ FloatingPoint %d %d)", f.sort().EBits, f.sort().SBits)
+	}
+	if a, ok := e.(internalArrayExpr); ok {
+		return fmt.Sprintf("(Array (_ BitVec %d) (_ BitVec %d))", a.indexSize(), a.valueSize())
+	}
+	return "Bool"
+}
+
+func conjuncts(e *BoolExprPtr) []*BoolExprPtr {
+	if e.Kind() == TY_BOOL_AND {
+		return e.e.(*internalBoolExprNaryOp).children
+	}
+	return []*BoolExprPtr{e}
+}
+
+type smtlib2Printer struct {
+	refs    map[uintptr]int
+	names   map[uintptr]string
+	symbols map[string]bool
+	arrays  map[string]*internalArrayS
+	funs    map[string]*FunDecl
+	shared  []internalExpr
+	counter int
+	hasFP   bool
+}
+
+func newSmtlib2Printer() *smtlib2Printer {
+	return &smtlib2Printer{
+		refs:    make(map[uintptr]int),
+		names:   make(map[uintptr]string),
+		symbols: make(map[string]bool),
+		arrays:  make(map[string]*internalArrayS),
+		funs:    make(map[string]*FunDecl),
+		shared:  make([]internalExpr, 0),
+	}
+}
+
+// visit counts the references to every subterm of e and collects, in
+// post-order, the non-leaf subterms that are referenced more than once
+func (p *smtlib2Printer) visit(e internalExpr) {
+	if _, ok := p.refs[e.rawPtr()]; ok {
+		p.refs[e.rawPtr()] += 1
+		if p.refs[e.rawPtr()] == 2 && !e.isLeaf() {
+			p.shared = append(p.shared, e)
+		}
+		return
+	}
+	p.refs[e.rawPtr()] = 1
+	if e.kind() == TY_SYM {
+		p.symbols[e.(*internalBVS).name] = true
+	}
+	if e.kind() == TY_ARRAY_SYM {
+		p.symbols[e.(*internalArrayS).name] = true
+		p.arrays[e.(*internalArrayS).name] = e.(*internalArrayS)
+	}
+	if _, ok := e.(internalFPExpr); ok {
+		p.hasFP = true
+	}
+	if e.kind() == TY_APPLY {
+		p.symbols[e.(*internalBVExprApply).fun.name] = true
+		p.funs[e.(*internalBVExprApply).fun.name] = e.(*internalBVExprApply).fun
+	}
+	for _, child := range e.subexprs() {
+		p.visit(child)
+	}
+}
+
+func (p *smtlib2Printer) sharedInPostOrder() []internalExpr {
+	// a subterm becomes shared when it is reached for the second time, which
+	// can happen after some of its parents were already marked as shared
+	order := make(map[uintptr]int)
+	idx := 0
+	var walk func(e internalExpr)
+	walk = func(e internalExpr) {
+		if _, ok := order[e.rawPtr()]; ok {
+			return
+		}
+		for _, child := range e.subexprs() {
+			walk(child)
+		}
+		order[e.rawPtr()] = idx
+		idx += 1
+	}
+	for _, e := range p.shared {
+		walk(e)
+	}
+	res := make([]internalExpr, len(p.shared))
+	copy(res, p.shared)
+	sort.Slice(res, func(i, j int) bool { return order[res[i].rawPtr()] < order[res[j].rawPtr()] })
+	return res
+}
+
+func (p *smtlib2Printer) bind(e internalExpr) string {
+	for {
+		name := fmt.Sprintf("?e%d", p.counter)
+		p.counter += 1
+		if !p.symbols[name] {
+			p.names[e.rawPtr()] = name
+			return name
+		}
+	}
+}
+
+func (p *smtlib2Printer) nary(op string, children []string) string {
+	res := children[0]
+	for i := 1; i < len(children); i++ {
+		res = fmt.Sprintf("(%s %s %s)", op, res, children[i])
+	}
+	return res
+}
+
+func (p *smtlib2Printer) term(e internalExpr) string {
+	if name, ok := p.names[e.rawPtr()]; ok {
+		return name
+	}
+
+	children := make([]string, 0)
+	for _, child := range e.subexprs() {
+		children = append(children, p.term(child))
+	}
+
+	switch e.kind() {
+	case TY_SYM:
+		return smtlib2Symbol(e.(*internalBVS).name)
+	case TY_CONST:
+		e := e.(*internalBVV)
+		return smtlib2Const(&e.Value)
+	case TY_EXTRACT:
+		e := e.(*internalBVExprExtract)
+		return fmt.Sprintf("((_ extract %d %d) %s)", e.high, e.low, children[0])
+	case TY_CONCAT:
+		return p.nary("concat", children)
+	case TY_ZEXT:
+		e := e.(*internalBVExprExtend)
+		return fmt.Sprintf("((_ zero_extend %d) %s)", e.n, children[0])
+	case TY_SEXT:
+		e := e.(*internalBVExprExtend)
+		return fmt.Sprintf("((_ sign_extend %d) %s)", e.n, children[0])
+	case TY_ITE:
+		// subexprs() of an ITE are iftrue, iffalse, cond
+		return fmt.Sprintf("(ite %s %s %s)", children[2], children[0], children[1])
+	case TY_NOT, TY_NEG, TY_BOOL_NOT:
+		return fmt.Sprintf("(%s %s)", smtlib2Ops[e.kind()], children[0])
+	case TY_SHL, TY_LSHR, TY_ASHR, TY_SDIV, TY_UDIV, TY_SREM, TY_UREM,
+		TY_AND, TY_OR, TY_XOR, TY_ADD, TY_MUL:
+		return p.nary(smtlib2Ops[e.kind()], children)
+	case TY_ULT, TY_ULE, TY_UGT, TY_UGE, TY_SLT, TY_SLE, TY_SGT, TY_SGE, TY_EQ:
+		return fmt.Sprintf("(%s %s %s)", smtlib2Ops[e.kind()], children[0], children[1])
+	case TY_BOOL_CONST:
+		e := e.(*internalBoolVal)
+		if e.Value.Value {
+			return "true"
+		}
+		return "false"
+	case TY_BOOL_AND, TY_BOOL_OR:
+		return fmt.Sprintf("(%s %s)", smtlib2Ops[e.kind()], strings.Join(children, " "))
+	case TY_ARRAY_SYM:
+		return smtlib2Symbol(e.(*internalArrayS).name)
+	case TY_ARRAY_CONST:
+		return fmt.Sprintf("((as const %s) %s)", smtlib2Sort(e), children[0])
+	case TY_STORE:
+		return fmt.Sprintf("(store %s %s %s)", children[0], children[1], children[2])
+	case TY_SELECT:
+		return fmt.Sprintf("(select %s %s)", children[0], children[1])
+	case TY_APPLY:
+		e := e.(*internalBVExprApply)
+		return fmt.Sprintf("(%s %s)", smtlib2Symbol(e.fun.name), strings.Join(children, " "))
+	case TY_FP_CONST:
+		e := e.(*internalFPV)
+		bits := e.Value.Bits()
+		size := e.Value.Sort.Size()
+		return fmt.Sprintf("(fp %s %s %s)",
+			smtlib2Bits(bits.Slice(size-1, size-1)),
+			smtlib2Bits(bits.Slice(size-2, e.Value.Sort.SBits-1)),
+			smtlib2Bits(bits.Slice(e.Value.Sort.SBits-2, 0)))
+	case TY_FP_FROM_BITS:
+		e := e.(*internalFPExprConvert)
+		return fmt.Sprintf("((_ to_fp %d %d) %s)", e.s.EBits, e.s.SBits, children[0])
+	case TY_FP_FROM_SBV, TY_FP_TO_FP:
+		e := e.(*internalFPExprConvert)
+		return fmt.Sprintf("((_ to_fp %d %d) %s %s)", e.s.EBits, e.s.SBits, smtlib2RoundingModes[e.rm], children[0])
+	case TY_FP_FROM_UBV:
+		e := e.(*internalFPExprConvert)
+		return fmt.Sprintf("((_ to_fp_unsigned %d %d) %s %s)", e.s.EBits, e.s.SBits, smtlib2RoundingModes[e.rm], children[0])
+	case TY_FP_NEG, TY_FP_ABS:
+		return fmt.Sprintf("(%s %s)", smtlib2Ops[e.kind()], children[0])
+	case TY_FP_SQRT, TY_FP_ADD, TY_FP_SUB, TY_FP_MUL, TY_FP_DIV:
+		e := e.(*internalFPExprArith)
+		return fmt.Sprintf("(%s %s %s)", smtlib2Ops[e.ty], smtlib2RoundingModes[e.rm], strings.Join(children, " "))
+	case TY_FP_LT, TY_FP_LE, TY_FP_GT, TY_FP_GE, TY_FP_EQ:
+		return fmt.Sprintf("(%s %s %s)", smtlib2Ops[e.kind()], children[0], children[1])
+	case TY_FP_TO_BITS:
+		// not part of the standard, but supported by Z3
+		return fmt.Sprintf("(fp.to_ieee_bv %s)", children[0])
+	case TY_FP_TO_UBV:
+		e := e.(*internalBVExprFromFP)
+		return fmt.Sprintf("((_ fp.to_ubv %d) %s %s)", e.n, smtlib2RoundingModes[e.rm], children[0])
+	case TY_FP_TO_SBV:
+		e := e.(*internalBVExprFromFP)
+		return fmt.Sprintf("((_ fp.to_sbv %d) %s %s)", e.n, smtlib2RoundingModes[e.rm], children[0])
+	}
+	panic("invalid expression type")
+}
+
+func ToSMTLIB2(e ExprPtr) string {
+	return smtlib2Term(e.getInternal())
+}
+
+func smtlib2Term(e internalExpr) string {
+	p := newSmtlib2Printer()
+	p.visit(e)
+
+	b := strings.Builder{}
+	shared := p.sharedInPostOrder()
+	for _, s := range shared {
+		def := p.term(s)
+		b.WriteString(fmt.Sprintf("(let ((%s %s)) ", p.bind(s), def))
+	}
+	b.WriteString(p.term(e))
+	b.WriteString(strings.Repeat(")", len(shared)))
+	return b.String()
+}
+
+func (s *Solver) DumpSMTLIB2(w io.Writer) error {
+	// the constraints are asserted in the order they were added, so that the
+	// dumps of the same queries can be compared
+	assertions := s.Constraints()
+
+	p := newSmtlib2Printer()
+	for _, a := range assertions {
+		p.visit(a.e)
+	}
+
+	syms := s.eb.InvolvedInputs(s.conjunction(assertions))
+	sort.Slice(syms, func(i, j int) bool { return syms[i].String() < syms[j].String() })
+
+	arrays := make([]*internalArrayS, 0, len(p.arrays))
+	for _, a := range p.arrays {
+		arrays = append(arrays, a)
+	}
+	sort.Slice(arrays, func(i, j int) bool { return arrays[i].name < arrays[j].name })
+
+	funs := make([]*FunDecl, 0, len(p.funs))
+	for _, f := range p.funs {
+		funs = append(funs, f)
+	}
+	sort.Slice(funs, func(i, j int) bool { return funs[i].name < funs[j].name })
+
+	logic := "QF_"
+	if len(arrays) > 0 {
+		logic += "A"
+	}
+	if len(funs) > 0 {
+		logic += "UF"
+	}
+	logic += "BV"
+	if p.hasFP {
+		logic += "FP"
+	}
+
+	b := strings.Builder{}
+	b.WriteString(fmt.Sprintf("(set-logic %s)\n", logic))
+	for _, sym := range syms {
+		b.WriteString(fmt.Sprintf("(declare-const %s (_ BitVec %d))\n", smtlib2Symbol(sym.String()), sym.Size()))
+	}
+	for _, a := range arrays {
+		b.WriteString(fmt.Sprintf("(declare-const %s %s)\n", smtlib2Symbol(a.name), smtlib2Sort(a)))
+	}
+	for _, f := range funs {
+		args := make([]string, len(f.argSizes))
+		for i, size := range f.argSizes {
+			args[i] = fmt.Sprintf("(_ BitVec %d)", size)
+		}
+		b.WriteString(fmt.Sprintf("(declare-fun %s (%s) (_ BitVec %d))\n", smtlib2Symbol(f.name), strings.Join(args, " "), f.retSize))
+	}
+	for _, e := range p.sharedInPostOrder() {
+		def := p.term(e)
+		b.WriteString(fmt.Sprintf("(define-fun %s () %s %s)\n", p.bind(e), smtlib2Sort(e), def))
+	}
+	for _, a := range assertions {
+		if a.IsConst() {
+			if v, _ := a.GetConst(); v {
+				continue
+			}
+		}
+		b.WriteString(fmt.Sprintf("(assert %s)\n", p.term(a.e)))
+	}
+	b.WriteString("(check-sat)\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,698 @@
+package gosmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// An error reported by the solver process with an (error "...") response
+type smtlib2SolverError struct {
+	msg string
+}
+
+func (e *smtlib2SolverError) Error() string {
+	return "solver error: " + e.msg
+}
+
+var errSmtlib2Unknown = errors.New("the solver returned unknown")
+
+type smtlib2Response struct {
+	sexpr *smtlib2Sexpr
+	err   error
+}
+
+type smtlib2Decl struct {
+	depth int
+	// the size of bit-vector symbols, 0 for arrays and functions
+	size uint
+}
+
+type smtlib2App struct {
+	depth int
+	fun   *FunDecl
+	term  string
+	args  []string
+}
+
+// A smtlib2Conn carries the commands to a solver and its responses
+type smtlib2Conn interface {
+	send(command string) error
+	responses() <-chan smtlib2Response
+	// close stops the solver, the command that is running is interrupted
+	close()
+}
+
+// A smtlib2Pipe talks to a solver process through its standard input and
+// output
+type smtlib2Pipe struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	resp  chan smtlib2Response
+	done  chan struct{}
+}
+
+func startSmtlib2Pipe(command string, args []string) (smtlib2Conn, error) {
+	cmd := exec.Command(command, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &smtlib2Pipe{
+		cmd:   cmd,
+		stdin: stdin,
+		resp:  make(chan smtlib2Response),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		rd := newSmtlib2Reader(stdout)
+		for {
+			sexpr, err := rd.read()
+			if err == io.EOF {
+				err = fmt.Errorf("the solver process terminated")
+			}
+			select {
+			case p.resp <- smtlib2Response{sexpr, err}:
+			case <-p.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (p *smtlib2Pipe) send(command string) error {
+	_, err := io.WriteString(p.stdin, command+"\n")
+	return err
+}
+
+func (p *smtlib2Pipe) responses() <-chan smtlib2Response {
+	return p.resp
+}
+
+func (p *smtlib2Pipe) close() {
+	close(p.done)
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+/*
+ *  A running solver. The solver mirrors the assertions and the scopes of the
+ *  backend up to `sent` and `depth`, the scopes popped by the backend are sent
+ *  with the next command
+ */
+type smtlib2Process struct {
+	conn smtlib2Conn
+
+	sent  int
+	depth int
+	pops  int
+
+	declared map[string]smtlib2Decl
+	apps     map[uintptr]smtlib2App
+}
+
+func startSmtlib2Process(solver *smtlib2Solver) (*smtlib2Process, error) {
+	conn, err := solver.connect()
+	if err != nil {
+		return nil, err
+	}
+	return &smtlib2Process{
+		conn:     conn,
+		declared: make(map[string]smtlib2Decl),
+		apps:     make(map[uintptr]smtlib2App),
+	}, nil
+}
+
+func (p *smtlib2Process) stop() {
+	p.conn.close()
+}
+
+func (p *smtlib2Process) send(command string) error {
+	return p.conn.send(command)
+}
+
+func (p *smtlib2Process) response(ctx context.Context) (*smtlib2Sexpr, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-p.conn.responses():
+		if r.err != nil {
+			return nil, r.err
+		}
+		if r.sexpr.isList && len(r.sexpr.list) == 2 && r.sexpr.list[0].isAtom("error") {
+			return nil, &smtlib2SolverError{strings.Trim(r.sexpr.list[1].atom, "\"")}
+		}
+		return r.sexpr, nil
+	}
+}
+
+// query sends a command and returns its response
+func (p *smtlib2Process) query(ctx context.Context, command string) (*smtlib2Sexpr, error) {
+	if err := p.send(command); err != nil {
+		return nil, err
+	}
+	return p.response(ctx)
+}
+
+// exec sends a command whose response must be `success`
+func (p *smtlib2Process) exec(ctx context.Context, command string) error {
+	r, err := p.query(ctx, command)
+	if err != nil {
+		return err
+	}
+	if !r.isAtom("success") {
+		return fmt.Errorf("unexpected response %s to %s", r, command)
+	}
+	return nil
+}
+
+func (p *smtlib2Process) push(ctx context.Context) error {
+	p.depth += 1
+	return p.exec(ctx, "(push 1)")
+}
+
+// popTo forgets the scopes deeper than depth, they are popped by the next
+// flush
+func (p *smtlib2Process) popTo(depth int) {
+	if p.depth <= depth {
+		return
+	}
+	p.pops += p.depth - depth
+	p.depth = depth
+	for name, decl := range p.declared {
+		if decl.depth > depth {
+			delete(p.declared, name)
+		}
+	}
+	for id, app := range p.apps {
+		if app.depth > depth {
+			delete(p.apps, id)
+		}
+	}
+}
+
+func (p *smtlib2Process) flush(ctx context.Context) error {
+	if p.pops == 0 {
+		return nil
+	}
+	pops := p.pops
+	p.pops = 0
+	return p.exec(ctx, fmt.Sprintf("(pop %d)", pops))
+}
+
+// declare declares the symbols and the functions in e that are not declared
+func (p *smtlib2Process) declare(ctx context.Context, e internalExpr) error {
+	visited := make(map[uintptr]bool)
+	queue := []internalExpr{e}
+	for len(queue) > 0 {
+		el := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if visited[el.rawPtr()] {
+			continue
+		}
+		visited[el.rawPtr()] = true
+		queue = append(queue, el.subexprs()...)
+
+		var name, decl string
+		size := uint(0)
+		switch el.kind() {
+		case TY_SYM:
+			sym := el.(*internalBVS)
+			name, size = sym.name, sym.size()
+			decl = fmt.Sprintf("(declare-const %s %s)", smtlib2Symbol(name), smtlib2Sort(el))
+		case TY_ARRAY_SYM:
+			name = el.(*internalArrayS).name
+			decl = fmt.Sprintf("(declare-const %s %s)", smtlib2Symbol(name), smtlib2Sort(el))
+		case TY_APPLY:
+			app := el.(*internalBVExprApply)
+			if _, ok := p.apps[el.rawPtr()]; !ok {
+				args := make([]string, len(app.args))
+				for i, a := range app.args {
+					args[i] = smtlib2Term(a.e)
+				}
+				p.apps[el.rawPtr()] = smtlib2App{depth: p.depth, fun: app.fun, term: smtlib2Term(el), args: args}
+			}
+			name = app.fun.name
+			sorts := make([]string, len(app.fun.argSizes))
+			for i, size := range app.fun.argSizes {
+				sorts[i] = fmt.Sprintf("(_ BitVec %d)", size)
+			}
+			decl = fmt.Sprintf("(declare-fun %s (%s) (_ BitVec %d))", smtlib2Symbol(name), strings.Join(sorts, " "), app.fun.retSize)
+		default:
+			continue
+		}
+		if _, ok := p.declared[name]; ok {
+			continue
+		}
+		if err := p.exec(ctx, decl); err != nil {
+			return err
+		}
+		p.declared[name] = smtlib2Decl{depth: p.depth, size: size}
+	}
+	return nil
+}
+
+func (p *smtlib2Process) assert(ctx context.Context, e *BoolExprPtr) error {
+	if err := p.declare(ctx, e.e); err != nil {
+		return err
+	}
+	return p.exec(ctx, fmt.Sprintf("(assert %s)", smtlib2Term(e.e)))
+}
+
+func (p *smtlib2Process) checkSat(ctx context.Context, command string) (int, error) {
+	r, err := p.query(ctx, command)
+	if err != nil {
+		return RESULT_UNKNOWN, err
+	}
+	switch {
+	case r.isAtom("sat"):
+		return RESULT_SAT, nil
+	case r.isAtom("unsat"):
+		return RESULT_UNSAT, nil
+	case r.isAtom("unknown"):
+		// not an error of the process, see errSmtlib2Unknown
+		return RESULT_UNKNOWN, nil
+	}
+	return RESULT_UNKNOWN, fmt.Errorf("unexpected response %s to %s", r, command)
+}
+
+// values returns the values of the bit-vector terms in the current model
+func (p *smtlib2Process) values(ctx context.Context, eb *ExprBuilder, terms []string) ([]*BVConst, error) {
+	if len(terms) == 0 {
+		return []*BVConst{}, nil
+	}
+	r, err := p.query(ctx, fmt.Sprintf("(get-value (%s))", strings.Join(terms, " ")))
+	if err != nil {
+		return nil, err
+	}
+	if !r.isList || len(r.list) != len(terms) {
+		return nil, fmt.Errorf("unexpected response %s to get-value", r)
+	}
+	parser := newSmtlib2Parser(eb)
+	res := make([]*BVConst, len(terms))
+	for i, pair := range r.list {
+		if !pair.isList || len(pair.list) != 2 {
+			return nil, fmt.Errorf("unexpected response %s to get-value", r)
+		}
+		res[i], err = parser.value(pair.list[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// model returns the values of the declared symbols and the interpretations
+// of the declared functions
+func (p *smtlib2Process) model(ctx context.Context, eb *ExprBuilder) (map[string]*BVConst, map[string]*FunInterp, error) {
+	names := make([]string, 0)
+	for name, decl := range p.declared {
+		if decl.size > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	apps := make([]smtlib2App, 0, len(p.apps))
+	for _, app := range p.apps {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].term < apps[j].term })
+
+	terms := make([]string, 0, len(names))
+	for _, name := range names {
+		terms = append(terms, smtlib2Symbol(name))
+	}
+	for _, app := range apps {
+		terms = append(terms, app.term)
+		terms = append(terms, app.args...)
+	}
+	values, err := p.values(ctx, eb, terms)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	model := make(map[string]*BVConst)
+	for i, name := range names {
+		model[name] = values[i]
+	}
+	values = values[len(names):]
+	interps := newFunInterpBuilder()
+	for _, app := range apps {
+		interps.add(app.fun, values[1:len(app.args)+1], values[0])
+		values = values[len(app.args)+1:]
+	}
+	return model, interps.interps, nil
+}
+
+// A smtlib2Solver tells how to start a solver: the options are set when it
+// starts and checkSat is the command that checks the assertions
+type smtlib2Solver struct {
+	name     string
+	connect  func() (smtlib2Conn, error)
+	options  []string
+	checkSat string
+}
+
+/*
+ *  The SMT-LIB2 backend talks to a solver (usually an external process, see
+ *  smtlib2Conn) in incremental mode. The commands are sent lazily, on the next
+ *  query. When a query fails or is interrupted the solver is stopped, and a
+ *  new one is started on the next query by replaying the assertions
+ */
+type smtlib2Backend struct {
+	eb     *ExprBuilder
+	solver *smtlib2Solver
+
+	assertions []*BoolExprPtr
+	scopes     []int
+	proc       *smtlib2Process
+
+	lastSatModel map[string]*BVConst
+	lastFunModel map[string]*FunInterp
+}
+
+func newSmtlib2Backend(eb *ExprBuilder, solver *smtlib2Solver) *smtlib2Backend {
+	s := &smtlib2Backend{
+		eb:         eb,
+		solver:     solver,
+		assertions: make([]*BoolExprPtr, 0),
+		scopes:     make([]int, 0),
+	}
+	runtime.SetFinalizer(s, (*smtlib2Backend).stop)
+	return s
+}
+
+// NewSMTLIB2Solver returns a solver that runs `command args...` and talks to
+// it in SMT-LIB2 (e.g., "z3 -in", "cvc5 --incremental", "bitwuzla"). Every
+// clone runs its own process
+func NewSMTLIB2Solver(eb *ExprBuilder, command string, args ...string) *Solver {
+	solver := &smtlib2Solver{
+		name:     filepath.Base(command),
+		connect:  func() (smtlib2Conn, error) { return startSmtlib2Pipe(command, args) },
+		checkSat: "(check-sat)",
+	}
+	return newSolver(eb, newSmtlib2Backend(eb, solver))
+}
+
+func (s *smtlib2Backend) name() string {
+	return s.solver.name
+}
+
+func (s *smtlib2Backend) stop() {
+	if s.proc != nil {
+		s.proc.stop()
+		s.proc = nil
+	}
+}
+
+func (s *smtlib2Backend) start(ctx context.Context) error {
+	p, err := startSmtlib2Process(s.solver)
+	if err != nil {
+		return err
+	}
+	s.proc = p
+	if err := p.exec(ctx, "(set-option :print-success true)"); err != nil {
+		return err
+	}
+	for _, option := range []string{":produce-models", ":produce-unsat-assumptions"} {
+		r, err := p.query(ctx, fmt.Sprintf("(set-option %s true)", option))
+		if err != nil && !errors.As(err, new(*smtlib2SolverError)) {
+			return err
+		}
+		if err == nil && !r.isAtom("success") && !r.isAtom("unsupported") {
+			return fmt.Errorf("unexpected response %s to set-option", r)
+		}
+	}
+	for _, option := range s.solver.options {
+		if err := p.exec(ctx, option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sync starts the process if it is not running and sends the pending commands
+func (s *smtlib2Backend) sync(ctx context.Context) (*smtlib2Process, error) {
+	if s.proc == nil {
+		if err := s.start(ctx); err != nil {
+			s.stop()
+			return nil, err
+		}
+	}
+	p := s.proc
+	err := p.flush(ctx)
+	for err == nil && (p.depth < len(s.scopes) || p.sent < len(s.assertions)) {
+		if p.depth < len(s.scopes) && s.scopes[p.depth] == p.sent {
+			err = p.push(ctx)
+		} else {
+			err = p.assert(ctx, s.assertions[p.sent])
+			p.sent += 1
+		}
+	}
+	if err != nil {
+		s.stop()
+		return nil, err
+	}
+	return p, nil
+}
+
+// done pops the scope of a query, or stops the process if the query failed
+func (s *smtlib2Backend) done(p *smtlib2Process, err error) error {
+	if err == nil {
+		p.popTo(p.depth - 1)
+		return nil
+	}
+	s.stop()
+	return err
+}
+
+func (s *smtlib2Backend) fresh() solverBackend {
+	return newSmtlib2Backend(s.eb, s.solver)
+}
+
+func (s *smtlib2Backend) clone() solverBackend {
+	clone := newSmtlib2Backend(s.eb, s.solver)
+	clone.assertions = append(clone.assertions, s.assertions...)
+	clone.scopes = append(clone.scopes, s.scopes...)
+	return clone
+}
+
+func (s *smtlib2Backend) push() {
+	s.scopes = append(s.scopes, len(s.assertions))
+}
+
+func (s *smtlib2Backend) pop(n int) {
+	for i := 0; i < n; i++ {
+		s.assertions = s.assertions[:s.scopes[len(s.scopes)-1]]
+		s.scopes = s.scopes[:len(s.scopes)-1]
+	}
+	if s.proc != nil {
+		s.proc.popTo(len(s.scopes))
+		s.proc.sent = min(s.proc.sent, len(s.assertions))
+	}
+}
+
+func (s *smtlib2Backend) add(constraint *BoolExprPtr) {
+	s.assertions = append(s.assertions, constraint)
+}
+
+func (s *smtlib2Backend) check(ctx context.Context, query *BoolExprPtr) (int, error) {
+	s.lastSatModel = nil
+	p, err := s.sync(ctx)
+	if err != nil {
+		return RESULT_UNKNOWN, err
+	}
+
+	r := RESULT_UNKNOWN
+	err = p.push(ctx)
+	if err == nil {
+		err = p.assert(ctx, query)
+	}
+	if err == nil {
+		r, err = p.checkSat(ctx, s.solver.checkSat)
+	}
+	if r == RESULT_SAT {
+		s.lastSatModel, s.lastFunModel, err = p.model(ctx, s.eb)
+	}
+	if err = s.done(p, err); err != nil {
+		return RESULT_UNKNOWN, err
+	}
+	if r == RESULT_UNKNOWN {
+		return r, errSmtlib2Unknown
+	}
+	return r, nil
+}
+
+func (s *smtlib2Backend) checkAssuming(ctx context.Context, assumptions []*BoolExprPtr) (int, []int, error) {
+	s.lastSatModel = nil
+	p, err := s.sync(ctx)
+	if err != nil {
+		return RESULT_UNKNOWN, nil, err
+	}
+
+	// check-sat-assuming takes literals, every assumption is named by a
+	// Boolean constant. The names are chosen after the symbols of the
+	// assumptions are declared, so that they do not clash
+	r := RESULT_UNKNOWN
+	names := make([]string, len(assumptions))
+	index := make(map[string]int)
+	err = p.push(ctx)
+	for i := 0; err == nil && i < len(assumptions); i++ {
+		err = p.declare(ctx, assumptions[i].e)
+	}
+	for i, k := 0, 0; err == nil && i < len(assumptions); i++ {
+		for ; names[i] == ""; k++ {
+			if _, ok := p.declared[fmt.Sprintf("?a%d", k)]; !ok {
+				names[i] = fmt.Sprintf("?a%d", k)
+			}
+		}
+		index[names[i]] = i
+		err = p.exec(ctx, fmt.Sprintf("(declare-const %s Bool)", names[i]))
+		if err == nil {
+			p.declared[names[i]] = smtlib2Decl{depth: p.depth}
+			err = p.exec(ctx, fmt.Sprintf("(assert (= %s %s))", names[i], smtlib2Term(assumptions[i].e)))
+		}
+	}
+	if err == nil {
+		r, err = p.checkSat(ctx, fmt.Sprintf("(check-sat-assuming (%s))", strings.Join(names, " ")))
+	}
+	if r == RESULT_SAT {
+		s.lastSatModel, s.lastFunModel, err = p.model(ctx, s.eb)
+	}
+
+	var failed []int
+	if r == RESULT_UNSAT && err == nil {
+		var core *smtlib2Sexpr
+		core, err = p.query(ctx, "(get-unsat-assumptions)")
+		if errors.As(err, new(*smtlib2SolverError)) {
+			// all the assumptions are a valid, non minimal, core
+			core = &smtlib2Sexpr{isList: true}
+			for _, name := range names {
+				core.list = append(core.list, &smtlib2Sexpr{atom: name})
+			}
+			err = nil
+		}
+		if err == nil && !core.isList {
+			err = fmt.Errorf("unexpected response %s to get-unsat-assumptions", core)
+		}
+		for i := 0; err == nil && i < len(core.list); i++ {
+			if j, ok := index[core.list[i].atom]; ok {
+				failed = append(failed, j)
+			}
+		}
+		sort.Ints(failed)
+	}
+	if err = s.done(p, err); err != nil {
+		return RESULT_UNKNOWN, nil, err
+	}
+	if r == RESULT_UNKNOWN {
+		return r, nil, errSmtlib2Unknown
+	}
+	return r, failed, nil
+}
+
+func (s *smtlib2Backend) model() map[string]*BVConst {
+	if s.lastSatModel == nil {
+		return nil
+	}
+	res := make(map[string]*BVConst)
+	for name, v := range s.lastSatModel {
+		res[name] = v
+	}
+	return res
+}
+
+func (s *smtlib2Backend) funModel() map[string]*FunInterp {
+	if s.lastSatModel == nil {
+		return nil
+	}
+	return s.lastFunModel
+}
+
+func (s *smtlib2Backend) evalUpto(ctx context.Context, bv *BVExprPtr, query *BoolExprPtr, n int) ([]*BVConst, error) {
+	s.lastSatModel = nil
+	p, err := s.sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	term := smtlib2Term(bv.e)
+	values := make([]*BVConst, 0)
+	err = p.push(ctx)
+	if err == nil {
+		err = p.declare(ctx, bv.e)
+	}
+	if err == nil {
+		err = p.assert(ctx, query)
+	}
+	r := RESULT_SAT
+	for err == nil && r == RESULT_SAT && len(values) < n {
+		r, err = p.checkSat(ctx, s.solver.checkSat)
+		if err != nil || r != RESULT_SAT {
+			break
+		}
+		var v []*BVConst
+		v, err = p.values(ctx, s.eb, []string{term})
+		if err != nil {
+			break
+		}
+		values = append(values, v[0])
+		if len(values) == n {
+			// the model of the last value is kept, like in check
+			s.lastSatModel, s.lastFunModel, err = p.model(ctx, s.eb)
+			break
+		}
+		err = p.exec(ctx, fmt.Sprintf("(assert (not (= %s %s)))", term, smtlib2Const(v[0])))
+	}
+	if err == nil && r != RESULT_SAT && len(values) > 0 {
+		// the scope of the query excludes the last value, its model is
+		// fetched in a new scope
+		p.popTo(p.depth - 1)
+		last := RESULT_UNKNOWN
+		err = p.flush(ctx)
+		if err == nil {
+			err = p.push(ctx)
+		}
+		if err == nil {
+			err = p.declare(ctx, bv.e)
+		}
+		if err == nil {
+			err = p.assert(ctx, query)
+		}
+		if err == nil {
+			err = p.exec(ctx, fmt.Sprintf("(assert (= %s %s))", term, smtlib2Const(values[len(values)-1])))
+		}
+		if err == nil {
+			last, err = p.checkSat(ctx, s.solver.checkSat)
+		}
+		if err == nil && last == RESULT_SAT {
+			s.lastSatModel, s.lastFunModel, err = p.model(ctx, s.eb)
+		}
+	}
+	if err = s.done(p, err); err != nil {
+		return values, err
+	}
+	if r == RESULT_UNKNOWN {
+		return values, errSmtlib2Unknown
+	}
+	return values, nil
+}
@@ -0,0 +1,333 @@
+package gosmt_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestMain(m *testing.M) {
+	if len(os.Args) == 3 && os.Args[1] == "-fake-solver" {
+		os.Exit(fakeSolver(os.Args[2]))
+	}
+	os.Exit(m.Run())
+}
+
+// readCommand reads a balanced s-expression
+func readCommand(r *bufio.Reader) (string, error) {
+	b := strings.Builder{}
+	depth, quoted := 0, false
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b.Len() == 0 && c != '(' {
+			continue
+		}
+		b.WriteByte(c)
+		switch {
+		case c == '|':
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth += 1
+		case c == ')' && !quoted:
+			depth -= 1
+			if depth == 0 {
+				return b.String(), nil
+			}
+		}
+	}
+}
+
+// splitList returns the top-level elements of a list
+func splitList(s string) []string {
+	res := make([]string, 0)
+	s = strings.TrimSpace(s)
+	s = s[1 : len(s)-1]
+	depth, quoted, start := 0, false, -1
+	for i, c := range s {
+		if start < 0 && c != ' ' {
+			start = i
+		}
+		switch {
+		case c == '|':
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth += 1
+		case c == ')' && !quoted:
+			depth -= 1
+		}
+		if start >= 0 && depth == 0 && !quoted && (i == len(s)-1 || s[i+1] == ' ') {
+			res = append(res, s[start:i+1])
+			start = -1
+		}
+	}
+	return res
+}
+
+/*
+ *  fakeSolver is an SMT-LIB2 solver process backed by the bit-blaster, used to
+ *  test the SMT-LIB2 backend. In "crash" mode it exits on the second check-sat,
+ *  in "hang" mode it never answers to check-sat, in "nocore" mode it does not
+ *  support get-unsat-assumptions
+ */
+func fakeSolver(mode string) int {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewBitblastSolver(eb)
+	decls := make(map[string]gosmt.ExprPtr)
+	scopes := make([][]string, 1)
+	assumptions := make([]string, 0)
+	checks := 0
+
+	in := bufio.NewReader(os.Stdin)
+	out := bufio.NewWriter(os.Stdout)
+	respond := func(format string, args ...interface{}) {
+		fmt.Fprintf(out, format+"\n", args...)
+		out.Flush()
+	}
+	for {
+		cmd, err := readCommand(in)
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			return 1
+		}
+		args := splitList(cmd)
+		// the assumptions are retracted before the next command
+		if len(assumptions) > 0 && !strings.HasPrefix(args[0], "get-") {
+			s.Pop(1)
+			assumptions = assumptions[:0]
+		}
+
+		switch args[0] {
+		case "set-option":
+			respond("success")
+		case "declare-const":
+			name := strings.Trim(args[1], "|")
+			if args[2] == "Bool" {
+				decls[name], _ = eb.Eq(eb.BVS(name, 1), eb.BVV(1, 1))
+			} else {
+				size, _ := strconv.Atoi(splitList(args[2])[2])
+				decls[name] = eb.BVS(name, uint(size))
+			}
+			scopes[len(scopes)-1] = append(scopes[len(scopes)-1], name)
+			respond("success")
+		case "assert":
+			e, err := eb.ParseSMTLIB2Expr(args[1], decls)
+			if err != nil {
+				respond("(error \"%s\")", err.Error())
+				continue
+			}
+			s.Add(e.(*gosmt.BoolExprPtr))
+			respond("success")
+		case "push":
+			s.Push()
+			scopes = append(scopes, []string{})
+			respond("success")
+		case "pop":
+			n, _ := strconv.Atoi(args[1])
+			s.Pop(n)
+			for ; n > 0; n-- {
+				for _, name := range scopes[len(scopes)-1] {
+					delete(decls, name)
+				}
+				scopes = scopes[:len(scopes)-1]
+			}
+			respond("success")
+		case "check-sat", "check-sat-assuming":
+			checks += 1
+			if mode == "crash" && checks == 2 {
+				return 1
+			}
+			if mode == "hang" {
+				time.Sleep(time.Hour)
+			}
+			if args[0] == "check-sat-assuming" {
+				assumptions = splitList(args[1])
+				s.Push()
+				for _, a := range assumptions {
+					s.Add(decls[a].(*gosmt.BoolExprPtr))
+				}
+			}
+			if r, _ := s.Satisfiable(); r == gosmt.RESULT_SAT {
+				respond("sat")
+			} else {
+				respond("unsat")
+			}
+		case "get-value":
+			values := make([]string, 0)
+			for _, term := range splitList(args[1]) {
+				e, err := eb.ParseSMTLIB2Expr(term, decls)
+				if err != nil {
+					respond("(error \"%s\")", err.Error())
+					continue
+				}
+				v := s.Eval(e.(*gosmt.BVExprPtr))
+				values = append(values, fmt.Sprintf("(%s (_ bv%d %d))", term, v.AsULong(), v.Size))
+			}
+			respond("(%s)", strings.Join(values, " "))
+		case "get-unsat-assumptions":
+			if mode == "nocore" {
+				respond("(error \"unsupported\")")
+				continue
+			}
+			respond("(%s)", strings.Join(assumptions, " "))
+		case "exit":
+			return 0
+		default:
+			respond("(error \"unsupported command\")")
+		}
+	}
+}
+
+func newFakeSolver(eb *gosmt.ExprBuilder, mode string) *gosmt.Solver {
+	return gosmt.NewSMTLIB2Solver(eb, os.Args[0], "-fake-solver", mode)
+}
+
+func TestSMTLIB2Solver(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, mode := range []string{"default", "nocore"} {
+		s := newFakeSolver(eb, mode)
+		a := eb.BVS("a", 16)
+		b := eb.BVS("b", 16)
+		c := eb.BVS("c", 16)
+		e, _ := eb.Ult(a, eb.BVV(10, 16))
+		s.AddNamed("a < 10", e)
+		x, _ := eb.Mul(a, a)
+		e, _ = eb.Eq(b, x)
+		s.AddNamed("b == a * a", e)
+		e, _ = eb.UGt(c, eb.BVV(5, 16))
+		s.AddNamed("c > 5", e)
+
+		q, _ := eb.Eq(b, eb.BVV(49, 16))
+		if s.CheckSat(q) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+		q, _ = eb.Eq(b, eb.BVV(50, 16))
+		if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		core, err := s.UnsatCore()
+		if isErr(t, err) {
+			return
+		}
+		if len(core) != 1 {
+			t.Errorf("wrong core %v", coreNames(s, core))
+			return
+		}
+
+		s.Push()
+		e, _ = eb.UGe(a, eb.BVV(7, 16))
+		s.Add(e)
+		if v := s.Eval(b); v == nil || (v.AsULong() != 49 && v.AsULong() != 64 && v.AsULong() != 81) {
+			t.Error("wrong model")
+			return
+		}
+		vals := s.EvalUpto(b, 10)
+		if len(vals) != 3 {
+			t.Errorf("wrong number of values %d", len(vals))
+			return
+		}
+		// the model is the one of the last value
+		if m := s.Model(); m == nil || m["b"].AsULong() != vals[2].AsULong() || m["a"].AsULong() < 7 {
+			t.Errorf("wrong model %v", m)
+			return
+		}
+		s.Pop(1)
+		if vals := s.EvalUpto(b, 20); len(vals) != 10 {
+			t.Errorf("wrong number of values %d", len(vals))
+			return
+		}
+		if v, err := s.Max(b, false); err != nil || v.AsULong() != 81 {
+			t.Error("wrong max")
+			return
+		}
+
+		// the clone runs its own process
+		clone := s.Clone()
+		e, _ = eb.Eq(b, eb.BVV(16, 16))
+		clone.Add(e)
+		if v := clone.Eval(a); v == nil || v.AsULong() != 4 {
+			t.Error("wrong model")
+			return
+		}
+		if len(s.EvalUpto(b, 20)) != 10 {
+			t.Error("the clone changed the solver")
+			return
+		}
+	}
+}
+
+func TestSMTLIB2SolverFailures(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	a := eb.BVS("a", 16)
+	sq, _ := eb.Mul(a, a)
+
+	s := gosmt.NewSMTLIB2Solver(eb, "/nonexistent/solver")
+	q, _ := eb.Eq(sq, eb.BVV(49, 16))
+	if r, err := s.CheckSatCtx(context.Background(), q); r != gosmt.RESULT_UNKNOWN || err == nil {
+		t.Error("should fail")
+		return
+	}
+
+	// a new process is started after a crash
+	s = newFakeSolver(eb, "crash")
+	if s.CheckSat(q) != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	q, _ = eb.Eq(sq, eb.BVV(50, 16))
+	if r, err := s.CheckSatCtx(context.Background(), q); r != gosmt.RESULT_UNKNOWN || err == nil {
+		t.Error("should fail")
+		return
+	}
+	if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+
+	s = newFakeSolver(eb, "hang")
+	s.SetTimeout(200 * time.Millisecond)
+	start := time.Now()
+	if r, err := s.CheckSatCtx(context.Background(), q); r != gosmt.RESULT_UNKNOWN || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("should time out")
+		return
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the query was not interrupted")
+		return
+	}
+}
+
+func TestSMTLIB2AssumptionNames(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := newFakeSolver(eb, "default")
+
+	// a symbol with the name of an assumption
+	x := eb.BVS("?a0", 8)
+	e, _ := eb.Ult(x, eb.BVV(10, 8))
+	s.Add(e)
+	a1, _ := eb.Eq(x, eb.BVV(20, 8))
+	a2, _ := eb.Eq(x, eb.BVV(3, 8))
+	if r, failed := s.CheckSatAssuming([]*gosmt.BoolExprPtr{a2, a1}); r != gosmt.RESULT_UNSAT || len(failed) == 0 {
+		t.Error("should be unsat")
+		return
+	}
+	if r, _ := s.CheckSatAssuming([]*gosmt.BoolExprPtr{a2}); r != gosmt.RESULT_SAT || s.Eval(x).AsULong() != 3 {
+		t.Error("should be sat")
+		return
+	}
+}
@@ -0,0 +1,1131 @@
+package gosmt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+ *  S-expression reader
+ */
+
+type smtlib2Sexpr struct {
+	atom   string
+	quoted bool
+	isList bool
+	list   []*smtlib2Sexpr
+}
+
+func (s *smtlib2Sexpr) String() string {
+	if !s.isList {
+		if s.quoted {
+			return "|" + s.atom + "|"
+		}
+		return s.atom
+	}
+	items := make([]string, 0)
+	for _, el := range s.list {
+		items = append(items, el.String())
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
+
+func (s *smtlib2Sexpr) isAtom(name string) bool {
+	return !s.isList && !s.quoted && s.atom == name
+}
+
+type smtlib2Reader struct {
+	r *bufio.Reader
+}
+
+func newSmtlib2Reader(r io.Reader) *smtlib2Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &smtlib2Reader{r: br}
+	}
+	return &smtlib2Reader{r: bufio.NewReader(r)}
+}
+
+func (rd *smtlib2Reader) skipSpaces() (rune, error) {
+	for {
+		c, _, err := rd.r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c == ';' {
+			if _, err := rd.r.ReadString('\n'); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			continue
+		}
+		return c, nil
+	}
+}
+
+func (rd *smtlib2Reader) readDelimited(end rune) (string, error) {
+	b := strings.Builder{}
+	for {
+		c, _, err := rd.r.ReadRune()
+		if err != nil {
+			return "", fmt.Errorf("unterminated literal")
+		}
+		if c == end {
+			if end != '"' {
+				return b.String(), nil
+			}
+			// "" is an escaped quote inside a string literal
+			next, _, err := rd.r.ReadRune()
+			if err != nil || next != '"' {
+				if err == nil {
+					rd.r.UnreadRune()
+				}
+				return b.String(), nil
+			}
+		}
+		b.WriteRune(c)
+	}
+}
+
+// read returns the next s-expression, or io.EOF if the input is over
+func (rd *smtlib2Reader) read() (*smtlib2Sexpr, error) {
+	c, err := rd.skipSpaces()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c {
+	case '(':
+		res := &smtlib2Sexpr{isList: true, list: make([]*smtlib2Sexpr, 0)}
+		for {
+			c, err := rd.skipSpaces()
+			if err != nil {
+				return nil, fmt.Errorf("unbalanced parenthesis")
+			}
+			if c == ')' {
+				return res, nil
+			}
+			rd.r.UnreadRune()
+			child, err := rd.read()
+			if err != nil {
+				if err == io.EOF {
+					return nil, fmt.Errorf("unbalanced parenthesis")
+				}
+				return nil, err
+			}
+			res.list = append(res.list, child)
+		}
+	case ')':
+		return nil, fmt.Errorf("unexpected ')'")
+	case '|':
+		name, err := rd.readDelimited('|')
+		if err != nil {
+			return nil, err
+		}
+		return &smtlib2Sexpr{atom: name, quoted: true}, nil
+	case '"':
+		str, err := rd.readDelimited('"')
+		if err != nil {
+			return nil, err
+		}
+		return &smtlib2Sexpr{atom: "\"" + str + "\""}, nil
+	}
+
+	b := strings.Builder{}
+	b.WriteRune(c)
+	for {
+		c, _, err := rd.r.ReadRune()
+		if err != nil {
+			break
+		}
+		if c == '(' || c == ')' || c == '|' || c == '"' || c == ';' ||
+			c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			rd.r.UnreadRune()
+			break
+		}
+		b.WriteRune(c)
+	}
+	return &smtlib2Sexpr{atom: b.String()}, nil
+}
+
+/*
+ *  Parser
+ */
+
+type SMTLIB2Script struct {
+	// Declared (and nullary defined) constants. Boolean constants are
+	// encoded as `sym == 0x1` on a 1-bit symbol
+	Declarations map[string]ExprPtr
+	// Assertions that are active at the end of the script
+	Assertions []*BoolExprPtr
+	// Active assertions (and assumptions) at every check-sat
+	Queries [][]*BoolExprPtr
+}
+
+/*
+ *  A smtlib2Fun is a function defined with define-fun. The body is resolved
+ *  lexically: the declarations and the functions it references are captured
+ *  when it is defined, so that they do not change with the later commands
+ */
+type smtlib2Fun struct {
+	params []string
+	sorts  []uint
+	body   *smtlib2Sexpr
+	decls  map[string]ExprPtr
+	funs   map[string]*smtlib2Fun
+}
+
+type smtlib2Scope struct {
+	numAssertions int
+	decls         []string
+	funs          []string
+}
+
+type smtlib2Env struct {
+	vars   map[string]ExprPtr
+	parent *smtlib2Env
+}
+
+func (env *smtlib2Env) lookup(name string) (ExprPtr, bool) {
+	for ; env != nil; env = env.parent {
+		if v, ok := env.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+type smtlib2Parser struct {
+	eb         *ExprBuilder
+	decls      map[string]ExprPtr
+	funs       map[string]*smtlib2Fun
+	scopes     []smtlib2Scope
+	assertions []*BoolExprPtr
+	queries    [][]*BoolExprPtr
+	// set by (set-option :global-declarations true), the declarations are
+	// not removed by pop and reset-assertions
+	globalDecls bool
+}
+
+func newSmtlib2Parser(eb *ExprBuilder) *smtlib2Parser {
+	return &smtlib2Parser{
+		eb:         eb,
+		decls:      make(map[string]ExprPtr),
+		funs:       make(map[string]*smtlib2Fun),
+		scopes:     make([]smtlib2Scope, 0),
+		assertions: make([]*BoolExprPtr, 0),
+		queries:    make([][]*BoolExprPtr, 0),
+	}
+}
+
+// ParseSMTLIB2 parses a script. The Bool constants are backed by 1-bit
+// symbols whose names start with "bool!", the prefix is reserved
+func (eb *ExprBuilder) ParseSMTLIB2(r io.Reader) (*SMTLIB2Script, error) {
+	p := newSmtlib2Parser(eb)
+	rd := newSmtlib2Reader(r)
+	for {
+		cmd, err := rd.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		done, err := p.command(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", cmd, err.Error())
+		}
+		if done {
+			break
+		}
+	}
+
+	script := &SMTLIB2Script{
+		Declarations: p.decls,
+		Assertions:   p.assertions,
+		Queries:      p.queries,
+	}
+	return script, nil
+}
+
+// ParseSMTLIB2Expr parses a single term, resolving free symbols in decls
+func (eb *ExprBuilder) ParseSMTLIB2Expr(term string, decls map[string]ExprPtr) (ExprPtr, error) {
+	p := newSmtlib2Parser(eb)
+	for name, e := range decls {
+		p.decls[name] = e
+	}
+	s, err := newSmtlib2Reader(strings.NewReader(term)).read()
+	if err != nil {
+		return nil, err
+	}
+	return p.term(s, nil)
+}
+
+func (p *smtlib2Parser) currentScope() *smtlib2Scope {
+	if len(p.scopes) == 0 {
+		return nil
+	}
+	return &p.scopes[len(p.scopes)-1]
+}
+
+func (p *smtlib2Parser) declare(name string, e ExprPtr) error {
+	if _, ok := p.decls[name]; ok {
+		return fmt.Errorf("%s already declared", name)
+	}
+	if _, ok := p.funs[name]; ok {
+		return fmt.Errorf("%s already declared", name)
+	}
+	p.decls[name] = e
+	if scope := p.currentScope(); scope != nil && !p.globalDecls {
+		scope.decls = append(scope.decls, name)
+	}
+	return nil
+}
+
+// capture returns the declarations and the functions referenced by s
+func (p *smtlib2Parser) capture(s *smtlib2Sexpr) (map[string]ExprPtr, map[string]*smtlib2Fun) {
+	decls := make(map[string]ExprPtr)
+	funs := make(map[string]*smtlib2Fun)
+	queue := []*smtlib2Sexpr{s}
+	for len(queue) > 0 {
+		el := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if el.isList {
+			queue = append(queue, el.list...)
+			continue
+		}
+		if e, ok := p.decls[el.atom]; ok {
+			decls[el.atom] = e
+		}
+		if fun, ok := p.funs[el.atom]; ok {
+			funs[el.atom] = fun
+		}
+	}
+	return decls, funs
+}
+
+func (p *smtlib2Parser) symbolName(s *smtlib2Sexpr) (string, error) {
+	if s.isList || strings.HasPrefix(s.atom, ":") || strings.HasPrefix(s.atom, "\"") {
+		return "", fmt.Errorf("expected a symbol, got %s", s)
+	}
+	return s.atom, nil
+}
+
+func (p *smtlib2Parser) numeral(s *smtlib2Sexpr) (uint, error) {
+	if s.isList || s.quoted {
+		return 0, fmt.Errorf("expected a numeral, got %s", s)
+	}
+	n, err := strconv.ParseUint(s.atom, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("expected a numeral, got %s", s)
+	}
+	return uint(n), nil
+}
+
+// sort returns 0 for Bool and the size for bit-vectors
+func (p *smtlib2Parser) sort(s *smtlib2Sexpr) (uint, error) {
+	if s.isAtom("Bool") {
+		return 0, nil
+	}
+	if s.isList && len(s.list) == 3 && s.list[0].isAtom("_") && s.list[1].isAtom("BitVec") {
+		n, err := p.numeral(s.list[2])
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, fmt.Errorf("invalid bit-vector size")
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("unsupported sort %s", s)
+}
+
+// The Bool constants are backed by 1-bit symbols, whose names start with
+// smtlib2BoolPrefix. The prefix is reserved, so that a Bool constant does not
+// alias a bit-vector with the same name (declared by another script parsed
+// with the same ExprBuilder, or built by the user)
+const smtlib2BoolPrefix = "bool!"
+
+func (p *smtlib2Parser) mkConst(name string, sort uint) (ExprPtr, error) {
+	if sort == 0 {
+		return p.eb.Eq(p.eb.BVS(smtlib2BoolPrefix+name, 1), p.eb.BVV(1, 1))
+	}
+	if strings.HasPrefix(name, smtlib2BoolPrefix) {
+		return nil, fmt.Errorf("the prefix of %s is reserved for the Bool constants", name)
+	}
+	return p.eb.BVS(name, sort), nil
+}
+
+func (p *smtlib2Parser) command(cmd *smtlib2Sexpr) (bool, error) {
+	if !cmd.isList || len(cmd.list) == 0 || cmd.list[0].isList {
+		return false, fmt.Errorf("invalid command")
+	}
+	args := cmd.list[1:]
+
+	switch cmd.list[0].atom {
+	case "set-option":
+		if len(args) == 2 && args[0].isAtom(":global-declarations") {
+			p.globalDecls = args[1].isAtom("true")
+		}
+		return false, nil
+	case "set-logic", "set-info", "get-info", "get-option",
+		"get-model", "get-value", "get-assignment", "get-unsat-core", "echo":
+		return false, nil
+	case "exit":
+		return true, nil
+	case "declare-const":
+		if len(args) != 2 {
+			return false, fmt.Errorf("wrong number of arguments")
+		}
+		name, err := p.symbolName(args[0])
+		if err != nil {
+			return false, err
+		}
+		sort, err := p.sort(args[1])
+		if err != nil {
+			return false, err
+		}
+		e, err := p.mkConst(name, sort)
+		if err != nil {
+			return false, err
+		}
+		return false, p.declare(name, e)
+	case "declare-fun":
+		if len(args) != 3 || !args[1].isList {
+			return false, fmt.Errorf("wrong number of arguments")
+		}
+		if len(args[1].list) != 0 {
+			return false, fmt.Errorf("uninterpreted functions are not supported")
+		}
+		name, err := p.symbolName(args[0])
+		if err != nil {
+			return false, err
+		}
+		sort, err := p.sort(args[2])
+		if err != nil {
+			return false, err
+		}
+		e, err := p.mkConst(name, sort)
+		if err != nil {
+			return false, err
+		}
+		return false, p.declare(name, e)
+	case "define-fun":
+		if len(args) != 4 || !args[1].isList {
+			return false, fmt.Errorf("wrong number of arguments")
+		}
+		name, err := p.symbolName(args[0])
+		if err != nil {
+			return false, err
+		}
+		retSort, err := p.sort(args[2])
+		if err != nil {
+			return false, err
+		}
+		fun := &smtlib2Fun{params: make([]string, 0), sorts: make([]uint, 0), body: args[3]}
+		for _, param := range args[1].list {
+			if !param.isList || len(param.list) != 2 {
+				return false, fmt.Errorf("invalid parameter %s", param)
+			}
+			pname, err := p.symbolName(param.list[0])
+			if err != nil {
+				return false, err
+			}
+			psort, err := p.sort(param.list[1])
+			if err != nil {
+				return false, err
+			}
+			fun.params = append(fun.params, pname)
+			fun.sorts = append(fun.sorts, psort)
+		}
+		if len(fun.params) == 0 {
+			e, err := p.term(args[3], nil)
+			if err != nil {
+				return false, err
+			}
+			if err := p.checkSort(e, retSort); err != nil {
+				return false, err
+			}
+			return false, p.declare(name, e)
+		}
+		if _, ok := p.decls[name]; ok {
+			return false, fmt.Errorf("%s already declared", name)
+		}
+		if _, ok := p.funs[name]; ok {
+			return false, fmt.Errorf("%s already declared", name)
+		}
+		// the body is checked with the parameters bound to constants
+		fun.decls, fun.funs = p.capture(fun.body)
+		env := &smtlib2Env{vars: make(map[string]ExprPtr)}
+		for i, pname := range fun.params {
+			env.vars[pname], err = p.mkConst(pname, fun.sorts[i])
+			if err != nil {
+				return false, err
+			}
+		}
+		e, err := p.funBody(fun, env)
+		if err != nil {
+			return false, err
+		}
+		if err := p.checkSort(e, retSort); err != nil {
+			return false, err
+		}
+		p.funs[name] = fun
+		if scope := p.currentScope(); scope != nil && !p.globalDecls {
+			scope.funs = append(scope.funs, name)
+		}
+		return false, nil
+	case "assert":
+		if len(args) != 1 {
+			return false, fmt.Errorf("wrong number of arguments")
+		}
+		e, err := p.boolTerm(args[0], nil)
+		if err != nil {
+			return false, err
+		}
+		p.assertions = append(p.assertions, e)
+		return false, nil
+	case "check-sat":
+		query := make([]*BoolExprPtr, len(p.assertions))
+		copy(query, p.assertions)
+		p.queries = append(p.queries, query)
+		return false, nil
+	case "check-sat-assuming":
+		if len(args) != 1 || !args[0].isList {
+			return false, fmt.Errorf("wrong number of arguments")
+		}
+		query := make([]*BoolExprPtr, len(p.assertions))
+		copy(query, p.assertions)
+		for _, a := range args[0].list {
+			e, err := p.boolTerm(a, nil)
+			if err != nil {
+				return false, err
+			}
+			query = append(query, e)
+		}
+		p.queries = append(p.queries, query)
+		return false, nil
+	case "push", "pop":
+		n := uint(1)
+		if len(args) == 1 {
+			var err error
+			n, err = p.numeral(args[0])
+			if err != nil {
+				return false, err
+			}
+		}
+		if cmd.list[0].atom == "pop" && n > uint(len(p.scopes)) {
+			return false, fmt.Errorf("pop without push")
+		}
+		for i := uint(0); i < n; i++ {
+			if cmd.list[0].atom == "push" {
+				p.scopes = append(p.scopes, smtlib2Scope{numAssertions: len(p.assertions)})
+				continue
+			}
+			scope := p.currentScope()
+			p.assertions = p.assertions[:scope.numAssertions]
+			for _, name := range scope.decls {
+				delete(p.decls, name)
+			}
+			for _, name := range scope.funs {
+				delete(p.funs, name)
+			}
+			p.scopes = p.scopes[:len(p.scopes)-1]
+		}
+		return false, nil
+	case "reset-assertions":
+		p.assertions = make([]*BoolExprPtr, 0)
+		p.scopes = make([]smtlib2Scope, 0)
+		if !p.globalDecls {
+			p.decls = make(map[string]ExprPtr)
+			p.funs = make(map[string]*smtlib2Fun)
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported command")
+}
+
+func (p *smtlib2Parser) checkSort(e ExprPtr, sort uint) error {
+	if sort == 0 && !e.IsBool() {
+		return fmt.Errorf("expected a Bool term")
+	}
+	if sort != 0 && (!e.IsBV() || e.(*BVExprPtr).Size() != sort) {
+		return fmt.Errorf("expected a term of sort (_ BitVec %d)", sort)
+	}
+	return nil
+}
+
+func (p *smtlib2Parser) boolTerm(s *smtlib2Sexpr, env *smtlib2Env) (*BoolExprPtr, error) {
+	e, err := p.term(s, env)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsBool() {
+		return nil, fmt.Errorf("%s is not a Bool term", s)
+	}
+	return e.(*BoolExprPtr), nil
+}
+
+func (p *smtlib2Parser) literal(atom string) (*BVExprPtr, bool) {
+	var v *BVConst
+	if strings.HasPrefix(atom, "#b") && len(atom) > 2 {
+		v = MakeBVConstFromString(atom[2:], 2, uint(len(atom)-2))
+	} else if strings.HasPrefix(atom, "#x") && len(atom) > 2 {
+		v = MakeBVConstFromString(atom[2:], 16, uint(len(atom)-2)*4)
+	}
+	if v == nil {
+		return nil, false
+	}
+	return p.eb.getOrCreateBV(mkinternalBVVFromConst(*v)), true
+}
+
+// value parses a bit-vector constant
+func (p *smtlib2Parser) value(s *smtlib2Sexpr) (*BVConst, error) {
+	e, err := p.term(s, nil)
+	if err != nil {
+		return nil, err
+	}
+	bv, ok := e.(*BVExprPtr)
+	if !ok || !bv.IsConst() {
+		return nil, fmt.Errorf("invalid value %s", s)
+	}
+	return bv.GetConst()
+}
+
+func (p *smtlib2Parser) term(s *smtlib2Sexpr, env *smtlib2Env) (ExprPtr, error) {
+	if !s.isList {
+		if e, ok := env.lookup(s.atom); ok {
+			return e, nil
+		}
+		if e, ok := p.decls[s.atom]; ok {
+			return e, nil
+		}
+		if !s.quoted {
+			if s.atom == "true" || s.atom == "false" {
+				return p.eb.BoolVal(s.atom == "true"), nil
+			}
+			if e, ok := p.literal(s.atom); ok {
+				return e, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown symbol %s", s)
+	}
+	if len(s.list) == 0 {
+		return nil, fmt.Errorf("empty term")
+	}
+
+	head := s.list[0]
+	if head.isAtom("_") {
+		// (_ bvN size)
+		if len(s.list) != 3 || s.list[1].isList || !strings.HasPrefix(s.list[1].atom, "bv") {
+			return nil, fmt.Errorf("invalid indexed term %s", s)
+		}
+		size, err := p.numeral(s.list[2])
+		if err != nil {
+			return nil, err
+		}
+		v := MakeBVConstFromString(s.list[1].atom[2:], 10, size)
+		if v == nil {
+			return nil, fmt.Errorf("invalid constant %s", s)
+		}
+		return p.eb.getOrCreateBV(mkinternalBVVFromConst(*v)), nil
+	}
+	if head.isAtom("let") {
+		if len(s.list) != 3 || !s.list[1].isList {
+			return nil, fmt.Errorf("invalid let")
+		}
+		newEnv := &smtlib2Env{vars: make(map[string]ExprPtr), parent: env}
+		for _, binding := range s.list[1].list {
+			if !binding.isList || len(binding.list) != 2 {
+				return nil, fmt.Errorf("invalid binding %s", binding)
+			}
+			name, err := p.symbolName(binding.list[0])
+			if err != nil {
+				return nil, err
+			}
+			// bindings are parallel, they are evaluated in the outer environment
+			e, err := p.term(binding.list[1], env)
+			if err != nil {
+				return nil, err
+			}
+			newEnv.vars[name] = e
+		}
+		return p.term(s.list[2], newEnv)
+	}
+	if head.isAtom("!") {
+		if len(s.list) < 2 {
+			return nil, fmt.Errorf("invalid annotation")
+		}
+		return p.term(s.list[1], env)
+	}
+
+	args := make([]ExprPtr, 0)
+	for _, arg := range s.list[1:] {
+		e, err := p.term(arg, env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, e)
+	}
+
+	if head.isList {
+		return p.indexedApp(head, args)
+	}
+	if fun, ok := p.funs[head.atom]; ok {
+		return p.funApp(fun, args)
+	}
+	if head.quoted {
+		return nil, fmt.Errorf("unknown function %s", head)
+	}
+	return p.app(head.atom, args)
+}
+
+func (p *smtlib2Parser) funApp(fun *smtlib2Fun, args []ExprPtr) (ExprPtr, error) {
+	if len(args) != len(fun.params) {
+		return nil, fmt.Errorf("wrong number of arguments")
+	}
+	env := &smtlib2Env{vars: make(map[string]ExprPtr)}
+	for i := 0; i < len(args); i++ {
+		if err := p.checkSort(args[i], fun.sorts[i]); err != nil {
+			return nil, err
+		}
+		env.vars[fun.params[i]] = args[i]
+	}
+	return p.funBody(fun, env)
+}
+
+// funBody parses the body of fun in env, with the declarations and the
+// functions captured when it was defined
+func (p *smtlib2Parser) funBody(fun *smtlib2Fun, env *smtlib2Env) (ExprPtr, error) {
+	decls, funs := p.decls, p.funs
+	p.decls, p.funs = fun.decls, fun.funs
+	defer func() { p.decls, p.funs = decls, funs }()
+	return p.term(fun.body, env)
+}
+
+func (p *smtlib2Parser) indexedApp(head *smtlib2Sexpr, args []ExprPtr) (ExprPtr, error) {
+	if len(head.list) < 3 || !head.list[0].isAtom("_") || head.list[1].isList {
+		return nil, fmt.Errorf("invalid function %s", head)
+	}
+	indices := make([]uint, 0)
+	for _, idx := range head.list[2:] {
+		n, err := p.numeral(idx)
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, n)
+	}
+	if len(args) != 1 || !args[0].IsBV() {
+		return nil, fmt.Errorf("%s expects one bit-vector argument", head)
+	}
+	arg := args[0].(*BVExprPtr)
+
+	name := head.list[1].atom
+	switch name {
+	case "extract":
+		if len(indices) != 2 {
+			return nil, fmt.Errorf("wrong number of indices")
+		}
+		if indices[0] >= arg.Size() {
+			return nil, fmt.Errorf("invalid extract")
+		}
+		return p.eb.Extract(arg, indices[0], indices[1])
+	case "zero_extend", "sign_extend", "repeat", "rotate_left", "rotate_right":
+		if len(indices) != 1 {
+			return nil, fmt.Errorf("wrong number of indices")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported function %s", head)
+	}
+
+	n := indices[0]
+	switch name {
+	case "zero_extend":
+		return p.eb.ZExt(arg, n)
+	case "sign_extend":
+		return p.eb.SExt(arg, n)
+	case "repeat":
+		if n == 0 {
+			return nil, fmt.Errorf("invalid repeat")
+		}
+		res := arg
+		for i := uint(1); i < n; i++ {
+			var err error
+			res, err = p.eb.Concat(res, arg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+
+	size := arg.Size()
+	n = n % size
+	if n == 0 {
+		return arg, nil
+	}
+	if name == "rotate_right" {
+		n = size - n
+	}
+	high, err := p.eb.Extract(arg, size-n-1, 0)
+	if err != nil {
+		return nil, err
+	}
+	low, err := p.eb.Extract(arg, size-1, size-n)
+	if err != nil {
+		return nil, err
+	}
+	return p.eb.Concat(high, low)
+}
+
+func (p *smtlib2Parser) bvArgs(name string, args []ExprPtr, n int) ([]*BVExprPtr, error) {
+	if (n > 0 && len(args) != n) || (n < 0 && len(args) < -n) {
+		return nil, fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	res := make([]*BVExprPtr, 0)
+	for _, arg := range args {
+		if !arg.IsBV() {
+			return nil, fmt.Errorf("%s expects bit-vector arguments", name)
+		}
+		res = append(res, arg.(*BVExprPtr))
+	}
+	return res, nil
+}
+
+func (p *smtlib2Parser) boolArgs(name string, args []ExprPtr, n int) ([]*BoolExprPtr, error) {
+	if (n > 0 && len(args) != n) || (n < 0 && len(args) < -n) {
+		return nil, fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	res := make([]*BoolExprPtr, 0)
+	for _, arg := range args {
+		if !arg.IsBool() {
+			return nil, fmt.Errorf("%s expects Bool arguments", name)
+		}
+		res = append(res, arg.(*BoolExprPtr))
+	}
+	return res, nil
+}
+
+func (p *smtlib2Parser) boolIff(lhs, rhs *BoolExprPtr) (*BoolExprPtr, error) {
+	x, err := p.boolXor(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return p.eb.BoolNot(x)
+}
+
+func (p *smtlib2Parser) boolXor(lhs, rhs *BoolExprPtr) (*BoolExprPtr, error) {
+	notLhs, err := p.eb.BoolNot(lhs)
+	if err != nil {
+		return nil, err
+	}
+	notRhs, err := p.eb.BoolNot(rhs)
+	if err != nil {
+		return nil, err
+	}
+	c1, err := p.eb.BoolAnd(lhs, notRhs)
+	if err != nil {
+		return nil, err
+	}
+	c2, err := p.eb.BoolAnd(notLhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return p.eb.BoolOr(c1, c2)
+}
+
+func (p *smtlib2Parser) boolIte(cond, iftrue, iffalse *BoolExprPtr) (*BoolExprPtr, error) {
+	notCond, err := p.eb.BoolNot(cond)
+	if err != nil {
+		return nil, err
+	}
+	c1, err := p.eb.BoolAnd(cond, iftrue)
+	if err != nil {
+		return nil, err
+	}
+	c2, err := p.eb.BoolAnd(notCond, iffalse)
+	if err != nil {
+		return nil, err
+	}
+	return p.eb.BoolOr(c1, c2)
+}
+
+func (p *smtlib2Parser) equal(lhs, rhs ExprPtr) (*BoolExprPtr, error) {
+	if lhs.IsBV() && rhs.IsBV() {
+		return p.eb.Eq(lhs.(*BVExprPtr), rhs.(*BVExprPtr))
+	}
+	if lhs.IsBool() && rhs.IsBool() {
+		return p.boolIff(lhs.(*BoolExprPtr), rhs.(*BoolExprPtr))
+	}
+	return nil, fmt.Errorf("= expects arguments of the same sort")
+}
+
+func (p *smtlib2Parser) bvSub(lhs, rhs *BVExprPtr) (*BVExprPtr, error) {
+	return p.eb.Add(lhs, p.eb.Neg(rhs))
+}
+
+func (p *smtlib2Parser) bvSmod(s, t *BVExprPtr) (*BVExprPtr, error) {
+	size := s.Size()
+	zero := p.eb.BVV(0, size)
+	msbS, err := p.eb.SLt(s, zero)
+	if err != nil {
+		return nil, err
+	}
+	msbT, err := p.eb.SLt(t, zero)
+	if err != nil {
+		return nil, err
+	}
+	absS, err := p.eb.ITE(msbS, p.eb.Neg(s), s)
+	if err != nil {
+		return nil, err
+	}
+	absT, err := p.eb.ITE(msbT, p.eb.Neg(t), t)
+	if err != nil {
+		return nil, err
+	}
+	u, err := p.eb.URem(absS, absT)
+	if err != nil {
+		return nil, err
+	}
+	uIsZero, err := p.eb.Eq(u, zero)
+	if err != nil {
+		return nil, err
+	}
+	negUPlusT, err := p.eb.Add(p.eb.Neg(u), t)
+	if err != nil {
+		return nil, err
+	}
+	uPlusT, err := p.eb.Add(u, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// sign(s) == sign(t): -u if negative, u otherwise
+	sameSign, err := p.eb.ITE(msbS, p.eb.Neg(u), u)
+	if err != nil {
+		return nil, err
+	}
+	// sign(s) != sign(t): -u + t if s is negative, u + t otherwise
+	diffSign, err := p.eb.ITE(msbS, negUPlusT, uPlusT)
+	if err != nil {
+		return nil, err
+	}
+	signsDiffer, err := p.boolXor(msbS, msbT)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.eb.ITE(signsDiffer, diffSign, sameSign)
+	if err != nil {
+		return nil, err
+	}
+	return p.eb.ITE(uIsZero, u, res)
+}
+
+var smtlib2Cmps = map[string]func(*ExprBuilder, *BVExprPtr, *BVExprPtr) (*BoolExprPtr, error){
+	"bvult": (*ExprBuilder).Ult,
+	"bvule": (*ExprBuilder).Ule,
+	"bvugt": (*ExprBuilder).UGt,
+	"bvuge": (*ExprBuilder).UGe,
+	"bvslt": (*ExprBuilder).SLt,
+	"bvsle": (*ExprBuilder).SLe,
+	"bvsgt": (*ExprBuilder).SGt,
+	"bvsge": (*ExprBuilder).SGe,
+}
+
+var smtlib2BinOps = map[string]func(*ExprBuilder, *BVExprPtr, *BVExprPtr) (*BVExprPtr, error){
+	"bvudiv": (*ExprBuilder).UDiv,
+	"bvurem": (*ExprBuilder).URem,
+	"bvsdiv": (*ExprBuilder).SDiv,
+	"bvsrem": (*ExprBuilder).SRem,
+	"bvshl":  (*ExprBuilder).Shl,
+	"bvlshr": (*ExprBuilder).LShr,
+	"bvashr": (*ExprBuilder).AShr,
+}
+
+var smtlib2NaryOps = map[string]func(*ExprBuilder, *BVExprPtr, *BVExprPtr) (*BVExprPtr, error){
+	"bvand":  (*ExprBuilder).And,
+	"bvor":   (*ExprBuilder).Or,
+	"bvxor":  (*ExprBuilder).Xor,
+	"bvadd":  (*ExprBuilder).Add,
+	"bvmul":  (*ExprBuilder).Mul,
+	"concat": (*ExprBuilder).Concat,
+}
+
+func (p *smtlib2Parser) app(name string, args []ExprPtr) (ExprPtr, error) {
+	if cmp, ok := smtlib2Cmps[name]; ok {
+		bvs, err := p.bvArgs(name, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return cmp(p.eb, bvs[0], bvs[1])
+	}
+	if op, ok := smtlib2BinOps[name]; ok {
+		bvs, err := p.bvArgs(name, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return op(p.eb, bvs[0], bvs[1])
+	}
+	if op, ok := smtlib2NaryOps[name]; ok {
+		bvs, err := p.bvArgs(name, args, -2)
+		if err != nil {
+			return nil, err
+		}
+		res := bvs[0]
+		for _, bv := range bvs[1:] {
+			res, err = op(p.eb, res, bv)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+
+	switch name {
+	case "bvnot", "bvneg":
+		bvs, err := p.bvArgs(name, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if name == "bvnot" {
+			return p.eb.Not(bvs[0]), nil
+		}
+		return p.eb.Neg(bvs[0]), nil
+	case "bvsub":
+		bvs, err := p.bvArgs(name, args, -2)
+		if err != nil {
+			return nil, err
+		}
+		res := bvs[0]
+		for _, bv := range bvs[1:] {
+			res, err = p.bvSub(res, bv)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case "bvnand", "bvnor", "bvxnor":
+		bvs, err := p.bvArgs(name, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		op := map[string]func(*ExprBuilder, *BVExprPtr, *BVExprPtr) (*BVExprPtr, error){
+			"bvnand": (*ExprBuilder).And,
+			"bvnor":  (*ExprBuilder).Or,
+			"bvxnor": (*ExprBuilder).Xor,
+		}[name]
+		res, err := op(p.eb, bvs[0], bvs[1])
+		if err != nil {
+			return nil, err
+		}
+		return p.eb.Not(res), nil
+	case "bvcomp":
+		bvs, err := p.bvArgs(name, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		eq, err := p.eb.Eq(bvs[0], bvs[1])
+		if err != nil {
+			return nil, err
+		}
+		return p.eb.ITE(eq, p.eb.BVV(1, 1), p.eb.BVV(0, 1))
+	case "bvsmod":
+		bvs, err := p.bvArgs(name, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		if bvs[0].Size() != bvs[1].Size() {
+			return nil, fmt.Errorf("different sizes")
+		}
+		return p.bvSmod(bvs[0], bvs[1])
+	case "not":
+		bs, err := p.boolArgs(name, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return p.eb.BoolNot(bs[0])
+	case "and", "or", "xor":
+		bs, err := p.boolArgs(name, args, -1)
+		if err != nil {
+			return nil, err
+		}
+		res := bs[0]
+		for _, b := range bs[1:] {
+			switch name {
+			case "and":
+				res, err = p.eb.BoolAnd(res, b)
+			case "or":
+				res, err = p.eb.BoolOr(res, b)
+			case "xor":
+				res, err = p.boolXor(res, b)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case "=>":
+		bs, err := p.boolArgs(name, args, -2)
+		if err != nil {
+			return nil, err
+		}
+		// right associative
+		res := bs[len(bs)-1]
+		for i := len(bs) - 2; i >= 0; i-- {
+			notB, err := p.eb.BoolNot(bs[i])
+			if err != nil {
+				return nil, err
+			}
+			res, err = p.eb.BoolOr(notB, res)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case "=", "distinct":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("wrong number of arguments for %s", name)
+		}
+		res := p.eb.BoolVal(true)
+		for i := 0; i < len(args); i++ {
+			for j := i + 1; j < len(args); j++ {
+				// = is chainable, distinct is pairwise
+				if name == "=" && j != i+1 {
+					break
+				}
+				c, err := p.equal(args[i], args[j])
+				if err != nil {
+					return nil, err
+				}
+				if name == "distinct" {
+					c, err = p.eb.BoolNot(c)
+					if err != nil {
+						return nil, err
+					}
+				}
+				res, err = p.eb.BoolAnd(res, c)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return res, nil
+	case "ite":
+		if len(args) != 3 || !args[0].IsBool() {
+			return nil, fmt.Errorf("invalid ite")
+		}
+		cond := args[0].(*BoolExprPtr)
+		if args[1].IsBV() && args[2].IsBV() {
+			return p.eb.ITE(cond, args[1].(*BVExprPtr), args[2].(*BVExprPtr))
+		}
+		if args[1].IsBool() && args[2].IsBool() {
+			return p.boolIte(cond, args[1].(*BoolExprPtr), args[2].(*BoolExprPtr))
+		}
+		return nil, fmt.Errorf("ite expects branches of the same sort")
+	}
+	return nil, fmt.Errorf("unsupported function %s", name)
+}
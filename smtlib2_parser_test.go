@@ -0,0 +1,181 @@
+package gosmt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestSMTLIB2Parse1(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	script, err := eb.ParseSMTLIB2(strings.NewReader(`
+		(set-logic QF_BV)
+		; a comment
+		(declare-const a (_ BitVec 32))
+		(declare-fun |b| () (_ BitVec 32))
+		(define-fun sum () (_ BitVec 32) (bvadd a b))
+		(assert (bvule sum #x0000002a))
+		(assert (let ((x (bvsub sum (_ bv21 32)))) (bvuge x #b00000000000000000000000000000000)))
+		(check-sat)
+		(exit)`))
+	if isErr(t, err) {
+		return
+	}
+
+	if len(script.Declarations) != 3 || len(script.Assertions) != 2 || len(script.Queries) != 1 {
+		t.Error("unexpected script")
+		return
+	}
+	if script.Assertions[0].String() != "(a + b) u<= 0x2a" && script.Assertions[0].String() != "(b + a) u<= 0x2a" {
+		t.Error("unexpected assertion")
+		return
+	}
+
+	s := gosmt.NewZ3Solver(eb)
+	for _, a := range script.Assertions {
+		s.Add(a)
+	}
+	if r, _ := s.Satisfiable(); r != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+}
+
+func TestSMTLIB2ParsePushPop(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	script, err := eb.ParseSMTLIB2(strings.NewReader(`
+		(declare-const p Bool)
+		(declare-const a (_ BitVec 8))
+		(assert (=> p (= a #x01)))
+		(push 1)
+		(declare-const c (_ BitVec 8))
+		(define-fun inc ((x (_ BitVec 8))) (_ BitVec 8) (bvadd x #x01))
+		(assert (and p (distinct (inc a) c)))
+		(check-sat)
+		(pop 1)
+		(check-sat)`))
+	if isErr(t, err) {
+		return
+	}
+
+	if len(script.Queries) != 2 || len(script.Queries[0]) != 2 || len(script.Queries[1]) != 1 {
+		t.Error("unexpected queries")
+		return
+	}
+	if _, ok := script.Declarations["c"]; ok {
+		t.Error("c should be out of scope")
+		return
+	}
+}
+
+func TestSMTLIB2ParseResetAssertions(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	script, err := eb.ParseSMTLIB2(strings.NewReader(`
+		(declare-const a (_ BitVec 8))
+		(define-fun inc ((x (_ BitVec 8))) (_ BitVec 8) (bvadd x #x01))
+		(assert (= (inc a) #x01))
+		(reset-assertions)
+		(declare-const a Bool)
+		(define-fun inc ((x Bool)) Bool (not x))
+		(set-option :global-declarations true)
+		(push 1)
+		(declare-const b (_ BitVec 8))
+		(pop 1)
+		(reset-assertions)
+		(assert (and (inc a) (= b #x02)))
+		(check-sat)`))
+	if isErr(t, err) {
+		return
+	}
+
+	if len(script.Queries) != 1 || len(script.Queries[0]) != 1 {
+		t.Error("unexpected queries")
+		return
+	}
+	if a, ok := script.Declarations["a"]; !ok || !a.IsBool() {
+		t.Error("a should be redeclared")
+		return
+	}
+	if _, ok := script.Declarations["b"]; !ok {
+		t.Error("b should be global")
+		return
+	}
+}
+
+func TestSMTLIB2ParseErrors(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	scripts := []string{
+		"(assert (bvadd a #x01))",
+		"(declare-const a (_ BitVec 8)) (assert (bvadd a #x01))",
+		"(declare-const a (_ BitVec 8)) (assert (= a #x0001))",
+		"(declare-const a (_ BitVec 8)) (assert (= a #x01)",
+		"(pop 1)",
+		"(push 1) (pop 2)",
+		// the names of the symbols backing the Bool constants are reserved
+		"(declare-const |bool!p| (_ BitVec 1))",
+		// the body is resolved when the function is defined
+		"(define-fun f ((x (_ BitVec 8))) (_ BitVec 8) (bvadd x y)) (declare-const y (_ BitVec 8)) (assert (= (f y) y))",
+		"(define-fun f ((x (_ BitVec 8))) Bool (bvadd x #x01))",
+		// reset-assertions removes the declarations
+		"(declare-const a (_ BitVec 8)) (reset-assertions) (assert (= a #x01))",
+	}
+	for _, script := range scripts {
+		if _, err := eb.ParseSMTLIB2(strings.NewReader(script)); err == nil {
+			t.Errorf("%s should not be parsed", script)
+			return
+		}
+	}
+}
+
+func TestSMTLIB2ParseBoolAlias(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	script, err := eb.ParseSMTLIB2(strings.NewReader(`
+		(declare-const p Bool)
+		(assert p)`))
+	if isErr(t, err) {
+		return
+	}
+
+	// a bit-vector with the same name is a different symbol
+	s := gosmt.NewBitblastSolver(eb)
+	s.Add(script.Assertions[0])
+	e, _ := eb.Eq(eb.BVS("p", 1), eb.BVV(0, 1))
+	s.Add(e)
+	if r, _ := s.Satisfiable(); r != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+}
+
+func TestSMTLIB2Roundtrip(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	decls := map[string]gosmt.ExprPtr{"a": eb.BVS("a", 16), "b": eb.BVS("b", 16)}
+	terms := []string{
+		"(bvsmod a b)",
+		"((_ rotate_left 3) a)",
+		"((_ repeat 2) ((_ extract 7 0) b))",
+		"(bvcomp a b)",
+		"(ite (bvslt a b) (bvnand a b) (bvxnor a b))",
+	}
+	for _, term := range terms {
+		e, err := eb.ParseSMTLIB2Expr(term, decls)
+		if isErr(t, err) {
+			return
+		}
+		e2, err := eb.ParseSMTLIB2Expr(gosmt.ToSMTLIB2(e), decls)
+		if isErr(t, err) {
+			return
+		}
+		if e.(*gosmt.BVExprPtr).Id() != e2.(*gosmt.BVExprPtr).Id() {
+			t.Errorf("%s does not roundtrip", term)
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package gosmt_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestSMTLIB2Expr(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	e, _ := eb.Extract(a, 15, 0)
+	e, _ = eb.ZExt(e, 16)
+	e, _ = eb.Shl(e, b)
+
+	if gosmt.ToSMTLIB2(e) != "(bvshl ((_ zero_extend 16) ((_ extract 15 0) a)) b)" {
+		t.Error("unexpected SMT-LIB2 expression")
+		return
+	}
+
+	c, _ := eb.Ult(e, eb.BVV(42, 32))
+	if gosmt.ToSMTLIB2(c) != "(bvult (bvshl ((_ zero_extend 16) ((_ extract 15 0) a)) b) #x0000002a)" {
+		t.Error("unexpected SMT-LIB2 expression")
+		return
+	}
+}
+
+func TestSMTLIB2Let(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+
+	a := eb.BVS("a", 8)
+	b := eb.BVS("b", 8)
+	s, _ := eb.LShr(a, b)
+	e, _ := eb.Concat(s, s)
+
+	if gosmt.ToSMTLIB2(e) != "(let ((?e0 (bvlshr a b))) (concat ?e0 ?e0))" {
+		t.Error("unexpected SMT-LIB2 expression")
+		return
+	}
+}
+
+func TestSMTLIB2Dump(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b weird", 32)
+	sum, _ := eb.Add(a, b)
+	e, _ := eb.Ule(sum, eb.BVV(42, 32))
+	s.Add(e)
+	e, _ = eb.UGe(sum, eb.BVV(21, 32))
+	s.Add(e)
+
+	out := strings.Builder{}
+	if err := s.DumpSMTLIB2(&out); err != nil {
+		t.Error(err)
+		return
+	}
+	dump := out.String()
+	if !strings.Contains(dump, "(declare-const a (_ BitVec 32))\n") ||
+		!strings.Contains(dump, "(declare-const |b weird| (_ BitVec 32))\n") {
+		t.Error("missing declarations")
+		return
+	}
+	if !strings.Contains(dump, "(define-fun ?e0 () (_ BitVec 32) (bvadd ") {
+		t.Error("missing shared subterm")
+		return
+	}
+	if strings.Count(dump, "(assert ") != 2 || !strings.HasSuffix(dump, "(check-sat)\n") {
+		t.Error("unexpected assertions")
+		return
+	}
+}
+
+func TestSMTLIB2DumpOrder(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+
+	// names that must be quoted
+	names := []string{"true", "let", "assert", "1x"}
+	for i, name := range names {
+		e, _ := eb.Ult(eb.BVS(name, 8), eb.BVV(int64(10+i), 8))
+		s.Add(e)
+	}
+
+	out := strings.Builder{}
+	if err := s.DumpSMTLIB2(&out); err != nil {
+		t.Error(err)
+		return
+	}
+	dump := out.String()
+	last := -1
+	for i, name := range names {
+		if !strings.Contains(dump, "(declare-const |"+name+"| (_ BitVec 8))\n") {
+			t.Errorf("%s should be quoted", name)
+			return
+		}
+		// the assertions are in the order of the constraints
+		pos := strings.Index(dump, fmt.Sprintf("(assert (bvult |%s| #x%02x))", name, 10+i))
+		if pos <= last {
+			t.Errorf("wrong order of the assertions\n%s", dump)
+			return
+		}
+		last = pos
+	}
+
+	script, err := eb.ParseSMTLIB2(strings.NewReader(dump))
+	if isErr(t, err) {
+		return
+	}
+	if len(script.Assertions) != len(names) {
+		t.Error("wrong number of assertions")
+		return
+	}
+	for i, a := range script.Assertions {
+		if a.Id() != s.Constraints()[i].Id() {
+			t.Errorf("wrong assertion %s", a.String())
+			return
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package gosmt
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
 
 const (
 	RESULT_ERROR   = 0
@@ -9,116 +16,217 @@ const (
 	RESULT_UNKNOWN = 3
 )
 
+/*
+ *  A backend keeps the constraints added with `add` across queries. `check` and
+ *  `evalUpto` work on the added constraints in conjunction with `query`, which
+ *  is not retained after the call. When the result is RESULT_UNKNOWN, the
+ *  returned error describes why (e.g., the context was cancelled).
+ *  `checkAssuming` is like `check` with a conjunction of queries and, when the
+ *  result is RESULT_UNSAT, it returns the indexes of a subset of the
+ *  assumptions that is still unsatisfiable.
+ */
 type solverBackend interface {
+	fresh() solverBackend
 	clone() solverBackend
-	check(query *BoolExprPtr) int
+	push()
+	pop(n int)
+	add(constraint *BoolExprPtr)
+	check(ctx context.Context, query *BoolExprPtr) (int, error)
+	checkAssuming(ctx context.Context, assumptions []*BoolExprPtr) (int, []int, error)
 	model() map[string]*BVConst
-	evalUpto(bv *BVExprPtr, pi *BoolExprPtr, n int) []*BVConst
+	funModel() map[string]*FunInterp
+	evalUpto(ctx context.Context, bv *BVExprPtr, query *BoolExprPtr, n int) ([]*BVConst, error)
 }
 
+type solverScope struct {
+	constraints []*BoolExprPtr
+	// the length of the trail of the partition
+	mark  int
+	model map[string]*BVConst
+}
+
+/*
+ *  A Solver can be used by multiple goroutines. The queries (CheckSat, Eval,
+ *  ...) do not change the constraints and can be issued concurrently, but
+ *  they are serialized on the backend, while the methods that change the
+ *  constraints (Add, Push, Pop, CheckSatAndAddIfSat, ...) wait for the
+ *  running queries. Queries that must run in parallel should be issued on
+ *  clones, whose backends are independent (each Z3 backend owns a context,
+ *  see Z3ContextPool). All the solvers can share the same ExprBuilder.
+ *  The constraints are partitioned in independent sets (see partition), the
+ *  partition is shared with the clones until one of them changes it
+ */
 type Solver struct {
-	eb              *ExprBuilder
-	backend         solverBackend
-	constraints     map[uintptr]*BoolExprPtr
-	symToContraints map[uintptr]map[uintptr]*BoolExprPtr
-	symDependencies map[uintptr]map[uintptr]*BVExprPtr
+	// lock protects the constraints, queryLock the backend and the results
+	// of the queries
+	lock      sync.RWMutex
+	queryLock sync.Mutex
+
+	eb          *ExprBuilder
+	backend     solverBackend
+	constraints map[uintptr]*BoolExprPtr
+	// the constraints in the order they were added, the ones in
+	// order[:verified] are known to be satisfiable
+	order           []*BoolExprPtr
+	verified        int
+	partition       *partition
+	partitionShared bool
+	names           map[uintptr]string
+	scopes          []solverScope
+	timeout         time.Duration
 
 	// A cache for previous evaluations
 	model map[string]*BVConst
+	// The results of previous queries, shared with the clones
+	cache *CexCache
+	// The last query found unsatisfiable, used to compute unsat cores
+	lastUnsatQuery *BoolExprPtr
 }
 
-func NewZ3Solver(eb *ExprBuilder) *Solver {
+func newSolver(eb *ExprBuilder, backend solverBackend) *Solver {
 	return &Solver{
-		eb:              eb,
-		backend:         newZ3Backend(),
-		constraints:     make(map[uintptr]*BoolExprPtr),
-		symToContraints: make(map[uintptr]map[uintptr]*BoolExprPtr),
-		symDependencies: make(map[uintptr]map[uintptr]*BVExprPtr),
-		model:           make(map[string]*BVConst),
+		eb:          eb,
+		backend:     backend,
+		constraints: make(map[uintptr]*BoolExprPtr),
+		order:       make([]*BoolExprPtr, 0),
+		partition:   newPartition(),
+		names:       make(map[uintptr]string),
+		scopes:      make([]solverScope, 0),
+		model:       make(map[string]*BVConst),
+		cache:       NewCexCache(eb),
+	}
+}
+
+// NewZ3Solver returns a solver whose backend (and every backend of its clones)
+// owns a new Z3 context
+func NewZ3Solver(eb *ExprBuilder) *Solver {
+	return newSolver(eb, newZ3Backend(NewZ3ContextPool(0)))
+}
+
+// NewZ3SolverWithPool returns a solver whose backends take the Z3 contexts
+// from pool
+func NewZ3SolverWithPool(eb *ExprBuilder, pool *Z3ContextPool) *Solver {
+	return newSolver(eb, newZ3Backend(pool))
+}
+
+// NewZ3SolverWithOptions returns a solver whose backends configure Z3 with
+// options, e.g., to race different seeds or tactics with NewPortfolioSolver.
+// Without options the backends take the Z3 contexts from pool (a new context
+// for each backend if nil). The bindings cannot configure their solvers, so
+// with options every backend owns a Z3 context, driven through SMT-LIB2
+// (see z3Conn), and pool is not used
+func NewZ3SolverWithOptions(eb *ExprBuilder, pool *Z3ContextPool, options Z3Options) (*Solver, error) {
+	if options.Tactic != "" && !z3HasTactic(options.Tactic) {
+		return nil, fmt.Errorf("unknown Z3 tactic %s", options.Tactic)
+	}
+	if options == (Z3Options{}) {
+		if pool == nil {
+			pool = NewZ3ContextPool(0)
+		}
+		return NewZ3SolverWithPool(eb, pool), nil
+	}
+	return newSolver(eb, newSmtlib2Backend(eb, newZ3Smtlib2Solver(options))), nil
+}
+
+// NewBitblastSolver returns a solver that does not depend on Z3, it bit-blasts
+// the constraints and solves them with the built-in SAT solver
+func NewBitblastSolver(eb *ExprBuilder) *Solver {
+	return newSolver(eb, newBitblastBackend())
+}
+
+// lockQuery locks the solver for a query, the returned function unlocks it
+func (s *Solver) lockQuery() func() {
+	s.lock.RLock()
+	s.queryLock.Lock()
+	return func() {
+		s.queryLock.Unlock()
+		s.lock.RUnlock()
 	}
 }
 
 func (s *Solver) Clone() *Solver {
+	defer s.lockQuery()()
+
 	clone := &Solver{
 		eb:              s.eb,
 		backend:         s.backend.clone(),
 		constraints:     make(map[uintptr]*BoolExprPtr),
-		symToContraints: make(map[uintptr]map[uintptr]*BoolExprPtr),
-		symDependencies: make(map[uintptr]map[uintptr]*BVExprPtr),
+		order:           append([]*BoolExprPtr{}, s.order...),
+		verified:        s.verified,
+		partition:       s.partition,
+		partitionShared: true,
+		names:           make(map[uintptr]string),
+		scopes:          make([]solverScope, 0),
+		timeout:         s.timeout,
 		model:           make(map[string]*BVConst),
+		cache:           s.cache,
+		lastUnsatQuery:  s.lastUnsatQuery,
 	}
 	for k, val := range s.constraints {
 		clone.constraints[k] = val
 	}
+	for k, val := range s.names {
+		clone.names[k] = val
+	}
 	for k, val := range s.model {
 		clone.model[k] = val
 	}
-	for k1, val1 := range s.symToContraints {
-		set := make(map[uintptr]*BoolExprPtr)
-		for k2, val2 := range val1 {
-			set[k2] = val2
-		}
-		clone.symToContraints[k1] = set
-	}
-	for k1, val1 := range s.symDependencies {
-		set := make(map[uintptr]*BVExprPtr)
-		for k2, val2 := range val1 {
-			set[k2] = val2
-		}
-		clone.symDependencies[k1] = set
+	for _, scope := range s.scopes {
+		clone.scopes = append(clone.scopes, solverScope{
+			constraints: append([]*BoolExprPtr{}, scope.constraints...),
+			mark:        scope.mark,
+			model:       scope.model,
+		})
 	}
+	// the queries are serialized, so the flag can be set with the read lock
+	s.partitionShared = true
 	return clone
 }
 
-func (s *Solver) registerConstraintForSym(sym *BVExprPtr, constraint *BoolExprPtr) {
-	if _, ok := s.symToContraints[sym.Id()]; !ok {
-		s.symToContraints[sym.Id()] = make(map[uintptr]*BoolExprPtr)
-	}
-	s.symToContraints[sym.Id()][constraint.Id()] = constraint
-}
-
-func (s *Solver) registerSymDepencency(sym1 *BVExprPtr, sym2 *BVExprPtr) {
-	if _, ok := s.symDependencies[sym1.Id()]; !ok {
-		s.symDependencies[sym1.Id()] = make(map[uintptr]*BVExprPtr)
+// writablePartition returns the partition, copying it if it is shared
+func (s *Solver) writablePartition() *partition {
+	if s.partitionShared {
+		s.partition = s.partition.copy()
+		s.partitionShared = false
 	}
-	if _, ok := s.symDependencies[sym2.Id()]; !ok {
-		s.symDependencies[sym2.Id()] = make(map[uintptr]*BVExprPtr)
-	}
-	s.symDependencies[sym1.Id()][sym2.Id()] = sym2
-	s.symDependencies[sym2.Id()][sym1.Id()] = sym1
+	return s.partition
 }
 
 func (s *Solver) getDependentConstraints(constraint ExprPtr) []*BoolExprPtr {
-	// return all the constraints that are related with the input one (even indirectly)
-	syms := s.eb.InvolvedInputs(constraint)
-	symsMap := make(map[uintptr]*BVExprPtr)
-	for i := 0; i < len(syms); i++ {
-		symsMap[syms[i].Id()] = syms[i]
-		otherSyms := s.symDependencies[syms[i].Id()]
-		for _, osym := range otherSyms {
-			symsMap[osym.Id()] = osym
+	// return all the constraints that are related with the input one (even
+	// indirectly). The other sets can be ignored only if they are satisfiable,
+	// so the sets of the constraints not known to be satisfiable are always
+	// returned (with the constraints without inputs, that are in no set)
+	keys := s.eb.dependencyKeys(constraint)
+	inputless := make([]*BoolExprPtr, 0)
+	for _, c := range s.order[s.verified:] {
+		cKeys := s.eb.dependencyKeys(c)
+		if len(cKeys) == 0 {
+			inputless = append(inputless, c)
 		}
+		keys = append(keys, cKeys...)
 	}
+	return append(s.partition.dependent(keys), inputless...)
+}
 
-	constraints := make(map[uintptr]*BoolExprPtr)
-	for _, sym := range symsMap {
-		if _, ok := s.symToContraints[sym.Id()]; !ok {
-			continue
-		}
-		symConstraints := s.symToContraints[sym.Id()]
-		for _, v := range symConstraints {
-			constraints[v.Id()] = v
-		}
-	}
+// IndependentSets returns the constraints grouped in independent sets, the
+// constraints without inputs are not in any set
+func (s *Solver) IndependentSets() [][]*BoolExprPtr {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-	res := make([]*BoolExprPtr, 0)
-	for _, c := range constraints {
-		res = append(res, c)
-	}
-	return res
+	sets := s.partition.sets()
+	sort.Slice(sets, func(i, j int) bool { return sets[i][0].Id() < sets[j][0].Id() })
+	return sets
 }
 
 func (s *Solver) Add(constraint *BoolExprPtr) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.add(constraint)
+}
+
+func (s *Solver) add(constraint *BoolExprPtr) {
 	if _, ok := s.constraints[constraint.Id()]; ok {
 		return
 	}
@@ -129,18 +237,69 @@ func (s *Solver) Add(constraint *BoolExprPtr) {
 		}
 	}
 	s.constraints[constraint.Id()] = constraint
+	s.order = append(s.order, constraint)
+	s.backend.add(constraint)
+
+	if len(s.scopes) > 0 {
+		scope := &s.scopes[len(s.scopes)-1]
+		scope.constraints = append(scope.constraints, constraint)
+	}
+	// the changes are undone only when a scope is popped
+	s.writablePartition().add(s.eb.dependencyKeys(constraint), constraint, len(s.scopes) > 0)
+}
+
+func (s *Solver) Push() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.scopes = append(s.scopes, solverScope{
+		constraints: make([]*BoolExprPtr, 0),
+		mark:        len(s.partition.trail),
+		model:       s.model,
+	})
+	s.backend.push()
+}
+
+func (s *Solver) Pop(n int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if n > len(s.scopes) {
+		return fmt.Errorf("cannot pop %d scopes, only %d available", n, len(s.scopes))
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	for i := 0; i < n; i++ {
+		scope := s.scopes[len(s.scopes)-1]
+		s.scopes = s.scopes[:len(s.scopes)-1]
 
-	syms := s.eb.InvolvedInputs(constraint)
-	for i := 0; i < len(syms); i++ {
-		sym := syms[i]
-		s.registerConstraintForSym(sym, constraint)
-		for j := i + 1; j < len(syms); j++ {
-			s.registerSymDepencency(sym, syms[j])
+		for _, c := range scope.constraints {
+			delete(s.constraints, c.Id())
+			delete(s.names, c.Id())
 		}
+		s.order = s.order[:len(s.order)-len(scope.constraints)]
+		if s.verified > len(s.order) {
+			s.verified = len(s.order)
+		}
+		s.writablePartition().undo(scope.mark)
+		s.model = scope.model
 	}
+	s.backend.pop(n)
+	return nil
+}
+
+func (s *Solver) NumScopes() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.scopes)
 }
 
 func (s *Solver) Pi() *BoolExprPtr {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	res := s.eb.BoolVal(true)
 	for _, val := range s.constraints {
 		var err error
@@ -153,8 +312,30 @@ func (s *Solver) Pi() *BoolExprPtr {
 	return res
 }
 
+// CexCache returns the counterexample cache of the solver
+func (s *Solver) CexCache() *CexCache {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.cache
+}
+
+// SetCexCache makes the solver use the counterexample cache c, that can be
+// shared with other solvers
+func (s *Solver) SetCexCache(c *CexCache) error {
+	if c.eb != s.eb {
+		return fmt.Errorf("the cache uses a different ExprBuilder")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cache = c
+	return nil
+}
+
 func (s *Solver) pi(e ExprPtr) *BoolExprPtr {
-	constraints := s.getDependentConstraints(e)
+	return s.conjunction(s.getDependentConstraints(e))
+}
+
+func (s *Solver) conjunction(constraints []*BoolExprPtr) *BoolExprPtr {
 	res := s.eb.BoolVal(true)
 	for _, v := range constraints {
 		var err error
@@ -185,68 +366,213 @@ func (s *Solver) checkSatCurrentModel(q *BoolExprPtr) int {
 	return RESULT_UNKNOWN
 }
 
+// checkSatCached checks the query using the cached model, the known bits and
+// the intervals of the constraints and the counterexample cache, pi is the conjunction of the query with the dependent
+// constraints. The returned model is not nil if it satisfies pi
+func (s *Solver) checkSatCached(query *BoolExprPtr, dependent []*BoolExprPtr, pi *BoolExprPtr) (int, map[string]*BVConst) {
+	result := s.checkSatCurrentModel(pi)
+	if result == RESULT_SAT {
+		return result, s.model
+	}
+	if result == RESULT_UNSAT {
+		return result, nil
+	}
+	if value, known := s.eb.knownBool(pi, -1); known {
+		if value {
+			return RESULT_SAT, nil
+		}
+		return RESULT_UNSAT, nil
+	}
+	constraints := append(append(make([]*BoolExprPtr, 0, len(dependent)+1), dependent...), query)
+	if newIntervalAnalysis(constraints).infeasible {
+		return RESULT_UNSAT, nil
+	}
+	return s.cache.lookup(s.constraints, dependent, query, pi)
+}
+
+// cacheResult stores the result of the backend in the counterexample cache
+// and returns the model if the result is RESULT_SAT
+func (s *Solver) cacheResult(query *BoolExprPtr, result int) map[string]*BVConst {
+	if result == RESULT_SAT {
+		model := s.backend.model()
+		s.cache.addSat(s.constraints, query, model)
+		return model
+	}
+	if result == RESULT_UNSAT {
+		s.cache.addUnsat(s.constraints, query)
+	}
+	return nil
+}
+
+func (s *Solver) recordResult(query *BoolExprPtr, result int) {
+	if result == RESULT_UNSAT {
+		s.lastUnsatQuery = query
+	} else if result == RESULT_SAT {
+		s.lastUnsatQuery = nil
+		// a satisfiable query proves that the constraints are satisfiable
+		s.verified = len(s.order)
+	}
+}
+
+func (s *Solver) SetTimeout(timeout time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.timeout = timeout
+}
+
+func (s *Solver) Timeout() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.timeout
+}
+
+func (s *Solver) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
 func (s *Solver) Satisfiable() (int, error) {
-	pi := s.Pi()
+	return s.SatisfiableCtx(context.Background())
+}
+
+func (s *Solver) SatisfiableCtx(ctx context.Context) (int, error) {
+	defer s.lockQuery()()
+
+	constraints := make([]*BoolExprPtr, 0, len(s.constraints))
+	for _, c := range s.constraints {
+		constraints = append(constraints, c)
+	}
+	pi := s.conjunction(constraints)
 	satCurrentModel := s.checkSatCurrentModel(pi)
 	if satCurrentModel == RESULT_SAT {
+		s.recordResult(s.eb.BoolVal(true), RESULT_SAT)
 		return RESULT_SAT, nil
 	}
 	if satCurrentModel == RESULT_UNSAT {
+		s.recordResult(s.eb.BoolVal(true), RESULT_UNSAT)
 		return RESULT_ERROR, fmt.Errorf("unsat state")
 	}
+	if r, model := s.cache.lookup(s.constraints, constraints, s.eb.BoolVal(true), pi); r != RESULT_UNKNOWN {
+		s.recordResult(s.eb.BoolVal(true), r)
+		if model != nil {
+			s.model = model
+		}
+		return r, nil
+	}
 
-	r := s.backend.check(s.Pi())
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	r, err := s.backend.check(ctx, s.eb.BoolVal(true))
+	if r == RESULT_UNKNOWN {
+		return r, err
+	}
+	s.recordResult(s.eb.BoolVal(true), r)
 	// save the model
-	s.model = s.backend.model()
+	if model := s.cacheResult(s.eb.BoolVal(true), r); model != nil {
+		s.model = model
+	}
 	return r, nil
 }
 
 func (s *Solver) CheckSat(query *BoolExprPtr) int {
-	pi, err := s.eb.BoolAnd(s.pi(query), query)
+	r, _ := s.CheckSatCtx(context.Background(), query)
+	return r
+}
+
+func (s *Solver) CheckSatCtx(ctx context.Context, query *BoolExprPtr) (int, error) {
+	defer s.lockQuery()()
+
+	dependent := s.getDependentConstraints(query)
+	pi, err := s.eb.BoolAnd(s.conjunction(dependent), query)
 	if err != nil {
 		panic(err)
 	}
-	satCurrentModel := s.checkSatCurrentModel(pi)
-	if satCurrentModel == RESULT_UNKNOWN {
-		return s.backend.check(pi)
+	result, _ := s.checkSatCached(query, dependent, pi)
+	if result == RESULT_UNKNOWN {
+		ctx, cancel := s.queryContext(ctx)
+		defer cancel()
+		result, err = s.backend.check(ctx, query)
+		if err != nil {
+			return result, err
+		}
+		s.cacheResult(query, result)
 	}
-	return satCurrentModel
+	s.recordResult(query, result)
+	return result, nil
 }
 
 func (s *Solver) CheckSatAndAddIfSat(query *BoolExprPtr) int {
-	pi, err := s.eb.BoolAnd(s.pi(query), query)
+	r, _ := s.CheckSatAndAddIfSatCtx(context.Background(), query)
+	return r
+}
+
+func (s *Solver) CheckSatAndAddIfSatCtx(ctx context.Context, query *BoolExprPtr) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dependent := s.getDependentConstraints(query)
+	pi, err := s.eb.BoolAnd(s.conjunction(dependent), query)
 	if err != nil {
 		panic(err)
 	}
-	result := s.checkSatCurrentModel(pi)
+	result, model := s.checkSatCached(query, dependent, pi)
 	if result == RESULT_UNKNOWN {
-		result = s.backend.check(pi)
+		ctx, cancel := s.queryContext(ctx)
+		defer cancel()
+		result, err = s.backend.check(ctx, query)
+		if err != nil {
+			return result, err
+		}
+		model = s.cacheResult(query, result)
 	}
 	if result == RESULT_SAT {
-		s.model = s.backend.model()
-		s.Add(query)
+		s.model = model
+		s.add(query)
 	}
-	return result
+	s.recordResult(query, result)
+	return result, nil
 }
 
 func (s *Solver) Model() map[string]*BVConst {
+	defer s.lockQuery()()
 	return s.backend.model()
 }
 
+// FunModel returns the interpretations of the uninterpreted functions in the
+// last model, with an entry for every application in the constraints
+func (s *Solver) FunModel() map[string]*FunInterp {
+	defer s.lockQuery()()
+	return s.backend.funModel()
+}
+
 func (s *Solver) Eval(bv *BVExprPtr) *BVConst {
+	r, _ := s.EvalCtx(context.Background(), bv)
+	return r
+}
+
+func (s *Solver) EvalCtx(ctx context.Context, bv *BVExprPtr) (*BVConst, error) {
+	defer s.lockQuery()()
+	return s.evalCtx(ctx, bv)
+}
+
+func (s *Solver) evalCtx(ctx context.Context, bv *BVExprPtr) (*BVConst, error) {
+	// the cached model is valid only if it satisfies the constraints added after it
 	bvEval := s.eb.eval(bv, s.model)
-	if bvEval.getInternal().kind() == TY_CONST {
+	if bvEval.getInternal().kind() == TY_CONST && s.checkSatCurrentModel(s.pi(bv)) == RESULT_SAT {
 		bvEvalInt := bvEval.getInternal().(*internalBVV)
-		return bvEvalInt.Value.Copy()
+		return bvEvalInt.Value.Copy(), nil
 	}
 
-	pi := s.pi(bv)
-	res := s.backend.evalUpto(bv, pi, 1)
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	res, err := s.backend.evalUpto(ctx, bv, s.eb.BoolVal(true), 1)
 	if len(res) == 0 {
-		return nil
+		return nil, err
 	}
 	s.model = s.backend.model()
-	return res[0]
+	return res[0], nil
 }
 
 func (s *Solver) EvalList(bvs []*BVExprPtr) []*BVConst {
@@ -254,30 +580,33 @@ func (s *Solver) EvalList(bvs []*BVExprPtr) []*BVConst {
 		return make([]*BVConst, 0)
 	}
 
-	joint := bvs[0]
-	for _, e := range bvs[1:] {
-		var err error
-		joint, err = s.eb.Concat(e, joint)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	jointVal := s.Eval(joint)
-	pieces := make([]*BVConst, 0)
-	accumulator := uint(0)
-	for i := 0; i < len(bvs); i++ {
-		pieces = append(pieces, jointVal.Slice(accumulator+bvs[i].Size()-1, accumulator))
-		accumulator += bvs[i].Size()
-	}
-	return pieces
+	return splitValue(bvs, s.Eval(s.joinExprs(bvs)))
 }
 
 func (s *Solver) EvalUpto(bv *BVExprPtr, n int) []*BVConst {
-	pi := s.pi(bv)
-	r := s.backend.evalUpto(bv, pi, n)
+	r, _ := s.EvalUptoCtx(context.Background(), bv, n)
+	return r
+}
+
+// EvalUptoCtx returns the values found so far together with an error if the
+// enumeration is interrupted
+func (s *Solver) EvalUptoCtx(ctx context.Context, bv *BVExprPtr, n int) ([]*BVConst, error) {
+	defer s.lockQuery()()
+
+	// no more values than the ones in the interval of bv
+	iv := s.interval(bv)
+	if iv == nil {
+		return make([]*BVConst, 0), nil
+	}
+	if iv.Count().Cmp(big.NewInt(int64(n))) < 0 {
+		n = int(iv.Count().Int64())
+	}
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	r, err := s.backend.evalUpto(ctx, bv, s.eb.BoolVal(true), n)
 	if len(r) > 0 {
 		s.model = s.backend.model()
 	}
-	return r
+	return r, err
 }
@@ -0,0 +1,115 @@
+package gosmt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A batchGroup is a set of queries that depend on the same constraints
+type batchGroup struct {
+	dependent []*BoolExprPtr
+	queries   []int
+}
+
+func (s *Solver) batchGroups(queries []*BoolExprPtr) []batchGroup {
+	groups := make([]batchGroup, 0)
+	index := make(map[string]int)
+	for i, q := range queries {
+		dependent := s.getDependentConstraints(q)
+		sort.Slice(dependent, func(i, j int) bool { return dependent[i].Id() < dependent[j].Id() })
+		key := strings.Builder{}
+		for _, d := range dependent {
+			fmt.Fprintf(&key, "%x,", d.Id())
+		}
+		g, ok := index[key.String()]
+		if !ok {
+			g = len(groups)
+			index[key.String()] = g
+			groups = append(groups, batchGroup{dependent: dependent})
+		}
+		groups[g].queries = append(groups[g].queries, i)
+	}
+	return groups
+}
+
+func (s *Solver) CheckSatMany(queries []*BoolExprPtr) []int {
+	r, _ := s.CheckSatManyCtx(context.Background(), queries)
+	return r
+}
+
+/*
+ *  CheckSatManyCtx checks every query in conjunction with the constraints, as
+ *  CheckSat does, and returns the results in the same order. The queries are
+ *  grouped by the constraints they depend on, and all of them are checked
+ *  with the cached models first. The others are checked one at a time as
+ *  assumptions on the backend, so this is a convenience loop over the queries
+ *  that shares the translation of the constraints and what the backend
+ *  learns, and every model it finds is tried on the pending queries of the
+ *  same group. The timeout applies to each query. When a query cannot be
+ *  decided its result is RESULT_UNKNOWN, and the last error is returned.
+ */
+func (s *Solver) CheckSatManyCtx(ctx context.Context, queries []*BoolExprPtr) ([]int, error) {
+	defer s.lockQuery()()
+
+	results := make([]int, len(queries))
+	pis := make([]*BoolExprPtr, len(queries))
+	pending := make([][]int, 0)
+	for _, g := range s.batchGroups(queries) {
+		conj := s.conjunction(g.dependent)
+		left := make([]int, 0)
+		for _, i := range g.queries {
+			pi, err := s.eb.BoolAnd(conj, queries[i])
+			if err != nil {
+				panic(err)
+			}
+			pis[i] = pi
+			results[i], _ = s.checkSatCached(queries[i], g.dependent, pi)
+			if results[i] == RESULT_UNKNOWN {
+				left = append(left, i)
+			} else {
+				s.recordResult(queries[i], results[i])
+			}
+		}
+		pending = append(pending, left)
+	}
+
+	var lastErr error
+	for _, left := range pending {
+		for j, i := range left {
+			if results[i] != RESULT_UNKNOWN {
+				continue
+			}
+			qctx, cancel := s.queryContext(ctx)
+			r, _, err := s.backend.checkAssuming(qctx, queries[i:i+1])
+			cancel()
+			if r == RESULT_UNKNOWN {
+				if ctx.Err() != nil {
+					return results, ctx.Err()
+				}
+				lastErr = err
+				continue
+			}
+			results[i] = r
+			s.recordResult(queries[i], r)
+			// the backend checks the query with all the constraints, so
+			// an unsatisfiable result is a valid entry of the cache
+			model := s.cacheResult(queries[i], r)
+			if r != RESULT_SAT {
+				continue
+			}
+			for _, k := range left[j+1:] {
+				if results[k] != RESULT_UNKNOWN {
+					continue
+				}
+				evalPi := s.eb.eval(pis[k], model)
+				if evalPi.getInternal().kind() == TY_BOOL_CONST && evalPi.getInternal().(*internalBoolVal).Value.Value {
+					results[k] = RESULT_SAT
+					s.recordResult(queries[k], RESULT_SAT)
+				}
+			}
+		}
+	}
+	return results, lastErr
+}
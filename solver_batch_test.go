@@ -0,0 +1,97 @@
+package gosmt_test
+
+import (
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestSolverCheckSatMany(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		if len(s.CheckSatMany(nil)) != 0 {
+			t.Error("no queries")
+			return
+		}
+
+		x := eb.BVS("x", 32)
+		y := eb.BVS("y", 32)
+		e, _ := eb.Ult(x, eb.BVV(10, 32))
+		s.Add(e)
+		sq, _ := eb.Mul(y, y)
+		e, _ = eb.Eq(sq, eb.BVV(49, 32))
+		s.Add(e)
+
+		// a switch on x, with some queries on y
+		queries := make([]*gosmt.BoolExprPtr, 0)
+		for i := 0; i < 16; i++ {
+			q, _ := eb.Eq(x, eb.BVV(int64(i), 32))
+			queries = append(queries, q)
+		}
+		q, _ := eb.Eq(y, eb.BVV(7, 32))
+		queries = append(queries, q)
+		q, _ = eb.Eq(y, eb.BVV(8, 32))
+		queries = append(queries, q)
+		q, _ = eb.Eq(x, y)
+		queries = append(queries, q)
+
+		results := s.CheckSatMany(queries)
+		if len(results) != len(queries) {
+			t.Error("wrong number of results")
+			return
+		}
+		for i, r := range results {
+			expected := gosmt.RESULT_SAT
+			if (i >= 10 && i < 16) || i == 17 {
+				expected = gosmt.RESULT_UNSAT
+			}
+			if r != expected {
+				t.Errorf("wrong result %d for query %d", r, i)
+				return
+			}
+			if s.CheckSat(queries[i]) != r {
+				t.Errorf("CheckSat disagrees on query %d", i)
+				return
+			}
+		}
+
+		// the queries are not added
+		if r, _ := s.Satisfiable(); r != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+		if len(s.EvalUpto(x, 20)) != 10 {
+			t.Error("wrong number of values")
+			return
+		}
+	}
+}
+
+func TestSolverCheckSatManyFalse(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		e, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.Add(e)
+
+		// not decided by the interval analysis
+		sq, _ := eb.Mul(a, a)
+		q, _ := eb.Eq(sq, eb.BVV(20, 32))
+		results := s.CheckSatMany([]*gosmt.BoolExprPtr{eb.BoolVal(false), q})
+		if results[0] != gosmt.RESULT_UNSAT || results[1] != gosmt.RESULT_UNSAT {
+			t.Errorf("wrong results %v", results)
+			return
+		}
+		// only the set of q is cached, false tells nothing about the
+		// constraints
+		if s.CexCache().Stats().CachedUnsatSets != 1 {
+			t.Error("only the set of q should be cached")
+			return
+		}
+		q, _ = eb.Eq(a, eb.BVV(3, 32))
+		if s.CheckSat(q) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+	}
+}
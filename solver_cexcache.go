@@ -0,0 +1,288 @@
+package gosmt
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	cexCacheMaxModels    = 256
+	cexCacheMaxUnsatSets = 256
+)
+
+type CexCacheStats struct {
+	Lookups         uint
+	SubsetUnsatHits uint
+	SupersetSatHits uint
+	ModelHits       uint
+	CachedModels    uint
+	CachedUnsatSets uint
+}
+
+/*
+ *  A cexEntry is a set of constraints that was found satisfiable (with the
+ *  model) or unsatisfiable. The entry keeps a reference to the constraints,
+ *  so that their ids cannot be reused by the builder while it is cached
+ */
+type cexEntry struct {
+	constraints map[uintptr]*BoolExprPtr
+	model       map[string]*BVConst
+}
+
+// A cexUnsatEntry is an unsatisfiable set of constraints, with their ids
+// sorted
+type cexUnsatEntry struct {
+	ids         []uintptr
+	constraints []*BoolExprPtr
+}
+
+func newCexUnsatEntry(set map[uintptr]*BoolExprPtr) cexUnsatEntry {
+	entry := cexUnsatEntry{
+		ids:         make([]uintptr, 0, len(set)),
+		constraints: make([]*BoolExprPtr, 0, len(set)),
+	}
+	for id := range set {
+		entry.ids = append(entry.ids, id)
+	}
+	sort.Slice(entry.ids, func(i, j int) bool { return entry.ids[i] < entry.ids[j] })
+	for _, id := range entry.ids {
+		entry.constraints = append(entry.constraints, set[id])
+	}
+	return entry
+}
+
+// in returns true if every constraint of the entry is in set
+func (e cexUnsatEntry) in(set map[uintptr]*BoolExprPtr) bool {
+	if len(e.ids) > len(set) {
+		return false
+	}
+	for _, id := range e.ids {
+		if _, ok := set[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// contains returns true if every constraint of other is in the entry
+func (e cexUnsatEntry) contains(other cexUnsatEntry) bool {
+	i := 0
+	for _, id := range other.ids {
+		for i < len(e.ids) && e.ids[i] < id {
+			i += 1
+		}
+		if i == len(e.ids) || e.ids[i] != id {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ *  A CexCache (counterexample cache) remembers the results of previous
+ *  queries. A set of constraints is unsatisfiable if it contains a set found
+ *  unsatisfiable, and it is satisfiable if it is contained in a set found
+ *  satisfiable or if one of the cached models satisfies it. The cache can be
+ *  shared by solvers that use the same ExprBuilder. The unsatisfiable sets
+ *  are ordered from the least recently used, which is evicted first
+ */
+type CexCache struct {
+	lock  sync.Mutex
+	eb    *ExprBuilder
+	sat   []cexEntry
+	unsat []cexUnsatEntry
+	next  int
+	stats CexCacheStats
+}
+
+func NewCexCache(eb *ExprBuilder) *CexCache {
+	return &CexCache{
+		lock:  sync.Mutex{},
+		eb:    eb,
+		sat:   make([]cexEntry, 0),
+		unsat: make([]cexUnsatEntry, 0),
+	}
+}
+
+func (c *CexCache) Stats() CexCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.stats
+}
+
+func (c *CexCache) PrintStats() {
+	stats := c.Stats()
+
+	fmt.Println("=====================")
+	fmt.Println("  CexCache Stats")
+	fmt.Println("=====================")
+	fmt.Printf("lookups:      %d\n", stats.Lookups)
+	fmt.Printf("unsat hits:   %d\n", stats.SubsetUnsatHits)
+	fmt.Printf("sat hits:     %d\n", stats.SupersetSatHits)
+	fmt.Printf("model hits:   %d\n", stats.ModelHits)
+	fmt.Printf("models:       %d\n", stats.CachedModels)
+	fmt.Printf("unsat sets:   %d\n", stats.CachedUnsatSets)
+	fmt.Println("=====================")
+}
+
+// cexIsConst returns true if the query is the constant value
+func cexIsConst(query *BoolExprPtr, value bool) bool {
+	c, err := query.GetConst()
+	return err == nil && c == value
+}
+
+// cexConstraintSet returns the constraints with the query, that is omitted
+// only if it is true
+func cexConstraintSet(constraints map[uintptr]*BoolExprPtr, query *BoolExprPtr) map[uintptr]*BoolExprPtr {
+	set := make(map[uintptr]*BoolExprPtr, len(constraints)+1)
+	for k, v := range constraints {
+		set[k] = v
+	}
+	if !cexIsConst(query, true) {
+		set[query.Id()] = query
+	}
+	return set
+}
+
+func (c *CexCache) addSat(constraints map[uintptr]*BoolExprPtr, query *BoolExprPtr, model map[string]*BVConst) {
+	if cexIsConst(query, false) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry := cexEntry{constraints: cexConstraintSet(constraints, query), model: model}
+	if len(c.sat) < cexCacheMaxModels {
+		c.sat = append(c.sat, entry)
+		c.stats.CachedModels += 1
+		return
+	}
+	// evict the oldest model
+	c.sat[c.next] = entry
+	c.next = (c.next + 1) % cexCacheMaxModels
+}
+
+func (c *CexCache) addUnsat(constraints map[uintptr]*BoolExprPtr, query *BoolExprPtr) {
+	// a false query is unsatisfiable with any constraints, the entry would
+	// tell nothing about them
+	if cexIsConst(query, false) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry := newCexUnsatEntry(cexConstraintSet(constraints, query))
+	newUnsat := make([]cexUnsatEntry, 0, len(c.unsat)+1)
+	for _, e := range c.unsat {
+		// a superset of the new set is redundant
+		if !e.contains(entry) {
+			newUnsat = append(newUnsat, e)
+		}
+	}
+	if len(newUnsat) >= cexCacheMaxUnsatSets {
+		// evict the least recently used sets
+		newUnsat = append([]cexUnsatEntry{}, newUnsat[len(newUnsat)-cexCacheMaxUnsatSets+1:]...)
+	}
+	c.unsat = append(newUnsat, entry)
+	c.stats.CachedUnsatSets = uint(len(c.unsat))
+}
+
+// cexContains returns true if every constraint in sub is also in set
+func cexContains(set map[uintptr]*BoolExprPtr, sub map[uintptr]*BoolExprPtr) bool {
+	if len(sub) > len(set) {
+		return false
+	}
+	for k := range sub {
+		if _, ok := set[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ *  lookup checks the query in conjunction with the constraints. `dependent` is
+ *  the subset of the constraints that share symbols with the query and `pi` is
+ *  their conjunction with the query. When the result is RESULT_SAT, the
+ *  returned model satisfies pi
+ */
+func (c *CexCache) lookup(constraints map[uintptr]*BoolExprPtr, dependent []*BoolExprPtr, query *BoolExprPtr, pi *BoolExprPtr) (int, map[string]*BVConst) {
+	c.lock.Lock()
+	c.stats.Lookups += 1
+
+	all := cexConstraintSet(constraints, query)
+	for i, e := range c.unsat {
+		if e.in(all) {
+			// the entry becomes the most recently used
+			copy(c.unsat[i:], c.unsat[i+1:])
+			c.unsat[len(c.unsat)-1] = e
+			c.stats.SubsetUnsatHits += 1
+			c.lock.Unlock()
+			return RESULT_UNSAT, nil
+		}
+	}
+
+	deps := make(map[uintptr]*BoolExprPtr, len(dependent)+1)
+	for _, d := range dependent {
+		deps[d.Id()] = d
+	}
+	if !cexIsConst(query, true) {
+		deps[query.Id()] = query
+	}
+	for _, e := range c.sat {
+		if cexContains(e.constraints, deps) {
+			c.stats.SupersetSatHits += 1
+			c.lock.Unlock()
+			return RESULT_SAT, e.model
+		}
+	}
+
+	// the models are evaluated without the lock, that would serialize the
+	// solvers sharing the cache (the cached models are never modified)
+	models := make([]map[string]*BVConst, len(c.sat))
+	for i, e := range c.sat {
+		models[i] = e.model
+	}
+	c.lock.Unlock()
+
+	// any assignment that satisfies pi is a model, so the symbols that a
+	// cached model does not assign (e.g., the ones of the constraints added
+	// after it) are set to zero
+	syms := c.eb.InvolvedInputs(pi)
+	for _, m := range models {
+		model := cexCompleteModel(m, syms)
+		evalQ, err := c.eb.Substitute(pi, model)
+		if err == nil && evalQ.getInternal().kind() == TY_BOOL_CONST && evalQ.getInternal().(*internalBoolVal).Value.Value {
+			c.lock.Lock()
+			c.stats.ModelHits += 1
+			c.lock.Unlock()
+			return RESULT_SAT, model
+		}
+	}
+	return RESULT_UNKNOWN, nil
+}
+
+// cexCompleteModel returns the model with a zero value for the symbols in
+// syms that it does not assign, the model is not modified
+func cexCompleteModel(model map[string]*BVConst, syms []*BVExprPtr) map[string]*BVConst {
+	var res map[string]*BVConst
+	for _, sym := range syms {
+		name := sym.e.(*internalBVS).name
+		if _, ok := model[name]; ok {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]*BVConst, len(model)+1)
+			for k, v := range model {
+				res[k] = v
+			}
+		}
+		res[name] = MakeBVConst(0, sym.Size())
+	}
+	if res == nil {
+		return model
+	}
+	return res
+}
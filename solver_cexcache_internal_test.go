@@ -0,0 +1,68 @@
+package gosmt
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCexCacheConstQuery(t *testing.T) {
+	eb := NewExprBuilder()
+	c := NewCexCache(eb)
+
+	a := eb.BVS("a", 32)
+	e, _ := eb.Ult(a, eb.BVV(10, 32))
+	constraints := map[uintptr]*BoolExprPtr{e.Id(): e}
+
+	// false is unsatisfiable with any constraints
+	c.addUnsat(constraints, eb.BoolVal(false))
+	if c.Stats().CachedUnsatSets != 0 {
+		t.Error("the false query should not be cached")
+		return
+	}
+	q, _ := eb.Eq(a, eb.BVV(3, 32))
+	pi, _ := eb.BoolAnd(e, q)
+	if r, _ := c.lookup(constraints, []*BoolExprPtr{e}, q, pi); r == RESULT_UNSAT {
+		t.Error("should not be unsat")
+		return
+	}
+
+	// the true query is omitted, the entry is the constraints alone
+	c.addUnsat(constraints, eb.BoolVal(true))
+	if r, _ := c.lookup(constraints, []*BoolExprPtr{e}, q, pi); r != RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+}
+
+func TestCexCacheUnsatEviction(t *testing.T) {
+	eb := NewExprBuilder()
+	c := NewCexCache(eb)
+
+	a := eb.BVS("a", 32)
+	first, _ := eb.Ult(a, eb.BVV(10, 32))
+	c.addUnsat(map[uintptr]*BoolExprPtr{}, first)
+	for i := 0; i < cexCacheMaxUnsatSets; i++ {
+		// the first set is used, it is not evicted
+		if i == cexCacheMaxUnsatSets/2 {
+			if r, _ := c.lookup(map[uintptr]*BoolExprPtr{}, nil, first, first); r != RESULT_UNSAT {
+				t.Error("should be unsat")
+				return
+			}
+		}
+		q, _ := eb.Eq(eb.BVS(fmt.Sprintf("x%d", i), 32), eb.BVV(int64(i), 32))
+		c.addUnsat(map[uintptr]*BoolExprPtr{}, q)
+	}
+	if c.Stats().CachedUnsatSets != cexCacheMaxUnsatSets {
+		t.Errorf("%d unsat sets", c.Stats().CachedUnsatSets)
+		return
+	}
+	if r, _ := c.lookup(map[uintptr]*BoolExprPtr{}, nil, first, first); r != RESULT_UNSAT {
+		t.Error("the used set was evicted")
+		return
+	}
+	q, _ := eb.Eq(eb.BVS("x0", 32), eb.BVV(0, 32))
+	if r, _ := c.lookup(map[uintptr]*BoolExprPtr{}, nil, q, q); r == RESULT_UNSAT {
+		t.Error("the least recently used set was not evicted")
+		return
+	}
+}
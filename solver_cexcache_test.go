@@ -0,0 +1,139 @@
+package gosmt_test
+
+import (
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestCexCache(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		b := eb.BVS("b", 32)
+		e, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.Add(e)
+
+		q1, _ := eb.Eq(a, eb.BVV(3, 32))
+		if s.CheckSat(q1) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+		// not decided by the interval analysis
+		sq, _ := eb.Mul(a, a)
+		q2, _ := eb.Eq(sq, eb.BVV(20, 32))
+		if s.CheckSat(q2) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		stats := s.CexCache().Stats()
+		if stats.CachedModels != 1 || stats.CachedUnsatSets != 1 {
+			t.Error("results should be cached")
+			return
+		}
+
+		// the clones share the cache
+		c := s.Clone()
+		if c.CheckSat(q1) != gosmt.RESULT_SAT || c.CexCache().Stats().SupersetSatHits != stats.SupersetSatHits+1 {
+			t.Error("should be a superset hit")
+			return
+		}
+		e, _ = eb.Ult(b, eb.BVV(10, 32))
+		c.Add(e)
+		if c.CheckSat(q2) != gosmt.RESULT_UNSAT || c.CexCache().Stats().SubsetUnsatHits != stats.SubsetUnsatHits+1 {
+			t.Error("should be a subset hit")
+			return
+		}
+
+		// a = 3 satisfies a < 5
+		q3, _ := eb.Ult(a, eb.BVV(5, 32))
+		if c.CheckSat(q3) != gosmt.RESULT_SAT || c.CexCache().Stats().ModelHits != stats.ModelHits+1 {
+			t.Error("should be a model hit")
+			return
+		}
+		if s.CexCache().Stats().Lookups != stats.Lookups+3 {
+			t.Error("should be the same cache")
+			return
+		}
+	}
+}
+
+func TestCexCacheShared(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s1 := gosmt.NewZ3Solver(eb)
+	s2 := gosmt.NewBitblastSolver(eb)
+	if isErr(t, s2.SetCexCache(s1.CexCache())) {
+		return
+	}
+	if err := s2.SetCexCache(gosmt.NewCexCache(gosmt.NewExprBuilder())); err == nil {
+		t.Error("should fail")
+		return
+	}
+
+	a := eb.BVS("a", 16)
+	e, _ := eb.UGt(a, eb.BVV(100, 16))
+	s1.Add(e)
+	s2.Add(e)
+	// odd squares are 1 modulo 8
+	sq, _ := eb.Mul(a, a)
+	q, _ := eb.Eq(sq, eb.BVV(3, 16))
+	if s1.CheckSat(q) != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+	if s2.CheckSat(q) != gosmt.RESULT_UNSAT || s2.CexCache().Stats().SubsetUnsatHits != 1 {
+		t.Error("should be a subset hit")
+		return
+	}
+
+	if r, err := s1.Satisfiable(); r != gosmt.RESULT_SAT || err != nil {
+		t.Error("should be sat")
+		return
+	}
+	v := s2.Eval(a)
+	if v == nil || v.AsULong() <= 100 {
+		t.Error("wrong model")
+		return
+	}
+	q, _ = eb.Eq(a, eb.BVV(int64(v.AsULong()), 16))
+	if s2.CheckSatAndAddIfSat(q) != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	if s2.CheckSat(q) != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+}
+
+func TestCexCacheUnverified(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		b := eb.BVS("b", 32)
+		e, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.Add(e)
+
+		q1, _ := eb.Eq(a, eb.BVV(3, 32))
+		if s.CheckSat(q1) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+
+		// the cached model does not satisfy the new constraint on b, that
+		// is unsatisfiable (squares are 0, 1 or 4 modulo 8)
+		sq, _ := eb.Mul(b, b)
+		e, _ = eb.Eq(sq, eb.BVV(3, 32))
+		s.Add(e)
+		stats := s.CexCache().Stats()
+		q2, _ := eb.Ult(a, eb.BVV(5, 32))
+		if s.CheckSat(q1) != gosmt.RESULT_UNSAT || s.CheckSat(q2) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		if newStats := s.CexCache().Stats(); newStats.SupersetSatHits != stats.SupersetSatHits || newStats.ModelHits != stats.ModelHits {
+			t.Error("should not be a cache hit")
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package gosmt
+
+import (
+	"context"
+	"fmt"
+)
+
+func (s *Solver) AddNamed(name string, constraint *BoolExprPtr) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.add(constraint)
+	if _, ok := s.constraints[constraint.Id()]; ok {
+		s.names[constraint.Id()] = name
+	}
+}
+
+func (s *Solver) ConstraintName(constraint *BoolExprPtr) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	name, ok := s.names[constraint.Id()]
+	return name, ok
+}
+
+func (s *Solver) UnsatCore() ([]*BoolExprPtr, error) {
+	return s.UnsatCoreCtx(context.Background())
+}
+
+/*
+ *  UnsatCoreCtx returns a minimal subset of the constraints that is
+ *  unsatisfiable together with the last query found unsatisfiable. If the
+ *  minimization is interrupted, the (unsatisfiable but possibly not minimal)
+ *  core found so far is returned along with the error.
+ */
+func (s *Solver) UnsatCoreCtx(ctx context.Context) ([]*BoolExprPtr, error) {
+	defer s.lockQuery()()
+
+	if s.lastUnsatQuery == nil {
+		return nil, fmt.Errorf("no unsatisfiable query")
+	}
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	// the ids depend on the addresses of the expressions, so the constraints
+	// are checked in the order they were added to make the core reproducible
+	constraints := append([]*BoolExprPtr{}, s.order...)
+
+	// The constraints cannot be retracted from s.backend, so they are checked
+	// as assumptions on a new backend
+	backend := s.backend.fresh()
+	backend.add(s.lastUnsatQuery)
+
+	pick := func(candidates []*BoolExprPtr, indexes []int) []*BoolExprPtr {
+		res := make([]*BoolExprPtr, 0, len(indexes))
+		for _, i := range indexes {
+			res = append(res, candidates[i])
+		}
+		return res
+	}
+
+	r, failed, err := backend.checkAssuming(ctx, constraints)
+	if r == RESULT_UNKNOWN {
+		return nil, err
+	}
+	if r != RESULT_UNSAT {
+		return nil, fmt.Errorf("the constraints are satisfiable")
+	}
+
+	// The failed subsets are not minimal, but checking one again can return
+	// a smaller one: the candidates are shrunk until they stop changing
+	core := pick(constraints, failed)
+	for {
+		r, failed, err := backend.checkAssuming(ctx, core)
+		if r == RESULT_UNKNOWN {
+			return core, err
+		}
+		if r != RESULT_UNSAT || len(failed) == len(core) {
+			break
+		}
+		core = pick(core, failed)
+	}
+
+	// Deletion-based minimization: a constraint is kept only if the core
+	// becomes satisfiable without it
+	for i := 0; i < len(core); {
+		candidates := append(append([]*BoolExprPtr{}, core[:i]...), core[i+1:]...)
+		r, failed, err := backend.checkAssuming(ctx, candidates)
+		if r == RESULT_UNKNOWN {
+			return core, err
+		}
+		if r == RESULT_UNSAT {
+			core = pick(candidates, failed)
+		} else {
+			i += 1
+		}
+	}
+	return core, nil
+}
+
+func (s *Solver) CheckSatAssuming(assumptions []*BoolExprPtr) (int, []*BoolExprPtr) {
+	r, failed, _ := s.CheckSatAssumingCtx(context.Background(), assumptions)
+	return r, failed
+}
+
+/*
+ *  CheckSatAssumingCtx checks the constraints together with the assumptions,
+ *  without adding them. If the result is RESULT_UNSAT, it returns a subset of
+ *  the assumptions (not necessarily minimal) that is unsatisfiable together
+ *  with the constraints. The check is performed on the backend of the solver,
+ *  so what it learns is reused by the following queries.
+ */
+func (s *Solver) CheckSatAssumingCtx(ctx context.Context, assumptions []*BoolExprPtr) (int, []*BoolExprPtr, error) {
+	defer s.lockQuery()()
+
+	// a false assumption fails with any constraints
+	falseAssumptions := make([]*BoolExprPtr, 0)
+	for _, a := range assumptions {
+		if c, err := a.GetConst(); err == nil && !c {
+			falseAssumptions = append(falseAssumptions, a)
+		}
+	}
+	if len(falseAssumptions) > 0 {
+		s.recordResult(s.eb.BoolVal(false), RESULT_UNSAT)
+		return RESULT_UNSAT, falseAssumptions, nil
+	}
+
+	query := s.conjunction(assumptions)
+	dependent := s.getDependentConstraints(query)
+	pi, err := s.eb.BoolAnd(s.conjunction(dependent), query)
+	if err != nil {
+		panic(err)
+	}
+	// the cache cannot tell which assumptions failed, so it is used only when
+	// the query is satisfiable
+	if result, _ := s.checkSatCached(query, dependent, pi); result == RESULT_SAT {
+		s.recordResult(query, result)
+		return result, nil, nil
+	}
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	result, indexes, err := s.backend.checkAssuming(ctx, assumptions)
+	if result == RESULT_UNKNOWN {
+		return result, nil, err
+	}
+	// only the failed assumptions are known to be unsatisfiable with the
+	// constraints, so the unsatisfiable results are not cached
+	if result == RESULT_SAT {
+		s.cacheResult(query, result)
+	}
+	s.recordResult(query, result)
+
+	failed := make([]*BoolExprPtr, 0, len(indexes))
+	for _, i := range indexes {
+		failed = append(failed, assumptions[i])
+	}
+	return result, failed, nil
+}
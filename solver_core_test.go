@@ -0,0 +1,221 @@
+package gosmt_test
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func coreNames(s *gosmt.Solver, core []*gosmt.BoolExprPtr) []string {
+	names := make([]string, 0)
+	for _, c := range core {
+		name, _ := s.ConstraintName(c)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSolverUnsatCore(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		b := eb.BVS("b", 32)
+		c := eb.BVS("c", 32)
+
+		if _, err := s.UnsatCore(); err == nil {
+			t.Error("no unsat query")
+			return
+		}
+
+		e, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.AddNamed("a < 10", e)
+		inc, _ := eb.Add(a, eb.BVV(1, 32))
+		e, _ = eb.Eq(b, inc)
+		s.AddNamed("b == a + 1", e)
+		e, _ = eb.Eq(c, eb.BVV(5, 32))
+		s.AddNamed("c == 5", e)
+
+		e, _ = eb.Eq(b, eb.BVV(20, 32))
+		if s.CheckSat(e) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		core, err := s.UnsatCore()
+		if isErr(t, err) {
+			return
+		}
+		names := coreNames(s, core)
+		if len(names) != 2 || names[0] != "a < 10" || names[1] != "b == a + 1" {
+			t.Errorf("unexpected core %v", names)
+			return
+		}
+
+		s.Push()
+		e, _ = eb.UGt(a, eb.BVV(20, 32))
+		s.AddNamed("a > 20", e)
+		if r, _ := s.Satisfiable(); r != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		core, err = s.UnsatCore()
+		if isErr(t, err) {
+			return
+		}
+		names = coreNames(s, core)
+		if len(names) != 2 || names[0] != "a < 10" || names[1] != "a > 20" {
+			t.Errorf("unexpected core %v", names)
+			return
+		}
+
+		s.Pop(1)
+		if _, ok := s.ConstraintName(e); ok {
+			t.Error("the name should be popped")
+			return
+		}
+	}
+}
+
+func TestSolverUnsatCoreShrink(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	checkAssuming := regexp.MustCompile(`^\(check-assuming \d+ \(([^)]*)\) (\w+) \(([^)]*)\)`)
+	for _, inner := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		log := bytes.Buffer{}
+		s := gosmt.NewRecordingSolver(inner, &log)
+		a := eb.BVS("a", 8)
+		prev := a
+		for i := 0; i < 8; i++ {
+			v := eb.BVS(string(rune('b'+i)), 8)
+			e, _ := eb.Ult(prev, v)
+			s.Add(e)
+			prev = v
+		}
+		e, _ := eb.UGt(a, eb.BVV(250, 8))
+		s.Add(e)
+		if r, _ := s.Satisfiable(); r != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		core, err := s.UnsatCore()
+		if isErr(t, err) {
+			return
+		}
+		if len(core) != 6 {
+			t.Errorf("wrong core size %d", len(core))
+			return
+		}
+
+		// the failed subset of the first check is checked again before the
+		// deletions
+		checks := make([][]string, 0)
+		for _, line := range strings.Split(log.String(), "\n") {
+			if m := checkAssuming.FindStringSubmatch(line); m != nil {
+				checks = append(checks, []string{m[1], m[2], m[3]})
+			}
+		}
+		if len(checks) < 2 || checks[0][1] != "unsat" || checks[1][0] != checks[0][2] {
+			t.Errorf("the failed subset was not checked again %v", checks)
+			return
+		}
+	}
+}
+
+func TestSolverCheckSatAssuming(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		b := eb.BVS("b", 32)
+		c := eb.BVS("c", 32)
+
+		e, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.AddNamed("a < 10", e)
+		inc, _ := eb.Add(a, eb.BVV(1, 32))
+		e, _ = eb.Eq(b, inc)
+		s.AddNamed("b == a + 1", e)
+
+		b5, _ := eb.Eq(b, eb.BVV(5, 32))
+		c3, _ := eb.Eq(c, eb.BVV(3, 32))
+		b20, _ := eb.Eq(b, eb.BVV(20, 32))
+		r, failed := s.CheckSatAssuming([]*gosmt.BoolExprPtr{c3, b20})
+		if r != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		// c == 3 is not needed to prove it
+		if len(failed) != 1 || failed[0].Id() != b20.Id() {
+			t.Errorf("only b == 20 should fail, not %v", failed)
+			return
+		}
+		core, err := s.UnsatCore()
+		if isErr(t, err) {
+			return
+		}
+		if names := coreNames(s, core); len(names) != 2 {
+			t.Errorf("unexpected core %v", names)
+			return
+		}
+
+		r, failed = s.CheckSatAssuming([]*gosmt.BoolExprPtr{b5, c3})
+		if r != gosmt.RESULT_SAT || len(failed) != 0 {
+			t.Error("should be sat")
+			return
+		}
+
+		// the assumptions are not retained
+		e, _ = eb.Eq(c, eb.BVV(4, 32))
+		if s.CheckSat(e) != gosmt.RESULT_SAT || s.CheckSat(b20) != gosmt.RESULT_UNSAT {
+			t.Error("wrong result")
+			return
+		}
+		if r, _ := s.CheckSatAssuming(nil); r != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+	}
+}
+
+func TestSolverCheckSatAssumingFalse(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		e, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.Add(e)
+
+		f := eb.BoolVal(false)
+		a3, _ := eb.Eq(a, eb.BVV(3, 32))
+		r, failed := s.CheckSatAssuming([]*gosmt.BoolExprPtr{a3, f})
+		if r != gosmt.RESULT_UNSAT || len(failed) != 1 || failed[0].Id() != f.Id() {
+			t.Errorf("only false should fail, not %v", failed)
+			return
+		}
+
+		// the constraints alone are still satisfiable
+		if s.CheckSat(a3) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+		if r, err := s.Satisfiable(); r != gosmt.RESULT_SAT || err != nil {
+			t.Error("should be sat")
+			return
+		}
+		if s.Clone().CheckSat(a3) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+
+		// the unsatisfiable assumptions are not cached
+		a20, _ := eb.Eq(a, eb.BVV(20, 32))
+		if r, _ := s.CheckSatAssuming([]*gosmt.BoolExprPtr{a3, a20}); r != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		if s.CexCache().Stats().CachedUnsatSets != 0 {
+			t.Error("no unsatisfiable set should be cached")
+			return
+		}
+	}
+}
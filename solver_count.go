@@ -0,0 +1,188 @@
+package gosmt
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"sort"
+)
+
+// A ModelCount is the number of assignments to a set of variables that
+// satisfy the constraints, that lies in [Lower, Upper] with the requested
+// confidence, unless Exact is true
+type ModelCount struct {
+	Estimate *big.Int
+	Lower    *big.Int
+	Upper    *big.Int
+	Exact    bool
+}
+
+func (s *Solver) joinVars(vars []*BVExprPtr) (*BVExprPtr, error) {
+	seen := make(map[uintptr]bool)
+	var joint *BVExprPtr
+	for _, v := range vars {
+		if seen[v.Id()] {
+			continue
+		}
+		seen[v.Id()] = true
+		if joint == nil {
+			joint = v
+			continue
+		}
+		var err error
+		joint, err = s.eb.Concat(v, joint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if joint == nil {
+		return nil, fmt.Errorf("no variables")
+	}
+	return joint, nil
+}
+
+// CountModels returns the number of assignments to vars that satisfy the
+// constraints, stopping at limit
+func (s *Solver) CountModels(vars []*BVExprPtr, limit int) (int, error) {
+	return s.CountModelsCtx(context.Background(), vars, limit)
+}
+
+func (s *Solver) CountModelsCtx(ctx context.Context, vars []*BVExprPtr, limit int) (int, error) {
+	joint, err := s.joinVars(vars)
+	if err != nil {
+		return 0, err
+	}
+	r, err := s.EvalUptoCtx(ctx, joint, limit)
+	return len(r), err
+}
+
+func (s *Solver) ApproxCountModels(vars []*BVExprPtr, epsilon float64, delta float64) (*ModelCount, error) {
+	return s.ApproxCountModelsCtx(context.Background(), vars, epsilon, delta)
+}
+
+/*
+ *  ApproxCountModelsCtx implements ApproxMC: the solutions are split into
+ *  cells by random XOR constraints on the bits of vars, and the count is
+ *  estimated from the size of a small enough cell. The result is within a
+ *  factor (1+epsilon) of the exact count with probability at least 1-delta
+ */
+func (s *Solver) ApproxCountModelsCtx(ctx context.Context, vars []*BVExprPtr, epsilon float64, delta float64) (*ModelCount, error) {
+	if epsilon <= 0 || delta <= 0 || delta >= 1 {
+		return nil, fmt.Errorf("invalid tolerance or confidence")
+	}
+	joint, err := s.joinVars(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.lockQuery()()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	thresh := int(math.Ceil(1 + 9.84*(1+epsilon/(1+epsilon))*(1+1/epsilon)*(1+1/epsilon)))
+	vals, err := s.backend.evalUpto(ctx, joint, s.eb.BoolVal(true), thresh)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) < thresh {
+		count := big.NewInt(int64(len(vals)))
+		return &ModelCount{Estimate: count, Lower: count, Upper: count, Exact: true}, nil
+	}
+
+	iterations := int(math.Ceil(17 * math.Log2(3/delta)))
+	estimates := make([]*big.Int, 0, iterations)
+	m := 1
+	for i := 0; i < iterations; i++ {
+		hashes, err := s.randomXors(joint)
+		if err != nil {
+			return nil, err
+		}
+
+		// the cells are nested, so their size decreases with the number of
+		// hashes; the search starts from the number of hashes of the previous
+		// iteration, that is usually close to the right one
+		if m > len(hashes) {
+			m = len(hashes)
+		}
+		cellSize, err := s.cellSize(ctx, joint, hashes[:m], thresh)
+		if err != nil {
+			return nil, err
+		}
+		if cellSize < thresh {
+			for m > 1 {
+				n, err := s.cellSize(ctx, joint, hashes[:m-1], thresh)
+				if err != nil {
+					return nil, err
+				}
+				if n >= thresh {
+					break
+				}
+				m, cellSize = m-1, n
+			}
+		} else {
+			for cellSize >= thresh && m < len(hashes) {
+				m++
+				cellSize, err = s.cellSize(ctx, joint, hashes[:m], thresh)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		estimates = append(estimates, new(big.Int).Lsh(big.NewInt(int64(cellSize)), uint(m)))
+	}
+
+	sort.Slice(estimates, func(i, j int) bool { return estimates[i].Cmp(estimates[j]) < 0 })
+	estimate := estimates[len(estimates)/2]
+
+	factor := new(big.Float).SetFloat64(1 + epsilon)
+	lower, _ := new(big.Float).Quo(new(big.Float).SetInt(estimate), factor).Int(nil)
+	upperF := new(big.Float).Mul(new(big.Float).SetInt(estimate), factor)
+	upper, acc := upperF.Int(nil)
+	if acc == big.Below {
+		upper.Add(upper, one)
+	}
+	return &ModelCount{Estimate: estimate, Lower: lower, Upper: upper, Exact: false}, nil
+}
+
+// randomXors returns one random parity constraint on the bits of bv for each
+// bit
+func (s *Solver) randomXors(bv *BVExprPtr) ([]*BoolExprPtr, error) {
+	hashes := make([]*BoolExprPtr, 0, bv.Size())
+	for i := uint(0); i < bv.Size(); i++ {
+		acc := s.eb.BVV(int64(rand.Intn(2)), 1)
+		for j := uint(0); j < bv.Size(); j++ {
+			if rand.Intn(2) == 0 {
+				continue
+			}
+			bit, err := s.eb.Extract(bv, j, j)
+			if err != nil {
+				return nil, err
+			}
+			acc, err = s.eb.Xor(acc, bit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		h, err := s.eb.Eq(acc, s.eb.BVV(0, 1))
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
+
+func (s *Solver) cellSize(ctx context.Context, bv *BVExprPtr, hashes []*BoolExprPtr, thresh int) (int, error) {
+	query := s.eb.BoolVal(true)
+	for _, h := range hashes {
+		var err error
+		query, err = s.eb.BoolAnd(query, h)
+		if err != nil {
+			return 0, err
+		}
+	}
+	vals, err := s.backend.evalUpto(ctx, bv, query, thresh)
+	return len(vals), err
+}
@@ -0,0 +1,66 @@
+package gosmt_test
+
+import (
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestSolverCountModels(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 8)
+		b := eb.BVS("b", 8)
+		e, _ := eb.Ult(a, eb.BVV(10, 8))
+		s.Add(e)
+		e, _ = eb.Ult(b, eb.BVV(3, 8))
+		s.Add(e)
+
+		n, err := s.CountModels([]*gosmt.BVExprPtr{a, b}, 100)
+		if isErr(t, err) {
+			return
+		}
+		if n != 30 {
+			t.Errorf("wrong count %d", n)
+			return
+		}
+		if n, _ = s.CountModels([]*gosmt.BVExprPtr{a, b, a}, 100); n != 30 {
+			t.Errorf("wrong count %d", n)
+			return
+		}
+		if n, _ = s.CountModels([]*gosmt.BVExprPtr{a}, 5); n != 5 {
+			t.Errorf("wrong count %d", n)
+			return
+		}
+
+		c, err := s.ApproxCountModels([]*gosmt.BVExprPtr{b}, 0.8, 0.2)
+		if isErr(t, err) {
+			return
+		}
+		if !c.Exact || c.Estimate.Int64() != 3 {
+			t.Error("should be exact")
+			return
+		}
+	}
+}
+
+func TestSolverApproxCountModels(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewBitblastSolver(eb)
+
+	a := eb.BVS("a", 12)
+	e, _ := eb.Ult(a, eb.BVV(1000, 12))
+	s.Add(e)
+	b := eb.BVS("b", 4)
+	e, _ = eb.Eq(b, eb.BVV(0, 4))
+	s.Add(e)
+
+	c, err := s.ApproxCountModels([]*gosmt.BVExprPtr{a, b}, 1, 0.3)
+	if isErr(t, err) {
+		return
+	}
+	if c.Exact || c.Lower.Int64() > 1000 || c.Upper.Int64() < 1000 {
+		t.Errorf("wrong estimate %s [%s, %s]", c.Estimate, c.Lower, c.Upper)
+		return
+	}
+}
@@ -0,0 +1,131 @@
+package gosmt
+
+import (
+	"fmt"
+)
+
+// Constraints returns the constraints in the order they were added
+func (s *Solver) Constraints() []*BoolExprPtr {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]*BoolExprPtr{}, s.order...)
+}
+
+func (s *Solver) Remove(constraint *BoolExprPtr) error {
+	return s.Replace(constraint, s.eb.BoolVal(true))
+}
+
+/*
+ *  Replace replaces the constraint old with repl, that takes its position and
+ *  its name and is removed when the scope of old is popped. If repl is already
+ *  a constraint of an inner scope, it is moved to the position of old. The
+ *  backends
+ *  cannot retract a constraint, so the backend is rebuilt (and it loses what
+ *  it learned). The cached models are kept, as they are checked against the
+ *  constraints before being used.
+ */
+func (s *Solver) Replace(old, repl *BoolExprPtr) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.constraints[old.Id()]; !ok {
+		return fmt.Errorf("not a constraint")
+	}
+	if old.Id() == repl.Id() {
+		return nil
+	}
+	// the depth of the scope of a constraint, 0 if it is in no scope
+	depth := func(c *BoolExprPtr) int {
+		for i, scope := range s.scopes {
+			for _, sc := range scope.constraints {
+				if sc.Id() == c.Id() {
+					return i + 1
+				}
+			}
+		}
+		return 0
+	}
+	keep := true
+	move := false
+	if _, ok := s.constraints[repl.Id()]; ok {
+		// repl must not be popped before old
+		move = depth(repl) > depth(old)
+		keep = move
+	}
+	if repl.IsConst() {
+		c, _ := repl.GetConst()
+		if c {
+			keep = false
+		}
+	}
+
+	// repl is not known to be satisfiable with the constraints before it
+	for i, c := range s.order[:s.verified] {
+		if c.Id() == old.Id() {
+			if keep {
+				s.verified = i
+			} else {
+				s.verified -= 1
+			}
+			break
+		}
+	}
+
+	name, named := s.names[old.Id()]
+	delete(s.constraints, old.Id())
+	delete(s.names, old.Id())
+	if keep {
+		s.constraints[repl.Id()] = repl
+		if _, replNamed := s.names[repl.Id()]; named && !replNamed {
+			s.names[repl.Id()] = name
+		}
+	}
+	edit := func(constraints []*BoolExprPtr) []*BoolExprPtr {
+		res := make([]*BoolExprPtr, 0, len(constraints))
+		for _, c := range constraints {
+			if move && c.Id() == repl.Id() {
+				continue
+			}
+			if c.Id() != old.Id() {
+				res = append(res, c)
+			} else if keep {
+				res = append(res, repl)
+			}
+		}
+		return res
+	}
+	s.order = edit(s.order)
+	for i := range s.scopes {
+		s.scopes[i].constraints = edit(s.scopes[i].constraints)
+	}
+	s.rebuild()
+
+	// the last unsatisfiable query may be satisfiable now
+	s.lastUnsatQuery = nil
+	return nil
+}
+
+// rebuild creates a new backend and a new partition with the constraints of
+// every scope
+func (s *Solver) rebuild() {
+	s.backend = s.backend.fresh()
+	s.partition = newPartition()
+	s.partitionShared = false
+
+	add := func(constraints []*BoolExprPtr, record bool) {
+		for _, c := range constraints {
+			s.backend.add(c)
+			s.partition.add(s.eb.dependencyKeys(c), c, record)
+		}
+	}
+	inScopes := 0
+	for _, scope := range s.scopes {
+		inScopes += len(scope.constraints)
+	}
+	add(s.order[:len(s.order)-inScopes], false)
+	for i := range s.scopes {
+		s.backend.push()
+		s.scopes[i].mark = len(s.partition.trail)
+		add(s.scopes[i].constraints, true)
+	}
+}
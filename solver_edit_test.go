@@ -0,0 +1,127 @@
+package gosmt_test
+
+import (
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestSolverRemoveReplace(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		b := eb.BVS("b", 32)
+		c := eb.BVS("c", 32)
+
+		aLt10, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.AddNamed("a < 10", aLt10)
+		inc, _ := eb.Add(a, eb.BVV(1, 32))
+		bEq, _ := eb.Eq(b, inc)
+		s.Add(bEq)
+		cEq, _ := eb.Eq(c, eb.BVV(5, 32))
+		s.Add(cEq)
+		if err := s.Remove(eb.BoolVal(false)); err == nil {
+			t.Error("not a constraint")
+			return
+		}
+
+		b20, _ := eb.Eq(b, eb.BVV(20, 32))
+		if s.CheckSat(b20) != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		if isErr(t, s.Remove(aLt10)) {
+			return
+		}
+		if len(s.Constraints()) != 2 || s.Constraints()[0] != bEq || s.Constraints()[1] != cEq {
+			t.Error("wrong constraints")
+			return
+		}
+		if _, err := s.UnsatCore(); err == nil {
+			t.Error("no unsat query")
+			return
+		}
+		if s.CheckSat(b20) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+
+		s.Push()
+		aGt5, _ := eb.UGt(a, eb.BVV(5, 32))
+		s.AddNamed("a > 5", aGt5)
+		aLt7, _ := eb.Ult(a, eb.BVV(7, 32))
+		if isErr(t, s.Replace(aGt5, aLt7)) {
+			return
+		}
+		if name, _ := s.ConstraintName(aLt7); name != "a > 5" {
+			t.Error("the name should be moved")
+			return
+		}
+		if len(s.EvalUpto(a, 10)) != 7 {
+			t.Error("wrong number of values")
+			return
+		}
+		// b and c are independent
+		if len(s.IndependentSets()) != 2 {
+			t.Error("wrong sets")
+			return
+		}
+		if isErr(t, s.Replace(cEq, aGt5)) {
+			return
+		}
+		if len(s.IndependentSets()) != 1 || len(s.EvalUpto(a, 10)) != 1 {
+			t.Error("wrong constraints")
+			return
+		}
+
+		// the replaced constraints are in the outer scope
+		if isErr(t, s.Pop(1)) {
+			return
+		}
+		if cs := s.Constraints(); len(cs) != 2 || cs[0] != bEq || cs[1] != aGt5 {
+			t.Error("wrong constraints")
+			return
+		}
+		if v, err := s.Min(a, false); err != nil || v.AsULong() != 6 {
+			t.Error("wrong min")
+			return
+		}
+		if s.CheckSat(cEq) != gosmt.RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+	}
+}
+
+func TestSolverReplaceInnerConstraint(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		aLt10, _ := eb.Ult(a, eb.BVV(10, 32))
+		s.AddNamed("a < 10", aLt10)
+
+		s.Push()
+		aLt5, _ := eb.Ult(a, eb.BVV(5, 32))
+		s.Add(aLt5)
+		if isErr(t, s.Replace(aLt10, aLt5)) {
+			return
+		}
+		if name, _ := s.ConstraintName(aLt5); name != "a < 10" {
+			t.Error("the name should be moved")
+			return
+		}
+
+		// a < 5 was moved to the outer scope
+		if isErr(t, s.Pop(1)) {
+			return
+		}
+		if len(s.Constraints()) != 1 || s.Constraints()[0] != aLt5 {
+			t.Error("wrong constraints")
+			return
+		}
+		if len(s.EvalUpto(a, 10)) != 5 {
+			t.Error("wrong number of values")
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package gosmt
+
+import (
+	"context"
+)
+
+// joinExprs concatenates the expressions, the first one in the least
+// significant bits
+func (s *Solver) joinExprs(bvs []*BVExprPtr) *BVExprPtr {
+	joint := bvs[0]
+	for _, e := range bvs[1:] {
+		var err error
+		joint, err = s.eb.Concat(e, joint)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return joint
+}
+
+// splitValue splits a value of joinExprs(bvs) into the values of bvs
+func splitValue(bvs []*BVExprPtr, v *BVConst) []*BVConst {
+	pieces := make([]*BVConst, 0, len(bvs))
+	accumulator := uint(0)
+	for i := 0; i < len(bvs); i++ {
+		pieces = append(pieces, v.Slice(accumulator+bvs[i].Size()-1, accumulator))
+		accumulator += bvs[i].Size()
+	}
+	return pieces
+}
+
+func (s *Solver) EvalUptoList(bvs []*BVExprPtr, n int) [][]*BVConst {
+	r, _ := s.EvalUptoListCtx(context.Background(), bvs, n)
+	return r
+}
+
+// EvalUptoListCtx returns up to n distinct tuples of values of bvs, together
+// with an error if the enumeration is interrupted
+func (s *Solver) EvalUptoListCtx(ctx context.Context, bvs []*BVExprPtr, n int) ([][]*BVConst, error) {
+	res := make([][]*BVConst, 0)
+	if len(bvs) == 0 {
+		return res, nil
+	}
+
+	values, err := s.EvalUptoCtx(ctx, s.joinExprs(bvs), n)
+	for _, v := range values {
+		res = append(res, splitValue(bvs, v))
+	}
+	return res, err
+}
+
+/*
+ *  A SolutionIterator enumerates lazily the distinct tuples of values of a
+ *  list of expressions that satisfy the constraints of a solver. It works on
+ *  a clone of the backend of the solver, so it sees the constraints at the
+ *  time of Solutions and it does not hold the solver between the calls. Every
+ *  call to Next adds to the clone a single clause that excludes the tuple it
+ *  returns, so the queries stay incremental. Close releases the clone.
+ */
+type SolutionIterator struct {
+	s       *Solver
+	backend solverBackend
+	bvs     []*BVExprPtr
+	joint   *BVExprPtr
+	done    bool
+	err     error
+}
+
+func (s *Solver) Solutions(bvs []*BVExprPtr) *SolutionIterator {
+	defer s.lockQuery()()
+
+	it := &SolutionIterator{s: s, bvs: bvs, done: len(bvs) == 0}
+	if !it.done {
+		it.joint = s.joinExprs(bvs)
+		it.backend = s.backend.clone()
+		// the clauses that exclude the tuples are in their own scope
+		it.backend.push()
+	}
+	return it
+}
+
+func (it *SolutionIterator) Next() ([]*BVConst, bool) {
+	return it.NextCtx(context.Background())
+}
+
+// NextCtx returns the next tuple, or false when there are no more tuples or
+// the query fails (see Err)
+func (it *SolutionIterator) NextCtx(ctx context.Context) ([]*BVConst, bool) {
+	if it.done {
+		return nil, false
+	}
+	s := it.s
+	s.lock.RLock()
+	ctx, cancel := s.queryContext(ctx)
+	s.lock.RUnlock()
+	defer cancel()
+
+	r, err := it.backend.evalUpto(ctx, it.joint, s.eb.BoolVal(true), 1)
+	if len(r) == 0 {
+		it.Close()
+		it.err = err
+		return nil, false
+	}
+
+	eq, err := s.eb.Eq(it.joint, s.eb.getOrCreateBV(mkinternalBVVFromConst(*r[0])))
+	if err != nil {
+		panic(err)
+	}
+	neq, err := s.eb.BoolNot(eq)
+	if err != nil {
+		panic(err)
+	}
+	it.backend.add(neq)
+	return splitValue(it.bvs, r[0]), true
+}
+
+// Close ends the enumeration and releases the clone of the backend
+func (it *SolutionIterator) Close() {
+	it.done = true
+	it.backend = nil
+}
+
+// Err returns the error that stopped the enumeration, if any
+func (it *SolutionIterator) Err() error {
+	return it.err
+}
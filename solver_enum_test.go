@@ -0,0 +1,90 @@
+package gosmt_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestSolverEvalUptoList(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 8)
+		b := eb.BVS("b", 16)
+		e, _ := eb.Ult(a, eb.BVV(3, 8))
+		s.Add(e)
+		e, _ = eb.Ult(b, eb.BVV(4, 16))
+		s.Add(e)
+		e, _ = eb.UGt(b, eb.BVV(1, 16))
+		s.Add(e)
+
+		if len(s.EvalUptoList(nil, 10)) != 0 {
+			t.Error("no expressions")
+			return
+		}
+		tuples := s.EvalUptoList([]*gosmt.BVExprPtr{a, b, a}, 10)
+		if len(tuples) != 6 {
+			t.Errorf("wrong number of tuples %d", len(tuples))
+			return
+		}
+		seen := make(map[string]bool)
+		for _, tuple := range tuples {
+			if len(tuple) != 3 || tuple[0].Size != 8 || tuple[1].Size != 16 || tuple[0].AsULong() != tuple[2].AsULong() {
+				t.Errorf("wrong tuple %v", tuple)
+				return
+			}
+			if tuple[0].AsULong() >= 3 || tuple[1].AsULong() < 2 || tuple[1].AsULong() >= 4 {
+				t.Errorf("wrong tuple %v", tuple)
+				return
+			}
+			seen[fmt.Sprint(tuple)] = true
+		}
+		if len(seen) != 6 {
+			t.Error("duplicated tuples")
+			return
+		}
+		if len(s.EvalUptoList([]*gosmt.BVExprPtr{a, b}, 4)) != 4 {
+			t.Error("wrong number of tuples")
+			return
+		}
+
+		it := s.Solutions([]*gosmt.BVExprPtr{a, b})
+		seen = make(map[string]bool)
+		for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+			seen[fmt.Sprint(tuple)] = true
+			if len(seen) == 2 {
+				// the iterator does not see the constraints added during the
+				// enumeration, and it does not block the solver
+				e, _ = eb.Eq(b, eb.BVV(2, 16))
+				s.Add(e)
+				if len(s.EvalUptoList([]*gosmt.BVExprPtr{a, b}, 10)) != 3 {
+					t.Error("wrong number of tuples")
+					return
+				}
+			}
+		}
+		if isErr(t, it.Err()) {
+			return
+		}
+		if len(seen) != 6 {
+			t.Errorf("wrong number of tuples %d", len(seen))
+			return
+		}
+		if _, ok := it.Next(); ok {
+			t.Error("the enumeration is over")
+			return
+		}
+
+		it = s.Solutions([]*gosmt.BVExprPtr{a, b})
+		if _, ok := it.Next(); !ok {
+			t.Error("should have a tuple")
+			return
+		}
+		it.Close()
+		if _, ok := it.Next(); ok || it.Err() != nil {
+			t.Error("the iterator is closed")
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gosmt
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+func (s *Solver) Min(bv *BVExprPtr, signed bool) (*BVConst, error) {
+	return s.MinCtx(context.Background(), bv, signed)
+}
+
+func (s *Solver) Max(bv *BVExprPtr, signed bool) (*BVConst, error) {
+	return s.MaxCtx(context.Background(), bv, signed)
+}
+
+// Interval returns a strided interval containing the values of bv under the
+// constraints, nil if the interval analysis finds them unsatisfiable
+func (s *Solver) Interval(bv *BVExprPtr) *Interval {
+	// the dependent constraints depend on the results of the queries
+	defer s.lockQuery()()
+	return s.interval(bv)
+}
+
+func (s *Solver) interval(bv *BVExprPtr) *Interval {
+	ia := newIntervalAnalysis(s.getDependentConstraints(bv))
+	if ia.infeasible {
+		return nil
+	}
+	return ia.bv(bv)
+}
+
+func (s *Solver) MinCtx(ctx context.Context, bv *BVExprPtr, signed bool) (*BVConst, error) {
+	return s.optimize(ctx, bv, signed, false)
+}
+
+func (s *Solver) MaxCtx(ctx context.Context, bv *BVExprPtr, signed bool) (*BVConst, error) {
+	return s.optimize(ctx, bv, signed, true)
+}
+
+/*
+ *  The search is done over keys, i.e., the values with the sign bit flipped
+ *  when signed, so that the order of the keys is always the unsigned one
+ */
+func optKey(v *BVConst, signed bool) *big.Int {
+	key := new(big.Int).Set(v.value)
+	if signed {
+		key.SetBit(key, int(v.Size-1), key.Bit(int(v.Size-1))^1)
+	}
+	return key
+}
+
+func optValue(key *big.Int, size uint, signed bool) *BVConst {
+	v := new(big.Int).Set(key)
+	if signed {
+		v.SetBit(v, int(size-1), v.Bit(int(size-1))^1)
+	}
+	return MakeBVConstFromBigint(v, size)
+}
+
+func (s *Solver) optimize(ctx context.Context, bv *BVExprPtr, signed bool, maximize bool) (*BVConst, error) {
+	defer s.lockQuery()()
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	best, err := s.evalCtx(ctx, bv)
+	if err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return nil, fmt.Errorf("unsat state")
+	}
+
+	// the value is within the interval of bv
+	iv := s.interval(bv)
+	if iv == nil {
+		return nil, fmt.Errorf("unsat state")
+	}
+	if signed {
+		iv = iv.signedKeys()
+	}
+	lo := new(big.Int).Set(iv.Low)
+	hi := new(big.Int).Set(iv.High)
+	if maximize {
+		lo = optKey(best, signed)
+	} else {
+		hi = optKey(best, signed)
+	}
+
+	for lo.Cmp(hi) < 0 {
+		mid := new(big.Int).Add(lo, hi)
+		if maximize {
+			mid.Add(mid, one)
+		}
+		mid.Rsh(mid, 1)
+
+		bound := s.eb.getOrCreateBV(mkinternalBVVFromConst(*optValue(mid, bv.Size(), signed)))
+		var query *BoolExprPtr
+		switch {
+		case maximize && signed:
+			query, err = s.eb.SGe(bv, bound)
+		case maximize:
+			query, err = s.eb.UGe(bv, bound)
+		case signed:
+			query, err = s.eb.SLe(bv, bound)
+		default:
+			query, err = s.eb.Ule(bv, bound)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := s.backend.check(ctx, query)
+		switch r {
+		case RESULT_SAT:
+			// the model may be better than the bound
+			s.model = s.backend.model()
+			key := mid
+			if v := s.eb.eval(bv, s.model); v.getInternal().kind() == TY_CONST {
+				key = optKey(&v.getInternal().(*internalBVV).Value, signed)
+			}
+			if maximize {
+				lo = key
+			} else {
+				hi = key
+			}
+		case RESULT_UNSAT:
+			if maximize {
+				hi = mid.Sub(mid, one)
+			} else {
+				lo = mid.Add(mid, one)
+			}
+		default:
+			return nil, err
+		}
+	}
+	return optValue(lo, bv.Size(), signed), nil
+}
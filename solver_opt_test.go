@@ -0,0 +1,61 @@
+package gosmt_test
+
+import (
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func TestSolverMinMax(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 32)
+		e, _ := eb.Ule(a, eb.BVV(42, 32))
+		s.Add(e)
+		e, _ = eb.UGe(a, eb.BVV(21, 32))
+		s.Add(e)
+
+		min, err := s.Min(a, false)
+		if isErr(t, err) {
+			return
+		}
+		max, err := s.Max(a, false)
+		if isErr(t, err) {
+			return
+		}
+		if min.AsULong() != 21 || max.AsULong() != 42 {
+			t.Error("wrong unsigned bounds")
+			return
+		}
+
+		b := eb.BVS("b", 8)
+		e, _ = eb.SLe(b, eb.BVV(5, 8))
+		s.Add(e)
+		e, _ = eb.SGe(b, eb.BVV(-7, 8))
+		s.Add(e)
+
+		min, err = s.Min(b, true)
+		if isErr(t, err) {
+			return
+		}
+		max, err = s.Max(b, true)
+		if isErr(t, err) {
+			return
+		}
+		if min.AsLong() != -7 || max.AsLong() != 5 {
+			t.Error("wrong signed bounds")
+			return
+		}
+		if max, _ = s.Max(b, false); max.AsULong() != 0xff {
+			t.Error("wrong unsigned bound")
+			return
+		}
+
+		e, _ = eb.Ult(a, eb.BVV(10, 32))
+		s.Add(e)
+		if _, err := s.Min(a, false); err == nil {
+			t.Error("should be unsat")
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package gosmt_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+// solveRange checks, on a solver of its own, that x is in [lo, lo+9]
+func solveRange(eb *gosmt.ExprBuilder, s *gosmt.Solver, name string, lo int64) error {
+	x := eb.BVS(name, 32)
+	e, _ := eb.UGe(x, eb.BVV(lo, 32))
+	s.Add(e)
+	e, _ = eb.Ult(x, eb.BVV(lo+10, 32))
+	s.Add(e)
+
+	y, _ := eb.Mul(x, x)
+	q, _ := eb.Eq(y, eb.BVV((lo+3)*(lo+3), 32))
+	if s.CheckSat(q) != gosmt.RESULT_SAT {
+		return fmt.Errorf("%s: should be sat", name)
+	}
+	if v := s.Eval(x); v == nil || v.AsLong() < lo || v.AsLong() >= lo+10 {
+		return fmt.Errorf("%s: wrong value", name)
+	}
+	if n := len(s.EvalUpto(x, 20)); n != 10 {
+		return fmt.Errorf("%s: %d values", name, n)
+	}
+	return nil
+}
+
+func TestParallelSolvers(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	pool := gosmt.NewZ3ContextPool(2)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 24)
+	for i := 0; i < 24; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var s *gosmt.Solver
+			switch i % 3 {
+			case 0:
+				s = gosmt.NewZ3Solver(eb)
+			case 1:
+				s = gosmt.NewZ3SolverWithPool(eb, pool)
+			default:
+				s = gosmt.NewBitblastSolver(eb)
+			}
+			// the symbols are shared by half of the solvers
+			errs <- solveRange(eb, s, fmt.Sprintf("x%d", i%12), int64(i%12)*100)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if isErr(t, err) {
+			return
+		}
+	}
+}
+
+func TestSharedSolver(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		a := eb.BVS("a", 16)
+		b := eb.BVS("b", 16)
+		e, _ := eb.Ule(a, eb.BVV(42, 16))
+		s.Add(e)
+		e, _ = eb.UGe(a, eb.BVV(21, 16))
+		s.Add(e)
+		e, _ = eb.Eq(b, eb.Neg(a))
+		s.Add(e)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 32)
+		for i := 0; i < 8; i++ {
+			wg.Add(4)
+			go func(i int) {
+				defer wg.Done()
+				q, _ := eb.Eq(a, eb.BVV(int64(20+i*3), 16))
+				expected := gosmt.RESULT_SAT
+				if i == 0 || 20+i*3 > 42 {
+					expected = gosmt.RESULT_UNSAT
+				}
+				if s.CheckSat(q) != expected {
+					errs <- fmt.Errorf("wrong result for a == %d", 20+i*3)
+				}
+			}(i)
+			go func() {
+				defer wg.Done()
+				v := s.Eval(b)
+				if v == nil || -v.AsLong()&0xffff < 21 || -v.AsLong()&0xffff > 42 {
+					errs <- fmt.Errorf("wrong value")
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if n := len(s.EvalUpto(b, 100)); n != 22 {
+					errs <- fmt.Errorf("%d values", n)
+				}
+				if iv := s.Interval(a); iv.String() != "[0x15, 0x2a]" {
+					errs <- fmt.Errorf("wrong interval %s", iv.String())
+				}
+			}()
+			// the clones can be changed while the solver is queried
+			go func(i int) {
+				defer wg.Done()
+				c := s.Clone()
+				c.Push()
+				e, _ := eb.Ult(a, eb.BVV(int64(21+i), 16))
+				c.Add(e)
+				if n := len(c.EvalUpto(a, 100)); n != i {
+					errs <- fmt.Errorf("%d values in the clone", n)
+				}
+				c.Pop(1)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if isErr(t, err) {
+				return
+			}
+		}
+	}
+}
+
+func TestSharedSolverWriters(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+	a := eb.BVS("a", 16)
+	e, _ := eb.Ult(a, eb.BVV(100, 16))
+	s.Add(e)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			// a < 100 is never removed
+			q, _ := eb.Eq(a, eb.BVV(int64(200+i), 16))
+			if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+				errs <- fmt.Errorf("should be unsat")
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			b := eb.BVS(fmt.Sprintf("b%d", i), 16)
+			q, _ := eb.UGt(b, a)
+			if s.CheckSatAndAddIfSat(q) != gosmt.RESULT_SAT {
+				errs <- fmt.Errorf("should be sat")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if isErr(t, err) {
+			return
+		}
+	}
+	if r, _ := s.Satisfiable(); r != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+}
@@ -0,0 +1,187 @@
+package gosmt
+
+import (
+	"sort"
+)
+
+const (
+	partitionNewSym = iota
+	partitionUnion
+	partitionConstraint
+)
+
+// A partitionChange is recorded in the trail of a partition to undo it
+type partitionChange struct {
+	kind int
+	// the new symbol, the root attached to another one, or the root of the
+	// set that got a new constraint
+	id uintptr
+	// for a union, the new root, whether its rank increased and the previous
+	// number of its constraints
+	root   uintptr
+	rankUp bool
+	size   int
+}
+
+/*
+ *  A partition divides the inputs of the constraints (see dependencyKeys) in
+ *  independent sets: two inputs are in the same set if they are connected by
+ *  a chain of constraints that share inputs. Every set keeps the constraints
+ *  on its inputs. It is a union-find without path compression, so that the changes
+ *  recorded in the trail can be undone when a scope is popped. A partition is
+ *  never changed while it is shared, see Solver.writablePartition
+ */
+type partition struct {
+	parent      map[uintptr]uintptr
+	rank        map[uintptr]int
+	constraints map[uintptr][]*BoolExprPtr
+	trail       []partitionChange
+}
+
+func newPartition() *partition {
+	return &partition{
+		parent:      make(map[uintptr]uintptr),
+		rank:        make(map[uintptr]int),
+		constraints: make(map[uintptr][]*BoolExprPtr),
+		trail:       make([]partitionChange, 0),
+	}
+}
+
+// copy returns a deep copy of the partition. It takes time linear in the
+// number of inputs, constraints and changes in the trail, and it is paid by a
+// solver and by each of its clones at the first change after Clone (e.g., a
+// single Add), so a clone that adds a few constraints to a large solver costs
+// as much as copying all its constraints
+func (p *partition) copy() *partition {
+	res := &partition{
+		parent:      make(map[uintptr]uintptr, len(p.parent)),
+		rank:        make(map[uintptr]int, len(p.rank)),
+		constraints: make(map[uintptr][]*BoolExprPtr, len(p.constraints)),
+		trail:       append([]partitionChange{}, p.trail...),
+	}
+	for k, v := range p.parent {
+		res.parent[k] = v
+	}
+	for k, v := range p.rank {
+		res.rank[k] = v
+	}
+	// the copies must not append to the same arrays
+	for k, v := range p.constraints {
+		res.constraints[k] = v[:len(v):len(v)]
+	}
+	return res
+}
+
+func (p *partition) find(id uintptr) uintptr {
+	for p.parent[id] != id {
+		id = p.parent[id]
+	}
+	return id
+}
+
+func (p *partition) union(a, b uintptr, record bool) uintptr {
+	if a == b {
+		return a
+	}
+	if p.rank[a] < p.rank[b] {
+		a, b = b, a
+	}
+	change := partitionChange{kind: partitionUnion, id: b, root: a, size: len(p.constraints[a])}
+	p.parent[b] = a
+	if p.rank[a] == p.rank[b] {
+		p.rank[a] += 1
+		change.rankUp = true
+	}
+	if len(p.constraints[b]) > 0 {
+		p.constraints[a] = append(p.constraints[a], p.constraints[b]...)
+	}
+	if record {
+		p.trail = append(p.trail, change)
+	}
+	return a
+}
+
+// add adds a constraint on the inputs keys, recording the changes in the trail
+// if record is true. The inputs are kept alive by the constraints, so their
+// keys cannot be reused while they are in the partition. A constraint without
+// inputs does not belong to any set
+func (p *partition) add(keys []uintptr, constraint *BoolExprPtr, record bool) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, key := range keys {
+		if _, ok := p.parent[key]; ok {
+			continue
+		}
+		p.parent[key] = key
+		if record {
+			p.trail = append(p.trail, partitionChange{kind: partitionNewSym, id: key})
+		}
+	}
+
+	root := p.find(keys[0])
+	for _, key := range keys[1:] {
+		root = p.union(root, p.find(key), record)
+	}
+	p.constraints[root] = append(p.constraints[root], constraint)
+	if record {
+		p.trail = append(p.trail, partitionChange{kind: partitionConstraint, id: root})
+	}
+}
+
+// undo reverts the changes recorded after the trail had length mark
+func (p *partition) undo(mark int) {
+	for len(p.trail) > mark {
+		change := p.trail[len(p.trail)-1]
+		p.trail = p.trail[:len(p.trail)-1]
+
+		// the capacities are cut too, the arrays can be shared with a copy
+		switch change.kind {
+		case partitionNewSym:
+			delete(p.parent, change.id)
+			delete(p.rank, change.id)
+			delete(p.constraints, change.id)
+		case partitionUnion:
+			p.parent[change.id] = change.id
+			if change.rankUp {
+				p.rank[change.root] -= 1
+			}
+			p.constraints[change.root] = p.constraints[change.root][:change.size:change.size]
+		case partitionConstraint:
+			list := p.constraints[change.id]
+			p.constraints[change.id] = list[: len(list)-1 : len(list)-1]
+		}
+	}
+}
+
+// dependent returns the constraints in the sets of the inputs keys
+func (p *partition) dependent(keys []uintptr) []*BoolExprPtr {
+	res := make([]*BoolExprPtr, 0)
+	roots := make(map[uintptr]bool)
+	for _, key := range keys {
+		if _, ok := p.parent[key]; !ok {
+			continue
+		}
+		root := p.find(key)
+		if roots[root] {
+			continue
+		}
+		roots[root] = true
+		res = append(res, p.constraints[root]...)
+	}
+	return res
+}
+
+// sets returns the constraints of every set, sorted by id
+func (p *partition) sets() [][]*BoolExprPtr {
+	res := make([][]*BoolExprPtr, 0)
+	for id, parent := range p.parent {
+		if id != parent || len(p.constraints[id]) == 0 {
+			continue
+		}
+		set := append([]*BoolExprPtr{}, p.constraints[id]...)
+		sort.Slice(set, func(i, j int) bool { return set[i].Id() < set[j].Id() })
+		res = append(res, set)
+	}
+	return res
+}
@@ -0,0 +1,180 @@
+package gosmt_test
+
+import (
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func setSizes(s *gosmt.Solver) []int {
+	sizes := make([]int, 0)
+	for _, set := range s.IndependentSets() {
+		sizes = append(sizes, len(set))
+	}
+	return sizes
+}
+
+func TestSolverTransitiveDependencies(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewBitblastSolver(eb)
+	x := eb.BVS("x", 8)
+	y := eb.BVS("y", 8)
+	z := eb.BVS("z", 8)
+	w := eb.BVS("w", 8)
+
+	e, _ := eb.Eq(x, y)
+	s.Add(e)
+	e, _ = eb.Eq(y, z)
+	s.Add(e)
+	e, _ = eb.Eq(z, w)
+	s.Add(e)
+	q, _ := eb.Eq(x, eb.BVV(200, 8))
+	if s.CheckSat(q) != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	// the model of the previous query must not be reused, w is related to x
+	e, _ = eb.Ult(w, eb.BVV(10, 8))
+	s.Add(e)
+	if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+}
+
+func TestSolverIndependentSets(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewBitblastSolver(eb)
+	x := eb.BVS("x", 8)
+	y := eb.BVS("y", 8)
+	z := eb.BVS("z", 8)
+	w := eb.BVS("w", 8)
+	v := eb.BVS("v", 8)
+
+	e, _ := eb.Ult(v, eb.BVV(3, 8))
+	s.Add(e)
+	e, _ = eb.Eq(x, y)
+	s.Add(e)
+	e, _ = eb.Eq(z, w)
+	s.Add(e)
+	if sizes := setSizes(s); len(sizes) != 3 {
+		t.Errorf("wrong sets %v", sizes)
+		return
+	}
+
+	s.Push()
+	// y and z connect the sets of x and w
+	e, _ = eb.Eq(y, z)
+	s.Add(e)
+	e, _ = eb.Ult(w, eb.BVV(10, 8))
+	s.Add(e)
+	sets := s.IndependentSets()
+	if len(sets) != 2 || len(sets[0])+len(sets[1]) != 5 || (len(sets[0]) != 4 && len(sets[1]) != 4) {
+		t.Errorf("wrong sets %v", setSizes(s))
+		return
+	}
+
+	clone := s.Clone()
+	e, _ = eb.Eq(v, x)
+	clone.Add(e)
+	if len(clone.IndependentSets()) != 1 || len(s.IndependentSets()) != 2 {
+		t.Error("the clone changed the solver")
+		return
+	}
+
+	if isErr(t, s.Pop(1)) {
+		return
+	}
+	if sizes := setSizes(s); len(sizes) != 3 {
+		t.Errorf("wrong sets %v", sizes)
+		return
+	}
+	if len(clone.IndependentSets()) != 1 {
+		t.Error("the solver changed the clone")
+		return
+	}
+	if isErr(t, clone.Pop(1)) {
+		return
+	}
+	if sizes := setSizes(clone); len(sizes) != 3 {
+		t.Errorf("wrong sets %v", sizes)
+		return
+	}
+}
+
+func TestSolverUnsatIndependentSet(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	x := eb.BVS("x", 8)
+	f, _ := eb.DeclareFun("f", []uint{8}, 8)
+	m := eb.ArrayS("m", 8, 8)
+
+	// pairs of contradictory constraints without bit-vector symbols
+	fa, _ := eb.Apply(f, eb.BVV(1, 8))
+	sel, _ := eb.Select(m, eb.BVV(0, 8))
+	pairs := [][2]*gosmt.BVExprPtr{{fa, eb.BVV(2, 8)}, {fa, eb.BVV(3, 8)}, {sel, eb.BVV(1, 8)}, {sel, eb.BVV(2, 8)}}
+	for _, s := range []*gosmt.Solver{gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb)} {
+		q, _ := eb.Eq(x, eb.BVV(0, 8))
+		for i := 0; i < len(pairs); i += 2 {
+			if s.CheckSat(q) != gosmt.RESULT_SAT {
+				t.Error("should be sat")
+				return
+			}
+
+			// the query does not depend on them, but the constraints are
+			// unsatisfiable
+			s.Push()
+			e, _ := eb.Eq(pairs[i][0], pairs[i][1])
+			s.Add(e)
+			e, _ = eb.Eq(pairs[i+1][0], pairs[i+1][1])
+			s.Add(e)
+			if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+				t.Error("should be unsat")
+				return
+			}
+			if isErr(t, s.Pop(1)) {
+				return
+			}
+		}
+	}
+}
+
+func TestSolverPopClone(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	x := eb.BVS("x", 8)
+	a := gosmt.NewBitblastSolver(eb)
+
+	e, _ := eb.UGe(x, eb.BVV(3, 8))
+	a.Add(e)
+	e, _ = eb.Ule(x, eb.BVV(200, 8))
+	a.Add(e)
+	a.Push()
+	lt50, _ := eb.Ult(x, eb.BVV(50, 8))
+	a.Add(lt50)
+	b := a.Clone()
+
+	// the solver must not overwrite the constraints of the clone after a pop
+	if isErr(t, a.Pop(1)) {
+		return
+	}
+	e, _ = eb.UGt(x, eb.BVV(5, 8))
+	a.Add(e)
+	sets := b.IndependentSets()
+	if len(sets) != 1 || len(sets[0]) != 3 {
+		t.Errorf("wrong sets %v", setSizes(b))
+		return
+	}
+	found := false
+	for _, c := range sets[0] {
+		found = found || c.Id() == lt50.Id()
+	}
+	if !found {
+		t.Error("the clone lost x < 50")
+		return
+	}
+
+	q, _ := eb.Eq(x, eb.BVV(60, 8))
+	if a.CheckSat(q) != gosmt.RESULT_SAT || b.CheckSat(q) != gosmt.RESULT_UNSAT {
+		t.Error("wrong result")
+		return
+	}
+}
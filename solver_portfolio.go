@@ -0,0 +1,272 @@
+package gosmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type PortfolioStats struct {
+	Backends []string
+	Queries  uint
+	// queries that no backend answered
+	Unknown uint
+	// queries answered first by each backend
+	Wins []uint
+}
+
+type portfolioStats struct {
+	lock  sync.Mutex
+	stats PortfolioStats
+}
+
+func (ps *portfolioStats) record(winner int) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.stats.Queries += 1
+	if winner < 0 {
+		ps.stats.Unknown += 1
+	} else {
+		ps.stats.Wins[winner] += 1
+	}
+}
+
+func (ps *portfolioStats) get() PortfolioStats {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	stats := ps.stats
+	stats.Backends = append([]string{}, ps.stats.Backends...)
+	stats.Wins = append([]uint{}, ps.stats.Wins...)
+	return stats
+}
+
+/*
+ *  The portfolio backend runs all its backends concurrently on every query and
+ *  takes the first definitive answer, the other backends are cancelled. All
+ *  the backends receive the same constraints, so every query can be won by a
+ *  different one. The statistics are shared with the clones
+ */
+type portfolioBackend struct {
+	backends []solverBackend
+	stats    *portfolioStats
+	// the backend that answered the last query, or -1
+	winner int
+}
+
+func newPortfolioBackend(backends []solverBackend, stats *portfolioStats) *portfolioBackend {
+	if stats == nil {
+		stats = &portfolioStats{stats: PortfolioStats{Wins: make([]uint, len(backends))}}
+		for _, b := range backends {
+			stats.stats.Backends = append(stats.stats.Backends, backendName(b))
+		}
+	}
+	return &portfolioBackend{backends: backends, stats: stats, winner: -1}
+}
+
+func backendName(b solverBackend) string {
+	switch b := b.(type) {
+	case *z3backend:
+		return "z3"
+	case *bitblastBackend:
+		return "bitblast"
+	case *portfolioBackend:
+		return "portfolio"
+	case *smtlib2Backend:
+		return b.name()
+	case *recordBackend:
+		return "record(" + backendName(b.inner) + ")"
+	case *replayBackend:
+		return "replay"
+	}
+	return fmt.Sprintf("%T", b)
+}
+
+// NewPortfolioSolver returns a solver that races the backends of solvers on
+// every query. Only the kind of the backends is taken from solvers, not their
+// constraints
+func NewPortfolioSolver(eb *ExprBuilder, solvers ...*Solver) (*Solver, error) {
+	if len(solvers) == 0 {
+		return nil, fmt.Errorf("no solvers")
+	}
+	backends := make([]solverBackend, 0, len(solvers))
+	for _, s := range solvers {
+		if s.eb != eb {
+			return nil, fmt.Errorf("the solvers use a different ExprBuilder")
+		}
+		s.lock.RLock()
+		backends = append(backends, s.backend.fresh())
+		s.lock.RUnlock()
+	}
+	return newSolver(eb, newPortfolioBackend(backends, nil)), nil
+}
+
+// PortfolioStats returns the statistics of a solver created with
+// NewPortfolioSolver
+func (s *Solver) PortfolioStats() (PortfolioStats, error) {
+	defer s.lockQuery()()
+
+	p, ok := s.backend.(*portfolioBackend)
+	if !ok {
+		return PortfolioStats{}, fmt.Errorf("not a portfolio solver")
+	}
+	return p.stats.get(), nil
+}
+
+func (s *Solver) PrintPortfolioStats() {
+	stats, err := s.PortfolioStats()
+	if err != nil {
+		return
+	}
+
+	fmt.Println("=====================")
+	fmt.Println("  Portfolio Stats")
+	fmt.Println("=====================")
+	fmt.Printf("queries:      %d\n", stats.Queries)
+	fmt.Printf("unknown:      %d\n", stats.Unknown)
+	for i, name := range stats.Backends {
+		fmt.Printf("%-13s %d\n", name+":", stats.Wins[i])
+	}
+	fmt.Println("=====================")
+}
+
+func (p *portfolioBackend) fresh() solverBackend {
+	backends := make([]solverBackend, len(p.backends))
+	for i, b := range p.backends {
+		backends[i] = b.fresh()
+	}
+	return newPortfolioBackend(backends, p.stats)
+}
+
+func (p *portfolioBackend) clone() solverBackend {
+	backends := make([]solverBackend, len(p.backends))
+	for i, b := range p.backends {
+		backends[i] = b.clone()
+	}
+	return newPortfolioBackend(backends, p.stats)
+}
+
+func (p *portfolioBackend) push() {
+	for _, b := range p.backends {
+		b.push()
+	}
+}
+
+func (p *portfolioBackend) pop(n int) {
+	for _, b := range p.backends {
+		b.pop(n)
+	}
+}
+
+func (p *portfolioBackend) add(constraint *BoolExprPtr) {
+	for _, b := range p.backends {
+		b.add(constraint)
+	}
+}
+
+/*
+ *  race runs query on every backend and returns the index of the first one
+ *  that answers (i.e., query returns true), or -1. The other backends are
+ *  cancelled, and race waits for them since a backend cannot be used by two
+ *  goroutines
+ */
+func (p *portfolioBackend) race(ctx context.Context, query func(ctx context.Context, i int) bool) int {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	answers := make(chan int, len(p.backends))
+	for i := range p.backends {
+		go func(i int) {
+			if query(ctx, i) {
+				answers <- i
+			} else {
+				answers <- -1
+			}
+		}(i)
+	}
+
+	p.winner = -1
+	for range p.backends {
+		if i := <-answers; i >= 0 && p.winner < 0 {
+			p.winner = i
+			cancel()
+		}
+	}
+	p.stats.record(p.winner)
+	return p.winner
+}
+
+func portfolioError(ctx context.Context, errs []error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+func (p *portfolioBackend) check(ctx context.Context, query *BoolExprPtr) (int, error) {
+	results := make([]int, len(p.backends))
+	errs := make([]error, len(p.backends))
+	winner := p.race(ctx, func(ctx context.Context, i int) bool {
+		results[i], errs[i] = p.backends[i].check(ctx, query)
+		return results[i] == RESULT_SAT || results[i] == RESULT_UNSAT
+	})
+	if winner < 0 {
+		return RESULT_UNKNOWN, portfolioError(ctx, errs)
+	}
+	return results[winner], nil
+}
+
+func (p *portfolioBackend) checkAssuming(ctx context.Context, assumptions []*BoolExprPtr) (int, []int, error) {
+	results := make([]int, len(p.backends))
+	failed := make([][]int, len(p.backends))
+	errs := make([]error, len(p.backends))
+	winner := p.race(ctx, func(ctx context.Context, i int) bool {
+		results[i], failed[i], errs[i] = p.backends[i].checkAssuming(ctx, assumptions)
+		return results[i] == RESULT_SAT || results[i] == RESULT_UNSAT
+	})
+	if winner < 0 {
+		return RESULT_UNKNOWN, nil, portfolioError(ctx, errs)
+	}
+	return results[winner], failed[winner], nil
+}
+
+func (p *portfolioBackend) model() map[string]*BVConst {
+	if p.winner < 0 {
+		return nil
+	}
+	return p.backends[p.winner].model()
+}
+
+func (p *portfolioBackend) funModel() map[string]*FunInterp {
+	if p.winner < 0 {
+		return nil
+	}
+	return p.backends[p.winner].funModel()
+}
+
+// If no backend completes the enumeration, the longest partial one is
+// returned
+func (p *portfolioBackend) evalUpto(ctx context.Context, bv *BVExprPtr, query *BoolExprPtr, n int) ([]*BVConst, error) {
+	values := make([][]*BVConst, len(p.backends))
+	errs := make([]error, len(p.backends))
+	winner := p.race(ctx, func(ctx context.Context, i int) bool {
+		values[i], errs[i] = p.backends[i].evalUpto(ctx, bv, query, n)
+		return errs[i] == nil
+	})
+	if winner >= 0 {
+		return values[winner], nil
+	}
+
+	longest := 0
+	for i := range values {
+		if len(values[i]) > len(values[longest]) {
+			longest = i
+		}
+	}
+	if len(values[longest]) > 0 {
+		p.winner = longest
+	}
+	return values[longest], portfolioError(ctx, errs)
+}
@@ -0,0 +1,232 @@
+package gosmt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+func newTestPortfolio(t *testing.T, eb *gosmt.ExprBuilder) *gosmt.Solver {
+	s, err := gosmt.NewPortfolioSolver(eb, gosmt.NewZ3Solver(eb), gosmt.NewBitblastSolver(eb))
+	if isErr(t, err) {
+		return nil
+	}
+	return s
+}
+
+func TestPortfolioSolver(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	if _, err := gosmt.NewPortfolioSolver(eb); err == nil {
+		t.Error("no solvers")
+		return
+	}
+	if _, err := gosmt.NewPortfolioSolver(eb, gosmt.NewZ3Solver(gosmt.NewExprBuilder())); err == nil {
+		t.Error("different ExprBuilder")
+		return
+	}
+	if _, err := gosmt.NewZ3Solver(eb).PortfolioStats(); err == nil {
+		t.Error("not a portfolio solver")
+		return
+	}
+
+	s := newTestPortfolio(t, eb)
+	if s == nil {
+		return
+	}
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	e, _ := eb.Ule(a, eb.BVV(42, 32))
+	s.Add(e)
+	e, _ = eb.UGe(a, eb.BVV(21, 32))
+	s.Add(e)
+	x, _ := eb.Mul(a, a)
+	e, _ = eb.Eq(b, x)
+	s.Add(e)
+
+	q, _ := eb.Eq(b, eb.BVV(900, 32))
+	if s.CheckSat(q) != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	s.Push()
+	s.Add(q)
+	if v := s.Eval(a); v == nil || v.AsULong() != 30 {
+		t.Error("wrong model")
+		return
+	}
+	s.Pop(1)
+	q, _ = eb.Eq(b, eb.BVV(901, 32))
+	if s.CheckSat(q) != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+	if len(s.EvalUpto(b, 100)) != 42-21+1 {
+		t.Error("wrong number of values")
+		return
+	}
+	if v, err := s.Max(b, false); err != nil || v.AsULong() != 42*42 {
+		t.Error("wrong max")
+		return
+	}
+
+	c := s.Clone()
+	c.Push()
+	e, _ = eb.Eq(a, eb.BVV(50, 32))
+	c.Add(e)
+	if r, _ := c.Satisfiable(); r != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+	c.Pop(1)
+	if r, _ := c.Satisfiable(); r != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+
+	// the clone records its queries in the same statistics
+	stats, err := s.PortfolioStats()
+	if isErr(t, err) {
+		return
+	}
+	if len(stats.Backends) != 2 || stats.Backends[0] != "z3" || stats.Backends[1] != "bitblast" {
+		t.Errorf("wrong backends %v", stats.Backends)
+		return
+	}
+	if stats.Queries == 0 || stats.Unknown != 0 || stats.Wins[0]+stats.Wins[1] != stats.Queries {
+		t.Errorf("wrong stats %v", stats)
+		return
+	}
+	cstats, _ := c.PortfolioStats()
+	if cstats.Queries != stats.Queries {
+		t.Error("the stats should be shared")
+		return
+	}
+}
+
+func TestPortfolioUnsupported(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := newTestPortfolio(t, eb)
+	if s == nil {
+		return
+	}
+
+	// floating point is not supported by the bitblaster, z3 answers anyway
+	x := eb.FPS("x", gosmt.Float32Sort)
+	c, _ := eb.FPGt(x, eb.FPV(1, gosmt.Float32Sort))
+	s.Add(c)
+	c, _ = eb.FPLt(x, eb.FPV(1, gosmt.Float32Sort))
+	if s.CheckSat(c) != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+	if s.Eval(eb.BVS("x", 32)) == nil {
+		t.Error("should be sat")
+		return
+	}
+	stats, _ := s.PortfolioStats()
+	if stats.Wins[1] != 0 || stats.Wins[0] != stats.Queries {
+		t.Errorf("wrong stats %v", stats)
+		return
+	}
+
+	core, err := s.UnsatCore()
+	if isErr(t, err) {
+		return
+	}
+	if len(core) != 1 {
+		t.Error("wrong core")
+		return
+	}
+}
+
+func TestPortfolioTimeout(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := newTestPortfolio(t, eb)
+	if s == nil {
+		return
+	}
+
+	a, _ := eb.ZExt(eb.BVS("a", 64), 64)
+	b, _ := eb.ZExt(eb.BVS("b", 64), 64)
+	n, _ := eb.Concat(eb.BVV(-142, 64), eb.BVV(4897, 64))
+	prod, _ := eb.Mul(a, b)
+	e, _ := eb.Eq(prod, n)
+	s.Add(e)
+	e, _ = eb.UGt(a, eb.BVV(1, 128))
+	s.Add(e)
+	e, _ = eb.UGt(b, eb.BVV(1, 128))
+	s.Add(e)
+
+	s.SetTimeout(200 * time.Millisecond)
+	start := time.Now()
+	r, err := s.Satisfiable()
+	if r != gosmt.RESULT_UNKNOWN || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("should time out")
+		return
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the query was not interrupted")
+		return
+	}
+	if stats, _ := s.PortfolioStats(); stats.Unknown != 1 {
+		t.Errorf("wrong stats %v", stats)
+		return
+	}
+
+	s.SetTimeout(0)
+	e, _ = eb.Eq(eb.BVS("a", 64), eb.BVV(1, 64))
+	if s.CheckSat(e) != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+}
+
+func TestPortfolioZ3Options(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	if _, err := gosmt.NewZ3SolverWithOptions(eb, nil, gosmt.Z3Options{Tactic: "no-such-tactic"}); err == nil {
+		t.Error("unknown tactic")
+		return
+	}
+	z1, err := gosmt.NewZ3SolverWithOptions(eb, nil, gosmt.Z3Options{Seed: 1})
+	if isErr(t, err) {
+		return
+	}
+	z2, err := gosmt.NewZ3SolverWithOptions(eb, gosmt.NewZ3ContextPool(1), gosmt.Z3Options{Seed: 2, Tactic: "qfbv"})
+	if isErr(t, err) {
+		return
+	}
+	s, err := gosmt.NewPortfolioSolver(eb, z1, z2)
+	if isErr(t, err) {
+		return
+	}
+
+	a := eb.BVS("a", 32)
+	x, _ := eb.Mul(a, a)
+	for _, solver := range []*gosmt.Solver{s, z2} {
+		e, _ := eb.Eq(x, eb.BVV(900, 32))
+		solver.Add(e)
+		e, _ = eb.Ult(a, eb.BVV(100, 32))
+		solver.Add(e)
+		solver.Push()
+		e, _ = eb.Eq(a, eb.BVV(31, 32))
+		solver.Add(e)
+		if r, _ := solver.Satisfiable(); r != gosmt.RESULT_UNSAT {
+			t.Error("should be unsat")
+			return
+		}
+		solver.Pop(1)
+	}
+	if v := s.Clone().Eval(a); v == nil || v.AsULong() != 30 {
+		t.Error("wrong model")
+		return
+	}
+
+	stats, _ := s.PortfolioStats()
+	if len(stats.Backends) != 2 || stats.Backends[0] != "z3(seed=1)" || stats.Backends[1] != "z3(seed=2,tactic=qfbv)" {
+		t.Errorf("wrong backends %v", stats.Backends)
+		return
+	}
+}
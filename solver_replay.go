@@ -0,0 +1,480 @@
+package gosmt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ *  The recording backend logs every operation on the wrapped backend, with the
+ *  answers of the queries, as one s-expression per line:
+ *
+ *    (<op> <backend> <arguments>... <answers>...)
+ *
+ *  The backends (the first one, and its clones and fresh copies) are numbered
+ *  in order of creation. Expressions are logged as structural hashes, that do
+ *  not depend on the ids of the expressions and thus on the process. The
+ *  replay backend serves the logged answers and panics if the operations
+ *  diverge from the log
+ */
+
+var replayResults = map[int]string{
+	RESULT_ERROR:   "error",
+	RESULT_SAT:     "sat",
+	RESULT_UNSAT:   "unsat",
+	RESULT_UNKNOWN: "unknown",
+}
+
+// structuralHash hashes the structure of e: the children of commutative
+// operators, that are sorted by id, are hashed in any order
+func structuralHash(e internalExpr, memo map[uintptr]uint64) uint64 {
+	if h, ok := memo[e.rawPtr()]; ok {
+		return h
+	}
+
+	// the node without its children
+	p := newSmtlib2Printer()
+	children := e.subexprs()
+	hashes := make([]uint64, len(children))
+	for i, child := range children {
+		hashes[i] = structuralHash(child, memo)
+		p.names[child.rawPtr()] = "_"
+	}
+	switch e.kind() {
+	case TY_ADD, TY_MUL, TY_AND, TY_OR, TY_XOR, TY_BOOL_AND, TY_BOOL_OR:
+		sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	}
+
+	h := fnv.New64a()
+	io.WriteString(h, p.term(e))
+	for _, child := range hashes {
+		binary.Write(h, binary.LittleEndian, child)
+	}
+	memo[e.rawPtr()] = h.Sum64()
+	return h.Sum64()
+}
+
+func replayHash(e ExprPtr) string {
+	return fmt.Sprintf("#x%016x", structuralHash(e.getInternal(), make(map[uintptr]uint64)))
+}
+
+// replayHashes identifies the assumptions by their structural hash, as their
+// ids change between runs
+func replayHashes(assumptions []*BoolExprPtr) []string {
+	hashes := make([]string, len(assumptions))
+	for i, a := range assumptions {
+		hashes[i] = replayHash(a)
+	}
+	return hashes
+}
+
+func replayString(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "\"\"") + "\""
+}
+
+func replayErrorString(err error) string {
+	if err == nil {
+		return "none"
+	}
+	return replayString(err.Error())
+}
+
+func replayValues(values []*BVConst) string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = smtlib2Const(v)
+	}
+	return "(" + strings.Join(res, " ") + ")"
+}
+
+type queryLog struct {
+	lock sync.Mutex
+	w    io.Writer
+	// the first write error
+	err  error
+	next int
+}
+
+func (l *queryLog) newId() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.next += 1
+	return l.next - 1
+}
+
+func (l *queryLog) write(op string, id int, args ...string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.err == nil {
+		entry := append([]string{op, strconv.Itoa(id)}, args...)
+		_, l.err = io.WriteString(l.w, "("+strings.Join(entry, " ")+")\n")
+	}
+	return l.err
+}
+
+type recordBackend struct {
+	inner solverBackend
+	log   *queryLog
+	id    int
+}
+
+// NewRecordingSolver returns a solver with a new backend of the same kind of
+// the one of s, that logs to w every operation and the answers of the queries.
+// The log can be replayed with NewReplaySolver
+func NewRecordingSolver(s *Solver, w io.Writer) *Solver {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	log := &queryLog{w: w}
+	return newSolver(s.eb, &recordBackend{inner: s.backend.fresh(), log: log, id: log.newId()})
+}
+
+func (r *recordBackend) fresh() solverBackend {
+	fresh := &recordBackend{inner: r.inner.fresh(), log: r.log, id: r.log.newId()}
+	r.log.write("fresh", r.id, strconv.Itoa(fresh.id))
+	return fresh
+}
+
+func (r *recordBackend) clone() solverBackend {
+	clone := &recordBackend{inner: r.inner.clone(), log: r.log, id: r.log.newId()}
+	r.log.write("clone", r.id, strconv.Itoa(clone.id))
+	return clone
+}
+
+func (r *recordBackend) push() {
+	r.inner.push()
+	r.log.write("push", r.id)
+}
+
+func (r *recordBackend) pop(n int) {
+	r.inner.pop(n)
+	r.log.write("pop", r.id, strconv.Itoa(n))
+}
+
+func (r *recordBackend) add(constraint *BoolExprPtr) {
+	r.inner.add(constraint)
+	r.log.write("add", r.id, replayHash(constraint))
+}
+
+// The errors of the log are returned by the queries
+func (r *recordBackend) check(ctx context.Context, query *BoolExprPtr) (int, error) {
+	res, err := r.inner.check(ctx, query)
+	if werr := r.log.write("check", r.id, replayHash(query), replayResults[res], replayErrorString(err)); werr != nil {
+		return RESULT_UNKNOWN, werr
+	}
+	return res, err
+}
+
+func (r *recordBackend) checkAssuming(ctx context.Context, assumptions []*BoolExprPtr) (int, []int, error) {
+	res, failed, err := r.inner.checkAssuming(ctx, assumptions)
+	hashes := replayHashes(assumptions)
+	failedHashes := make([]string, len(failed))
+	for i, idx := range failed {
+		failedHashes[i] = hashes[idx]
+	}
+	sort.Strings(failedHashes)
+	sort.Strings(hashes)
+	werr := r.log.write("check-assuming", r.id, "("+strings.Join(hashes, " ")+")", replayResults[res],
+		"("+strings.Join(failedHashes, " ")+")", replayErrorString(err))
+	if werr != nil {
+		return RESULT_UNKNOWN, nil, werr
+	}
+	return res, failed, err
+}
+
+func (r *recordBackend) model() map[string]*BVConst {
+	model := r.inner.model()
+	if model == nil {
+		r.log.write("model", r.id, "none")
+		return nil
+	}
+	names := make([]string, 0, len(model))
+	for name := range model {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]string, len(names))
+	for i, name := range names {
+		entries[i] = fmt.Sprintf("(%s %s)", smtlib2Symbol(name), smtlib2Const(model[name]))
+	}
+	r.log.write("model", r.id, "("+strings.Join(entries, " ")+")")
+	return model
+}
+
+func (r *recordBackend) funModel() map[string]*FunInterp {
+	interps := r.inner.funModel()
+	if interps == nil {
+		r.log.write("fun-model", r.id, "none")
+		return nil
+	}
+	names := make([]string, 0, len(interps))
+	for name := range interps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	funs := make([]string, len(names))
+	for i, name := range names {
+		entries := make([]string, len(interps[name].Entries))
+		for j, entry := range interps[name].Entries {
+			entries[j] = fmt.Sprintf("(%s %s)", replayValues(entry.Args), smtlib2Const(entry.Value))
+		}
+		funs[i] = fmt.Sprintf("(%s (%s) %s)", smtlib2Symbol(name), strings.Join(entries, " "), smtlib2Const(interps[name].Default))
+	}
+	r.log.write("fun-model", r.id, "("+strings.Join(funs, " ")+")")
+	return interps
+}
+
+func (r *recordBackend) evalUpto(ctx context.Context, bv *BVExprPtr, query *BoolExprPtr, n int) ([]*BVConst, error) {
+	values, err := r.inner.evalUpto(ctx, bv, query, n)
+	werr := r.log.write("eval-upto", r.id, replayHash(bv), replayHash(query), strconv.Itoa(n),
+		replayValues(values), replayErrorString(err))
+	if werr != nil {
+		return nil, werr
+	}
+	return values, err
+}
+
+type replayLog struct {
+	lock    sync.Mutex
+	parser  *smtlib2Parser
+	entries map[int][]*smtlib2Sexpr
+	next    int
+}
+
+func (l *replayLog) newId() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.next += 1
+	return l.next - 1
+}
+
+type replayBackend struct {
+	log *replayLog
+	id  int
+}
+
+// NewReplaySolver returns a solver that answers the queries with the ones
+// logged by a recording solver. The solver panics if the operations diverge
+// from the log
+func NewReplaySolver(eb *ExprBuilder, r io.Reader) (*Solver, error) {
+	log := &replayLog{parser: newSmtlib2Parser(eb), entries: make(map[int][]*smtlib2Sexpr)}
+	rd := newSmtlib2Reader(r)
+	for {
+		entry, err := rd.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !entry.isList || len(entry.list) < 2 {
+			return nil, fmt.Errorf("invalid entry %s", entry)
+		}
+		id, err := log.parser.numeral(entry.list[1])
+		if err != nil {
+			return nil, err
+		}
+		log.entries[int(id)] = append(log.entries[int(id)], entry)
+	}
+	return newSolver(eb, &replayBackend{log: log, id: log.newId()}), nil
+}
+
+func (r *replayBackend) diverge(format string, args ...interface{}) {
+	panic(fmt.Sprintf("replay divergence on backend %d: %s", r.id, fmt.Sprintf(format, args...)))
+}
+
+// next returns the answers of the next entry, that must be the operation op
+// with arguments args
+func (r *replayBackend) next(op string, args ...string) []*smtlib2Sexpr {
+	r.log.lock.Lock()
+	defer r.log.lock.Unlock()
+
+	actual := fmt.Sprintf("(%s)", strings.Join(append([]string{op, strconv.Itoa(r.id)}, args...), " "))
+	entries := r.log.entries[r.id]
+	if len(entries) == 0 {
+		r.diverge("%s is not in the log", actual)
+	}
+	entry := entries[0]
+	r.log.entries[r.id] = entries[1:]
+	if !entry.list[0].isAtom(op) || len(entry.list) < len(args)+2 {
+		r.diverge("expected %s, got %s", entry, actual)
+	}
+	for i, arg := range args {
+		if entry.list[i+2].String() != arg {
+			r.diverge("expected %s, got %s", entry, actual)
+		}
+	}
+	return entry.list[len(args)+2:]
+}
+
+func (r *replayBackend) answers(entry []*smtlib2Sexpr, n int) []*smtlib2Sexpr {
+	if len(entry) != n {
+		r.diverge("invalid entry %v", entry)
+	}
+	return entry
+}
+
+func (r *replayBackend) result(s *smtlib2Sexpr) int {
+	for res, name := range replayResults {
+		if s.isAtom(name) {
+			return res
+		}
+	}
+	r.diverge("invalid result %s", s)
+	return RESULT_ERROR
+}
+
+func (r *replayBackend) error(s *smtlib2Sexpr) error {
+	if s.isAtom("none") {
+		return nil
+	}
+	if s.isList || !strings.HasPrefix(s.atom, "\"") {
+		r.diverge("invalid error %s", s)
+	}
+	msg := s.atom[1 : len(s.atom)-1]
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded} {
+		if msg == err.Error() {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+func (r *replayBackend) value(s *smtlib2Sexpr) *BVConst {
+	r.log.lock.Lock()
+	defer r.log.lock.Unlock()
+
+	v, err := r.log.parser.value(s)
+	if err != nil {
+		r.diverge(err.Error())
+	}
+	return v
+}
+
+func (r *replayBackend) values(s *smtlib2Sexpr) []*BVConst {
+	if !s.isList {
+		r.diverge("invalid values %s", s)
+	}
+	values := make([]*BVConst, len(s.list))
+	for i, el := range s.list {
+		values[i] = r.value(el)
+	}
+	return values
+}
+
+func (r *replayBackend) fresh() solverBackend {
+	fresh := &replayBackend{log: r.log, id: r.log.newId()}
+	r.next("fresh", strconv.Itoa(fresh.id))
+	return fresh
+}
+
+func (r *replayBackend) clone() solverBackend {
+	clone := &replayBackend{log: r.log, id: r.log.newId()}
+	r.next("clone", strconv.Itoa(clone.id))
+	return clone
+}
+
+func (r *replayBackend) push() {
+	r.next("push")
+}
+
+func (r *replayBackend) pop(n int) {
+	r.next("pop", strconv.Itoa(n))
+}
+
+func (r *replayBackend) add(constraint *BoolExprPtr) {
+	r.next("add", replayHash(constraint))
+}
+
+func (r *replayBackend) check(ctx context.Context, query *BoolExprPtr) (int, error) {
+	answers := r.answers(r.next("check", replayHash(query)), 2)
+	return r.result(answers[0]), r.error(answers[1])
+}
+
+func (r *replayBackend) checkAssuming(ctx context.Context, assumptions []*BoolExprPtr) (int, []int, error) {
+	hashes := replayHashes(assumptions)
+	index := make(map[string]int)
+	for i, h := range hashes {
+		index[h] = i
+	}
+	sort.Strings(hashes)
+
+	answers := r.answers(r.next("check-assuming", "("+strings.Join(hashes, " ")+")"), 3)
+	res, err := r.result(answers[0]), r.error(answers[2])
+	if res != RESULT_UNSAT {
+		return res, nil, err
+	}
+	if !answers[1].isList {
+		r.diverge("invalid failed assumptions %s", answers[1])
+	}
+	failed := make([]int, 0, len(answers[1].list))
+	for _, h := range answers[1].list {
+		i, ok := index[h.String()]
+		if !ok {
+			r.diverge("invalid failed assumption %s", h)
+		}
+		failed = append(failed, i)
+	}
+	sort.Ints(failed)
+	return res, failed, err
+}
+
+func (r *replayBackend) model() map[string]*BVConst {
+	answer := r.answers(r.next("model"), 1)[0]
+	if answer.isAtom("none") {
+		return nil
+	}
+	if !answer.isList {
+		r.diverge("invalid model %s", answer)
+	}
+	model := make(map[string]*BVConst)
+	for _, el := range answer.list {
+		if !el.isList || len(el.list) != 2 || el.list[0].isList {
+			r.diverge("invalid model %s", answer)
+		}
+		model[el.list[0].atom] = r.value(el.list[1])
+	}
+	return model
+}
+
+func (r *replayBackend) funModel() map[string]*FunInterp {
+	answer := r.answers(r.next("fun-model"), 1)[0]
+	if answer.isAtom("none") {
+		return nil
+	}
+	if !answer.isList {
+		r.diverge("invalid function model %s", answer)
+	}
+	interps := make(map[string]*FunInterp)
+	for _, fun := range answer.list {
+		if !fun.isList || len(fun.list) != 3 || fun.list[0].isList || !fun.list[1].isList {
+			r.diverge("invalid function model %s", answer)
+		}
+		interp := &FunInterp{Entries: make([]FunEntry, 0)}
+		for _, entry := range fun.list[1].list {
+			if !entry.isList || len(entry.list) != 2 {
+				r.diverge("invalid function model %s", answer)
+			}
+			interp.Entries = append(interp.Entries, FunEntry{Args: r.values(entry.list[0]), Value: r.value(entry.list[1])})
+		}
+		interp.Default = r.value(fun.list[2])
+		interps[fun.list[0].atom] = interp
+	}
+	return interps
+}
+
+func (r *replayBackend) evalUpto(ctx context.Context, bv *BVExprPtr, query *BoolExprPtr, n int) ([]*BVConst, error) {
+	answers := r.answers(r.next("eval-upto", replayHash(bv), replayHash(query), strconv.Itoa(n)), 2)
+	return r.values(answers[0]), r.error(answers[1])
+}
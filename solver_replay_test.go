@@ -0,0 +1,90 @@
+package gosmt_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/borzacchiello/gosmt"
+)
+
+// replayScenario runs some queries on s and returns their answers
+func replayScenario(eb *gosmt.ExprBuilder, s *gosmt.Solver, last int64) []string {
+	res := make([]string, 0)
+	a := eb.BVS("a", 16)
+	b := eb.BVS("b", 16)
+	c := eb.BVS("c", 16)
+	f, _ := eb.DeclareFun("f", []uint{16}, 16)
+
+	e, _ := eb.Ult(a, eb.BVV(10, 16))
+	s.AddNamed("a < 10", e)
+	x, _ := eb.Mul(a, a)
+	y, _ := eb.Add(x, c)
+	e, _ = eb.Eq(b, y)
+	s.AddNamed("b == a * a + c", e)
+	e, _ = eb.Ult(c, eb.BVV(3, 16))
+	s.AddNamed("c < 3", e)
+
+	q, _ := eb.Eq(b, eb.BVV(50, 16))
+	res = append(res, fmt.Sprint(s.CheckSat(q)))
+	res = append(res, s.Eval(a).String(), s.Eval(c).String())
+	q, _ = eb.Eq(b, eb.BVV(90, 16))
+	res = append(res, fmt.Sprint(s.CheckSat(q)))
+	core, err := s.UnsatCore()
+	res = append(res, fmt.Sprint(coreNames(s, core), err))
+
+	s.Push()
+	app, _ := eb.Apply(f, a)
+	e, _ = eb.Eq(app, b)
+	s.Add(e)
+	for _, v := range s.EvalUpto(b, 5) {
+		res = append(res, v.String())
+	}
+	res = append(res, fmt.Sprint(s.FunModel()["f"]))
+	s.Pop(1)
+
+	clone := s.Clone()
+	e, _ = eb.Eq(b, eb.BVV(last, 16))
+	clone.Add(e)
+	if v, err := clone.Max(a, false); err == nil {
+		res = append(res, v.String())
+	}
+	return res
+}
+
+func TestRecordReplay(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	log := bytes.Buffer{}
+	s := gosmt.NewRecordingSolver(gosmt.NewBitblastSolver(eb), &log)
+	recorded := replayScenario(eb, s, 81)
+
+	// the log does not depend on the ids of the expressions
+	eb = gosmt.NewExprBuilder()
+	eb.BVS("c", 16)
+	r, err := gosmt.NewReplaySolver(eb, strings.NewReader(log.String()))
+	if isErr(t, err) {
+		return
+	}
+	replayed := replayScenario(eb, r, 81)
+	if strings.Join(recorded, ",") != strings.Join(replayed, ",") {
+		t.Errorf("different answers %v and %v", recorded, replayed)
+		return
+	}
+
+	// a different query panics
+	r, _ = gosmt.NewReplaySolver(eb, strings.NewReader(log.String()))
+	func() {
+		defer func() {
+			if p := recover(); p == nil || !strings.Contains(fmt.Sprint(p), "replay divergence") {
+				t.Errorf("should diverge, %v", p)
+			}
+		}()
+		replayScenario(eb, r, 82)
+	}()
+
+	if _, err := gosmt.NewReplaySolver(eb, strings.NewReader("(check 0")); err == nil {
+		t.Error("invalid log")
+		return
+	}
+}
@@ -1,7 +1,10 @@
 package gosmt_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/borzacchiello/gosmt"
 )
@@ -63,3 +66,108 @@ func TestSolverEval2(t *testing.T) {
 		return
 	}
 }
+
+func TestSolverPushPop(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+
+	a := eb.BVS("a", 32)
+	b := eb.BVS("b", 32)
+	e, _ := eb.Ule(a, eb.BVV(42, 32))
+	s.Add(e)
+
+	s.Push()
+	e, _ = eb.UGe(a, eb.BVV(50, 32))
+	s.Add(e)
+	e, _ = eb.Eq(a, b)
+	s.Add(e)
+	if r, _ := s.Satisfiable(); r != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+
+	clone := s.Clone()
+	if err := s.Pop(1); err != nil {
+		t.Error(err)
+		return
+	}
+	if r, _ := s.Satisfiable(); r != gosmt.RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	if vals := s.EvalUpto(a, 128); len(vals) != 43 {
+		t.Error("unable to find all values")
+		return
+	}
+	e, _ = eb.Eq(b, eb.BVV(100, 32))
+	if s.CheckSat(e) != gosmt.RESULT_SAT {
+		t.Error("b should be unconstrained")
+		return
+	}
+	if s.Pop(1) == nil {
+		t.Error("no scopes left")
+		return
+	}
+
+	if r, _ := clone.Satisfiable(); r != gosmt.RESULT_UNSAT {
+		t.Error("clone should be unsat")
+		return
+	}
+	clone.Pop(1)
+	if clone.CheckSat(e) != gosmt.RESULT_SAT {
+		t.Error("clone should be sat")
+		return
+	}
+}
+
+func TestSolverTimeout(t *testing.T) {
+	eb := gosmt.NewExprBuilder()
+	s := gosmt.NewZ3Solver(eb)
+
+	// factor the product of two 64 bit primes
+	a, _ := eb.ZExt(eb.BVS("a", 64), 64)
+	b, _ := eb.ZExt(eb.BVS("b", 64), 64)
+	n, _ := eb.Concat(eb.BVV(-142, 64), eb.BVV(4897, 64))
+	prod, _ := eb.Mul(a, b)
+	e, _ := eb.Eq(prod, n)
+	s.Add(e)
+	e, _ = eb.UGt(a, eb.BVV(1, 128))
+	s.Add(e)
+	e, _ = eb.UGt(b, eb.BVV(1, 128))
+	s.Add(e)
+
+	s.SetTimeout(200 * time.Millisecond)
+	start := time.Now()
+	r, err := s.Satisfiable()
+	if r != gosmt.RESULT_UNKNOWN || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("should time out")
+		return
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the query was not interrupted")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e, _ = eb.Ult(a, b)
+	if r, err := s.CheckSatCtx(ctx, e); r != gosmt.RESULT_UNKNOWN || !errors.Is(err, context.Canceled) {
+		t.Error("should be cancelled")
+		return
+	}
+	if _, err := s.EvalUptoCtx(ctx, prod, 2); err == nil {
+		t.Error("should be cancelled")
+		return
+	}
+
+	// the solver is still usable after an interrupted query
+	s.SetTimeout(0)
+	c := s.Clone()
+	c.Push()
+	e, _ = eb.Eq(a, eb.BVV(2, 128))
+	c.Add(e)
+	if r, _ := c.Satisfiable(); r != gosmt.RESULT_UNSAT {
+		t.Error("should be unsat")
+		return
+	}
+}
@@ -1,75 +1,442 @@
 package gosmt
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/aclements/go-z3/z3"
 )
 
+// Translations are kept across queries as long as the translated roots are
+// pinned (so that their addresses cannot be reused by the ExprBuilder)
+const z3MaxCachedTranslations = 1 << 16
+
 /*
- *  Note: we are using a global Z3 context, which is thread-safe and locks a lot
- *        *but* it uses possibly less memory. We should test whether using multiple
- *        contexts is better
+ *  A Z3 context can be used by a single goroutine at a time, the backends
+ *  that share one hold its lock for the whole duration of their operations.
+ *  Interrupting the context stops whatever check is running on it, so the
+ *  interrupt is only sent if the check that registered it is still the
+ *  running one. An interrupt sent while the check is returning is not
+ *  consumed by it, and it would cancel the next operation on the context
+ *  (e.g., a push), so it is cleared with a check on an empty solver
  */
-var cfg *z3.Config = z3.NewContextConfig()
-var ctx *z3.Context = z3.NewContext(cfg)
+type z3context struct {
+	ctx  *z3.Context
+	lock sync.Mutex
+
+	interruptLock sync.Mutex
+	runningCheck  uint64
+	interrupted   bool
+}
+
+func newZ3Context() *z3context {
+	return &z3context{ctx: z3.NewContext(z3.NewContextConfig())}
+}
+
+/*
+ *  Z3ContextPool hands out the Z3 contexts to the backends of the solvers
+ *  (including their clones). With a positive size, the backends share that
+ *  many contexts in a round-robin fashion, and the ones sharing a context are
+ *  serialized on it. With size zero every backend owns a new context, so that
+ *  solvers never block each other
+ */
+type Z3ContextPool struct {
+	lock     sync.Mutex
+	size     int
+	contexts []*z3context
+	next     int
+}
+
+func NewZ3ContextPool(size int) *Z3ContextPool {
+	return &Z3ContextPool{size: size, contexts: make([]*z3context, 0, size)}
+}
+
+func (p *Z3ContextPool) get() *z3context {
+	if p.size <= 0 {
+		return newZ3Context()
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.contexts) < p.size {
+		p.contexts = append(p.contexts, newZ3Context())
+	}
+	c := p.contexts[p.next%len(p.contexts)]
+	p.next += 1
+	return c
+}
+
+// the context lock must be held
+func (c *z3context) check(qctx context.Context, solver *z3.Solver) (bool, error) {
+	return c.run(qctx, solver.Check)
+}
+
+// run runs check, interrupting it when qctx is done
+func (c *z3context) run(qctx context.Context, check func() (bool, error)) (bool, error) {
+	if err := qctx.Err(); err != nil {
+		return false, err
+	}
+
+	c.interruptLock.Lock()
+	c.runningCheck += 1
+	token := c.runningCheck
+	c.interruptLock.Unlock()
+
+	stop := context.AfterFunc(qctx, func() {
+		c.interruptLock.Lock()
+		defer c.interruptLock.Unlock()
+		if c.runningCheck == token {
+			c.ctx.Interrupt()
+			c.interrupted = true
+		}
+	})
+	r, err := check()
+	stop()
+
+	c.interruptLock.Lock()
+	c.runningCheck += 1
+	interrupted := c.interrupted
+	c.interrupted = false
+	c.interruptLock.Unlock()
+	if interrupted {
+		z3.NewSolver(c.ctx).Check()
+	}
+
+	if err != nil && qctx.Err() != nil {
+		return false, qctx.Err()
+	}
+	return r, err
+}
+
+/*
+ *  The bindings take the rounding mode of the floating-point operations from
+ *  the context, so it is set (and restored) around every operation
+ */
+var z3roundingModes = map[RoundingMode]z3.RoundingMode{
+	RM_RNE: z3.RoundToNearestEven,
+	RM_RNA: z3.RoundToNearestAway,
+	RM_RTP: z3.RoundToPositive,
+	RM_RTN: z3.RoundToNegative,
+	RM_RTZ: z3.RoundToZero,
+}
+
+func (c *z3context) withRoundingMode(rm RoundingMode, op func() z3.Value) z3.Value {
+	old := c.ctx.SetRoundingMode(z3roundingModes[rm])
+	defer c.ctx.SetRoundingMode(old)
+	return op()
+}
+
+func (c *z3context) floatSort(sort FPSort) z3.Sort {
+	return c.ctx.FloatSort(int(sort.EBits), int(sort.SBits))
+}
 
 type z3backend struct {
+	pool   *Z3ContextPool
+	zctx   *z3context
 	solver *z3.Solver
+	synced bool
+
+	assertions []*BoolExprPtr
+	scopes     []int
+
+	cache   map[uintptr]z3.Value
+	pinned  []ExprPtr
+	symbols map[uintptr]z3.BV
+	apps    map[uintptr]z3Apply
 
 	lastSatModel *z3.Model
-	lastSymbols  map[uintptr]z3.BV
+	lastSymbols  []z3.BV
+	lastApps     []z3Apply
 }
 
-func newZ3Backend() *z3backend {
+// The applications of uninterpreted functions are kept to build the function
+// interpretations, which are not exposed by the Z3 bindings
+type z3Apply struct {
+	fun   *FunDecl
+	args  []z3.BV
+	value z3.BV
+}
+
+func newZ3Backend(pool *Z3ContextPool) *z3backend {
+	// the bindings create the solver and take its reference in two steps,
+	// so no other operation can run on the context in between
+	zctx := pool.get()
+	zctx.lock.Lock()
+	solver := z3.NewSolver(zctx.ctx)
+	zctx.lock.Unlock()
+
 	return &z3backend{
-		solver:       z3.NewSolver(ctx),
+		pool:         pool,
+		zctx:         zctx,
+		solver:       solver,
+		synced:       true,
+		assertions:   make([]*BoolExprPtr, 0),
+		scopes:       make([]int, 0),
+		cache:        make(map[uintptr]z3.Value),
+		pinned:       make([]ExprPtr, 0),
+		symbols:      make(map[uintptr]z3.BV),
+		apps:         make(map[uintptr]z3Apply),
 		lastSatModel: nil,
 	}
 }
 
+func (s *z3backend) fresh() solverBackend {
+	return newZ3Backend(s.pool)
+}
+
 func (s *z3backend) clone() solverBackend {
-	return newZ3Backend()
+	// The assertions are replayed lazily, on the first query
+	clone := newZ3Backend(s.pool)
+	clone.synced = false
+	clone.assertions = append(clone.assertions, s.assertions...)
+	clone.scopes = append(clone.scopes, s.scopes...)
+	return clone
+}
+
+func (s *z3backend) translate(e ExprPtr) z3.Value {
+	// only the expressions that add a translation are pinned, the others are
+	// already kept alive by the expressions that reference them
+	if _, ok := s.cache[e.getInternal().rawPtr()]; !ok {
+		s.pinned = append(s.pinned, e)
+	}
+	return s.convert(e.getInternal(), s.cache, s.symbols)
+}
+
+// trimCache drops the translations when there are too many of them. It is
+// called before a query, when the symbols and the applications of the
+// previous queries are no longer needed by model and funModel: only the ones
+// in the assertions are kept, the others are released with the expressions
+// that are pinned by the cache (so their keys can be reused)
+func (s *z3backend) trimCache() {
+	if len(s.cache) <= z3MaxCachedTranslations {
+		return
+	}
+	s.cache = make(map[uintptr]z3.Value)
+	s.pinned = make([]ExprPtr, 0)
+
+	visited := s.reachable()
+	for k := range s.symbols {
+		if !visited[k] {
+			delete(s.symbols, k)
+		}
+	}
+	for k := range s.apps {
+		if !visited[k] {
+			delete(s.apps, k)
+		}
+	}
+}
+
+// reachable returns the subexpressions of the assertions and of exprs
+func (s *z3backend) reachable(exprs ...ExprPtr) map[uintptr]bool {
+	queue := make([]internalExpr, 0, len(s.assertions)+len(exprs))
+	for _, a := range s.assertions {
+		queue = append(queue, a.e)
+	}
+	for _, e := range exprs {
+		queue = append(queue, e.getInternal())
+	}
+	visited := make(map[uintptr]bool)
+	for len(queue) > 0 {
+		el := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if visited[el.rawPtr()] {
+			continue
+		}
+		visited[el.rawPtr()] = true
+		queue = append(queue, el.subexprs()...)
+	}
+	return visited
+}
+
+// setLastModel sets the model of the last query, model and funModel report
+// only the symbols and the applications of the assertions and of exprs (the
+// cache keeps also the ones of the previous queries and of the popped scopes)
+func (s *z3backend) setLastModel(m *z3.Model, exprs ...ExprPtr) {
+	s.lastSatModel = m
+	s.lastSymbols = s.lastSymbols[:0]
+	s.lastApps = s.lastApps[:0]
+	if m == nil {
+		return
+	}
+	visited := s.reachable(exprs...)
+	for k, sym := range s.symbols {
+		if visited[k] {
+			s.lastSymbols = append(s.lastSymbols, sym)
+		}
+	}
+	for k, app := range s.apps {
+		if visited[k] {
+			s.lastApps = append(s.lastApps, app)
+		}
+	}
+}
+
+func (s *z3backend) assert(e *BoolExprPtr) {
+	for _, c := range conjuncts(e) {
+		s.solver.Assert(s.translate(c).(z3.Bool))
+	}
 }
 
-func (s *z3backend) check(query *BoolExprPtr) int {
+func (s *z3backend) sync() {
+	if s.synced {
+		return
+	}
+
 	s.solver.Reset()
-	s.lastSymbols = make(map[uintptr]z3.BV)
+	scope := 0
+	for i, a := range s.assertions {
+		for ; scope < len(s.scopes) && s.scopes[scope] == i; scope++ {
+			s.solver.Push()
+		}
+		s.assert(a)
+	}
+	for ; scope < len(s.scopes); scope++ {
+		s.solver.Push()
+	}
+	s.synced = true
+}
+
+func (s *z3backend) push() {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
+
+	s.scopes = append(s.scopes, len(s.assertions))
+	if s.synced {
+		s.solver.Push()
+	}
+}
+
+func (s *z3backend) pop(n int) {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.assertions = s.assertions[:s.scopes[len(s.scopes)-1]]
+		s.scopes = s.scopes[:len(s.scopes)-1]
+		if s.synced {
+			s.solver.Pop()
+		}
+	}
+}
+
+func (s *z3backend) add(constraint *BoolExprPtr) {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
+
+	s.assertions = append(s.assertions, constraint)
+	if s.synced {
+		s.assert(constraint)
+	}
+}
+
+func (s *z3backend) check(qctx context.Context, query *BoolExprPtr) (int, error) {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
+
+	s.trimCache()
+	s.sync()
+	s.solver.Push()
+	defer s.solver.Pop()
+
+	s.assert(query)
+	r, err := s.zctx.check(qctx, s.solver)
+	if err != nil {
+		s.setLastModel(nil)
+		return RESULT_UNKNOWN, err
+	}
+	if r {
+		s.setLastModel(s.solver.Model(), query)
+		return RESULT_SAT, nil
+	}
+	s.setLastModel(nil)
+	return RESULT_UNSAT, nil
+}
+
+/*
+ *  Every assumption is implied by a fresh guard literal, and the guards are
+ *  asserted in a nested scope to check a subset of the assumptions. The
+ *  bindings do not expose the unsat cores, so when all the assumptions are
+ *  unsatisfiable the failed ones are found by dropping, one at a time, the
+ *  assumptions that are not needed. If the minimization is interrupted, the
+ *  assumptions not yet dropped are returned
+ */
+func (s *z3backend) checkAssuming(qctx context.Context, assumptions []*BoolExprPtr) (int, []int, error) {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
+
+	s.trimCache()
+	s.sync()
+	s.solver.Push()
+	defer s.solver.Pop()
 
-	cache := make(map[uintptr]z3.Value)
-	if query.Kind() == TY_BOOL_AND {
-		andQuery := query.e.(*internalBoolExprNaryOp)
-		for i := 0; i < len(andQuery.children); i++ {
-			z3query := s.convert(andQuery.children[i].e, cache, s.lastSymbols)
-			s.solver.Assert(z3query.(z3.Bool))
+	ctx := s.zctx.ctx
+	guards := make([]z3.Bool, len(assumptions))
+	for i, a := range assumptions {
+		guards[i] = ctx.FreshConst("?a", ctx.BoolSort()).(z3.Bool)
+		s.solver.Assert(guards[i].Implies(s.translate(a).(z3.Bool)))
+	}
+	var model *z3.Model
+	checkSubset := func(subset []int) (bool, error) {
+		s.solver.Push()
+		defer s.solver.Pop()
+		for _, i := range subset {
+			s.solver.Assert(guards[i])
+		}
+		r, err := s.zctx.check(qctx, s.solver)
+		if r {
+			model = s.solver.Model()
 		}
-	} else {
-		z3query := s.convert(query.e, cache, s.lastSymbols)
-		s.solver.Assert(z3query.(z3.Bool))
+		return r, err
 	}
 
-	r, err := s.solver.Check()
+	failed := make([]int, len(assumptions))
+	for i := range failed {
+		failed[i] = i
+	}
+	r, err := checkSubset(failed)
 	if err != nil {
-		s.lastSatModel = nil
-		return RESULT_UNKNOWN
+		s.setLastModel(nil)
+		return RESULT_UNKNOWN, nil, err
 	}
 	if r {
-		s.lastSatModel = s.solver.Model()
-		return RESULT_SAT
+		exprs := make([]ExprPtr, len(assumptions))
+		for i, a := range assumptions {
+			exprs[i] = a
+		}
+		s.setLastModel(model, exprs...)
+		return RESULT_SAT, nil, nil
 	}
-	s.lastSatModel = nil
-	return RESULT_UNSAT
+	// a single assumption is already a valid subset
+	for i := 0; len(failed) > 1 && i < len(failed); {
+		candidates := append(append([]int{}, failed[:i]...), failed[i+1:]...)
+		r, err := checkSubset(candidates)
+		if err != nil {
+			break
+		}
+		if r {
+			i += 1
+		} else {
+			failed = candidates
+		}
+	}
+	s.setLastModel(nil)
+	return RESULT_UNSAT, failed, nil
 }
 
 func convertZ3Const(c z3.BV) (*BVConst, error) {
-	v := MakeBVConstFromString(c.String()[2:], 16, uint(c.Sort().BVSize()))
-	if v == nil {
+	v, ok := c.AsBigUnsigned()
+	if !ok {
 		return nil, fmt.Errorf("not a constant")
 	}
-	return v, nil
+	return MakeBVConstFromBigint(v, uint(c.Sort().BVSize())), nil
 }
 
 func (s *z3backend) model() map[string]*BVConst {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
+
 	m := s.lastSatModel
 	if m == nil {
 		return nil
@@ -87,27 +454,60 @@ func (s *z3backend) model() map[string]*BVConst {
 	return res
 }
 
-func (s *z3backend) evalUpto(bv *BVExprPtr, pi *BoolExprPtr, n int) []*BVConst {
-	s.solver.Reset()
-	s.lastSymbols = make(map[uintptr]z3.BV, 0)
-	cache := make(map[uintptr]z3.Value)
+func (s *z3backend) funModel() map[string]*FunInterp {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
 
-	values := make([]*BVConst, 0)
-	bvZ3 := s.convert(bv.e, cache, s.lastSymbols).(z3.BV)
-	if pi.Kind() == TY_BOOL_AND {
-		andQuery := pi.e.(*internalBoolExprNaryOp)
-		for i := 0; i < len(andQuery.children); i++ {
-			z3query := s.convert(andQuery.children[i].e, cache, s.lastSymbols)
-			s.solver.Assert(z3query.(z3.Bool))
+	m := s.lastSatModel
+	if m == nil {
+		return nil
+	}
+
+	interps := newFunInterpBuilder()
+	for _, app := range s.lastApps {
+		args := make([]*BVConst, len(app.args))
+		for i, a := range app.args {
+			c, err := convertZ3Const(m.Eval(a, true).(z3.BV))
+			if err != nil {
+				panic("unable to create constant [" + err.Error() + "]")
+			}
+			args[i] = c
+		}
+		value, err := convertZ3Const(m.Eval(app.value, true).(z3.BV))
+		if err != nil {
+			panic("unable to create constant [" + err.Error() + "]")
 		}
-	} else {
-		z3query := s.convert(pi.e, cache, s.lastSymbols)
-		s.solver.Assert(z3query.(z3.Bool))
+		interps.add(app.fun, args, value)
 	}
+	return interps.interps
+}
+
+func (s *z3backend) evalUpto(qctx context.Context, bv *BVExprPtr, query *BoolExprPtr, n int) ([]*BVConst, error) {
+	s.zctx.lock.Lock()
+	defer s.zctx.lock.Unlock()
 
+	s.trimCache()
+	s.sync()
+	s.solver.Push()
+	defer s.solver.Pop()
+
+	values := make([]*BVConst, 0)
+	bvZ3 := s.translate(bv).(z3.BV)
+	s.assert(query)
+
+	// the model of the last value is kept
+	var last *z3.Model
+	defer func() {
+		if last != nil {
+			s.setLastModel(last, bv, query)
+		}
+	}()
 	for {
-		r, err := s.solver.Check()
-		if err != nil || !r {
+		r, err := s.zctx.check(qctx, s.solver)
+		if err != nil {
+			return values, err
+		}
+		if !r {
 			break
 		}
 
@@ -115,7 +515,7 @@ func (s *z3backend) evalUpto(bv *BVExprPtr, pi *BoolExprPtr, n int) []*BVConst {
 		if m == nil {
 			panic("no model")
 		}
-		s.lastSatModel = m
+		last = m
 
 		v := m.Eval(bvZ3, true).(z3.BV)
 		c, err := convertZ3Const(v)
@@ -130,7 +530,7 @@ func (s *z3backend) evalUpto(bv *BVExprPtr, pi *BoolExprPtr, n int) []*BVConst {
 			break
 		}
 	}
-	return values
+	return values, nil
 }
 
 func (s *z3backend) convert(e internalExpr, cache map[uintptr]z3.Value, symbols map[uintptr]z3.BV) z3.Value {
@@ -138,6 +538,7 @@ func (s *z3backend) convert(e internalExpr, cache map[uintptr]z3.Value, symbols
 		return v
 	}
 
+	ctx := s.zctx.ctx
 	var result z3.Value
 	switch e.kind() {
 	case TY_SYM:
@@ -324,6 +725,113 @@ func (s *z3backend) convert(e internalExpr, cache map[uintptr]z3.Value, symbols
 			res = res.Or(child)
 		}
 		result = res
+	case TY_ARRAY_SYM:
+		e := e.(*internalArrayS)
+		result = ctx.Const(e.name, ctx.ArraySort(ctx.BVSort(int(e.idxSize)), ctx.BVSort(int(e.valSize))))
+	case TY_ARRAY_CONST:
+		e := e.(*internalArrayConst)
+		value := s.convert(e.value.e, cache, symbols)
+		result = ctx.ConstArray(ctx.BVSort(int(e.idxSize)), value)
+	case TY_STORE:
+		e := e.(*internalArrayStore)
+		array := s.convert(e.array.e, cache, symbols).(z3.Array)
+		index := s.convert(e.index.e, cache, symbols)
+		value := s.convert(e.value.e, cache, symbols)
+		result = array.Store(index, value)
+	case TY_SELECT:
+		e := e.(*internalBVExprSelect)
+		array := s.convert(e.array.e, cache, symbols).(z3.Array)
+		index := s.convert(e.index.e, cache, symbols)
+		result = array.Select(index)
+	case TY_APPLY:
+		e := e.(*internalBVExprApply)
+		domain := make([]z3.Sort, len(e.args))
+		args := make([]z3.Value, len(e.args))
+		argsBV := make([]z3.BV, len(e.args))
+		for i, a := range e.args {
+			domain[i] = ctx.BVSort(int(a.Size()))
+			argsBV[i] = s.convert(a.e, cache, symbols).(z3.BV)
+			args[i] = argsBV[i]
+		}
+		fun := ctx.FuncDecl(e.fun.name, domain, ctx.BVSort(int(e.fun.retSize)))
+		result = fun.Apply(args...)
+		s.apps[e.rawPtr()] = z3Apply{fun: e.fun, args: argsBV, value: result.(z3.BV)}
+	case TY_FP_CONST:
+		e := e.(*internalFPV)
+		bits := e.Value.Bits()
+		sort := e.Value.Sort
+		sign := ctx.FromBigInt(bits.Slice(sort.Size()-1, sort.Size()-1).value, ctx.BVSort(1)).(z3.BV)
+		exp := ctx.FromBigInt(bits.Slice(sort.Size()-2, sort.SBits-1).value, ctx.BVSort(int(sort.EBits))).(z3.BV)
+		sig := ctx.FromBigInt(bits.Slice(sort.SBits-2, 0).value, ctx.BVSort(int(sort.SBits-1))).(z3.BV)
+		result = ctx.FloatFromBits(sign, exp, sig)
+	case TY_FP_FROM_BITS:
+		e := e.(*internalFPExprConvert)
+		child := s.convert(e.child.getInternal(), cache, symbols).(z3.BV)
+		result = child.IEEEToFloat(s.zctx.floatSort(e.s))
+	case TY_FP_FROM_SBV:
+		e := e.(*internalFPExprConvert)
+		child := s.convert(e.child.getInternal(), cache, symbols).(z3.BV)
+		result = s.zctx.withRoundingMode(e.rm, func() z3.Value { return child.SToFloat(s.zctx.floatSort(e.s)) })
+	case TY_FP_FROM_UBV:
+		e := e.(*internalFPExprConvert)
+		child := s.convert(e.child.getInternal(), cache, symbols).(z3.BV)
+		result = s.zctx.withRoundingMode(e.rm, func() z3.Value { return child.UToFloat(s.zctx.floatSort(e.s)) })
+	case TY_FP_TO_FP:
+		e := e.(*internalFPExprConvert)
+		child := s.convert(e.child.getInternal(), cache, symbols).(z3.Float)
+		result = s.zctx.withRoundingMode(e.rm, func() z3.Value { return child.ToFloat(s.zctx.floatSort(e.s)) })
+	case TY_FP_NEG:
+		e := e.(*internalFPExprArith)
+		result = s.convert(e.children[0].e, cache, symbols).(z3.Float).Neg()
+	case TY_FP_ABS:
+		e := e.(*internalFPExprArith)
+		result = s.convert(e.children[0].e, cache, symbols).(z3.Float).Abs()
+	case TY_FP_SQRT:
+		e := e.(*internalFPExprArith)
+		child := s.convert(e.children[0].e, cache, symbols).(z3.Float)
+		result = s.zctx.withRoundingMode(e.rm, func() z3.Value { return child.Sqrt() })
+	case TY_FP_ADD, TY_FP_SUB, TY_FP_MUL, TY_FP_DIV:
+		e := e.(*internalFPExprArith)
+		lhs := s.convert(e.children[0].e, cache, symbols).(z3.Float)
+		rhs := s.convert(e.children[1].e, cache, symbols).(z3.Float)
+		result = s.zctx.withRoundingMode(e.rm, func() z3.Value {
+			switch e.ty {
+			case TY_FP_ADD:
+				return lhs.Add(rhs)
+			case TY_FP_SUB:
+				return lhs.Sub(rhs)
+			case TY_FP_MUL:
+				return lhs.Mul(rhs)
+			}
+			return lhs.Div(rhs)
+		})
+	case TY_FP_LT, TY_FP_LE, TY_FP_GT, TY_FP_GE, TY_FP_EQ:
+		e := e.(*internalBoolExprFPCmp)
+		lhs := s.convert(e.lhs.e, cache, symbols).(z3.Float)
+		rhs := s.convert(e.rhs.e, cache, symbols).(z3.Float)
+		switch e.ty {
+		case TY_FP_LT:
+			result = lhs.LT(rhs)
+		case TY_FP_LE:
+			result = lhs.LE(rhs)
+		case TY_FP_GT:
+			result = lhs.GT(rhs)
+		case TY_FP_GE:
+			result = lhs.GE(rhs)
+		case TY_FP_EQ:
+			result = lhs.IEEEEq(rhs)
+		}
+	case TY_FP_TO_BITS:
+		e := e.(*internalBVExprFromFP)
+		result = s.convert(e.child.e, cache, symbols).(z3.Float).ToIEEEBV()
+	case TY_FP_TO_UBV:
+		e := e.(*internalBVExprFromFP)
+		child := s.convert(e.child.e, cache, symbols).(z3.Float)
+		result = s.zctx.withRoundingMode(e.rm, func() z3.Value { return child.ToUBV(int(e.n)) })
+	case TY_FP_TO_SBV:
+		e := e.(*internalBVExprFromFP)
+		child := s.convert(e.child.e, cache, symbols).(z3.Float)
+		result = s.zctx.withRoundingMode(e.rm, func() z3.Value { return child.ToSBV(int(e.n)) })
 	default:
 		panic("invalid expression type")
 	}
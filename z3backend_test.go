@@ -0,0 +1,118 @@
+package gosmt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aclements/go-z3/z3"
+)
+
+func TestZ3TrimCache(t *testing.T) {
+	eb := NewExprBuilder()
+	s := newZ3Backend(NewZ3ContextPool(0))
+
+	a := eb.BVS("a", 8)
+	c, _ := eb.Ult(a, eb.BVV(10, 8))
+	s.add(c)
+
+	// the translations of the previous queries, with their symbols
+	for i := 0; len(s.cache) <= z3MaxCachedTranslations; i++ {
+		e, _ := eb.Eq(eb.BVS(fmt.Sprintf("x%d", i), 8), eb.BVV(int64(i), 8))
+		s.translate(e)
+	}
+
+	q, _ := eb.Eq(eb.BVS("y", 8), eb.BVV(1, 8))
+	if r, _ := s.check(context.Background(), q); r != RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	if len(s.cache) > 16 || len(s.symbols) != 2 {
+		t.Errorf("the cache was not trimmed (%d translations, %d symbols)", len(s.cache), len(s.symbols))
+		return
+	}
+	m := s.model()
+	if len(m) != 2 || m["a"].AsULong() >= 10 || m["y"].AsULong() != 1 {
+		t.Error("unexpected model")
+		return
+	}
+}
+
+func TestZ3ModelSymbols(t *testing.T) {
+	eb := NewExprBuilder()
+	s := newZ3Backend(NewZ3ContextPool(0))
+
+	c, _ := eb.Ult(eb.BVS("a", 8), eb.BVV(10, 8))
+	s.add(c)
+	s.push()
+	c, _ = eb.Eq(eb.BVS("b", 8), eb.BVV(2, 8))
+	s.add(c)
+	q, _ := eb.Eq(eb.BVS("y", 8), eb.BVV(1, 8))
+	if r, _ := s.check(context.Background(), q); r != RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	s.pop(1)
+
+	// the symbols of the popped scope and of the previous query are not in
+	// the model
+	q, _ = eb.Eq(eb.BVS("z", 8), eb.BVV(3, 8))
+	if r, _ := s.check(context.Background(), q); r != RESULT_SAT {
+		t.Error("should be sat")
+		return
+	}
+	m := s.model()
+	if len(m) != 2 || m["a"] == nil || m["z"] == nil || m["z"].AsULong() != 3 {
+		t.Errorf("unexpected model %v", m)
+		return
+	}
+}
+
+func TestZ3PinnedCacheHits(t *testing.T) {
+	eb := NewExprBuilder()
+	s := newZ3Backend(NewZ3ContextPool(0))
+
+	// checking the same query does not pin it again
+	q, _ := eb.Ult(eb.BVS("a", 8), eb.BVV(10, 8))
+	for i := 0; i < 100; i++ {
+		if r, _ := s.check(context.Background(), q); r != RESULT_SAT {
+			t.Error("should be sat")
+			return
+		}
+	}
+	if len(s.pinned) != 1 {
+		t.Errorf("%d pinned expressions", len(s.pinned))
+		return
+	}
+}
+
+func TestZ3LateInterrupt(t *testing.T) {
+	zctx := newZ3Context()
+	solver := z3.NewSolver(zctx.ctx)
+
+	// the query is cancelled while the check is returning
+	qctx, cancel := context.WithCancel(context.Background())
+	r, err := zctx.run(qctx, func() (bool, error) {
+		cancel()
+		for {
+			zctx.interruptLock.Lock()
+			interrupted := zctx.interrupted
+			zctx.interruptLock.Unlock()
+			if interrupted {
+				return true, nil
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+	if !r || err != nil {
+		t.Error("should be sat")
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("the interrupt was not cleared: %v", r)
+		}
+	}()
+	solver.Push()
+}
@@ -0,0 +1,150 @@
+package gosmt
+
+/*
+#cgo LDFLAGS: -lz3
+#include <z3.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Z3Options configures the solvers of a Z3 backend: Seed is the random seed
+// of the solver and Tactic the name of the tactic used to check the
+// assertions (e.g., "qfbv"). The zero value is the default solver of Z3
+type Z3Options struct {
+	Seed   uint
+	Tactic string
+}
+
+func (o Z3Options) String() string {
+	if o.Tactic == "" {
+		return fmt.Sprintf("seed=%d", o.Seed)
+	}
+	return fmt.Sprintf("seed=%d,tactic=%s", o.Seed, o.Tactic)
+}
+
+/*
+ *  A z3Conn is a Z3 context owned by the package, not by the bindings, that
+ *  evaluates SMT-LIB2 commands. The bindings do not expose the parameters of
+ *  the solvers, while the commands can set the seed and the tactic. The
+ *  commands run on a goroutine, so that close can interrupt them
+ */
+type z3Conn struct {
+	ctx      C.Z3_context
+	commands chan string
+	resp     chan smtlib2Response
+	done     chan struct{}
+	exited   chan struct{}
+}
+
+func newZ3Conn() (smtlib2Conn, error) {
+	cfg := C.Z3_mk_config()
+	ctx := C.Z3_mk_context(cfg)
+	C.Z3_del_config(cfg)
+	if ctx == nil {
+		return nil, fmt.Errorf("cannot create a Z3 context")
+	}
+	// the errors of the commands are reported in their output
+	C.Z3_set_error_handler(ctx, nil)
+
+	c := &z3Conn{
+		ctx:      ctx,
+		commands: make(chan string),
+		resp:     make(chan smtlib2Response),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+func (c *z3Conn) run() {
+	defer close(c.exited)
+	for {
+		select {
+		case command := <-c.commands:
+			ccommand := C.CString(command)
+			out := C.GoString(C.Z3_eval_smtlib2_string(c.ctx, ccommand))
+			C.free(unsafe.Pointer(ccommand))
+
+			rd := newSmtlib2Reader(strings.NewReader(out))
+			for {
+				sexpr, err := rd.read()
+				if err == io.EOF {
+					break
+				}
+				select {
+				case c.resp <- smtlib2Response{sexpr, err}:
+				case <-c.done:
+					return
+				}
+				if err != nil {
+					break
+				}
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *z3Conn) send(command string) error {
+	select {
+	case c.commands <- command:
+		return nil
+	case <-c.exited:
+		return fmt.Errorf("the Z3 context was closed")
+	}
+}
+
+func (c *z3Conn) responses() <-chan smtlib2Response {
+	return c.resp
+}
+
+func (c *z3Conn) close() {
+	close(c.done)
+	// the interrupt is not cleared, a command that starts later stops too
+	C.Z3_interrupt(c.ctx)
+	<-c.exited
+	C.Z3_del_context(c.ctx)
+}
+
+func newZ3Smtlib2Solver(options Z3Options) *smtlib2Solver {
+	checkSat := "(check-sat)"
+	if options.Tactic != "" {
+		checkSat = fmt.Sprintf("(check-sat-using %s)", smtlib2Symbol(options.Tactic))
+	}
+	return &smtlib2Solver{
+		name:     "z3(" + options.String() + ")",
+		connect:  newZ3Conn,
+		options:  []string{fmt.Sprintf("(set-option :random-seed %d)", options.Seed)},
+		checkSat: checkSat,
+	}
+}
+
+var z3Tactics struct {
+	once  sync.Once
+	names map[string]bool
+}
+
+// z3HasTactic tells whether Z3 has a tactic with the given name
+func z3HasTactic(name string) bool {
+	z3Tactics.once.Do(func() {
+		z3Tactics.names = make(map[string]bool)
+		cfg := C.Z3_mk_config()
+		ctx := C.Z3_mk_context(cfg)
+		C.Z3_del_config(cfg)
+		defer C.Z3_del_context(ctx)
+		for i := C.uint(0); i < C.Z3_get_num_tactics(ctx); i++ {
+			z3Tactics.names[C.GoString(C.Z3_get_tactic_name(ctx, i))] = true
+		}
+	})
+	return z3Tactics.names[name]
+}